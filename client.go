@@ -13,6 +13,7 @@ type Client interface {
 	v1.DocumentServiceClient
 	v1.PublishedDocumentServiceClient
 	v1.DocumentBackupServiceClient
+	v1.PublishScheduleServiceClient
 }
 
 type client struct {
@@ -20,6 +21,7 @@ type client struct {
 	v1.DocumentServiceClient
 	v1.PublishedDocumentServiceClient
 	v1.DocumentBackupServiceClient
+	v1.PublishScheduleServiceClient
 }
 
 // NewClient creates a new document service client
@@ -33,6 +35,7 @@ func NewClient(port string) (Client, error) {
 		DocumentServiceClient:          v1.NewDocumentServiceClient(conn),
 		PublishedDocumentServiceClient: v1.NewPublishedDocumentServiceClient(conn),
 		DocumentBackupServiceClient:    v1.NewDocumentBackupServiceClient(conn),
+		PublishScheduleServiceClient:   v1.NewPublishScheduleServiceClient(conn),
 	}, nil
 }
 
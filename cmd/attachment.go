@@ -0,0 +1,299 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/emrgen/document"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/metadata"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+var attachmentCmd = &cobra.Command{
+	Use:   "attachment",
+	Short: "attach binary files to documents",
+	Example: `  doc attachment upload -d <doc-id> -f <file>
+  doc attachment get -d <doc-id> -a <attachment-id> -o <file>
+  doc attachment list -d <doc-id>
+  doc attachment delete -d <doc-id> -a <attachment-id>`,
+}
+
+func init() {
+	rootCmd.AddCommand(attachmentCmd)
+	attachmentCmd.SetHelpCommand(&cobra.Command{Use: "no-help", Hidden: true})
+	attachmentCmd.AddCommand(uploadAttachmentCmd())
+	attachmentCmd.AddCommand(getAttachmentCmd())
+	attachmentCmd.AddCommand(listAttachmentsCmd())
+	attachmentCmd.AddCommand(deleteAttachmentCmd())
+}
+
+func uploadAttachmentCmd() *cobra.Command {
+	var docID string
+	var input string
+	var name string
+	var version int64
+
+	var required = []string{"doc-id", "file"}
+
+	command := &cobra.Command{
+		Use:     "upload",
+		Short:   "attach a file to a document",
+		Example: "doc attachment upload -d <doc-id> -f <file> -n <name> -v <next-version>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			file, err := os.Open(input)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer file.Close()
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			if name == "" {
+				name = filepath.Base(input)
+			}
+			pairs := []string{"document-id", docID, "attachment-name", name}
+			if version != 0 {
+				pairs = append(pairs, "document-version", strconv.FormatInt(version, 10))
+			}
+			stream, err := client.UploadAttachment(metadata.AppendToOutgoingContext(tokenContext(), pairs...))
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			// an empty content type lets the server detect it
+			contentType := mime.TypeByExtension(filepath.Ext(name))
+			buf := make([]byte, contentChunkSize)
+			for {
+				n, err := file.Read(buf)
+				if n > 0 {
+					if err := stream.Send(&httpbody.HttpBody{ContentType: contentType, Data: buf[:n]}); err != nil {
+						logrus.Error(err)
+						return
+					}
+				}
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					logrus.Error(err)
+					return
+				}
+			}
+
+			res, err := stream.CloseAndRecv()
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			color.Green("attached %s (%d bytes) as %s, document %s is at version %d", res.Attachment.Name, res.Attachment.Size, res.Attachment.Id, docID, res.Version)
+		},
+	}
+
+	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id (required)")
+	command.Flags().StringVarP(&input, "file", "f", "", "file to attach (required)")
+	command.Flags().StringVarP(&name, "name", "n", "", "attachment name, the file name if empty")
+	command.Flags().Int64VarP(&version, "version", "v", 0, "next version of the document, not checked if not set")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func getAttachmentCmd() *cobra.Command {
+	var docID string
+	var attachmentID string
+	var published string
+	var output string
+
+	var required = []string{"doc-id", "attachment-id"}
+
+	command := &cobra.Command{
+		Use:     "get",
+		Short:   "download an attachment to a file",
+		Example: "doc attachment get -d <doc-id> -a <attachment-id> -p <published-version> -o <file>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			req := &v1.GetAttachmentRequest{DocumentId: docID, AttachmentId: attachmentID}
+			if published != "" {
+				req.PublishedVersion = &published
+			}
+			stream, err := client.GetAttachment(tokenContext(), req)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			if output == "" {
+				output = attachmentID
+			}
+			file, err := os.Create(output)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer file.Close()
+
+			var size int
+			for {
+				chunk, err := stream.Recv()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					logrus.Error(err)
+					return
+				}
+
+				n, err := file.Write(chunk.GetData())
+				if err != nil {
+					logrus.Error(err)
+					return
+				}
+				size += n
+			}
+
+			logrus.Infof("downloaded the attachment to %s (%d bytes)", output, size)
+		},
+	}
+
+	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id (required)")
+	command.Flags().StringVarP(&attachmentID, "attachment-id", "a", "", "attachment id (required)")
+	command.Flags().StringVarP(&published, "published", "p", "", "published version of the document")
+	command.Flags().StringVarP(&output, "output", "o", "", "output file, <attachment-id> if empty")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func listAttachmentsCmd() *cobra.Command {
+	var docID string
+	var version int64
+	var published string
+
+	var required = []string{"doc-id"}
+
+	command := &cobra.Command{
+		Use:     "list",
+		Short:   "list the attachments of a document version",
+		Example: "doc attachment list -d <doc-id> -v <version> -p <published-version>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			req := &v1.ListAttachmentsRequest{DocumentId: docID}
+			if version != 0 {
+				req.Version = &version
+			}
+			if published != "" {
+				req.PublishedVersion = &published
+			}
+			res, err := client.ListAttachments(tokenContext(), req)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"ID", "Name", "Content Type", "Size", "Added Version"})
+			for _, attachment := range res.Attachments {
+				table.Append([]string{
+					attachment.Id,
+					attachment.Name,
+					attachment.ContentType,
+					strconv.FormatInt(attachment.Size, 10),
+					strconv.FormatInt(attachment.AddedVersion, 10),
+				})
+			}
+			table.Render()
+		},
+	}
+
+	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id (required)")
+	command.Flags().Int64VarP(&version, "version", "v", 0, "draft version of the document, the current version if not set")
+	command.Flags().StringVarP(&published, "published", "p", "", "published version of the document")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func deleteAttachmentCmd() *cobra.Command {
+	var docID string
+	var attachmentID string
+	var version int64
+
+	var required = []string{"doc-id", "attachment-id"}
+
+	command := &cobra.Command{
+		Use:     "delete",
+		Short:   "remove an attachment from a document, the published versions keep it",
+		Example: "doc attachment delete -d <doc-id> -a <attachment-id> -v <next-version>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			req := &v1.DeleteAttachmentRequest{DocumentId: docID, AttachmentId: attachmentID}
+			if version != 0 {
+				req.Version = &version
+			}
+			res, err := client.DeleteAttachment(tokenContext(), req)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			color.Green("removed attachment %s, document %s is at version %d", attachmentID, docID, res.Version)
+		},
+	}
+
+	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id (required)")
+	command.Flags().StringVarP(&attachmentID, "attachment-id", "a", "", "attachment id (required)")
+	command.Flags().Int64VarP(&version, "version", "v", 0, "next version of the document, not checked if not set")
+	command.Flags().SortFlags = false
+
+	return command
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/emrgen/document"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"os"
+	"strconv"
+)
+
+func init() {
+	rootCmd.AddCommand(batchWriteCmd())
+}
+
+func batchWriteCmd() *cobra.Command {
+	var file string
+	var bestEffort bool
+
+	var required = []string{"file"}
+
+	command := &cobra.Command{
+		Use:     "batch",
+		Short:   "run the create, update, delete and link operations of a json file in one call",
+		Long:    `run a batch of operations, the file is a BatchWriteRequest in json, e.g. {"operations": [{"tempId": "a", "create": {"projectId": "<project-id>"}}, {"link": {"sourceId": "<doc-id>", "target": "$a@current"}}]}`,
+		Example: "doc batch -f operations.json --best-effort",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			req := &v1.BatchWriteRequest{}
+			if err = protojson.Unmarshal(data, req); err != nil {
+				logrus.Error(err)
+				return
+			}
+			if bestEffort {
+				req.Mode = v1.BatchMode_BATCH_BEST_EFFORT
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			res, err := client.BatchWrite(tokenContext(), req)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"#", "Status", "Document", "Version", "Message"})
+			for _, result := range res.Results {
+				code := codes.Code(result.Code)
+				status := code.String()
+				if code == codes.OK {
+					status = color.GreenString(status)
+				} else {
+					status = color.RedString(status)
+				}
+				table.Append([]string{strconv.Itoa(int(result.Index)), status, result.DocumentId, strconv.FormatInt(result.Version, 10), result.Message})
+			}
+			table.Render()
+
+			for tempID, id := range res.TempIds {
+				fmt.Printf("$%s: %s\n", tempID, id)
+			}
+			if res.Failed > 0 {
+				color.Red("failed operations: %d", res.Failed)
+			}
+		},
+	}
+
+	command.Flags().StringVarP(&file, "file", "f", "", "json file of the batch request (required)")
+	command.Flags().BoolVar(&bestEffort, "best-effort", false, "save each operation on its own instead of all or nothing")
+	command.Flags().SortFlags = false
+
+	return command
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/emrgen/document"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+func init() {
+	rootCmd.AddCommand(checkProjectCmd())
+}
+
+func checkProjectCmd() *cobra.Command {
+	var projectID string
+	var rootIDs []string
+	var parentID string
+	var fix bool
+
+	var required = []string{"project-id"}
+
+	command := &cobra.Command{
+		Use:     "check",
+		Short:   "report broken links, missing children, cycles and orphan documents of a project",
+		Example: "doc check -p <project-id> -r <root-id> --parent <doc-id> --fix",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			req := &v1.ValidateProjectRequest{
+				ProjectId:  projectID,
+				RootIds:    rootIDs,
+				ApplyFixes: fix,
+			}
+			if parentID != "" {
+				req.OrphanParentId = &parentID
+			}
+
+			res, err := client.ValidateProject(tokenContext(), req)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			if len(res.Findings) == 0 {
+				color.Green("no problems found")
+				return
+			}
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"Severity", "Kind", "Document", "Reference", "Message", "Fix"})
+			for _, finding := range res.Findings {
+				kind := strings.ToLower(strings.TrimPrefix(finding.Kind.String(), "FINDING_"))
+				fixAction := ""
+				if finding.Fix != nil {
+					fixAction = strings.ToLower(strings.TrimPrefix(finding.Fix.Action.String(), "FIX_"))
+					if finding.Fixed {
+						fixAction += " (fixed)"
+					}
+				}
+				table.Append([]string{severityString(finding.Severity), kind, finding.DocumentId, finding.Reference, finding.Message, fixAction})
+			}
+			table.Render()
+
+			if fix {
+				fmt.Printf("fixed: %d/%d\n", res.Fixed, len(res.Findings))
+			}
+		},
+	}
+
+	command.Flags().StringVarP(&projectID, "project-id", "p", "", "project id (required)")
+	command.Flags().StringSliceVarP(&rootIDs, "roots", "r", nil, "root document ids, the released and indexed roots if empty")
+	command.Flags().StringVar(&parentID, "parent", "", "document the orphans are added to as children, the first root if empty")
+	command.Flags().BoolVar(&fix, "fix", false, "apply the fixes")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+// severityString shows the severity in color
+func severityString(severity v1.Severity) string {
+	name := strings.ToLower(strings.TrimPrefix(severity.String(), "SEVERITY_"))
+	switch severity {
+	case v1.Severity_SEVERITY_ERROR:
+		return color.RedString(name)
+	case v1.Severity_SEVERITY_WARNING:
+		return color.YellowString(name)
+	default:
+		return name
+	}
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/emrgen/document"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/fatih/color"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/metadata"
+	"io"
+	"os"
+	"strconv"
+)
+
+// contentChunkSize is the size of the chunks streamed by the content upload
+const contentChunkSize = 1 << 20 // 1 MB
+
+var contentCmd = &cobra.Command{
+	Use:   "content",
+	Short: "stream the content of large documents",
+	Example: `  doc content upload -d <doc-id> -f <file> -v <next-version>
+  doc content download -d <doc-id> -o <file>`,
+}
+
+func init() {
+	rootCmd.AddCommand(contentCmd)
+	contentCmd.SetHelpCommand(&cobra.Command{Use: "no-help", Hidden: true})
+	contentCmd.AddCommand(uploadContentCmd())
+	contentCmd.AddCommand(downloadContentCmd())
+}
+
+func uploadContentCmd() *cobra.Command {
+	var docID string
+	var input string
+	var version int64
+
+	var required = []string{"doc-id", "file"}
+
+	command := &cobra.Command{
+		Use:     "upload",
+		Short:   "replace the content of a document with the content of a file",
+		Example: "doc content upload -d <doc-id> -f <file> -v <next-version>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			file, err := os.Open(input)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer file.Close()
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			ctx := metadata.AppendToOutgoingContext(tokenContext(),
+				"document-id", docID,
+				"document-version", strconv.FormatInt(version, 10),
+			)
+			stream, err := client.UploadDocumentContent(ctx)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			buf := make([]byte, contentChunkSize)
+			for {
+				n, err := file.Read(buf)
+				if n > 0 {
+					if err := stream.Send(&httpbody.HttpBody{ContentType: "application/octet-stream", Data: buf[:n]}); err != nil {
+						logrus.Error(err)
+						return
+					}
+				}
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					logrus.Error(err)
+					return
+				}
+			}
+
+			res, err := stream.CloseAndRecv()
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			color.Green("uploaded %d bytes, document %s is at version %d", res.Size, res.DocumentId, res.Version)
+		},
+	}
+
+	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id (required)")
+	command.Flags().StringVarP(&input, "file", "f", "", "file with the content (required)")
+	command.Flags().Int64VarP(&version, "version", "v", -1, "next version, overwrites the document if not set")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func downloadContentCmd() *cobra.Command {
+	var docID string
+	var output string
+
+	var required = []string{"doc-id"}
+
+	command := &cobra.Command{
+		Use:     "download",
+		Short:   "download the content of a document to a file",
+		Example: "doc content download -d <doc-id> -o <file>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			stream, err := client.DownloadDocumentContent(tokenContext(), &v1.DownloadDocumentContentRequest{DocumentId: docID})
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			if output == "" {
+				output = docID
+			}
+			file, err := os.Create(output)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer file.Close()
+
+			var size int
+			for {
+				chunk, err := stream.Recv()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					logrus.Error(err)
+					return
+				}
+
+				n, err := file.Write(chunk.GetData())
+				if err != nil {
+					logrus.Error(err)
+					return
+				}
+				size += n
+			}
+
+			logrus.Infof("downloaded the content to %s (%d bytes)", output, size)
+		},
+	}
+
+	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id (required)")
+	command.Flags().StringVarP(&output, "output", "o", "", "output file, <doc-id> if empty")
+	command.Flags().SortFlags = false
+
+	return command
+}
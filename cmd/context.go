@@ -115,6 +115,15 @@ func tokenContext() context.Context {
 	return ctx
 }
 
+// idempotentContext sends the idempotency key with the request, an empty key sends none
+func idempotentContext(ctx context.Context, key string) context.Context {
+	if key == "" {
+		return ctx
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, "idempotency-key", key)
+}
+
 func readContext() Context {
 	var ctx Context
 
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/Masterminds/semver"
 	"github.com/emrgen/document"
@@ -11,6 +12,9 @@ import (
 	"github.com/olekukonko/tablewriter"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -23,17 +27,24 @@ func init() {
 	rootCmd.AddCommand(updateDocCmd())
 	rootCmd.AddCommand(publishDocCmd())
 	rootCmd.AddCommand(listDocVersionsCmd())
+	rootCmd.AddCommand(deleteDocCmd())
+	rootCmd.AddCommand(moveDocCmd())
+	rootCmd.AddCommand(copyDocCmd())
+	rootCmd.AddCommand(duplicateDocCmd())
+	rootCmd.AddCommand(listParentsCmd())
 
 	rootCmd.AddCommand(linkCmd)
 	linkCmd.SetHelpCommand(&cobra.Command{Use: "no-help", Hidden: true})
 	linkCmd.AddCommand(addLinkCmd())
 	linkCmd.AddCommand(removeLinkCmd())
 	linkCmd.AddCommand(listLinksCmd())
+	linkCmd.AddCommand(linkGraphCmd())
 
 	rootCmd.AddCommand(childCmd)
 	childCmd.SetHelpCommand(&cobra.Command{Use: "no-help", Hidden: true})
 	childCmd.AddCommand(addChildCmd())
 	childCmd.AddCommand(listChildCmd())
+	childCmd.AddCommand(moveChildCmd())
 	childCmd.AddCommand(removeChildCmd())
 
 	rootCmd.AddCommand(publishedCmd)
@@ -43,6 +54,10 @@ func init() {
 	publishedCmd.AddCommand(listPublishedVersionsCmd())
 	publishedCmd.AddCommand(listPublishedLinksCommand())
 	publishedCmd.AddCommand(listPublishedChildrenCmd())
+	publishedCmd.AddCommand(getReleaseCmd())
+	publishedCmd.AddCommand(listReleasesCmd())
+	publishedCmd.AddCommand(changelogCmd())
+	publishedCmd.AddCommand(exportSiteCmd())
 }
 
 func createDocCmd() *cobra.Command {
@@ -50,6 +65,10 @@ func createDocCmd() *cobra.Command {
 	var docID string
 	var docTitle string
 	var content string
+	var template bool
+	var docType string
+	var jsonContent bool
+	var idempotencyKey string
 
 	var required = []string{"project-id"}
 
@@ -73,10 +92,18 @@ func createDocCmd() *cobra.Command {
 			req := &v1.CreateDocumentRequest{
 				ProjectId: projectID,
 				Content:   content,
+				Template:  template,
 			}
-			if docTitle != "" {
-				meta := map[string]string{
-					"title": docTitle,
+			if jsonContent {
+				req.Kind = v1.DocumentKind_DOC_JSON
+			}
+			if docTitle != "" || docType != "" {
+				meta := map[string]string{}
+				if docTitle != "" {
+					meta["title"] = docTitle
+				}
+				if docType != "" {
+					meta["type"] = docType
 				}
 
 				metaData, err := json.Marshal(meta)
@@ -96,7 +123,7 @@ func createDocCmd() *cobra.Command {
 				req.DocumentId = &docID
 			}
 
-			ctx := tokenContext()
+			ctx := idempotentContext(tokenContext(), idempotencyKey)
 			res, err := client.CreateDocument(ctx, req)
 			if err != nil {
 				logrus.Error(err)
@@ -111,6 +138,10 @@ func createDocCmd() *cobra.Command {
 	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id")
 	command.Flags().StringVarP(&docTitle, "title", "t", "", "title of the document")
 	command.Flags().StringVarP(&content, "content", "c", "", "content of the document")
+	command.Flags().BoolVar(&template, "template", false, "create the document as a template with {{name}} placeholders")
+	command.Flags().StringVar(&docType, "type", "", "type of the document, validated against the schema of the type")
+	command.Flags().BoolVar(&jsonContent, "json", false, "the content is json")
+	command.Flags().StringVar(&idempotencyKey, "idempotency-key", "", "a retry with the same key returns the first response")
 
 	command.Flags().SortFlags = false
 
@@ -120,6 +151,7 @@ func createDocCmd() *cobra.Command {
 func getDocCmd() *cobra.Command {
 	var docID string
 	var version int64
+	var fields []string
 
 	var required = []string{"doc-id"}
 
@@ -166,6 +198,9 @@ func getDocCmd() *cobra.Command {
 			req := &v1.GetDocumentRequest{
 				DocumentId: docID,
 			}
+			if len(fields) > 0 {
+				req.ReadMask = &fieldmaskpb.FieldMask{Paths: fields}
+			}
 
 			res, err := client.GetDocument(tokenContext(), req)
 			if err != nil {
@@ -181,12 +216,24 @@ func getDocCmd() *cobra.Command {
 			table.Render()
 
 			printField("Title", getTitle(doc.Meta))
+			for _, breadcrumb := range res.Breadcrumbs {
+				var path []string
+				for _, item := range breadcrumb.Items {
+					if item.Title != "" {
+						path = append(path, item.Title)
+					} else {
+						path = append(path, item.Id)
+					}
+				}
+				printField("Path", strings.Join(path, " / "))
+			}
 			printField("Content", doc.Content)
 		},
 	}
 
 	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id (required)")
 	command.Flags().Int64VarP(&version, "version", "v", -1, "version of the document")
+	command.Flags().StringSliceVar(&fields, "fields", nil, "document fields to read, e.g. meta,children (default all)")
 
 	command.SetHelpCommand(&cobra.Command{Use: "no-help", Hidden: true})
 	command.Flags().SortFlags = false
@@ -197,6 +244,8 @@ func getDocCmd() *cobra.Command {
 func listDocCmd() *cobra.Command {
 	var projectID string
 	var published bool
+	var popular bool
+	var fields []string
 
 	var required = []string{"project-id"}
 	command := &cobra.Command{
@@ -215,18 +264,25 @@ func listDocCmd() *cobra.Command {
 			defer client.Close()
 
 			ctx := tokenContext()
-			res, err := client.ListDocuments(ctx, &v1.ListDocumentsRequest{
+			req := &v1.ListDocumentsRequest{
 				ProjectId: projectID,
-			})
+			}
+			if popular {
+				req.Order = v1.DocumentOrder_ORDER_BACKLINK_COUNT
+			}
+			if len(fields) > 0 {
+				req.ReadMask = &fieldmaskpb.FieldMask{Paths: fields}
+			}
+			res, err := client.ListDocuments(ctx, req)
 			if err != nil {
 				logrus.Error(err)
 				return
 			}
 
 			table := tablewriter.NewWriter(os.Stdout)
-			table.SetHeader([]string{"ID", "Title", "Version", "Links", "Children"})
+			table.SetHeader([]string{"ID", "Title", "Version", "Links", "Children", "Backlinks"})
 			for _, doc := range res.Documents {
-				table.Append([]string{doc.Id, getTitle(doc.Meta), strconv.FormatInt(doc.Version, 10), strconv.Itoa(len(doc.Links)), strconv.Itoa(len(doc.Children))})
+				table.Append([]string{doc.Id, getTitle(doc.Meta), strconv.FormatInt(doc.Version, 10), strconv.Itoa(len(doc.Links)), strconv.Itoa(len(doc.Children)), strconv.FormatInt(doc.BacklinkCount, 10)})
 			}
 
 			table.Render()
@@ -235,6 +291,8 @@ func listDocCmd() *cobra.Command {
 
 	command.Flags().StringVarP(&projectID, "project-id", "p", "", "project id (required)")
 	command.Flags().BoolVarP(&published, "pub", "u", false, "list published documents")
+	command.Flags().BoolVar(&popular, "popular", false, "list the most linked documents first")
+	command.Flags().StringSliceVar(&fields, "fields", nil, "document fields to read, e.g. meta,children")
 	command.Flags().SortFlags = false
 
 	return command
@@ -245,6 +303,7 @@ func updateDocCmd() *cobra.Command {
 	var docTitle string
 	var content string
 	var version int64
+	var merge bool
 
 	var required = []string{"doc-id"}
 
@@ -278,10 +337,16 @@ Constraint:
 				Version:    version,
 				Kind:       v1.UpdateKind_TEXT,
 			}
+			if merge {
+				req.Kind = v1.UpdateKind_MERGEPATCH
+			}
+			// without a merge patch only the given fields are updated, the other meta keys are kept
+			var paths []string
 
 			// update content if provided
 			if content != "" {
 				req.Content = &content
+				paths = append(paths, "content")
 			}
 
 			// update meta if title is provided
@@ -297,6 +362,10 @@ Constraint:
 				}
 				data := string(metaData)
 				req.Meta = &data
+				paths = append(paths, "meta.title")
+			}
+			if !merge && len(paths) > 0 {
+				req.UpdateMask = &fieldmaskpb.FieldMask{Paths: paths}
 			}
 
 			res, err := client.UpdateDocument(tokenContext(), req)
@@ -316,6 +385,7 @@ Constraint:
 	command.Flags().StringVarP(&docTitle, "title", "t", "", "title")
 	command.Flags().StringVarP(&content, "content", "c", "", "content")
 	command.Flags().Int64VarP(&version, "version", "v", -1, "next version")
+	command.Flags().BoolVar(&merge, "merge", false, "the content is a json merge patch of the current content")
 
 	command.Flags().SortFlags = false
 
@@ -325,6 +395,9 @@ Constraint:
 func publishDocCmd() *cobra.Command {
 	var docID string
 	var version string
+	var strictLinks bool
+	var releaseName string
+	var idempotencyKey string
 
 	var required = []string{"doc-id"}
 
@@ -345,6 +418,13 @@ func publishDocCmd() *cobra.Command {
 
 			req := &v1.PublishDocumentsRequest{
 				DocumentIds: []string{docID},
+				StrictLinks: strictLinks,
+			}
+
+			// publishing as a root document records a release
+			if releaseName != "" {
+				req.RootDocumentId = docID
+				req.ReleaseName = &releaseName
 			}
 
 			if version != "" {
@@ -356,9 +436,10 @@ func publishDocCmd() *cobra.Command {
 				req.Version = &version
 			}
 
-			res, err := client.PublishDocuments(tokenContext(), req)
+			res, err := client.PublishDocuments(idempotentContext(tokenContext(), idempotencyKey), req)
 			if err != nil {
 				logrus.Error(err)
+				printDanglingReferences(err)
 				return
 			}
 
@@ -368,11 +449,320 @@ func publishDocCmd() *cobra.Command {
 				table.Append([]string{doc.Id, doc.Version})
 			}
 			table.Render()
+
+			if res.Release != nil {
+				color.Green("release %s recorded with %d documents", res.Release.Version, len(res.Release.Members))
+			}
 		},
 	}
 
 	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id to publish")
 	command.Flags().StringVarP(&version, "version", "v", "", "version of the document to publish")
+	command.Flags().BoolVar(&strictLinks, "strict-links", false, "fail if a linked or child document is not published")
+	command.Flags().StringVarP(&releaseName, "release", "r", "", "record a release of the document tree with the given name")
+	command.Flags().StringVar(&idempotencyKey, "idempotency-key", "", "a retry with the same key returns the first response")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+// printDanglingReferences prints the dangling references attached to a failed strict publish or restricted delete
+func printDanglingReferences(err error) {
+	st, ok := status.FromError(err)
+	if !ok {
+		return
+	}
+
+	for _, detail := range st.Details() {
+		dangling, ok := detail.(*v1.DanglingReferences)
+		if !ok {
+			continue
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Source ID", "Target ID", "Target Version", "Kind"})
+		for _, ref := range dangling.References {
+			table.Append([]string{ref.SourceId, ref.TargetId, ref.TargetVersion, ref.Kind.String()})
+		}
+		table.Render()
+	}
+}
+
+func deleteDocCmd() *cobra.Command {
+	var docID string
+	var policy string
+	var erase bool
+
+	var required = []string{"doc-id"}
+
+	command := &cobra.Command{
+		Use:     "delete",
+		Short:   "delete a document, the policy decides what happens to the documents referencing it",
+		Example: "doc delete -d <doc-id> --policy detach --erase",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			policyValue, ok := v1.DeletePolicy_value["DELETE_"+strings.ToUpper(policy)]
+			if !ok {
+				color.Red("invalid policy, expected only, restrict, detach or cascade")
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			var report *v1.DeleteReport
+			if erase {
+				res, err := client.EraseDocument(tokenContext(), &v1.EraseDocumentRequest{Id: docID, Policy: v1.DeletePolicy(policyValue)})
+				if err != nil {
+					logrus.Error(err)
+					printDanglingReferences(err)
+					return
+				}
+				report = res.Report
+			} else {
+				res, err := client.DeleteDocument(tokenContext(), &v1.DeleteDocumentRequest{Id: docID, Policy: v1.DeletePolicy(policyValue)})
+				if err != nil {
+					logrus.Error(err)
+					printDanglingReferences(err)
+					return
+				}
+				report = res.Report
+			}
+
+			for _, id := range report.DeletedIds {
+				color.Green("deleted %s", id)
+			}
+			for _, doc := range report.Detached {
+				for _, ref := range doc.References {
+					fmt.Printf("detached %s from %s, new version %d\n", ref.TargetId, doc.Id, doc.Version)
+				}
+			}
+			for _, ref := range report.Dangling {
+				kind := strings.ToLower(strings.TrimPrefix(ref.Kind.String(), "REFERENCE_"))
+				color.Yellow("dangling %s from %s to %s@%s", kind, ref.SourceId, ref.TargetId, ref.TargetVersion)
+			}
+			if erase {
+				fmt.Printf("erased links: %d, backups: %d, tree indexes: %d, attachments: %d\n", report.ErasedLinks, report.ErasedBackups, report.ErasedIndexes, report.ErasedAttachments)
+			}
+		},
+	}
+
+	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id (required)")
+	command.Flags().StringVar(&policy, "policy", "only", "what happens to the referencing documents: only, restrict, detach or cascade")
+	command.Flags().BoolVar(&erase, "erase", false, "erase the document instead of a soft delete")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func moveDocCmd() *cobra.Command {
+	var docIDs []string
+	var projectID string
+	var parentID string
+
+	var required = []string{"doc-id", "project-id"}
+
+	command := &cobra.Command{
+		Use:     "move",
+		Short:   "move documents with their children to another project",
+		Example: "doc move -d <doc-id> -p <project-id> --parent <doc-id>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			req := &v1.MoveDocumentsRequest{DocumentIds: docIDs, ProjectId: projectID}
+			if parentID != "" {
+				req.ParentId = &parentID
+			}
+			res, err := client.MoveDocuments(tokenContext(), req)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			for _, id := range res.MovedIds {
+				color.Green("moved %s", id)
+			}
+			for _, doc := range res.Detached {
+				for _, ref := range doc.References {
+					fmt.Printf("detached %s from %s, new version %d\n", ref.TargetId, doc.Id, doc.Version)
+				}
+			}
+		},
+	}
+
+	command.Flags().StringSliceVarP(&docIDs, "doc-id", "d", nil, "document ids (required)")
+	command.Flags().StringVarP(&projectID, "project-id", "p", "", "target project id (required)")
+	command.Flags().StringVar(&parentID, "parent", "", "target project document the moved documents are added to as children")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func copyDocCmd() *cobra.Command {
+	var docIDs []string
+	var projectID string
+	var parentID string
+
+	var required = []string{"doc-id", "project-id"}
+
+	command := &cobra.Command{
+		Use:     "copy",
+		Short:   "copy documents with their children to another project",
+		Example: "doc copy -d <doc-id> -p <project-id> --parent <doc-id>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			req := &v1.CopyDocumentsRequest{DocumentIds: docIDs, ProjectId: projectID}
+			if parentID != "" {
+				req.ParentId = &parentID
+			}
+			res, err := client.CopyDocuments(tokenContext(), req)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"Document", "Copy"})
+			for id, copyID := range res.CopiedIds {
+				table.Append([]string{id, copyID})
+			}
+			table.Render()
+		},
+	}
+
+	command.Flags().StringSliceVarP(&docIDs, "doc-id", "d", nil, "document ids (required)")
+	command.Flags().StringVarP(&projectID, "project-id", "p", "", "target project id (required)")
+	command.Flags().StringVar(&parentID, "parent", "", "target project document the copies are added to as children")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func duplicateDocCmd() *cobra.Command {
+	var docID string
+	var deep bool
+	var parentID string
+
+	var required = []string{"doc-id"}
+
+	command := &cobra.Command{
+		Use:     "duplicate",
+		Short:   "copy a document in its project with a new id",
+		Example: "doc duplicate -d <doc-id> --deep --parent <doc-id>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			req := &v1.DuplicateDocumentRequest{Id: docID, Deep: deep}
+			if parentID != "" {
+				req.ParentId = &parentID
+			}
+			res, err := client.DuplicateDocument(tokenContext(), req)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			color.Green("document duplicated with id: %s", res.Document.Id)
+			if deep {
+				fmt.Printf("copied documents: %d\n", len(res.CopiedIds))
+			}
+		},
+	}
+
+	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id (required)")
+	command.Flags().BoolVar(&deep, "deep", false, "also copy the documents under it")
+	command.Flags().StringVar(&parentID, "parent", "", "document the duplicate is added to as a child")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func listParentsCmd() *cobra.Command {
+	var docID string
+	var published bool
+	var version string
+
+	var required = []string{"doc-id"}
+
+	command := &cobra.Command{
+		Use:     "parents",
+		Short:   "list the parents of a document",
+		Example: "doc parents -d <doc-id> --published -v <version>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			req := &v1.ListParentsRequest{
+				DocumentId: docID,
+				Published:  published,
+			}
+			if version != "" {
+				req.Version = &version
+			}
+
+			res, err := client.ListParents(tokenContext(), req)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"ID", "Version", "Child Version", "Title"})
+			for _, parent := range res.Parents {
+				table.Append([]string{parent.Id, parent.Version, parent.ChildVersion, parent.Title})
+			}
+			table.Render()
+		},
+	}
+
+	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id (required)")
+	command.Flags().BoolVar(&published, "published", false, "list the published parent versions")
+	command.Flags().StringVarP(&version, "version", "v", "", "published version of the document")
+
+	command.SetHelpCommand(&cobra.Command{Use: "no-help", Hidden: true})
 	command.Flags().SortFlags = false
 
 	return command
@@ -428,6 +818,7 @@ var linkCmd = &cobra.Command{
 	Short: "manage links between documents",
 	Example: `  doc link add -s <source-id> -t <target-id>
   doc link list -d <doc-id> --published --backlink
+  doc link graph -d <doc-id> -f links,backlinks --depth 3
   doc link remove -s <source-id> -t <target-id>`,
 }
 
@@ -435,13 +826,16 @@ func addLinkCmd() *cobra.Command {
 	var sourceID string
 	var targetID string
 	var targetVersion string
+	var linkType string
+	var anchor string
+	var label string
 
 	var required = []string{"source-id", "target-id"}
 
 	command := &cobra.Command{
 		Use:     "add",
 		Short:   "add a link between two documents",
-		Example: "doc link -s <source-id> -t <target-id> -v <target-version>",
+		Example: "doc link add -s <source-id> -t <target-id> -v <target-version> --type embeds --anchor <block-id> --label <label>",
 
 		Run: func(cmd *cobra.Command, args []string) {
 			if checkMissingFlags(cmd, required) {
@@ -466,8 +860,17 @@ func addLinkCmd() *cobra.Command {
 				res.Document.Links = make(map[string]string)
 			}
 
-			// add link to the document
-			res.Document.Links[fmt.Sprintf("%s@%s", targetID, targetVersion)] = ""
+			// add link to the document, the value is the link type or a json annotation with the anchor and label
+			value := linkType
+			if anchor != "" || label != "" {
+				data, err := json.Marshal(map[string]string{"type": linkType, "anchor": anchor, "label": label})
+				if err != nil {
+					logrus.Error(err)
+					return
+				}
+				value = string(data)
+			}
+			res.Document.Links[fmt.Sprintf("%s@%s", targetID, targetVersion)] = value
 
 			_, err = client.UpdateDocument(tokenContext(), &v1.UpdateDocumentRequest{
 				DocumentId: sourceID,
@@ -484,6 +887,9 @@ func addLinkCmd() *cobra.Command {
 	command.Flags().StringVarP(&sourceID, "source-id", "s", "", "source document id (required)")
 	command.Flags().StringVarP(&targetID, "target-id", "t", "", "target document id (required)")
 	command.Flags().StringVarP(&targetVersion, "target-version", "v", "current", "target document version")
+	command.Flags().StringVar(&linkType, "type", "references", "link type: references, embeds, derived_from, supersedes or a custom type")
+	command.Flags().StringVar(&anchor, "anchor", "", "block id inside the target document")
+	command.Flags().StringVar(&label, "label", "", "label of the link")
 
 	command.Flags().SortFlags = false
 
@@ -494,6 +900,7 @@ func listLinksCmd() *cobra.Command {
 	var docID string
 	var version string
 	var backlink bool
+	var types []string
 
 	var required = []string{"doc-id"}
 
@@ -528,15 +935,15 @@ func listLinksCmd() *cobra.Command {
 				}
 
 				table := tablewriter.NewWriter(os.Stdout)
-				table.SetHeader([]string{"ID", "Version"})
-				for link, _ := range res.Document.Links {
+				table.SetHeader([]string{"ID", "Version", "Annotation"})
+				for link, annotation := range res.Document.Links {
 					tokens := strings.Split(link, "@")
 					if len(tokens) != 2 {
 						logrus.Warnf("invalid link: %s, expected format: <id>@<version>", link)
 						continue
 					}
 
-					table.Append([]string{tokens[0], tokens[1]})
+					table.Append([]string{tokens[0], tokens[1], annotation})
 				}
 
 				table.Render()
@@ -546,6 +953,7 @@ func listLinksCmd() *cobra.Command {
 			if backlink {
 				res, err := client.ListBacklinks(tokenContext(), &v1.ListBacklinksRequest{
 					DocumentId: docID,
+					Types:      types,
 				})
 				if err != nil {
 					logrus.Error(err)
@@ -553,9 +961,9 @@ func listLinksCmd() *cobra.Command {
 				}
 
 				table := tablewriter.NewWriter(os.Stdout)
-				table.SetHeader([]string{"ID", "Version"})
+				table.SetHeader([]string{"ID", "Version", "Type", "Anchor", "Label"})
 				for _, link := range res.Links {
-					table.Append([]string{link.SourceId, link.SourceVersion})
+					table.Append([]string{link.SourceId, link.SourceVersion, link.Type, link.Anchor, link.Label})
 				}
 
 				table.Render()
@@ -567,12 +975,92 @@ func listLinksCmd() *cobra.Command {
 	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id of the document")
 	command.Flags().StringVarP(&version, "version", "v", "", "version of the document")
 	command.Flags().BoolVarP(&backlink, "backlink", "b", false, "backlink id")
+	command.Flags().StringSliceVar(&types, "type", nil, "link types of the backlinks to list")
 
 	command.Flags().SortFlags = false
 
 	return command
 }
 
+func linkGraphCmd() *cobra.Command {
+	var docID string
+	var version string
+	var follow []string
+	var depth int32
+	var limit int32
+
+	var required = []string{"doc-id"}
+
+	command := &cobra.Command{
+		Use:     "graph",
+		Short:   "traverse the links, backlinks and children around a document",
+		Example: "doc link graph -d <doc-id> -v <version> -f links,backlinks,children --depth 2 --limit 100",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			req := &v1.TraverseLinksRequest{
+				DocumentId: docID,
+				MaxDepth:   depth,
+				Limit:      limit,
+			}
+			if version != "" {
+				req.Version = &version
+			}
+			for _, edge := range follow {
+				value, ok := v1.TraverseEdge_value["TRAVERSE_"+strings.ToUpper(edge)]
+				if !ok {
+					color.Red("invalid edge %s, expected links, backlinks or children", edge)
+					return
+				}
+				req.Follow = append(req.Follow, v1.TraverseEdge(value))
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			res, err := client.TraverseLinks(tokenContext(), req)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"ID", "Version", "Title", "Depth"})
+			for _, node := range res.Nodes {
+				table.Append([]string{node.Id, node.Version, node.Title, strconv.Itoa(int(node.Depth))})
+			}
+			table.Render()
+
+			table = tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"Source", "Target", "Kind"})
+			for _, edge := range res.Edges {
+				kind := strings.ToLower(strings.TrimPrefix(edge.Kind.String(), "REFERENCE_"))
+				table.Append([]string{edge.SourceId + "@" + edge.SourceVersion, edge.TargetId + "@" + edge.TargetVersion, kind})
+			}
+			table.Render()
+
+			if res.Truncated {
+				color.Yellow("the graph is truncated at %d nodes", len(res.Nodes))
+			}
+		},
+	}
+
+	command.Flags().StringVarP(&docID, "doc-id", "d", "", "start document id (required)")
+	command.Flags().StringVarP(&version, "version", "v", "", "published version of the start document, the draft graph if empty")
+	command.Flags().StringSliceVarP(&follow, "follow", "f", nil, "edges to follow: links, backlinks, children (default all)")
+	command.Flags().Int32Var(&depth, "depth", 2, "max depth of the traversal")
+	command.Flags().Int32Var(&limit, "limit", 100, "max number of nodes")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
 func removeLinkCmd() *cobra.Command {
 	var sourceID string
 	var targetID string
@@ -643,13 +1131,15 @@ func addChildCmd() *cobra.Command {
 	var parentID string
 	var childID string
 	var childVersion string
+	var after string
+	var before string
 
 	var required = []string{"parent-id", "child-id"}
 
 	command := &cobra.Command{
 		Use:     "add",
 		Short:   "add a child document",
-		Example: "doc child add -p <parent-id> -c <child-id> -v <child-version>",
+		Example: "doc child add -p <parent-id> -c <child-id> -v <child-version> --after <sibling-id>@<version>",
 		Run: func(cmd *cobra.Command, args []string) {
 			if checkMissingFlags(cmd, required) {
 				return
@@ -662,43 +1152,91 @@ func addChildCmd() *cobra.Command {
 			}
 			defer client.Close()
 
-			res, err := client.GetDocument(tokenContext(), &v1.GetDocumentRequest{
+			res, err := client.InsertChild(tokenContext(), &v1.InsertChildRequest{
 				DocumentId: parentID,
+				Child:      fmt.Sprintf("%s@%s", childID, childVersion),
+				Position:   childPosition(after, before),
 			})
 			if err != nil {
 				logrus.Error(err)
 				return
 			}
 
-			if res.Document.Children == nil {
-				res.Document.Children = make([]string, 0)
+			logrus.Infof("child added with key %s, new version %d", res.Key, res.Version)
+		},
+	}
+
+	command.Flags().StringVarP(&parentID, "parent-id", "p", "", "source document id (required)")
+	command.Flags().StringVarP(&childID, "child-id", "c", "", "target document id (required)")
+	command.Flags().StringVarP(&childVersion, "child-version", "v", "current", "child document version")
+	command.Flags().StringVar(&after, "after", "", "sibling <id>@<version> the child is added after")
+	command.Flags().StringVar(&before, "before", "", "sibling <id>@<version> the child is added before")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func moveChildCmd() *cobra.Command {
+	var parentID string
+	var childID string
+	var childVersion string
+	var after string
+	var before string
+
+	var required = []string{"parent-id", "child-id"}
+
+	command := &cobra.Command{
+		Use:     "move",
+		Short:   "move a child document among its siblings, to the end without a position",
+		Example: "doc child move -p <parent-id> -c <child-id> --before <sibling-id>@<version>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
 			}
 
-			// add link to the document
-			res.Document.Children = append(res.Document.Children, fmt.Sprintf("%s@%s", childID, childVersion))
-			// remove duplicates
-			res.Document.Children = unique(res.Document.Children)
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
 
-			_, err = client.UpdateDocument(tokenContext(), &v1.UpdateDocumentRequest{
+			res, err := client.MoveChild(tokenContext(), &v1.MoveChildRequest{
 				DocumentId: parentID,
-				Children:   res.Document.Children,
-				Version:    res.Document.Version + 1,
+				Child:      fmt.Sprintf("%s@%s", childID, childVersion),
+				Position:   childPosition(after, before),
 			})
 			if err != nil {
 				logrus.Error(err)
 				return
 			}
+
+			logrus.Infof("child moved to key %s, new version %d", res.Key, res.Version)
 		},
 	}
 
-	command.Flags().StringVarP(&parentID, "parent-id", "p", "", "source document id (required)")
-	command.Flags().StringVarP(&childID, "child-id", "c", "", "target document id (required)")
+	command.Flags().StringVarP(&parentID, "parent-id", "p", "", "parent document id (required)")
+	command.Flags().StringVarP(&childID, "child-id", "c", "", "child document id (required)")
 	command.Flags().StringVarP(&childVersion, "child-version", "v", "current", "child document version")
+	command.Flags().StringVar(&after, "after", "", "sibling <id>@<version> the child is moved after")
+	command.Flags().StringVar(&before, "before", "", "sibling <id>@<version> the child is moved before")
 	command.Flags().SortFlags = false
 
 	return command
 }
 
+// childPosition returns the position of a child from the after and before flags
+func childPosition(after, before string) *v1.ChildPosition {
+	position := &v1.ChildPosition{}
+	if after != "" {
+		position.After = &after
+	}
+	if before != "" {
+		position.Before = &before
+	}
+	return position
+}
+
 func listChildCmd() *cobra.Command {
 	var docID string
 	var version string
@@ -730,14 +1268,18 @@ func listChildCmd() *cobra.Command {
 			}
 
 			table := tablewriter.NewWriter(os.Stdout)
-			table.SetHeader([]string{"ID", "Version"})
-			for _, child := range res.Document.Children {
+			table.SetHeader([]string{"ID", "Version", "Key"})
+			for i, child := range res.Document.Children {
 				tokens := strings.Split(child, "@")
 				if len(tokens) != 2 {
 					logrus.Warnf("invalid child link: %s, expected format: <id>@<version>", child)
 					continue
 				}
-				table.Append([]string{tokens[0], tokens[1]})
+				key := ""
+				if i < len(res.Document.ChildKeys) {
+					key = res.Document.ChildKeys[i]
+				}
+				table.Append([]string{tokens[0], tokens[1], key})
 			}
 
 			table.Render()
@@ -775,31 +1317,9 @@ func removeChildCmd() *cobra.Command {
 			}
 			defer client.Close()
 
-			res, err := client.GetDocument(tokenContext(), &v1.GetDocumentRequest{
-				DocumentId: parentID,
-			})
-			if err != nil {
-				logrus.Error(err)
-				return
-			}
-
-			if res.Document.Children == nil {
-				res.Document.Children = make([]string, 0)
-			}
-
-			childFullID := fmt.Sprintf("%s@%s", childID, childVersion)
-
-			// remove link from the document
-			for i, child := range res.Document.Children {
-				if child == childFullID {
-					res.Document.Children = append(res.Document.Children[:i], res.Document.Children[i+1:]...)
-				}
-			}
-
-			_, err = client.UpdateDocument(tokenContext(), &v1.UpdateDocumentRequest{
+			_, err = client.RemoveChild(tokenContext(), &v1.RemoveChildRequest{
 				DocumentId: parentID,
-				Children:   res.Document.Children,
-				Version:    res.Document.Version + 1,
+				Child:      fmt.Sprintf("%s@%s", childID, childVersion),
 			})
 			if err != nil {
 				logrus.Error(err)
@@ -988,6 +1508,7 @@ func listPublishedLinksCommand() *cobra.Command {
 	var docID string
 	var backlink bool
 	var version string
+	var types []string
 
 	command := &cobra.Command{
 		Use:   "links",
@@ -1037,6 +1558,7 @@ func listPublishedLinksCommand() *cobra.Command {
 				res, err := client.ListPublishedBacklinks(tokenContext(), &v1.ListPublishedBacklinksRequest{
 					DocumentId: docID,
 					Version:    docVersion,
+					Types:      types,
 				})
 				if err != nil {
 					logrus.Error(err)
@@ -1044,9 +1566,9 @@ func listPublishedLinksCommand() *cobra.Command {
 				}
 
 				table := tablewriter.NewWriter(os.Stdout)
-				table.SetHeader([]string{"ID", "Version"})
+				table.SetHeader([]string{"ID", "Version", "Type", "Anchor", "Label"})
 				for _, link := range res.Links {
-					table.Append([]string{link.SourceId, link.SourceVersion})
+					table.Append([]string{link.SourceId, link.SourceVersion, link.Type, link.Anchor, link.Label})
 				}
 
 				table.Render()
@@ -1059,6 +1581,7 @@ func listPublishedLinksCommand() *cobra.Command {
 	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id of the document")
 	command.Flags().BoolVarP(&backlink, "backlink", "b", false, "backlink")
 	command.Flags().StringVarP(&version, "version", "v", "", "version of the document")
+	command.Flags().StringSliceVar(&types, "type", nil, "link types of the backlinks to list")
 
 	return command
 }
@@ -1114,6 +1637,259 @@ func listPublishedChildrenCmd() *cobra.Command {
 	return command
 }
 
+func getReleaseCmd() *cobra.Command {
+	var rootID string
+	var version string
+	var withDocs bool
+
+	var required = []string{"root-id"}
+
+	command := &cobra.Command{
+		Use:     "release",
+		Short:   "get a release of a published document tree",
+		Example: "doc pub release -r <root-id> -v 2.1 --docs",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			res, err := client.GetRelease(tokenContext(), &v1.GetReleaseRequest{
+				RootDocumentId:   rootID,
+				Version:          version,
+				IncludeDocuments: withDocs,
+			})
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			printField("Release", res.Release.Version)
+			printField("Name", res.Release.Name)
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"ID", "Version"})
+			for _, member := range res.Release.Members {
+				table.Append([]string{member.Id, member.Version})
+			}
+			table.Render()
+
+			for _, doc := range res.Documents {
+				printField(doc.Id+"@"+doc.Version, getTitle(doc.Meta))
+			}
+		},
+	}
+
+	command.Flags().StringVarP(&rootID, "root-id", "r", "", "root document id (required)")
+	command.Flags().StringVarP(&version, "version", "v", "latest", "release version")
+	command.Flags().BoolVar(&withDocs, "docs", false, "fetch the member documents")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func listReleasesCmd() *cobra.Command {
+	var rootID string
+
+	var required = []string{"root-id"}
+
+	command := &cobra.Command{
+		Use:   "releases",
+		Short: "list releases of a published document tree",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			res, err := client.ListReleases(tokenContext(), &v1.ListReleasesRequest{
+				RootDocumentId: rootID,
+			})
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"Version", "Name", "Documents", "Created At"})
+			for _, release := range res.Releases {
+				table.Append([]string{release.Version, release.Name, strconv.Itoa(len(release.Members)), release.CreatedAt.AsTime().Format("2006-01-02 15:04:05")})
+			}
+			table.Render()
+		},
+	}
+
+	command.Flags().StringVarP(&rootID, "root-id", "r", "", "root document id (required)")
+
+	return command
+}
+
+func changelogCmd() *cobra.Command {
+	var rootID string
+	var fromVersion string
+	var toVersion string
+
+	var required = []string{"root-id", "from", "to"}
+
+	command := &cobra.Command{
+		Use:     "changelog",
+		Short:   "list the documents changed between two versions of a published tree",
+		Example: "doc pub changelog -r <root-id> --from 1.0.0 --to 1.1.0",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			if !checkValidSemvar(fromVersion) || !checkValidSemvar(toVersion) {
+				color.Red("invalid version format, expected semver")
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			res, err := client.GetPublishedChangelog(tokenContext(), &v1.GetPublishedChangelogRequest{
+				RootDocumentId: rootID,
+				FromVersion:    fromVersion,
+				ToVersion:      toVersion,
+			})
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			if len(res.Changes) == 0 {
+				logrus.Infof("no changes found")
+				return
+			}
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"ID", "Title", "Change", "From", "To", "Lines"})
+			for _, change := range res.Changes {
+				kind := strings.ToLower(strings.TrimPrefix(change.Kind.String(), "CHANGE_"))
+				lines := fmt.Sprintf("+%d -%d", change.LinesAdded, change.LinesRemoved)
+				table.Append([]string{change.DocumentId, change.Title, kind, change.FromVersion, change.ToVersion, lines})
+			}
+			table.Render()
+		},
+	}
+
+	command.Flags().StringVarP(&rootID, "root-id", "r", "", "root document id (required)")
+	command.Flags().StringVar(&fromVersion, "from", "", "root document version to compare from (required)")
+	command.Flags().StringVar(&toVersion, "to", "", "root document version to compare to (required)")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func exportSiteCmd() *cobra.Command {
+	var rootID string
+	var version string
+	var format string
+	var output string
+
+	var required = []string{"root-id"}
+
+	command := &cobra.Command{
+		Use:     "export-site",
+		Short:   "export a published tree as a zip of static files",
+		Example: "doc pub export-site -r <root-id> -v <version> -f html -o site.zip",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			if version != "" && !checkValidSemvar(version) {
+				color.Red("invalid version format, expected semver")
+				return
+			}
+
+			var exportFormat v1.ExportFormat
+			switch format {
+			case "markdown", "md":
+				exportFormat = v1.ExportFormat_EXPORT_MARKDOWN
+			case "html":
+				exportFormat = v1.ExportFormat_EXPORT_HTML
+			default:
+				color.Red("invalid format %s, expected markdown or html", format)
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			stream, err := client.ExportPublishedSite(tokenContext(), &v1.ExportPublishedSiteRequest{
+				RootDocumentId: rootID,
+				Version:        version,
+				Format:         exportFormat,
+			})
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			if output == "" {
+				output = rootID + ".zip"
+			}
+			file, err := os.Create(output)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer file.Close()
+
+			var size int
+			for {
+				chunk, err := stream.Recv()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					logrus.Error(err)
+					return
+				}
+
+				n, err := file.Write(chunk.GetData())
+				if err != nil {
+					logrus.Error(err)
+					return
+				}
+				size += n
+			}
+
+			logrus.Infof("exported site to %s (%d bytes)", output, size)
+		},
+	}
+
+	command.Flags().StringVarP(&rootID, "root-id", "r", "", "root document id (required)")
+	command.Flags().StringVarP(&version, "version", "v", "", "root document version, latest if empty")
+	command.Flags().StringVarP(&format, "format", "f", "markdown", "output format, markdown or html")
+	command.Flags().StringVarP(&output, "output", "o", "", "output zip file, <root-id>.zip if empty")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
 func parseMap(meta string) map[string]interface{} {
 	var m map[string]interface{}
 	err := json.Unmarshal([]byte(meta), &m)
@@ -1181,18 +1957,3 @@ func checkValidSemvar(ver string) bool {
 	_, err := semver.NewVersion(ver)
 	return err == nil
 }
-
-// unique returns a slice with unique elements
-func unique(s []string) []string {
-	seen := make(map[string]struct{}, len(s))
-	j := 0
-	for _, v := range s {
-		if _, ok := seen[v]; ok {
-			continue
-		}
-		seen[v] = struct{}{}
-		s[j] = v
-		j++
-	}
-	return s[:j]
-}
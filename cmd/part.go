@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"github.com/emrgen/document"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var partCmd = &cobra.Command{
+	Use:   "part",
+	Short: "manage the parts of large documents",
+	Example: `  doc part get -d <doc-id> -p <part-id>
+  doc part update -d <doc-id> -p <part-id> -c <content> -v <next-version>
+  doc part remove -d <doc-id> -p <part-id>`,
+}
+
+func init() {
+	rootCmd.AddCommand(partCmd)
+	partCmd.SetHelpCommand(&cobra.Command{Use: "no-help", Hidden: true})
+	partCmd.AddCommand(getPartCmd())
+	partCmd.AddCommand(updatePartCmd())
+	partCmd.AddCommand(removePartCmd())
+}
+
+func getPartCmd() *cobra.Command {
+	var docID string
+	var partID string
+
+	var required = []string{"doc-id", "part-id"}
+
+	command := &cobra.Command{
+		Use:     "get",
+		Short:   "get a part of a document",
+		Example: "doc part get -d <doc-id> -p <part-id>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			res, err := client.GetDocumentPart(tokenContext(), &v1.GetDocumentPartRequest{DocumentId: docID, PartId: partID})
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"Part", "Version"})
+			table.Append([]string{res.Part.Id, strconv.FormatInt(res.Part.Version, 10)})
+			table.Render()
+
+			printField("Content", res.Part.Content)
+		},
+	}
+
+	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id (required)")
+	command.Flags().StringVarP(&partID, "part-id", "p", "", "part id (required)")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func updatePartCmd() *cobra.Command {
+	var docID string
+	var partID string
+	var content string
+	var version int64
+	var after string
+
+	var required = []string{"doc-id", "part-id"}
+
+	command := &cobra.Command{
+		Use:     "update",
+		Short:   "create or update a part of a document, a new part is created with version 1",
+		Example: "doc part update -d <doc-id> -p <part-id> -c <content> -v <next-version> --after <part-id>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			req := &v1.UpdateDocumentPartRequest{
+				DocumentId: docID,
+				PartId:     partID,
+				Content:    content,
+				Version:    version,
+			}
+			if cmd.Flags().Changed("after") {
+				req.After = &after
+			}
+
+			res, err := client.UpdateDocumentPart(tokenContext(), req)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			color.Green("part %s saved with version %d", res.PartId, res.Version)
+			printField("Parts", strings.Join(res.Parts, ", "))
+		},
+	}
+
+	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id (required)")
+	command.Flags().StringVarP(&partID, "part-id", "p", "", "part id (required)")
+	command.Flags().StringVarP(&content, "content", "c", "", "content of the part")
+	command.Flags().Int64VarP(&version, "version", "v", -1, "next version of the part")
+	command.Flags().StringVar(&after, "after", "", "place a new part after this part, first if empty")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func removePartCmd() *cobra.Command {
+	var docID string
+	var partID string
+	var version int64
+
+	var required = []string{"doc-id", "part-id"}
+
+	command := &cobra.Command{
+		Use:     "remove",
+		Short:   "remove a part of a document",
+		Example: "doc part remove -d <doc-id> -p <part-id>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			res, err := client.UpdateDocumentPart(tokenContext(), &v1.UpdateDocumentPartRequest{
+				DocumentId: docID,
+				PartId:     partID,
+				Version:    version,
+				Remove:     true,
+			})
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			color.Green("part %s removed", partID)
+			printField("Parts", strings.Join(res.Parts, ", "))
+		},
+	}
+
+	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id (required)")
+	command.Flags().StringVarP(&partID, "part-id", "p", "", "part id (required)")
+	command.Flags().Int64VarP(&version, "version", "v", -1, "next version of the part")
+	command.Flags().SortFlags = false
+
+	return command
+}
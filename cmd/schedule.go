@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"github.com/Masterminds/semver"
+	"github.com/emrgen/document"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"os"
+	"strings"
+	"time"
+)
+
+func init() {
+	rootCmd.AddCommand(scheduleCmd)
+	scheduleCmd.SetHelpCommand(&cobra.Command{Use: "no-help", Hidden: true})
+	scheduleCmd.AddCommand(createScheduleCmd())
+	scheduleCmd.AddCommand(listSchedulesCmd())
+	scheduleCmd.AddCommand(cancelScheduleCmd())
+}
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "manage scheduled publishes",
+	Example: `  doc schedule create -p <project-id> -r <root-id> -d <doc-id>,<doc-id> -a 2026-01-02T15:04:05Z
+  doc schedule list -p <project-id> --pending
+  doc schedule cancel -i <schedule-id>`,
+}
+
+func createScheduleCmd() *cobra.Command {
+	var projectID string
+	var rootID string
+	var docIDs []string
+	var version string
+	var bump string
+	var publishAt string
+	var strictLinks bool
+
+	var required = []string{"project-id", "doc-ids", "at"}
+
+	command := &cobra.Command{
+		Use:     "create",
+		Short:   "schedule a publish",
+		Example: "doc schedule create -p <project-id> -r <root-id> -d <doc-id>,<doc-id> -a 2026-01-02T15:04:05Z -b minor",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			at, err := time.Parse(time.RFC3339, publishAt)
+			if err != nil {
+				color.Red("invalid publish time, expected RFC3339 format")
+				return
+			}
+
+			bumpValue, ok := v1.VersionBump_value["BUMP_"+strings.ToUpper(bump)]
+			if !ok {
+				color.Red("invalid bump, expected patch, minor or major")
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			req := &v1.SchedulePublishRequest{
+				ProjectId:      projectID,
+				RootDocumentId: rootID,
+				DocumentIds:    docIDs,
+				Bump:           v1.VersionBump(bumpValue),
+				StrictLinks:    strictLinks,
+				PublishAt:      timestamppb.New(at),
+			}
+
+			if version != "" {
+				if _, err := semver.NewVersion(version); err != nil {
+					logrus.Error(err)
+					return
+				}
+				req.Version = &version
+			}
+
+			res, err := client.SchedulePublish(tokenContext(), req)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			printSchedules([]*v1.PublishSchedule{res.Schedule})
+		},
+	}
+
+	command.Flags().StringVarP(&projectID, "project-id", "p", "", "project id (required)")
+	command.Flags().StringVarP(&rootID, "root-id", "r", "", "root document id")
+	command.Flags().StringSliceVarP(&docIDs, "doc-ids", "d", nil, "document ids to publish (required)")
+	command.Flags().StringVarP(&publishAt, "at", "a", "", "publish time in RFC3339 format (required)")
+	command.Flags().StringVarP(&version, "version", "v", "", "version to publish")
+	command.Flags().StringVarP(&bump, "bump", "b", "patch", "version bump: patch, minor or major")
+	command.Flags().BoolVar(&strictLinks, "strict-links", false, "fail if a linked or child document is not published")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func listSchedulesCmd() *cobra.Command {
+	var projectID string
+	var pending bool
+	var page int32
+	var perPage int32
+
+	var required = []string{"project-id"}
+
+	command := &cobra.Command{
+		Use:   "list",
+		Short: "list scheduled publishes",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			res, err := client.ListPublishSchedules(tokenContext(), &v1.ListPublishSchedulesRequest{
+				ProjectId:   projectID,
+				PendingOnly: pending,
+				Page:        page,
+				PerPage:     perPage,
+			})
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			printSchedules(res.Schedules)
+		},
+	}
+
+	command.Flags().StringVarP(&projectID, "project-id", "p", "", "project id (required)")
+	command.Flags().BoolVar(&pending, "pending", false, "list only pending schedules")
+	command.Flags().Int32Var(&page, "page", 1, "page number")
+	command.Flags().Int32Var(&perPage, "per-page", 0, "number of schedules per page, 0 lists all")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func cancelScheduleCmd() *cobra.Command {
+	var scheduleID string
+
+	var required = []string{"id"}
+
+	command := &cobra.Command{
+		Use:   "cancel",
+		Short: "cancel a scheduled publish",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			_, err = client.CancelPublishSchedule(tokenContext(), &v1.CancelPublishScheduleRequest{
+				Id: scheduleID,
+			})
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			color.Green("schedule cancelled")
+		},
+	}
+
+	command.Flags().StringVarP(&scheduleID, "id", "i", "", "schedule id (required)")
+
+	return command
+}
+
+func printSchedules(schedules []*v1.PublishSchedule) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"ID", "Root ID", "Documents", "Publish At", "Status", "Published"})
+	for _, schedule := range schedules {
+		var published []string
+		for _, doc := range schedule.Published {
+			published = append(published, doc.Id+"@"+doc.Version)
+		}
+
+		table.Append([]string{
+			schedule.Id,
+			schedule.RootDocumentId,
+			strings.Join(schedule.DocumentIds, "\n"),
+			schedule.PublishAt.AsTime().Format("2006-01-02 15:04:05"),
+			schedule.Status.String(),
+			strings.Join(published, "\n"),
+		})
+	}
+	table.Render()
+}
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"github.com/emrgen/document"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"os"
+	"strconv"
+)
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "validate the documents of a type with JSON Schemas",
+	Example: `  doc schema put -p <project-id> -t <type> --meta <meta-schema-file> --content <content-schema-file>
+  doc schema get -p <project-id> -t <type>
+  doc schema list -p <project-id>
+  doc schema delete -p <project-id> -t <type>`,
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+	schemaCmd.SetHelpCommand(&cobra.Command{Use: "no-help", Hidden: true})
+	schemaCmd.AddCommand(putSchemaCmd())
+	schemaCmd.AddCommand(getSchemaCmd())
+	schemaCmd.AddCommand(listSchemasCmd())
+	schemaCmd.AddCommand(deleteSchemaCmd())
+}
+
+func putSchemaCmd() *cobra.Command {
+	var projectID string
+	var docType string
+	var metaFile string
+	var contentFile string
+
+	var required = []string{"project-id", "type"}
+
+	command := &cobra.Command{
+		Use:     "put",
+		Short:   "create or replace the schemas of a document type",
+		Example: "doc schema put -p <project-id> -t <type> --meta <meta-schema-file> --content <content-schema-file>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			req := &v1.PutDocumentSchemaRequest{ProjectId: projectID, Type: docType}
+			if metaFile != "" {
+				data, err := os.ReadFile(metaFile)
+				if err != nil {
+					logrus.Error(err)
+					return
+				}
+				req.MetaSchema = string(data)
+			}
+			if contentFile != "" {
+				data, err := os.ReadFile(contentFile)
+				if err != nil {
+					logrus.Error(err)
+					return
+				}
+				req.ContentSchema = string(data)
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			res, err := client.PutDocumentSchema(tokenContext(), req)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			color.Green("saved the schemas of type %s", res.Schema.Type)
+		},
+	}
+
+	command.Flags().StringVarP(&projectID, "project-id", "p", "", "project id (required)")
+	command.Flags().StringVarP(&docType, "type", "t", "", "document type, the type field of the meta (required)")
+	command.Flags().StringVar(&metaFile, "meta", "", "file with the JSON Schema of the meta")
+	command.Flags().StringVar(&contentFile, "content", "", "file with the JSON Schema of the content")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func getSchemaCmd() *cobra.Command {
+	var projectID string
+	var docType string
+
+	var required = []string{"project-id", "type"}
+
+	command := &cobra.Command{
+		Use:     "get",
+		Short:   "print the schemas of a document type",
+		Example: "doc schema get -p <project-id> -t <type>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			res, err := client.GetDocumentSchema(tokenContext(), &v1.GetDocumentSchemaRequest{ProjectId: projectID, Type: docType})
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			printField("Type", res.Schema.Type)
+			printField("Meta Schema", res.Schema.MetaSchema)
+			printField("Content Schema", res.Schema.ContentSchema)
+		},
+	}
+
+	command.Flags().StringVarP(&projectID, "project-id", "p", "", "project id (required)")
+	command.Flags().StringVarP(&docType, "type", "t", "", "document type (required)")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func listSchemasCmd() *cobra.Command {
+	var projectID string
+
+	var required = []string{"project-id"}
+
+	command := &cobra.Command{
+		Use:     "list",
+		Short:   "list the document types with schemas",
+		Example: "doc schema list -p <project-id>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			res, err := client.ListDocumentSchemas(tokenContext(), &v1.ListDocumentSchemasRequest{ProjectId: projectID})
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"Type", "Meta Schema", "Content Schema", "Updated At"})
+			for _, schema := range res.Schemas {
+				table.Append([]string{
+					schema.Type,
+					strconv.FormatBool(schema.MetaSchema != ""),
+					strconv.FormatBool(schema.ContentSchema != ""),
+					schema.UpdatedAt.AsTime().String(),
+				})
+			}
+			table.Render()
+		},
+	}
+
+	command.Flags().StringVarP(&projectID, "project-id", "p", "", "project id (required)")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func deleteSchemaCmd() *cobra.Command {
+	var projectID string
+	var docType string
+
+	var required = []string{"project-id", "type"}
+
+	command := &cobra.Command{
+		Use:     "delete",
+		Short:   "delete the schemas of a document type",
+		Example: "doc schema delete -p <project-id> -t <type>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			_, err = client.DeleteDocumentSchema(tokenContext(), &v1.DeleteDocumentSchemaRequest{ProjectId: projectID, Type: docType})
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			color.Green("deleted the schemas of type %s", docType)
+		},
+	}
+
+	command.Flags().StringVarP(&projectID, "project-id", "p", "", "project id (required)")
+	command.Flags().StringVarP(&docType, "type", "t", "", "document type (required)")
+	command.Flags().SortFlags = false
+
+	return command
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/emrgen/document"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"os"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	rootCmd.AddCommand(searchDocCmd())
+}
+
+func searchDocCmd() *cobra.Command {
+	var projectID string
+	var kind string
+	var tags []string
+	var page int32
+	var perPage int32
+
+	command := &cobra.Command{
+		Use:     "search <query>",
+		Short:   "search documents",
+		Example: "doc search -p <project-id> -k published -t guide \"getting started\"",
+		Args:    cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			kindValue, ok := v1.SearchKind_value["SEARCH_"+strings.ToUpper(kind)]
+			if !ok {
+				color.Red("invalid kind, expected all, draft or published")
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			req := &v1.SearchDocumentsRequest{
+				Query:   strings.Join(args, " "),
+				Kind:    v1.SearchKind(kindValue),
+				Tags:    tags,
+				Page:    page,
+				PerPage: perPage,
+			}
+			if projectID != "" {
+				req.ProjectId = &projectID
+			}
+
+			res, err := client.SearchDocuments(tokenContext(), req)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			if len(res.Hits) == 0 {
+				logrus.Infof("no documents found")
+				return
+			}
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"ID", "Kind", "Version", "Title", "Snippet"})
+			for _, hit := range res.Hits {
+				hitKind := strings.ToLower(strings.TrimPrefix(hit.Kind.String(), "SEARCH_"))
+				table.Append([]string{hit.DocumentId, hitKind, hit.Version, hit.Title, highlightTerms(hit.Snippet)})
+			}
+			table.Render()
+			fmt.Printf("total: %d\n", res.Total)
+		},
+	}
+
+	command.Flags().StringVarP(&projectID, "project-id", "p", "", "project id")
+	command.Flags().StringVarP(&kind, "kind", "k", "all", "document kind, all, draft or published")
+	command.Flags().StringSliceVarP(&tags, "tags", "t", nil, "tags the documents must have")
+	command.Flags().Int32Var(&page, "page", 1, "page number")
+	command.Flags().Int32Var(&perPage, "per-page", 20, "number of documents per page")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+var markPattern = regexp.MustCompile(`<mark>(.*?)</mark>`)
+
+// highlightTerms shows the highlighted terms in color instead of the <mark> tags
+func highlightTerms(s string) string {
+	return markPattern.ReplaceAllStringFunc(s, func(mark string) string {
+		return color.YellowString(markPattern.FindStringSubmatch(mark)[1])
+	})
+}
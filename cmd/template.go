@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"github.com/emrgen/document"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"os"
+	"strconv"
+)
+
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "manage the document templates",
+}
+
+func init() {
+	rootCmd.AddCommand(templateCmd)
+	templateCmd.SetHelpCommand(&cobra.Command{Use: "no-help", Hidden: true})
+	templateCmd.AddCommand(listTemplatesCmd())
+	templateCmd.AddCommand(instantiateTemplateCmd())
+}
+
+func listTemplatesCmd() *cobra.Command {
+	var projectID string
+
+	var required = []string{"project-id"}
+
+	command := &cobra.Command{
+		Use:     "list",
+		Short:   "list the templates of a project",
+		Example: "doc template list -p <project-id>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			res, err := client.ListDocuments(tokenContext(), &v1.ListDocumentsRequest{ProjectId: projectID, Templates: true})
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"ID", "Title", "Version", "Children"})
+			for _, doc := range res.Documents {
+				table.Append([]string{doc.Id, getTitle(doc.Meta), strconv.FormatInt(doc.Version, 10), strconv.Itoa(len(doc.Children))})
+			}
+			table.Render()
+		},
+	}
+
+	command.Flags().StringVarP(&projectID, "project-id", "p", "", "project id (required)")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func instantiateTemplateCmd() *cobra.Command {
+	var templateID string
+	var projectID string
+	var parentID string
+	var variables map[string]string
+	var children bool
+
+	var required = []string{"template-id"}
+
+	command := &cobra.Command{
+		Use:     "instantiate",
+		Short:   "create a document from a template, the {{name}} placeholders are filled from the variables",
+		Example: "doc template instantiate -t <template-id> --var title=Spec --var owner=me --children",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			req := &v1.InstantiateTemplateRequest{
+				TemplateId:   templateID,
+				Variables:    variables,
+				WithChildren: children,
+			}
+			if projectID != "" {
+				req.ProjectId = &projectID
+			}
+			if parentID != "" {
+				req.ParentId = &parentID
+			}
+
+			res, err := client.InstantiateTemplate(tokenContext(), req)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			color.Green("document created with id: %s", res.Document.Id)
+		},
+	}
+
+	command.Flags().StringVarP(&templateID, "template-id", "t", "", "template document id (required)")
+	command.Flags().StringToStringVar(&variables, "var", nil, "template variables as name=value")
+	command.Flags().BoolVar(&children, "children", false, "also instantiate the documents under the template")
+	command.Flags().StringVarP(&projectID, "project-id", "p", "", "project of the new document, the template project if empty")
+	command.Flags().StringVar(&parentID, "parent", "", "document the new document is added to as a child")
+	command.Flags().SortFlags = false
+
+	return command
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/emrgen/document"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"os"
+	"strconv"
+	"time"
+)
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "manage the deleted documents",
+}
+
+func init() {
+	rootCmd.AddCommand(trashCmd)
+	trashCmd.SetHelpCommand(&cobra.Command{Use: "no-help", Hidden: true})
+	trashCmd.AddCommand(listTrashCmd())
+	trashCmd.AddCommand(restoreTrashCmd())
+	trashCmd.AddCommand(emptyTrashCmd())
+}
+
+func listTrashCmd() *cobra.Command {
+	var projectID string
+
+	var required = []string{"project-id"}
+
+	command := &cobra.Command{
+		Use:     "list",
+		Short:   "list the deleted documents of a project",
+		Example: "doc trash list -p <project-id>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			res, err := client.ListDeletedDocuments(tokenContext(), &v1.ListDeletedDocumentsRequest{ProjectId: projectID})
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			if len(res.Documents) == 0 {
+				logrus.Infof("trash is empty")
+				return
+			}
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"ID", "Title", "Version", "Deleted At"})
+			for _, doc := range res.Documents {
+				table.Append([]string{doc.Id, getTitle(doc.Meta), strconv.FormatInt(doc.Version, 10), doc.DeletedAt.AsTime().Local().Format(time.RFC822)})
+			}
+			table.Render()
+		},
+	}
+
+	command.Flags().StringVarP(&projectID, "project-id", "p", "", "project id (required)")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func restoreTrashCmd() *cobra.Command {
+	var docID string
+
+	var required = []string{"doc-id"}
+
+	command := &cobra.Command{
+		Use:     "restore",
+		Short:   "restore a deleted document",
+		Example: "doc trash restore -d <doc-id>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			res, err := client.UndeleteDocument(tokenContext(), &v1.UndeleteDocumentRequest{Id: docID})
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			color.Green("restored %s", res.Document.Id)
+		},
+	}
+
+	command.Flags().StringVarP(&docID, "doc-id", "d", "", "document id (required)")
+	command.Flags().SortFlags = false
+
+	return command
+}
+
+func emptyTrashCmd() *cobra.Command {
+	var projectID string
+
+	var required = []string{"project-id"}
+
+	command := &cobra.Command{
+		Use:     "empty",
+		Short:   "erase all the deleted documents of a project",
+		Example: "doc trash empty -p <project-id>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkMissingFlags(cmd, required) {
+				return
+			}
+
+			client, err := document.NewClient("4020")
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			defer client.Close()
+
+			res, err := client.ListDeletedDocuments(tokenContext(), &v1.ListDeletedDocumentsRequest{ProjectId: projectID})
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+
+			erased := 0
+			for _, doc := range res.Documents {
+				_, err := client.EraseDocument(tokenContext(), &v1.EraseDocumentRequest{Id: doc.Id})
+				if err != nil {
+					logrus.Errorf("error erasing %s: %v", doc.Id, err)
+					continue
+				}
+				erased++
+			}
+
+			fmt.Printf("erased %d/%d documents\n", erased, len(res.Documents))
+		},
+	}
+
+	command.Flags().StringVarP(&projectID, "project-id", "p", "", "project id (required)")
+	command.Flags().SortFlags = false
+
+	return command
+}
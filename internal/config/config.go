@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strconv"
 )
 
 // config package is used to load the configuration from the environment variables
@@ -17,10 +18,13 @@ const (
 	Testing     Environment = "testing"
 )
 
+// ObjectStoreConfig selects where the attachments are kept: local (default) under the path or s3 in the bucket
 type ObjectStoreConfig struct {
 	StoreType string
+	Path      string
 	Bucket    string
 	Endpoint  string
+	Region    string
 	AccessKey string
 	SecretKey string
 }
@@ -30,10 +34,31 @@ type DbConfig struct {
 	ConnectionString string `json:"connection_string"`
 }
 
+// SearchConfig selects the search index backend: sqlite (default), meilisearch or none
+type SearchConfig struct {
+	Backend           string
+	SqlitePath        string
+	MeilisearchURL    string
+	MeilisearchAPIKey string
+}
+
+// TrashConfig is the retention of the soft deleted documents, 0 keeps them until the trash is emptied
+type TrashConfig struct {
+	RetentionDays int
+}
+
+// IdempotencyConfig is how long the responses of the requests sent with an idempotency key are replayed
+type IdempotencyConfig struct {
+	TTLHours int
+}
+
 type Config struct {
 	Environment       string `json:"environment"`
 	DbConfig          DbConfig
 	ObjectStoreConfig ObjectStoreConfig
+	SearchConfig      SearchConfig
+	TrashConfig       TrashConfig
+	IdempotencyConfig IdempotencyConfig
 }
 
 var AppConfig *Config
@@ -75,12 +100,65 @@ func LoadConfig() *Config {
 		panic("DB_CONNECTION_STRING is not set")
 	}
 
+	// load search config, search is disabled unless a backend is selected
+	SearchBackend := os.Getenv("SEARCH_BACKEND")
+	if SearchBackend == "" {
+		SearchBackend = "none"
+	}
+
+	// load object store config
+	ObjectStoreType := os.Getenv("OBJECT_STORE_TYPE")
+	if ObjectStoreType == "" {
+		ObjectStoreType = "local"
+	}
+
+	// load trash config, the deleted documents are kept until an operator sets a retention
+	RetentionDays := 0
+	if days := os.Getenv("TRASH_RETENTION_DAYS"); days != "" {
+		value, err := strconv.Atoi(days)
+		if err != nil || value < 0 {
+			panic("TRASH_RETENTION_DAYS must be a number of days")
+		}
+		RetentionDays = value
+	}
+
+	// load idempotency config
+	IdempotencyTTLHours := 24
+	if hours := os.Getenv("IDEMPOTENCY_KEY_TTL_HOURS"); hours != "" {
+		value, err := strconv.Atoi(hours)
+		if err != nil || value <= 0 {
+			panic("IDEMPOTENCY_KEY_TTL_HOURS must be a positive number of hours")
+		}
+		IdempotencyTTLHours = value
+	}
+
 	AppConfig = &Config{
 		Environment: Env,
 		DbConfig: DbConfig{
 			Type:             DbType,
 			ConnectionString: DbConnString,
 		},
+		ObjectStoreConfig: ObjectStoreConfig{
+			StoreType: ObjectStoreType,
+			Path:      os.Getenv("OBJECT_STORE_PATH"),
+			Bucket:    os.Getenv("OBJECT_STORE_BUCKET"),
+			Endpoint:  os.Getenv("OBJECT_STORE_ENDPOINT"),
+			Region:    os.Getenv("OBJECT_STORE_REGION"),
+			AccessKey: os.Getenv("OBJECT_STORE_ACCESS_KEY"),
+			SecretKey: os.Getenv("OBJECT_STORE_SECRET_KEY"),
+		},
+		SearchConfig: SearchConfig{
+			Backend:           SearchBackend,
+			SqlitePath:        os.Getenv("SEARCH_SQLITE_PATH"),
+			MeilisearchURL:    os.Getenv("MEILISEARCH_URL"),
+			MeilisearchAPIKey: os.Getenv("MEILISEARCH_API_KEY"),
+		},
+		TrashConfig: TrashConfig{
+			RetentionDays: RetentionDays,
+		},
+		IdempotencyConfig: IdempotencyConfig{
+			TTLHours: IdempotencyTTLHours,
+		},
 	}
 
 	return AppConfig
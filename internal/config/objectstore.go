@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"github.com/emrgen/document/internal/objectstore"
+)
+
+// GetObjectStore creates the object store selected by the object store config
+func GetObjectStore(config *Config) objectstore.ObjectStore {
+	var store objectstore.ObjectStore
+	var err error
+
+	switch config.ObjectStoreConfig.StoreType {
+	case "local":
+		path := config.ObjectStoreConfig.Path
+		if path == "" {
+			path = ".tmp/objects"
+		}
+		store, err = objectstore.NewFileObjectStore(path)
+	case "s3":
+		cnf := config.ObjectStoreConfig
+		if cnf.Endpoint == "" {
+			panic("OBJECT_STORE_ENDPOINT is not set")
+		}
+		store, err = objectstore.NewS3ObjectStore(cnf.Endpoint, cnf.Bucket, cnf.Region, cnf.AccessKey, cnf.SecretKey)
+	default:
+		err = fmt.Errorf("unknown OBJECT_STORE_TYPE: %s", config.ObjectStoreConfig.StoreType)
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	return store
+}
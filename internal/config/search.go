@@ -0,0 +1,39 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"github.com/emrgen/document/internal/search"
+	"github.com/sirupsen/logrus"
+)
+
+// GetSearchIndex creates the search index selected by the search config
+func GetSearchIndex(config *Config) search.Index {
+	var index search.Index
+	var err error
+
+	switch config.SearchConfig.Backend {
+	case "meilisearch":
+		if config.SearchConfig.MeilisearchURL == "" {
+			panic("MEILISEARCH_URL is not set")
+		}
+		index, err = search.NewMeilisearch(context.Background(), config.SearchConfig.MeilisearchURL, config.SearchConfig.MeilisearchAPIKey)
+	case "sqlite":
+		filePath := config.SearchConfig.SqlitePath
+		if filePath == "" {
+			filePath = ".tmp/db/_search.db"
+		}
+		index, err = search.NewSqlite(filePath)
+	case "none":
+		logrus.Warn("search is disabled, SearchDocuments returns no results")
+		index = search.NewNop()
+	default:
+		err = fmt.Errorf("unknown SEARCH_BACKEND: %s", config.SearchConfig.Backend)
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	return index
+}
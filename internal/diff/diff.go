@@ -0,0 +1,74 @@
+package diff
+
+import "strings"
+
+// Summary is the number of lines added and removed between two texts
+type Summary struct {
+	Added   int
+	Removed int
+}
+
+// Changed returns true if any line is added or removed
+func (s Summary) Changed() bool {
+	return s.Added > 0 || s.Removed > 0
+}
+
+// Lines summarizes the line changes needed to turn a into b.
+func Lines(a, b string) Summary {
+	return sequences(splitLines(a), splitLines(b))
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, "\n")
+}
+
+// sequences finds the length of the shortest edit script using the greedy Myers algorithm.
+// Only the edit distance is tracked, which is enough to count the added and removed lines.
+func sequences(a, b []string) Summary {
+	// the common prefix and suffix do not change the edit distance
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return Summary{}
+	}
+
+	offset := max
+	v := make([]int, 2*max+2)
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return Summary{
+					Added:   (d - n + m) / 2,
+					Removed: (d + n - m) / 2,
+				}
+			}
+		}
+	}
+
+	return Summary{Added: m, Removed: n}
+}
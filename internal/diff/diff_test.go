@@ -0,0 +1,31 @@
+package diff
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want Summary
+	}{
+		{name: "empty", a: "", b: "", want: Summary{}},
+		{name: "same", a: "a\nb\nc", b: "a\nb\nc", want: Summary{}},
+		{name: "added", a: "", b: "a\nb", want: Summary{Added: 2}},
+		{name: "removed", a: "a\nb", b: "", want: Summary{Removed: 2}},
+		{name: "insert in the middle", a: "a\nc", b: "a\nb\nc", want: Summary{Added: 1}},
+		{name: "replace a line", a: "a\nb\nc", b: "a\nx\nc", want: Summary{Added: 1, Removed: 1}},
+		{name: "reorder", a: "a\nb\nc\nd", b: "b\na\nd\nc", want: Summary{Added: 2, Removed: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lines(tt.a, tt.b)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.want.Changed(), got.Changed())
+		})
+	}
+}
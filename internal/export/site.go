@@ -0,0 +1,261 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/yuin/goldmark"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Format is the output format of an exported site
+type Format string
+
+const (
+	Markdown Format = "markdown"
+	HTML     Format = "html"
+)
+
+// Ext returns the file extension of the pages in the format
+func (f Format) Ext() string {
+	if f == HTML {
+		return ".html"
+	}
+
+	return ".md"
+}
+
+// Page is a published document rendered as one file of the site
+type Page struct {
+	ID      string
+	Version string
+	Title   string
+	Content string
+}
+
+// NavNode is an entry of the site navigation
+type NavNode struct {
+	ID       string     `json:"id"`
+	Title    string     `json:"title"`
+	Children []*NavNode `json:"children"`
+}
+
+// pageID returns the page file name of the node, the node id may be a versioned <id>@<version> link
+func (n *NavNode) pageID() string {
+	id, _, _ := strings.Cut(n.ID, "@")
+	return strings.ToLower(id)
+}
+
+// Site is a published document tree exported to static files
+type Site struct {
+	Title string
+	Pages []*Page
+	Nav   []*NavNode
+}
+
+// ParseIndex parses the navigation from a document tree index.
+// The index is either a single node or a list of nodes, each node is {"id", "title", "children"}.
+func ParseIndex(content string) ([]*NavNode, error) {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "[") {
+		var nodes []*NavNode
+		if err := json.Unmarshal([]byte(content), &nodes); err != nil {
+			return nil, err
+		}
+		return nodes, nil
+	}
+
+	var node NavNode
+	if err := json.Unmarshal([]byte(content), &node); err != nil {
+		return nil, err
+	}
+	if node.ID == "" && len(node.Children) == 0 {
+		return nil, fmt.Errorf("tree index has no navigation")
+	}
+
+	return []*NavNode{&node}, nil
+}
+
+// linkPattern matches a versioned document link <id>@<version>
+var linkPattern = regexp.MustCompile(`([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})@[0-9A-Za-z]+(?:[.+\-][0-9A-Za-z]+)*`)
+
+// RewriteLinks replaces the <id>@<version> links to the pages of the site with relative urls.
+// Links to documents outside the site are left as they are.
+func (s *Site) RewriteLinks(content string, format Format) string {
+	pages := make(map[string]bool)
+	for _, page := range s.Pages {
+		pages[strings.ToLower(page.ID)] = true
+	}
+
+	return linkPattern.ReplaceAllStringFunc(content, func(link string) string {
+		id := strings.ToLower(linkPattern.FindStringSubmatch(link)[1])
+		if !pages[id] {
+			return link
+		}
+		return "./" + id + format.Ext()
+	})
+}
+
+// WriteZip writes the site as a zip archive with one file per page and an index file with the navigation.
+func (s *Site) WriteZip(w io.Writer, format Format) error {
+	if format != Markdown && format != HTML {
+		return fmt.Errorf("unsupported export format: %s", format)
+	}
+
+	titles := make(map[string]string)
+	for _, page := range s.Pages {
+		titles[strings.ToLower(page.ID)] = page.Title
+	}
+
+	archive := zip.NewWriter(w)
+	for _, page := range s.Pages {
+		data, err := s.renderPage(page, format, titles)
+		if err != nil {
+			return err
+		}
+
+		file, err := archive.Create(strings.ToLower(page.ID) + format.Ext())
+		if err != nil {
+			return err
+		}
+		if _, err = file.Write(data); err != nil {
+			return err
+		}
+	}
+
+	file, err := archive.Create("index" + format.Ext())
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(s.renderIndex(format, titles)); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func (s *Site) renderPage(page *Page, format Format, titles map[string]string) ([]byte, error) {
+	content := s.RewriteLinks(page.Content, format)
+
+	if format == Markdown {
+		var buf bytes.Buffer
+		buf.WriteString("---\n")
+		fmt.Fprintf(&buf, "id: %s\n", page.ID)
+		fmt.Fprintf(&buf, "version: %s\n", page.Version)
+		if page.Title != "" {
+			fmt.Fprintf(&buf, "title: %q\n", page.Title)
+		}
+		buf.WriteString("---\n\n")
+		buf.WriteString(content)
+		return buf.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	if err := goldmark.Convert([]byte(content), &body); err != nil {
+		return nil, err
+	}
+
+	return htmlDocument(pageTitle(page.Title, page.ID), s.renderNavHTML(titles), body.String()), nil
+}
+
+func (s *Site) renderIndex(format Format, titles map[string]string) []byte {
+	if format == Markdown {
+		var buf bytes.Buffer
+		if s.Title != "" {
+			fmt.Fprintf(&buf, "# %s\n\n", s.Title)
+		}
+		writeNavMarkdown(&buf, s.nav(), titles, 0)
+		return buf.Bytes()
+	}
+
+	return htmlDocument(pageTitle(s.Title, "Index"), s.renderNavHTML(titles), "")
+}
+
+// nav returns the site navigation, a flat list of the pages is used when the site has no navigation
+func (s *Site) nav() []*NavNode {
+	if len(s.Nav) > 0 {
+		return s.Nav
+	}
+
+	nodes := make([]*NavNode, 0, len(s.Pages))
+	for _, page := range s.Pages {
+		nodes = append(nodes, &NavNode{ID: page.ID, Title: page.Title})
+	}
+
+	return nodes
+}
+
+func writeNavMarkdown(buf *bytes.Buffer, nodes []*NavNode, titles map[string]string, depth int) {
+	for _, node := range nodes {
+		id := node.pageID()
+		title, ok := titles[id]
+		if node.Title != "" {
+			title = node.Title
+		}
+		title = pageTitle(title, node.ID)
+
+		buf.WriteString(strings.Repeat("  ", depth))
+		if ok {
+			fmt.Fprintf(buf, "- [%s](./%s%s)\n", title, id, Markdown.Ext())
+		} else {
+			fmt.Fprintf(buf, "- %s\n", title)
+		}
+		writeNavMarkdown(buf, node.Children, titles, depth+1)
+	}
+}
+
+func (s *Site) renderNavHTML(titles map[string]string) string {
+	var buf bytes.Buffer
+	writeNavHTML(&buf, s.nav(), titles)
+	return buf.String()
+}
+
+func writeNavHTML(buf *bytes.Buffer, nodes []*NavNode, titles map[string]string) {
+	if len(nodes) == 0 {
+		return
+	}
+
+	buf.WriteString("<ul>")
+	for _, node := range nodes {
+		id := node.pageID()
+		title, ok := titles[id]
+		if node.Title != "" {
+			title = node.Title
+		}
+		title = html.EscapeString(pageTitle(title, node.ID))
+
+		buf.WriteString("<li>")
+		if ok {
+			fmt.Fprintf(buf, `<a href="./%s%s">%s</a>`, html.EscapeString(id), HTML.Ext(), title)
+		} else {
+			buf.WriteString(title)
+		}
+		writeNavHTML(buf, node.Children, titles)
+		buf.WriteString("</li>")
+	}
+	buf.WriteString("</ul>")
+}
+
+func htmlDocument(title, nav, body string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&buf, "<title>%s</title>\n", html.EscapeString(title))
+	buf.WriteString("</head>\n<body>\n")
+	fmt.Fprintf(&buf, "<nav>%s</nav>\n", nav)
+	fmt.Fprintf(&buf, "<main>\n%s</main>\n", body)
+	buf.WriteString("</body>\n</html>\n")
+	return buf.Bytes()
+}
+
+// pageTitle falls back to the given name when the title is empty
+func pageTitle(title, fallback string) string {
+	if title == "" {
+		return fallback
+	}
+
+	return title
+}
@@ -0,0 +1,88 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+const (
+	rootID  = "0b8a5c3e-6a3f-4d4c-9a57-1f8e2b6a9c01"
+	childID = "5d2f7e91-3c4b-4a8e-b1d6-7e9f0a2b3c4d"
+	otherID = "9e8d7c6b-5a49-4838-a726-15f4e3d2c1b0"
+)
+
+func testSite() *Site {
+	return &Site{
+		Title: "Book",
+		Pages: []*Page{
+			{ID: rootID, Version: "1.0.0", Title: "Book", Content: "# Book\n\nSee [chapter](" + childID + "@1.0.0)."},
+			{ID: childID, Version: "1.0.0", Title: "Chapter", Content: "Back to [book](" + rootID + "@latest), see " + otherID + "@2.0.0"},
+		},
+		Nav: []*NavNode{{ID: rootID, Children: []*NavNode{{ID: childID + "@1.0.0", Title: "Chapter One"}}}},
+	}
+}
+
+func readZip(t *testing.T, data []byte) map[string]string {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+
+	files := make(map[string]string)
+	for _, file := range reader.File {
+		r, err := file.Open()
+		assert.NoError(t, err)
+		content, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		files[file.Name] = string(content)
+	}
+
+	return files
+}
+
+func TestParseIndex(t *testing.T) {
+	nodes, err := ParseIndex(`{"id": "` + rootID + `", "children": [{"id": "` + childID + `", "title": "Chapter"}]}`)
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 1)
+	assert.Equal(t, rootID, nodes[0].ID)
+	assert.Equal(t, "Chapter", nodes[0].Children[0].Title)
+
+	nodes, err = ParseIndex(`[{"id": "` + rootID + `"}, {"id": "` + childID + `"}]`)
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 2)
+
+	_, err = ParseIndex("chapter one, chapter two")
+	assert.Error(t, err)
+	_, err = ParseIndex("{}")
+	assert.Error(t, err)
+}
+
+func TestSite_WriteZipMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	err := testSite().WriteZip(&buf, Markdown)
+	assert.NoError(t, err)
+
+	files := readZip(t, buf.Bytes())
+	assert.Len(t, files, 3)
+	assert.Contains(t, files[rootID+".md"], "title: \"Book\"")
+	assert.Contains(t, files[rootID+".md"], "See [chapter](./"+childID+".md).")
+	// links outside the site are not rewritten
+	assert.Contains(t, files[childID+".md"], "see "+otherID+"@2.0.0")
+	assert.Contains(t, files["index.md"], "- [Book](./"+rootID+".md)\n  - [Chapter One](./"+childID+".md)\n")
+}
+
+func TestSite_WriteZipHTML(t *testing.T) {
+	var buf bytes.Buffer
+	err := testSite().WriteZip(&buf, HTML)
+	assert.NoError(t, err)
+
+	files := readZip(t, buf.Bytes())
+	assert.Len(t, files, 3)
+	assert.Contains(t, files[rootID+".html"], `<a href="./`+childID+`.html">chapter</a>`)
+	assert.Contains(t, files[childID+".html"], "<title>Chapter</title>")
+	assert.Contains(t, files["index.html"], `<a href="./`+childID+`.html">Chapter One</a>`)
+
+	err = testSite().WriteZip(&buf, Format("pdf"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,97 @@
+package job
+
+import (
+	"context"
+	goset "github.com/deckarep/golang-set/v2"
+	"github.com/emrgen/document/internal/store"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// pendingLinkBatch is the number of pending links processed in one transaction
+const pendingLinkBatch = 500
+
+// BacklinkReconciler is a job that keeps the backlink count of the documents in sync with the links table.
+// New links are created pending, the reconciler recounts the backlinks of their targets and clears the pending flag.
+// Deleted links leave nothing pending behind, the stale counts are recounted on a slower interval.
+type BacklinkReconciler struct {
+	store store.Store
+	done  chan struct{}
+}
+
+// NewBacklinkReconciler creates a new BacklinkReconciler instance.
+func NewBacklinkReconciler(store store.Store) *BacklinkReconciler {
+	return &BacklinkReconciler{
+		store: store,
+		done:  make(chan struct{}),
+	}
+}
+
+func (r *BacklinkReconciler) Stop() {
+	close(r.done)
+}
+
+func (r *BacklinkReconciler) Run() {
+	ticker := time.NewTicker(5 * time.Second)
+	staleTicker := time.NewTicker(time.Minute)
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.reconcilePending(context.TODO())
+		case <-staleTicker.C:
+			r.reconcileStale(context.TODO())
+		}
+	}
+}
+
+// reconcilePending processes the pending links batch by batch until none is left
+func (r *BacklinkReconciler) reconcilePending(ctx context.Context) {
+	for {
+		links, err := r.store.ListPendingLinks(ctx, pendingLinkBatch)
+		if err != nil {
+			logrus.Error("Error getting the pending links: ", err)
+			return
+		}
+		if len(links) == 0 {
+			return
+		}
+
+		targets := goset.NewSet[string]()
+		for _, link := range links {
+			targets.Add(link.TargetID)
+		}
+
+		err = r.store.Transaction(ctx, func(tx store.Store) error {
+			if err := tx.UpdateBacklinkCounts(ctx, targets.ToSlice()); err != nil {
+				return err
+			}
+
+			return tx.ClearPendingLinks(ctx, links)
+		})
+		if err != nil {
+			logrus.Error("Error updating the backlink counts: ", err)
+			return
+		}
+
+		logrus.Infof("Updated the backlink count of %d documents", targets.Cardinality())
+		if len(links) < pendingLinkBatch {
+			return
+		}
+	}
+}
+
+// reconcileStale recounts the documents that lost backlinks
+func (r *BacklinkReconciler) reconcileStale(ctx context.Context) {
+	updated, err := r.store.UpdateStaleBacklinkCounts(ctx)
+	if err != nil {
+		logrus.Error("Error updating the stale backlink counts: ", err)
+		return
+	}
+
+	if updated > 0 {
+		logrus.Infof("Updated the stale backlink count of %d documents", updated)
+	}
+}
@@ -0,0 +1,53 @@
+package job
+
+import (
+	"context"
+	"github.com/emrgen/document/internal/store"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// IdempotencyKeyCleaner is a job that deletes the expired idempotency keys with their responses.
+// An expired key is not replayed even before it is deleted.
+type IdempotencyKeyCleaner struct {
+	store store.Store
+	done  chan struct{}
+}
+
+// NewIdempotencyKeyCleaner creates a new IdempotencyKeyCleaner instance.
+func NewIdempotencyKeyCleaner(store store.Store) *IdempotencyKeyCleaner {
+	return &IdempotencyKeyCleaner{
+		store: store,
+		done:  make(chan struct{}),
+	}
+}
+
+func (c *IdempotencyKeyCleaner) Stop() {
+	close(c.done)
+}
+
+func (c *IdempotencyKeyCleaner) Run() {
+	ticker := time.NewTicker(time.Hour)
+
+	c.clean()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.clean()
+		}
+	}
+}
+
+// clean deletes the keys that expired
+func (c *IdempotencyKeyCleaner) clean() {
+	deleted, err := c.store.DeleteExpiredIdempotencyKeys(context.TODO(), time.Now())
+	if err != nil {
+		logrus.Error("Error deleting the expired idempotency keys: ", err)
+		return
+	}
+	if deleted != 0 {
+		logrus.Infof("Deleted %d expired idempotency keys", deleted)
+	}
+}
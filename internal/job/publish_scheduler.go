@@ -0,0 +1,142 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/store"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// publishScheduleLease is how long a schedule may run, a schedule running for longer was lost by a stopped scheduler
+const publishScheduleLease = 15 * time.Minute
+
+// PublishScheduler is a job that publishes the document sets whose schedule is due.
+type PublishScheduler struct {
+	store store.Store
+	docs  v1.DocumentServiceServer
+	done  chan struct{}
+}
+
+// NewPublishScheduler creates a new PublishScheduler instance.
+func NewPublishScheduler(store store.Store, docs v1.DocumentServiceServer) *PublishScheduler {
+	return &PublishScheduler{
+		store: store,
+		docs:  docs,
+		done:  make(chan struct{}),
+	}
+}
+
+func (s *PublishScheduler) Stop() {
+	close(s.done)
+}
+
+func (s *PublishScheduler) Run() {
+	ticker := time.NewTicker(10 * time.Second)
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.publish()
+		}
+	}
+}
+
+// publish runs all the schedules due by now
+func (s *PublishScheduler) publish() {
+	ctx := context.TODO()
+
+	// the publish runs in a transaction but the lost run might have committed it, so it is failed rather than run again
+	failed, err := s.store.FailStalePublishSchedules(ctx, time.Now().Add(-publishScheduleLease), "the publish scheduler stopped while running the schedule, check the published versions before scheduling it again")
+	if err != nil {
+		logrus.Error("Error failing the stale publish schedules: ", err)
+	} else if failed > 0 {
+		logrus.Warnf("Failed %d stale publish schedules", failed)
+	}
+
+	schedules, err := s.store.ListDuePublishSchedules(ctx, time.Now())
+	if err != nil {
+		logrus.Error("Error getting the due publish schedules: ", err)
+		return
+	}
+
+	for _, schedule := range schedules {
+		s.run(ctx, schedule)
+	}
+}
+
+func (s *PublishScheduler) run(ctx context.Context, schedule *model.PublishSchedule) {
+	// claim the schedule, it might be cancelled or picked up by another instance.
+	// The claim time identifies the run when it finishes, it is stored at the microsecond precision of the databases
+	claimedAt := time.Now().UTC().Truncate(time.Microsecond)
+	claimed, err := s.store.ClaimPublishSchedule(ctx, uuid.MustParse(schedule.ID), claimedAt)
+	if err != nil {
+		logrus.Errorf("Error claiming the publish schedule %s: %v", schedule.ID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	schedule.Status = model.PublishScheduleRunning
+	schedule.ClaimedAt = &claimedAt
+
+	logrus.Infof("Running publish schedule %s", schedule.ID)
+
+	var audits []*model.PublishAudit
+	res, err := s.docs.PublishDocuments(ctx, publishRequest(schedule))
+	if err != nil {
+		schedule.Status = model.PublishScheduleFailed
+		schedule.Error = err.Error()
+	} else {
+		now := time.Now()
+		schedule.Status = model.PublishSchedulePublished
+		schedule.PublishedAt = &now
+
+		for _, doc := range res.Documents {
+			audits = append(audits, &model.PublishAudit{
+				ScheduleID: schedule.ID,
+				DocumentID: doc.Id,
+				Version:    doc.Version,
+			})
+		}
+	}
+
+	finished, err := s.store.FinishPublishSchedule(ctx, schedule, audits)
+	if err != nil {
+		logrus.Errorf("Error saving the publish schedule %s: %v", schedule.ID, err)
+		return
+	}
+	if !finished {
+		logrus.Warnf("Publish schedule %s ran past its lease, the outcome %s is not saved", schedule.ID, schedule.Status)
+		return
+	}
+
+	logrus.Infof("Publish schedule %s finished with status %s", schedule.ID, schedule.Status)
+}
+
+// publishRequest converts a schedule into a publish request
+func publishRequest(schedule *model.PublishSchedule) *v1.PublishDocumentsRequest {
+	var documentIDs []string
+	if err := json.Unmarshal([]byte(schedule.DocumentIDs), &documentIDs); err != nil {
+		logrus.Errorf("Error parsing the documents of publish schedule %s: %v", schedule.ID, err)
+	}
+
+	req := &v1.PublishDocumentsRequest{
+		RootDocumentId: schedule.RootDocumentID,
+		DocumentIds:    documentIDs,
+		Force:          schedule.Force,
+		Index:          schedule.Index,
+		StrictLinks:    schedule.StrictLinks,
+		Bump:           v1.VersionBump(v1.VersionBump_value[schedule.Bump]),
+	}
+	if schedule.Version != "" {
+		req.Version = &schedule.Version
+	}
+
+	return req
+}
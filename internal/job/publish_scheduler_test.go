@@ -0,0 +1,151 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/store"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakePublisher publishes the requested documents at version 1.0.0 or fails with err, publishing runs before the publish
+type fakePublisher struct {
+	v1.UnimplementedDocumentServiceServer
+	requests   []*v1.PublishDocumentsRequest
+	err        error
+	publishing func()
+}
+
+func (f *fakePublisher) PublishDocuments(ctx context.Context, request *v1.PublishDocumentsRequest) (*v1.PublishDocumentsResponse, error) {
+	f.requests = append(f.requests, request)
+	if f.publishing != nil {
+		f.publishing()
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	res := &v1.PublishDocumentsResponse{}
+	for _, id := range request.GetDocumentIds() {
+		res.Documents = append(res.Documents, &v1.PublishedDocument{Id: id, Version: "1.0.0"})
+	}
+	return res, nil
+}
+
+func newSchedule(t *testing.T, docStore store.Store, publishAt time.Time, docIDs ...string) *model.PublishSchedule {
+	documentIDs, err := json.Marshal(docIDs)
+	assert.NoError(t, err)
+
+	schedule := &model.PublishSchedule{
+		ID:          uuid.New().String(),
+		ProjectID:   uuid.New().String(),
+		DocumentIDs: string(documentIDs),
+		Bump:        v1.VersionBump_BUMP_PATCH.String(),
+		PublishAt:   publishAt,
+		Status:      model.PublishSchedulePending,
+	}
+	assert.NoError(t, docStore.CreatePublishSchedule(context.TODO(), schedule))
+	return schedule
+}
+
+func TestPublishScheduler(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "document.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, model.Migrate(db))
+
+	ctx := context.TODO()
+	docStore := store.NewGormStore(db)
+	docs := &fakePublisher{}
+	scheduler := NewPublishScheduler(docStore, docs)
+
+	docID := uuid.New().String()
+	due := newSchedule(t, docStore, time.Now().Add(-time.Minute), docID)
+	later := newSchedule(t, docStore, time.Now().Add(time.Hour), docID)
+	cancelled := newSchedule(t, docStore, time.Now().Add(-time.Minute), docID)
+	_, err = docStore.UpdatePublishScheduleStatus(ctx, uuid.MustParse(cancelled.ID), model.PublishSchedulePending, model.PublishScheduleCancelled)
+	assert.NoError(t, err)
+
+	// only the due pending schedule is published, with an audit of the published versions
+	scheduler.publish()
+	assert.Len(t, docs.requests, 1)
+	assert.Equal(t, []string{docID}, docs.requests[0].DocumentIds)
+
+	got, err := docStore.GetPublishSchedule(ctx, uuid.MustParse(due.ID))
+	assert.NoError(t, err)
+	assert.Equal(t, model.PublishSchedulePublished, got.Status)
+	assert.NotNil(t, got.ClaimedAt)
+	assert.NotNil(t, got.PublishedAt)
+	assert.Len(t, got.Audits, 1)
+	assert.Equal(t, docID, got.Audits[0].DocumentID)
+	assert.Equal(t, "1.0.0", got.Audits[0].Version)
+
+	got, err = docStore.GetPublishSchedule(ctx, uuid.MustParse(later.ID))
+	assert.NoError(t, err)
+	assert.Equal(t, model.PublishSchedulePending, got.Status)
+	got, err = docStore.GetPublishSchedule(ctx, uuid.MustParse(cancelled.ID))
+	assert.NoError(t, err)
+	assert.Equal(t, model.PublishScheduleCancelled, got.Status)
+
+	// a schedule claimed by another instance is not run twice
+	claimed := newSchedule(t, docStore, time.Now().Add(-time.Minute), docID)
+	ok, err := docStore.ClaimPublishSchedule(ctx, uuid.MustParse(claimed.ID), time.Now())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	scheduler.run(ctx, claimed)
+	assert.Len(t, docs.requests, 1)
+
+	// a failed publish is recorded with its error and without audits
+	docs.err = errors.New("document is locked")
+	failing := newSchedule(t, docStore, time.Now().Add(-time.Minute), docID)
+	scheduler.publish()
+	assert.Len(t, docs.requests, 2)
+
+	got, err = docStore.GetPublishSchedule(ctx, uuid.MustParse(failing.ID))
+	assert.NoError(t, err)
+	assert.Equal(t, model.PublishScheduleFailed, got.Status)
+	assert.Equal(t, "document is locked", got.Error)
+	assert.Nil(t, got.PublishedAt)
+	assert.Empty(t, got.Audits)
+
+	// a schedule left running by a stopped scheduler fails once its lease is over
+	stale := newSchedule(t, docStore, time.Now().Add(-time.Hour), docID)
+	ok, err = docStore.ClaimPublishSchedule(ctx, uuid.MustParse(stale.ID), time.Now().Add(-publishScheduleLease-time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	scheduler.publish()
+	assert.Len(t, docs.requests, 2)
+
+	got, err = docStore.GetPublishSchedule(ctx, uuid.MustParse(stale.ID))
+	assert.NoError(t, err)
+	assert.Equal(t, model.PublishScheduleFailed, got.Status)
+	assert.NotEmpty(t, got.Error)
+
+	got, err = docStore.GetPublishSchedule(ctx, uuid.MustParse(claimed.ID))
+	assert.NoError(t, err)
+	assert.Equal(t, model.PublishScheduleRunning, got.Status)
+
+	// a run failed for its lease while publishing does not overwrite the failure
+	docs.err = nil
+	slow := newSchedule(t, docStore, time.Now().Add(-time.Minute), docID)
+	docs.publishing = func() {
+		_, err := docStore.FailStalePublishSchedules(ctx, time.Now().Add(time.Minute), "lease is over")
+		assert.NoError(t, err)
+	}
+	scheduler.run(ctx, slow)
+	assert.Len(t, docs.requests, 3)
+
+	got, err = docStore.GetPublishSchedule(ctx, uuid.MustParse(slow.ID))
+	assert.NoError(t, err)
+	assert.Equal(t, model.PublishScheduleFailed, got.Status)
+	assert.Equal(t, "lease is over", got.Error)
+	assert.Nil(t, got.PublishedAt)
+	assert.Empty(t, got.Audits)
+}
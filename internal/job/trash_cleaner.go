@@ -0,0 +1,66 @@
+package job
+
+import (
+	"context"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/store"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// TrashCleaner is a job that erases the soft deleted documents once they are older than the retention.
+// The documents are erased through the document service so that the links, backups and tree indexes are erased too.
+type TrashCleaner struct {
+	store     store.Store
+	docs      v1.DocumentServiceServer
+	retention time.Duration
+	done      chan struct{}
+}
+
+// NewTrashCleaner creates a new TrashCleaner instance.
+func NewTrashCleaner(store store.Store, docs v1.DocumentServiceServer, retention time.Duration) *TrashCleaner {
+	return &TrashCleaner{
+		store:     store,
+		docs:      docs,
+		retention: retention,
+		done:      make(chan struct{}),
+	}
+}
+
+func (c *TrashCleaner) Stop() {
+	close(c.done)
+}
+
+func (c *TrashCleaner) Run() {
+	ticker := time.NewTicker(time.Hour)
+
+	c.clean()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.clean()
+		}
+	}
+}
+
+// clean erases the documents deleted before the retention
+func (c *TrashCleaner) clean() {
+	ctx := context.TODO()
+
+	docs, err := c.store.ListDocumentsDeletedBefore(ctx, time.Now().Add(-c.retention))
+	if err != nil {
+		logrus.Error("Error getting the expired deleted documents: ", err)
+		return
+	}
+
+	for _, doc := range docs {
+		_, err := c.docs.EraseDocument(ctx, &v1.EraseDocumentRequest{Id: doc.ID})
+		if err != nil {
+			logrus.Errorf("Error erasing the deleted document %s: %v", doc.ID, err)
+			continue
+		}
+		logrus.Infof("Erased the deleted document %s", doc.ID)
+	}
+}
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// Attachment is a binary file attached to a document, the bytes are kept in the object store under the object key.
+// The attachment belongs to the document versions from the added version until the removed version, 0 while it is attached.
+type Attachment struct {
+	ID             string `gorm:"primaryKey;uuid;not null"`
+	DocumentID     string `gorm:"uuid;not null;index:idx_attachments_document_id"`
+	Name           string `gorm:"not null"`
+	ContentType    string `gorm:"not null"`
+	Size           int64  `gorm:"not null"`
+	Checksum       string `gorm:"not null"`
+	ObjectKey      string `gorm:"not null"`
+	AddedVersion   int64  `gorm:"not null"`
+	RemovedVersion int64  `gorm:"not null;default:0"`
+	CreatedAt      time.Time
+}
+
+func (a *Attachment) TableName() string {
+	return "attachments"
+}
+
+// PublishedAttachment freezes an attachment into a published document version.
+type PublishedAttachment struct {
+	DocumentID   string `gorm:"primaryKey;uuid;not null"`
+	Version      string `gorm:"primaryKey;not null"`
+	AttachmentID string `gorm:"primaryKey;uuid;not null;index:idx_published_attachments_attachment_id"`
+}
+
+func (a *PublishedAttachment) TableName() string {
+	return "published_attachments"
+}
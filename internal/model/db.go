@@ -11,6 +11,10 @@ func Migrate(db *gorm.DB) error {
 		return err
 	}
 
+	if err := db.AutoMigrate(&DocumentIndex{}); err != nil {
+		return err
+	}
+
 	if err := db.AutoMigrate(&PublishedDocument{}); err != nil {
 		return err
 	}
@@ -35,5 +39,49 @@ func Migrate(db *gorm.DB) error {
 		return err
 	}
 
+	if err := db.AutoMigrate(&DocumentPart{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(&DocumentChild{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(&PublishedDocumentChild{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(&Attachment{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(&PublishedAttachment{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(&DocumentSchema{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(&PublishSchedule{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(&PublishAudit{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(&Release{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(&ReleaseMember{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(&IdempotencyKey{}); err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -13,9 +13,11 @@ type Document struct {
 	Content       string  `gorm:"not null"`
 	Parts         string  `gorm:"not null;default:[]"`
 	Children      string  `gorm:"not null;default:[]"`
+	ChildKeys     string  `gorm:"not null;default:[]"` // fractional index keys of the children, in the same order
 	Links         string  `gorm:"not null;default:{}"`
 	Backlinks     []*Link `gorm:"foreignKey:TargetID;references:ID"`
-	BacklinkCount int     // update trigger
+	BacklinkCount int     // updated by the backlink reconciler job from the pending links
+	Template      bool    `gorm:"not null;default:false"` // templates are copied with their placeholders filled
 	Kind          string  // markdown, html, json, etc.
 	Compression   string  // the compression algorithm used to compress the document content
 }
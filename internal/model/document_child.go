@@ -0,0 +1,25 @@
+package model
+
+// DocumentChild is a parent to child edge of the draft documents.
+// The edges mirror the children of the parent, so the parents of a document can be listed without scanning the children.
+type DocumentChild struct {
+	ParentID     string `gorm:"primaryKey;uuid;not null"`
+	ChildID      string `gorm:"primaryKey;uuid;not null;index:idx_document_children_child_id"`
+	ChildVersion string `gorm:"primaryKey;not null;default:current"`
+}
+
+func (c *DocumentChild) TableName() string {
+	return "document_children"
+}
+
+// PublishedDocumentChild is a parent to child edge of a published document version.
+type PublishedDocumentChild struct {
+	ParentID      string `gorm:"primaryKey;uuid;not null"`
+	ParentVersion string `gorm:"primaryKey;not null"`
+	ChildID       string `gorm:"primaryKey;uuid;not null;index:idx_published_document_children_child_id"`
+	ChildVersion  string `gorm:"primaryKey;not null;default:current"`
+}
+
+func (c *PublishedDocumentChild) TableName() string {
+	return "published_document_children"
+}
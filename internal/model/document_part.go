@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// DocumentPart is an independently versioned chunk of the content of a large document.
+// The parts are appended to the content of the document in the order of the document parts.
+type DocumentPart struct {
+	DocumentID string `gorm:"primaryKey;uuid;not null"`
+	PartID     string `gorm:"primaryKey;not null"`
+	Version    int64  `gorm:"not null"`
+	Content    string `gorm:"not null"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (p *DocumentPart) TableName() string {
+	return "document_parts"
+}
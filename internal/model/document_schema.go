@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// DocumentSchema holds the JSON Schemas of the documents of a type in a project.
+// The type of a document is the "type" field of its meta, the documents without a type are not validated.
+type DocumentSchema struct {
+	ProjectID     string `gorm:"primaryKey;uuid;not null"`
+	Type          string `gorm:"primaryKey;not null"`
+	MetaSchema    string `gorm:"not null;default:''"`
+	ContentSchema string `gorm:"not null;default:''"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (s *DocumentSchema) TableName() string {
+	return "document_schemas"
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// IdempotencyKey holds the response of a request sent with an idempotency key, a retry with the key replays the response.
+// The response is empty while the first request is in progress, the key then expires after a short lease so an abandoned request can be retried.
+type IdempotencyKey struct {
+	Key         string `gorm:"primaryKey;not null"` // sha256 of the caller, the project, the method and the client key
+	Method      string `gorm:"not null"`
+	RequestHash string `gorm:"not null"` // sha256 of the method and the request
+	Response    []byte // the response marshaled as a protobuf Any
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+}
+
+func (k *IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
@@ -1,5 +1,13 @@
 package model
 
+// link types known to the service, any other non-empty type is a custom type
+const (
+	LinkTypeReferences  = "references"
+	LinkTypeEmbeds      = "embeds"
+	LinkTypeDerivedFrom = "derived_from"
+	LinkTypeSupersedes  = "supersedes"
+)
+
 // Link represents a back link between two documents.
 // This is used to track the relationships between documents.
 // Dynamic relationships are created between documents when a link is created.
@@ -7,7 +15,10 @@ type Link struct {
 	SourceID      string `gorm:"primaryKey;uuid;not null;index:idx_back_links_source_id"`
 	TargetID      string `gorm:"primaryKey;uuid;not null;index:idx_back_links_target_id_version"`
 	TargetVersion string `gorm:"primaryKey;not null;index:idx_back_links_target_id_version"`
-	Pending       bool   `gorm:"not null;default:true"` // pending links are marked false when the target document backlink count is updated
+	Type          string `gorm:"not null;default:references"`
+	Anchor        string // block id inside the target document
+	Label         string
+	Pending       bool `gorm:"not null;default:true"` // pending links are marked false when the target document backlink count is updated
 }
 
 func (b *Link) TableName() string {
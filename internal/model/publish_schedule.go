@@ -0,0 +1,52 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	PublishSchedulePending   = "pending"
+	PublishScheduleRunning   = "running"
+	PublishSchedulePublished = "published"
+	PublishScheduleCancelled = "cancelled"
+	PublishScheduleFailed    = "failed"
+)
+
+// PublishSchedule represents a publish of a document set scheduled for a future time
+// the schedules are picked up by the publish scheduler job once PublishAt is reached
+type PublishSchedule struct {
+	gorm.Model
+	ID             string `gorm:"primaryKey;uuid;not null;"`
+	ProjectID      string `gorm:"uuid;not null;index"`
+	RootDocumentID string
+	DocumentIDs    string `gorm:"not null;default:[]"` // json encoded list of document ids
+	Version        string // semantic versioning, empty means bump the last published version
+	Bump           string
+	Index          string
+	Force          bool
+	StrictLinks    bool
+	PublishAt      time.Time  `gorm:"not null;index"`
+	Status         string     `gorm:"not null;default:pending;index"`
+	ClaimedAt      *time.Time // set when the scheduler starts running the schedule, a stale claim means the run was lost
+	Error          string
+	PublishedAt    *time.Time
+	Audits         []*PublishAudit `gorm:"foreignKey:ScheduleID;references:ID"`
+}
+
+func (PublishSchedule) TableName() string {
+	return "publish_schedules"
+}
+
+// PublishAudit records a document version published by a schedule
+type PublishAudit struct {
+	gorm.Model
+	ScheduleID string `gorm:"uuid;not null;index"`
+	DocumentID string `gorm:"uuid;not null"`
+	Version    string `gorm:"not null"`
+}
+
+func (PublishAudit) TableName() string {
+	return "publish_audits"
+}
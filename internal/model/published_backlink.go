@@ -9,6 +9,9 @@ type PublishedLink struct {
 	SourceVersion string `gorm:"primaryKey;not null;default:current;index:idx_published_backlinks_source_id_version"`
 	TargetID      string `gorm:"primaryKey;uuid;not null;index:idx_published_backlinks_target_id_version"`
 	TargetVersion string `gorm:"primaryKey;not null;default:current;index:idx_published_backlinks_target_id_version"`
+	Type          string `gorm:"not null;default:references"`
+	Anchor        string // block id inside the target document
+	Label         string
 }
 
 func (b *PublishedLink) TableName() string {
@@ -0,0 +1,31 @@
+package model
+
+import "gorm.io/gorm"
+
+// Release is a named and versioned snapshot of a published document tree.
+// It maps every member of the tree to the version published along with the release,
+// so a reader can fetch a consistent tree instead of mixing the latest version of each document.
+type Release struct {
+	gorm.Model
+	ID             string           `gorm:"primaryKey;uuid;not null;"`
+	ProjectID      string           `gorm:"uuid;not null;index"`
+	RootDocumentID string           `gorm:"uuid;not null;uniqueIndex:idx_releases_root_document_id_version"`
+	Version        string           `gorm:"not null;uniqueIndex:idx_releases_root_document_id_version"` // semantic versioning, same as the root document version
+	Name           string           // optional name of the release
+	Members        []*ReleaseMember `gorm:"foreignKey:ReleaseID;references:ID"`
+}
+
+func (Release) TableName() string {
+	return "releases"
+}
+
+// ReleaseMember is a published document version included in a release
+type ReleaseMember struct {
+	ReleaseID  string `gorm:"primaryKey;uuid;not null"`
+	DocumentID string `gorm:"primaryKey;uuid;not null"`
+	Version    string `gorm:"not null"`
+}
+
+func (ReleaseMember) TableName() string {
+	return "release_members"
+}
@@ -0,0 +1,80 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var _ ObjectStore = (*FileObjectStore)(nil)
+
+// FileObjectStore keeps the objects as files under a root directory, the key is the path of the file
+type FileObjectStore struct {
+	root string
+}
+
+// NewFileObjectStore creates the root directory if needed and returns a file object store
+func NewFileObjectStore(root string) (*FileObjectStore, error) {
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	return &FileObjectStore{root: root}, nil
+}
+
+// Put writes the object to a temporary file first, so a failed upload never replaces the previous object
+func (f *FileObjectStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	path := f.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	written, err := io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("object %s has %d bytes, expected %d", key, written, size)
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+func (f *FileObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, err := os.Open(f.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (f *FileObjectStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(f.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// path returns the file of the key, the key is cleaned so it can not escape the root directory
+func (f *FileObjectStore) path(key string) string {
+	return filepath.Join(f.root, filepath.FromSlash(filepath.Clean("/"+key)))
+}
@@ -0,0 +1,65 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var _ ObjectStore = (*MemoryObjectStore)(nil)
+
+// MemoryObjectStore keeps the objects in memory, it is meant for the tests and for trying out the server
+type MemoryObjectStore struct {
+	mu      sync.RWMutex
+	objects map[string][]byte
+}
+
+func NewMemoryObjectStore() *MemoryObjectStore {
+	return &MemoryObjectStore{objects: make(map[string][]byte)}
+}
+
+func (m *MemoryObjectStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return fmt.Errorf("object %s has %d bytes, expected %d", key, len(data), size)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = data
+
+	return nil
+}
+
+func (m *MemoryObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+
+	return memoryObject{bytes.NewReader(data)}, nil
+}
+
+func (m *MemoryObjectStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+
+	return nil
+}
+
+// memoryObject is a seekable reader of an object in memory
+type memoryObject struct {
+	*bytes.Reader
+}
+
+func (memoryObject) Close() error {
+	return nil
+}
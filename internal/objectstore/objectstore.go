@@ -0,0 +1,20 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrObjectNotFound is returned when an object is not found.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore keeps the binary objects, like the document attachments, outside the database
+type ObjectStore interface {
+	// Put saves the object under the key, the size is the number of bytes in the body
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get opens the object of the key, the reader is also an io.Seeker when the store can seek
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete deletes the object of the key, a missing object is not an error
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,52 @@
+package objectstore
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFileObjectStore(t *testing.T) {
+	store, err := NewFileObjectStore(t.TempDir())
+	assert.NoError(t, err)
+
+	testObjectStore(t, store)
+
+	// the key can not escape the root directory
+	assert.Equal(t, store.path("escape"), store.path("../../escape"))
+}
+
+func TestMemoryObjectStore(t *testing.T) {
+	testObjectStore(t, NewMemoryObjectStore())
+}
+
+func testObjectStore(t *testing.T, store ObjectStore) {
+	ctx := context.Background()
+	key := "documents/1/attachments/2"
+
+	_, err := store.Get(ctx, key)
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+
+	err = store.Put(ctx, key, strings.NewReader("hello"), 5, "text/plain")
+	assert.NoError(t, err)
+
+	// a short body does not replace the object
+	err = store.Put(ctx, key, strings.NewReader("hi"), 5, "text/plain")
+	assert.Error(t, err)
+
+	object, err := store.Get(ctx, key)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(object)
+	assert.NoError(t, err)
+	assert.NoError(t, object.Close())
+	assert.Equal(t, "hello", string(data))
+	_, ok := object.(io.Seeker)
+	assert.True(t, ok)
+
+	assert.NoError(t, store.Delete(ctx, key))
+	assert.NoError(t, store.Delete(ctx, key))
+	_, err = store.Get(ctx, key)
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+}
@@ -0,0 +1,246 @@
+package objectstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// unsignedPayload skips hashing the body of an upload, the body is streamed and read only once
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// emptyPayloadHash is the sha256 of an empty body
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+var _ ObjectStore = (*S3ObjectStore)(nil)
+
+// S3ObjectStore keeps the objects in a bucket of an S3 compatible object store, like AWS S3 or MinIO.
+// The requests use path style urls and are signed with AWS signature version 4.
+type S3ObjectStore struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+	now       func() time.Time
+}
+
+// NewS3ObjectStore returns a store of the bucket at the endpoint, the region defaults to us-east-1
+func NewS3ObjectStore(endpoint, bucket, region, accessKey, secretKey string) (*S3ObjectStore, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("s3 bucket is not set")
+	}
+	u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint: %s", endpoint)
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &S3ObjectStore{
+		endpoint:  u,
+		bucket:    bucket,
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{},
+		now:       time.Now,
+	}, nil
+}
+
+func (s *S3ObjectStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := s.do(req, unsignedPayload)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return s.check(res, key)
+}
+
+// Get returns the body of the response, the object is streamed while it is read
+func (s *S3ObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.do(req, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.check(res, key); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+func (s *S3ObjectStore) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.do(req, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// deleting a missing object succeeds on S3, some compatible stores answer not found
+	if err = s.check(res, key); err != nil && err != ErrObjectNotFound {
+		return err
+	}
+
+	return nil
+}
+
+func (s *S3ObjectStore) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	s.sign(req, payloadHash, s.now())
+	return s.client.Do(req)
+}
+
+// check turns an error response into an error, the body of the response is the S3 error document
+func (s *S3ObjectStore) check(res *http.Response, key string) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return ErrObjectNotFound
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	return fmt.Errorf("s3 object %s: %s: %s", key, res.Status, strings.TrimSpace(string(body)))
+}
+
+// objectURL returns the path style url of the object, the key is escaped the way the signature expects
+func (s *S3ObjectStore) objectURL(key string) string {
+	u := *s.endpoint
+	u.Path = u.Path + "/" + s.bucket + "/" + key
+	u.RawPath = s.endpoint.EscapedPath() + "/" + s3Escape(s.bucket) + "/" + s3Escape(key)
+	return u.String()
+}
+
+// sign adds the AWS signature version 4 authorization of the request.
+// The host, the content type and the x-amz-* headers are signed.
+func (s *S3ObjectStore) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex(canonicalRequest)}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s", s.accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery sorts and escapes the query parameters for the signature
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var params []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, queryEscape(key)+"="+queryEscape(value))
+		}
+	}
+
+	return strings.Join(params, "&")
+}
+
+// s3Escape escapes everything but the unreserved characters and the slashes, as the signature requires
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) != -1 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+
+	return b.String()
+}
+
+// queryEscape escapes a query parameter for the signature, the slashes included
+func queryEscape(s string) string {
+	return strings.ReplaceAll(s3Escape(s), "/", "%2F")
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
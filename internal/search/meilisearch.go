@@ -0,0 +1,265 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const meilisearchIndex = "documents"
+
+var _ Index = (*Meilisearch)(nil)
+
+// Meilisearch is a search index backed by a Meilisearch server.
+// Meilisearch processes writes as asynchronous tasks, the adapter waits for the tasks to finish
+// so that a document is searchable as soon as the write returns, same as the sqlite index.
+type Meilisearch struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// meilisearchDocument is the document stored in the Meilisearch index
+type meilisearchDocument struct {
+	Key       string   `json:"key"`
+	ID        string   `json:"id"`
+	ProjectID string   `json:"project_id"`
+	Kind      string   `json:"kind"`
+	Version   string   `json:"version"`
+	Tags      []string `json:"tags"`
+	Title     string   `json:"title"`
+	Meta      string   `json:"meta"`
+	Content   string   `json:"content"`
+}
+
+type meilisearchTask struct {
+	TaskUID int64  `json:"taskUid"`
+	UID     int64  `json:"uid"`
+	Status  string `json:"status"`
+	Error   *struct {
+		Message string `json:"message"`
+		Code    string `json:"code"`
+	} `json:"error"`
+}
+
+// NewMeilisearch connects to the Meilisearch server and configures the documents index.
+func NewMeilisearch(ctx context.Context, url, apiKey string) (*Meilisearch, error) {
+	m := &Meilisearch{
+		url:    strings.TrimRight(url, "/"),
+		apiKey: apiKey,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	var task meilisearchTask
+	err := m.do(ctx, http.MethodPost, "/indexes", map[string]string{"uid": meilisearchIndex, "primaryKey": "key"}, &task)
+	if err != nil {
+		return nil, err
+	}
+	// the index may already exist, the settings are updated either way
+	if err = m.waitTask(ctx, task.TaskUID); err != nil && !strings.Contains(err.Error(), "index_already_exists") {
+		return nil, err
+	}
+
+	settings := map[string]interface{}{
+		"searchableAttributes": []string{"title", "meta", "content"},
+		"filterableAttributes": []string{"project_id", "kind", "tags"},
+	}
+	err = m.do(ctx, http.MethodPatch, "/indexes/"+meilisearchIndex+"/settings", settings, &task)
+	if err != nil {
+		return nil, err
+	}
+	if err = m.waitTask(ctx, task.TaskUID); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Index adds or replaces the documents in the index
+func (m *Meilisearch) Index(ctx context.Context, docs ...*Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	documents := make([]*meilisearchDocument, 0, len(docs))
+	for _, doc := range docs {
+		tags := doc.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		documents = append(documents, &meilisearchDocument{
+			Key:       doc.Key(),
+			ID:        doc.ID,
+			ProjectID: doc.ProjectID,
+			Kind:      string(doc.Kind),
+			Version:   doc.Version,
+			Tags:      tags,
+			Title:     doc.Title,
+			Meta:      doc.Meta,
+			Content:   doc.Content,
+		})
+	}
+
+	var task meilisearchTask
+	if err := m.do(ctx, http.MethodPost, "/indexes/"+meilisearchIndex+"/documents", documents, &task); err != nil {
+		return err
+	}
+
+	return m.waitTask(ctx, task.TaskUID)
+}
+
+// Delete removes a document from the index
+func (m *Meilisearch) Delete(ctx context.Context, kind Kind, id string) error {
+	var task meilisearchTask
+	if err := m.do(ctx, http.MethodDelete, "/indexes/"+meilisearchIndex+"/documents/"+Key(kind, id), nil, &task); err != nil {
+		return err
+	}
+
+	return m.waitTask(ctx, task.TaskUID)
+}
+
+// Search returns the documents matching the query ordered by relevance
+func (m *Meilisearch) Search(ctx context.Context, query *Query) (*Result, error) {
+	var filters []string
+	if query.ProjectID != "" {
+		filters = append(filters, fmt.Sprintf("project_id = %s", quoteFilter(query.ProjectID)))
+	}
+	if len(query.Kinds) > 0 {
+		kinds := make([]string, 0, len(query.Kinds))
+		for _, kind := range query.Kinds {
+			kinds = append(kinds, quoteFilter(string(kind)))
+		}
+		filters = append(filters, fmt.Sprintf("kind IN [%s]", strings.Join(kinds, ", ")))
+	}
+	for _, tag := range query.Tags {
+		filters = append(filters, fmt.Sprintf("tags = %s", quoteFilter(tag)))
+	}
+
+	request := map[string]interface{}{
+		"q":                     query.Text,
+		"limit":                 query.limit(),
+		"offset":                query.Offset,
+		"attributesToHighlight": []string{"title"},
+		"attributesToCrop":      []string{"content"},
+		"cropLength":            16,
+		"cropMarker":            "...",
+		"highlightPreTag":       HighlightPreTag,
+		"highlightPostTag":      HighlightPostTag,
+		"showRankingScore":      true,
+	}
+	if len(filters) > 0 {
+		request["filter"] = strings.Join(filters, " AND ")
+	}
+
+	var response struct {
+		Hits []struct {
+			meilisearchDocument
+			RankingScore float64 `json:"_rankingScore"`
+			Formatted    struct {
+				Title   string `json:"title"`
+				Content string `json:"content"`
+			} `json:"_formatted"`
+		} `json:"hits"`
+		EstimatedTotalHits int `json:"estimatedTotalHits"`
+	}
+	if err := m.do(ctx, http.MethodPost, "/indexes/"+meilisearchIndex+"/search", request, &response); err != nil {
+		return nil, err
+	}
+
+	result := &Result{Total: response.EstimatedTotalHits}
+	for _, hit := range response.Hits {
+		result.Hits = append(result.Hits, &Hit{
+			ID:             hit.ID,
+			ProjectID:      hit.ProjectID,
+			Kind:           Kind(hit.Kind),
+			Version:        hit.Version,
+			Title:          hit.Title,
+			TitleHighlight: hit.Formatted.Title,
+			Snippet:        hit.Formatted.Content,
+			Score:          hit.RankingScore,
+		})
+	}
+
+	return result, nil
+}
+
+// Close is a no-op, the http client has nothing to release
+func (m *Meilisearch) Close() error {
+	return nil
+}
+
+// waitTask polls the task until it succeeds or fails
+func (m *Meilisearch) waitTask(ctx context.Context, uid int64) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		var task meilisearchTask
+		if err := m.do(ctx, http.MethodGet, fmt.Sprintf("/tasks/%d", uid), nil, &task); err != nil {
+			return err
+		}
+
+		switch task.Status {
+		case "succeeded":
+			return nil
+		case "failed", "canceled":
+			if task.Error != nil {
+				return fmt.Errorf("meilisearch task %d %s: %s (%s)", uid, task.Status, task.Error.Message, task.Error.Code)
+			}
+			return fmt.Errorf("meilisearch task %d %s", uid, task.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// do sends a json request to the Meilisearch api and decodes the json response into out
+func (m *Meilisearch) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, m.url+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	}
+
+	res, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("meilisearch %s %s: %s: %s", method, path, res.Status, data)
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+// quoteFilter quotes a value of a Meilisearch filter expression
+func quoteFilter(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
@@ -0,0 +1,22 @@
+package search
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+// TestMeilisearch runs against a local instance, for example
+// docker run -p 7700:7700 getmeili/meilisearch and MEILISEARCH_URL=http://localhost:7700
+func TestMeilisearch(t *testing.T) {
+	url := os.Getenv("MEILISEARCH_URL")
+	if url == "" {
+		t.Skip("MEILISEARCH_URL is not set")
+	}
+
+	index, err := NewMeilisearch(context.Background(), url, os.Getenv("MEILISEARCH_API_KEY"))
+	assert.NoError(t, err)
+
+	testIndex(t, index)
+}
@@ -0,0 +1,131 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Kind is the kind of the indexed document
+type Kind string
+
+const (
+	Draft     Kind = "draft"
+	Published Kind = "published"
+)
+
+const (
+	// HighlightPreTag and HighlightPostTag wrap the matched terms in the highlights
+	HighlightPreTag  = "<mark>"
+	HighlightPostTag = "</mark>"
+
+	defaultLimit = 20
+)
+
+// Document is a draft or the latest published version of a document in the search index
+type Document struct {
+	ID        string
+	ProjectID string
+	Kind      Kind
+	Version   string
+	Title     string
+	Meta      string
+	Content   string
+	Tags      []string
+}
+
+// Key returns the key of the document in the index, a draft and its published version are indexed separately
+func (d *Document) Key() string {
+	return Key(d.Kind, d.ID)
+}
+
+// Key returns the key of a document in the index
+func Key(kind Kind, id string) string {
+	return fmt.Sprintf("%s-%s", kind, id)
+}
+
+// Query is a full-text search query, the filters are optional
+type Query struct {
+	Text      string
+	ProjectID string
+	Kinds     []Kind
+	Tags      []string // documents must have all the tags
+	Limit     int
+	Offset    int
+}
+
+// limit returns the page size of the query
+func (q *Query) limit() int {
+	if q.Limit <= 0 {
+		return defaultLimit
+	}
+
+	return q.Limit
+}
+
+// Hit is a document matching a query with the matched terms highlighted
+type Hit struct {
+	ID             string
+	ProjectID      string
+	Kind           Kind
+	Version        string
+	Title          string
+	TitleHighlight string
+	Snippet        string
+	Score          float64
+}
+
+// Result is a page of hits and the total number of matching documents
+type Result struct {
+	Hits  []*Hit
+	Total int
+}
+
+// Index is a full-text search index over documents
+type Index interface {
+	// Index adds or replaces the documents in the index.
+	Index(ctx context.Context, docs ...*Document) error
+	// Delete removes a document of the given kind from the index.
+	Delete(ctx context.Context, kind Kind, id string) error
+	// Search returns the documents matching the query.
+	Search(ctx context.Context, query *Query) (*Result, error)
+	// Close releases the resources of the index.
+	Close() error
+}
+
+// ParseMeta returns the title and tags from the document meta
+func ParseMeta(meta string) (string, []string) {
+	var m struct {
+		Title string   `json:"title"`
+		Tags  []string `json:"tags"`
+	}
+	if err := json.Unmarshal([]byte(meta), &m); err != nil {
+		// the meta is free-form, a meta without title or tags is still indexed
+		return "", nil
+	}
+
+	return m.Title, m.Tags
+}
+
+// NewNop creates an index that does not index anything
+func NewNop() Index {
+	return &nop{}
+}
+
+type nop struct{}
+
+func (n *nop) Index(ctx context.Context, docs ...*Document) error {
+	return nil
+}
+
+func (n *nop) Delete(ctx context.Context, kind Kind, id string) error {
+	return nil
+}
+
+func (n *nop) Search(ctx context.Context, query *Query) (*Result, error) {
+	return &Result{}, nil
+}
+
+func (n *nop) Close() error {
+	return nil
+}
@@ -0,0 +1,77 @@
+package search
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const (
+	projectID      = "1b7e3f8a-2c4d-4e5f-8a9b-0c1d2e3f4a5b"
+	otherProjectID = "6c5d4e3f-2a1b-4c0d-9e8f-7a6b5c4d3e2f"
+)
+
+// testIndex runs the same checks against every index implementation
+func testIndex(t *testing.T, index Index) {
+	ctx := context.Background()
+
+	err := index.Index(ctx,
+		&Document{ID: "doc-1", ProjectID: projectID, Kind: Draft, Version: "3", Title: "Gardening notes", Content: "How to grow tomatoes in a small garden", Tags: []string{"garden", "food"}},
+		&Document{ID: "doc-1", ProjectID: projectID, Kind: Published, Version: "1.0.0", Title: "Gardening notes", Content: "How to grow tomatoes", Tags: []string{"garden"}},
+		&Document{ID: "doc-2", ProjectID: projectID, Kind: Draft, Version: "1", Title: "Cooking", Content: "A tomato soup recipe", Tags: []string{"food"}},
+		&Document{ID: "doc-3", ProjectID: otherProjectID, Kind: Draft, Version: "1", Title: "Tomatoes", Content: "Tomatoes everywhere"},
+	)
+	assert.NoError(t, err)
+
+	res, err := index.Search(ctx, &Query{Text: "tomato", ProjectID: projectID})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, res.Total)
+
+	res, err = index.Search(ctx, &Query{Text: "tomatoes", ProjectID: projectID, Kinds: []Kind{Published}})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Hits, 1) {
+		hit := res.Hits[0]
+		assert.Equal(t, "doc-1", hit.ID)
+		assert.Equal(t, Published, hit.Kind)
+		assert.Equal(t, "1.0.0", hit.Version)
+		assert.Contains(t, hit.Snippet, HighlightPreTag)
+	}
+
+	res, err = index.Search(ctx, &Query{Text: "tomato", Tags: []string{"garden", "food"}})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Hits, 1) {
+		assert.Equal(t, "doc-1", res.Hits[0].ID)
+		assert.Equal(t, Draft, res.Hits[0].Kind)
+	}
+
+	res, err = index.Search(ctx, &Query{Text: "garden"})
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, res.Hits) {
+		assert.Contains(t, res.Hits[0].TitleHighlight, HighlightPreTag+"Garden")
+	}
+
+	// reindexing replaces the document
+	err = index.Index(ctx, &Document{ID: "doc-2", ProjectID: projectID, Kind: Draft, Version: "2", Title: "Cooking", Content: "A pumpkin soup recipe"})
+	assert.NoError(t, err)
+	res, err = index.Search(ctx, &Query{Text: "soup"})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Hits, 1) {
+		assert.Equal(t, "2", res.Hits[0].Version)
+	}
+
+	err = index.Delete(ctx, Draft, "doc-2")
+	assert.NoError(t, err)
+	res, err = index.Search(ctx, &Query{Text: "soup"})
+	assert.NoError(t, err)
+	assert.Empty(t, res.Hits)
+}
+
+func TestParseMeta(t *testing.T) {
+	title, tags := ParseMeta(`{"title": "Notes", "tags": ["a", "b"]}`)
+	assert.Equal(t, "Notes", title)
+	assert.Equal(t, []string{"a", "b"}, tags)
+
+	title, tags = ParseMeta("not json")
+	assert.Equal(t, "", title)
+	assert.Nil(t, tags)
+}
@@ -0,0 +1,194 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the sqlite index uses a FTS5 virtual table, the sqlite driver must be built with the sqlite_fts5 tag
+const createSqliteTable = `CREATE VIRTUAL TABLE IF NOT EXISTS search_documents USING fts5(
+	key UNINDEXED,
+	id UNINDEXED,
+	project_id UNINDEXED,
+	kind UNINDEXED,
+	version UNINDEXED,
+	tags UNINDEXED,
+	title,
+	meta,
+	content,
+	tokenize = 'porter unicode61'
+)`
+
+// column positions of the FTS5 table used by highlight() and snippet()
+const (
+	titleColumn   = 6
+	contentColumn = 8
+)
+
+var _ Index = (*Sqlite)(nil)
+
+// Sqlite is an embedded search index backed by a sqlite FTS5 table
+type Sqlite struct {
+	db *gorm.DB
+}
+
+// NewSqlite opens the sqlite search index at the given path and creates the FTS5 table if needed.
+func NewSqlite(path string) (*Sqlite, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.Exec(createSqliteTable).Error; err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			return nil, fmt.Errorf("sqlite search index requires fts5, build with -tags sqlite_fts5: %w", err)
+		}
+		return nil, err
+	}
+
+	return &Sqlite{db: db}, nil
+}
+
+// Index replaces the documents in the index
+func (s *Sqlite) Index(ctx context.Context, docs ...*Document) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, doc := range docs {
+			if err := tx.Exec("DELETE FROM search_documents WHERE key = ?", doc.Key()).Error; err != nil {
+				return err
+			}
+
+			err := tx.Exec("INSERT INTO search_documents (key, id, project_id, kind, version, tags, title, meta, content) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+				doc.Key(), doc.ID, doc.ProjectID, string(doc.Kind), doc.Version, joinTags(doc.Tags), doc.Title, doc.Meta, doc.Content).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Delete removes a document from the index
+func (s *Sqlite) Delete(ctx context.Context, kind Kind, id string) error {
+	return s.db.WithContext(ctx).Exec("DELETE FROM search_documents WHERE key = ?", Key(kind, id)).Error
+}
+
+// Search returns the documents matching the query ordered by relevance
+func (s *Sqlite) Search(ctx context.Context, query *Query) (*Result, error) {
+	match := matchExpression(query.Text)
+	if match == "" {
+		return &Result{}, nil
+	}
+
+	where := []string{"search_documents MATCH ?"}
+	args := []interface{}{match}
+	if query.ProjectID != "" {
+		where = append(where, "project_id = ?")
+		args = append(args, query.ProjectID)
+	}
+	if len(query.Kinds) > 0 {
+		kinds := make([]string, 0, len(query.Kinds))
+		for _, kind := range query.Kinds {
+			kinds = append(kinds, string(kind))
+		}
+		where = append(where, "kind IN ?")
+		args = append(args, kinds)
+	}
+	for _, tag := range query.Tags {
+		where = append(where, `tags LIKE ? ESCAPE '\'`)
+		args = append(args, "%|"+escapeLike(tag)+"|%")
+	}
+	condition := strings.Join(where, " AND ")
+
+	var total int64
+	err := s.db.WithContext(ctx).Raw("SELECT count(*) FROM search_documents WHERE "+condition, args...).Scan(&total).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		ID             string
+		ProjectID      string
+		Kind           string
+		Version        string
+		Title          string
+		TitleHighlight string
+		Snippet        string
+		Rank           float64
+	}
+	selectHits := fmt.Sprintf(`SELECT id, project_id, kind, version, title,
+		highlight(search_documents, %d, ?, ?) AS title_highlight,
+		snippet(search_documents, %d, ?, ?, '...', 16) AS snippet,
+		rank
+		FROM search_documents WHERE %s ORDER BY rank LIMIT ? OFFSET ?`, titleColumn, contentColumn, condition)
+	hitArgs := append([]interface{}{HighlightPreTag, HighlightPostTag, HighlightPreTag, HighlightPostTag}, args...)
+	hitArgs = append(hitArgs, query.limit(), query.Offset)
+	err = s.db.WithContext(ctx).Raw(selectHits, hitArgs...).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Total: int(total)}
+	for _, row := range rows {
+		result.Hits = append(result.Hits, &Hit{
+			ID:             row.ID,
+			ProjectID:      row.ProjectID,
+			Kind:           Kind(row.Kind),
+			Version:        row.Version,
+			Title:          row.Title,
+			TitleHighlight: row.TitleHighlight,
+			Snippet:        row.Snippet,
+			Score:          -row.Rank, // bm25 rank is lower for better matches
+		})
+	}
+
+	return result, nil
+}
+
+// Close closes the sqlite database
+func (s *Sqlite) Close() error {
+	db, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+
+	return db.Close()
+}
+
+// matchExpression quotes each term of the text so that the text is never parsed as FTS5 query syntax,
+// the last term matches as a prefix to support search as you type.
+func matchExpression(text string) string {
+	terms := strings.Fields(text)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	if len(terms) > 0 {
+		terms[len(terms)-1] += "*"
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// joinTags stores the tags in a single column, each tag is wrapped with the separator
+// so that a tag can be matched exactly with LIKE '%|tag|%'
+func joinTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	return "|" + strings.Join(tags, "|") + "|"
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,26 @@
+package search
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSqlite(t *testing.T) {
+	index, err := NewSqlite(filepath.Join(t.TempDir(), "search.db"))
+	if err != nil && strings.Contains(err.Error(), "fts5") {
+		t.Skip("sqlite is built without fts5, run the tests with -tags sqlite_fts5")
+	}
+	assert.NoError(t, err)
+	defer index.Close()
+
+	testIndex(t, index)
+}
+
+func TestMatchExpression(t *testing.T) {
+	assert.Equal(t, "", matchExpression("  "))
+	assert.Equal(t, `"tomato"*`, matchExpression("tomato"))
+	assert.Equal(t, `"grow" "tomato"*`, matchExpression("grow tomato"))
+	assert.Equal(t, `"""hi"""*`, matchExpression(`"hi"`))
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"github.com/emrgen/document/internal/service"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/rs/cors"
+	"google.golang.org/protobuf/proto"
+	"net/http"
+	"net/textproto"
+	"strconv"
+)
+
+// withIncomingHeaderMatcher forwards the Idempotency-Key header to the grpc metadata,
+// the Range header is forwarded for the downloads as by gatewayfile.WithFileIncomingHeaderMatcher
+func withIncomingHeaderMatcher() runtime.ServeMuxOption {
+	return runtime.WithIncomingHeaderMatcher(func(key string) (string, bool) {
+		switch key = textproto.CanonicalMIMEHeaderKey(key); key {
+		case "Idempotency-Key":
+			return idempotencyKeyMetadata, true
+		case "Range":
+			return runtime.MetadataPrefix + key, true
+		default:
+			return runtime.DefaultHeaderMatcher(key)
+		}
+	})
+}
+
+// withOutgoingHeaderMatcher writes the caching and the idempotency headers of the responses as http headers,
+// the status code is only read by the response option and the other headers keep the Grpc-Metadata- prefix
+func withOutgoingHeaderMatcher() runtime.ServeMuxOption {
+	return runtime.WithOutgoingHeaderMatcher(func(key string) (string, bool) {
+		switch key {
+		case service.ETagHeader:
+			return "ETag", true
+		case service.CacheControlHeader:
+			return "Cache-Control", true
+		case idempotentReplayedHeader:
+			return "Idempotent-Replayed", true
+		case service.StatusCodeHeader:
+			return "", false
+		default:
+			return runtime.MetadataHeaderPrefix + key, true
+		}
+	})
+}
+
+// withStatusCodeResponseOption writes the status code set by a unary rpc, e.g. 304 for a matching If-None-Match.
+// The streamed responses are left to gatewayfile, which reads the same header.
+func withStatusCodeResponseOption() runtime.ServeMuxOption {
+	return runtime.WithForwardResponseOption(func(ctx context.Context, writer http.ResponseWriter, message proto.Message) error {
+		if message == nil {
+			return nil
+		}
+
+		md, ok := runtime.ServerMetadataFromContext(ctx)
+		if !ok {
+			return nil
+		}
+		values := md.HeaderMD.Get(service.StatusCodeHeader)
+		if len(values) == 0 {
+			return nil
+		}
+		code, err := strconv.Atoi(values[0])
+		if err != nil {
+			return err
+		}
+		writer.WriteHeader(code)
+		return nil
+	})
+}
+
+// allowAllCors allows all the origins like cors.AllowAll, the browsers can read the etag for the If-Match of an update
+// and see the replayed responses
+func allowAllCors() *cors.Cors {
+	return cors.New(cors.Options{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{
+			http.MethodHead,
+			http.MethodGet,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+		},
+		AllowedHeaders:   []string{"*"},
+		ExposedHeaders:   []string{"ETag", "Idempotent-Replayed"},
+		AllowCredentials: false,
+	})
+}
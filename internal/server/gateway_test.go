@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGateway_CacheHeaders(t *testing.T) {
+	mux := runtime.NewServeMux(withOutgoingHeaderMatcher(), withStatusCodeResponseOption())
+	forward := func(md metadata.MD) *httptest.ResponseRecorder {
+		ctx := runtime.NewServerMetadataContext(context.TODO(), runtime.ServerMetadata{HeaderMD: md})
+		req := httptest.NewRequest(http.MethodGet, "/v1/documents/id", nil)
+		recorder := httptest.NewRecorder()
+		runtime.ForwardResponseMessage(ctx, mux, &runtime.JSONPb{}, recorder, req, &v1.GetDocumentResponse{}, mux.GetForwardResponseOptions()...)
+		return recorder
+	}
+
+	res := forward(metadata.Pairs("etag", `"1-2"`, "cache-control", "private, no-cache", "x-request", "7"))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, `"1-2"`, res.Header().Get("ETag"))
+	assert.Equal(t, "private, no-cache", res.Header().Get("Cache-Control"))
+	assert.Equal(t, "7", res.Header().Get("Grpc-Metadata-X-Request"))
+
+	res = forward(metadata.Pairs("etag", `"1-2"`, "code", "304"))
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	assert.Equal(t, `"1-2"`, res.Header().Get("ETag"))
+	assert.Empty(t, res.Header().Get("Grpc-Metadata-Code"))
+}
+
+func TestGateway_IdempotencyKeyHeader(t *testing.T) {
+	mux := runtime.NewServeMux(withIncomingHeaderMatcher())
+	req := httptest.NewRequest(http.MethodPost, "/v1/documents", nil)
+	req.Header.Set("Idempotency-Key", "key-1")
+	req.Header.Set("Range", "bytes=0-10")
+	req.Header.Set("X-Other", "ignored")
+
+	ctx, err := runtime.AnnotateIncomingContext(context.TODO(), mux, req, "/apis.v1.DocumentService/CreateDocument")
+	assert.NoError(t, err)
+	md, _ := metadata.FromIncomingContext(ctx)
+	assert.Equal(t, []string{"key-1"}, md.Get(idempotencyKeyMetadata))
+	assert.Equal(t, []string{"bytes=0-10"}, md.Get("grpcgateway-range"))
+	assert.Empty(t, md.Get("x-other"))
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/store"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"time"
+)
+
+// idempotencyKeyMetadata is the metadata of the idempotency key, the rest gateway forwards the Idempotency-Key header as it
+const idempotencyKeyMetadata = "idempotency-key"
+
+// idempotentReplayedHeader marks a response replayed for a retry
+const idempotentReplayedHeader = "idempotent-replayed"
+
+// authorizationMetadata is the token of the caller, the keys of different callers do not collide
+const authorizationMetadata = "authorization"
+
+// idempotencyLease is how long a request in progress holds its key, a retry after the lease runs the request again
+const idempotencyLease = 5 * time.Minute
+
+// UnaryIdempotencyInterceptor replays the response of a mutating request sent again with the same idempotency key,
+// the key of a read is ignored so the read never returns a stale response.
+// The key is scoped by the caller token, the project of the request and the method, so the same key sent by
+// another caller or for another project or method is a new request. A key used with a different request is a conflict,
+// a failed request releases its key so the retry runs it again.
+// The client streaming uploads are not covered, their request is only known after the stream is read so the key is ignored.
+func UnaryIdempotencyInterceptor(store store.Store, ttl time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !idempotentMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		clientKey := firstMetadata(md, idempotencyKeyMetadata)
+		message, ok := req.(proto.Message)
+		if clientKey == "" || !ok {
+			return handler(ctx, req)
+		}
+		key := scopedIdempotencyKey(md, info.FullMethod, req, clientKey)
+
+		hash, err := requestHash(info.FullMethod, message)
+		if err != nil {
+			return nil, err
+		}
+		record, created, err := claimIdempotencyKey(ctx, store, &model.IdempotencyKey{
+			Key:         key,
+			Method:      info.FullMethod,
+			RequestHash: hash,
+			ExpiresAt:   time.Now().Add(idempotencyLease),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if !created {
+			if record.RequestHash != hash {
+				return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("idempotency key %s was used with a different request", clientKey))
+			}
+			if len(record.Response) == 0 {
+				return nil, status.Error(codes.Aborted, fmt.Sprintf("the request with idempotency key %s is in progress", clientKey))
+			}
+			return replayResponse(ctx, record)
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			if err := store.DeleteIdempotencyKey(ctx, key); err != nil {
+				logrus.Errorf("error releasing the idempotency key %s: %v", clientKey, err)
+			}
+			return nil, err
+		}
+
+		// the response is returned even when it is not saved, the retry then conflicts as in progress until the lease ends
+		if err := saveResponse(ctx, store, key, resp, time.Now().Add(ttl)); err != nil {
+			logrus.Errorf("error saving the response of the idempotency key %s: %v", clientKey, err)
+		}
+
+		return resp, nil
+	}
+}
+
+// idempotentMethod reports whether the method changes the documents, only the responses of those are replayed
+func idempotentMethod(method string) bool {
+	switch method {
+	case v1.DocumentService_CreateDocument_FullMethodName,
+		v1.DocumentService_UpdateDocument_FullMethodName,
+		v1.DocumentService_DeleteDocument_FullMethodName,
+		v1.DocumentService_EraseDocument_FullMethodName,
+		v1.DocumentService_UndeleteDocument_FullMethodName,
+		v1.DocumentService_InsertChild_FullMethodName,
+		v1.DocumentService_MoveChild_FullMethodName,
+		v1.DocumentService_RemoveChild_FullMethodName,
+		v1.DocumentService_BatchWrite_FullMethodName,
+		v1.DocumentService_DuplicateDocument_FullMethodName,
+		v1.DocumentService_InstantiateTemplate_FullMethodName,
+		v1.DocumentService_MoveDocuments_FullMethodName,
+		v1.DocumentService_CopyDocuments_FullMethodName,
+		v1.DocumentService_PublishDocuments_FullMethodName,
+		v1.DocumentService_DeleteAttachment_FullMethodName,
+		v1.DocumentService_PutDocumentSchema_FullMethodName,
+		v1.DocumentService_DeleteDocumentSchema_FullMethodName,
+		v1.DocumentService_UpdateDocumentPart_FullMethodName,
+		v1.DocumentService_ValidateProject_FullMethodName,
+		v1.DocumentBackupService_CreateDocumentBackup_FullMethodName,
+		v1.DocumentBackupService_DeleteDocumentBackup_FullMethodName,
+		v1.DocumentBackupService_RestoreDocumentBackup_FullMethodName,
+		v1.PublishScheduleService_SchedulePublish_FullMethodName,
+		v1.PublishScheduleService_CancelPublishSchedule_FullMethodName:
+		return true
+	default:
+		return false
+	}
+}
+
+// scopedIdempotencyKey hashes the client key with the caller token, the project of the request and the method
+func scopedIdempotencyKey(md metadata.MD, method string, req interface{}, key string) string {
+	var projectID string
+	if request, ok := req.(interface{ GetProjectId() string }); ok {
+		projectID = request.GetProjectId()
+	}
+
+	hash := sha256.New()
+	for _, part := range []string{firstMetadata(md, authorizationMetadata), projectID, method, key} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// firstMetadata returns the first value of the metadata key, or empty when it is missing
+func firstMetadata(md metadata.MD, key string) string {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// claimIdempotencyKey creates the key or returns the existing one, an expired key or an abandoned request past its lease is replaced
+func claimIdempotencyKey(ctx context.Context, store store.Store, record *model.IdempotencyKey) (*model.IdempotencyKey, bool, error) {
+	created, err := store.CreateIdempotencyKey(ctx, record)
+	if err != nil || created {
+		return record, created, err
+	}
+
+	existing, err := store.GetIdempotencyKey(ctx, record.Key)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing.ExpiresAt.After(time.Now()) {
+		return existing, false, nil
+	}
+
+	if err = store.DeleteIdempotencyKey(ctx, record.Key); err != nil {
+		return nil, false, err
+	}
+	created, err = store.CreateIdempotencyKey(ctx, record)
+	if err != nil {
+		return nil, false, err
+	}
+	if !created {
+		return nil, false, status.Error(codes.Aborted, "the request with the idempotency key is in progress")
+	}
+
+	return record, true, nil
+}
+
+// requestHash hashes the method with the request, the deterministic marshaling keeps the maps in order
+func requestHash(method string, req proto.Message) (string, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(method))
+	hash.Write([]byte{0})
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// saveResponse saves the response as a protobuf Any so it is replayed without knowing its type
+func saveResponse(ctx context.Context, store store.Store, key string, resp interface{}, expiresAt time.Time) error {
+	message, ok := resp.(proto.Message)
+	if !ok {
+		return errors.New("the response is not a protobuf message")
+	}
+	response, err := anypb.New(message)
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	return store.SaveIdempotencyResponse(ctx, key, data, expiresAt)
+}
+
+// replayResponse returns the saved response, the calls made without a grpc stream have no headers
+func replayResponse(ctx context.Context, record *model.IdempotencyKey) (interface{}, error) {
+	var response anypb.Any
+	if err := proto.Unmarshal(record.Response, &response); err != nil {
+		return nil, err
+	}
+	resp, err := response.UnmarshalNew()
+	if err != nil {
+		return nil, err
+	}
+
+	_ = grpc.SetHeader(ctx, metadata.Pairs(idempotentReplayedHeader, "true"))
+	return resp, nil
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"errors"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/store"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"testing"
+	"time"
+)
+
+func TestUnaryIdempotencyInterceptor(t *testing.T) {
+	docStore := store.NewGormStore(db)
+	interceptor := UnaryIdempotencyInterceptor(docStore, time.Hour)
+	info := &grpc.UnaryServerInfo{FullMethod: "/apis.v1.DocumentService/CreateDocument"}
+
+	// the handler creates a document with a new id on every call
+	calls := 0
+	var failure error
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		if failure != nil {
+			return nil, failure
+		}
+		return &v1.CreateDocumentResponse{Document: &v1.Document{Id: uuid.New().String()}}, nil
+	}
+	token := "Bearer " + uuid.New().String()
+	callAs := func(token, key string, req *v1.CreateDocumentRequest) (*v1.CreateDocumentResponse, error) {
+		ctx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs(idempotencyKeyMetadata, key, authorizationMetadata, token))
+		res, err := interceptor(ctx, req, info, handler)
+		if err != nil {
+			return nil, err
+		}
+		return res.(*v1.CreateDocumentResponse), nil
+	}
+	call := func(key string, req *v1.CreateDocumentRequest) (*v1.CreateDocumentResponse, error) {
+		return callAs(token, key, req)
+	}
+	scoped := func(key string, req *v1.CreateDocumentRequest) string {
+		return scopedIdempotencyKey(metadata.Pairs(authorizationMetadata, token), info.FullMethod, req, key)
+	}
+	req := &v1.CreateDocumentRequest{ProjectId: uuid.New().String(), Meta: `{"title": "Tomatoes"}`}
+	key := uuid.New().String()
+
+	first, err := call(key, req)
+	assert.NoError(t, err)
+	retry, err := call(key, req)
+	assert.NoError(t, err)
+	assert.True(t, proto.Equal(first, retry))
+	assert.Equal(t, 1, calls)
+
+	// the same key with another request is a conflict
+	_, err = call(key, &v1.CreateDocumentRequest{ProjectId: req.ProjectId, Meta: `{"title": "Cherries"}`})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.AlreadyExists, st.Code())
+
+	// the requests without a key are not recorded
+	_, err = interceptor(context.TODO(), req, info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	// the key of a read is ignored
+	ctx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs(idempotencyKeyMetadata, key, authorizationMetadata, token))
+	read := &grpc.UnaryServerInfo{FullMethod: v1.DocumentService_GetDocument_FullMethodName}
+	_, err = interceptor(ctx, &v1.GetDocumentRequest{DocumentId: uuid.New().String()}, read, handler)
+	assert.NoError(t, err)
+	_, err = interceptor(ctx, &v1.GetDocumentRequest{DocumentId: uuid.New().String()}, read, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, calls)
+	calls -= 2
+
+	// the key is scoped by the caller and the project
+	other, err := callAs("Bearer "+uuid.New().String(), key, req)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.Document.Id, other.Document.Id)
+	other, err = call(key, &v1.CreateDocumentRequest{ProjectId: uuid.New().String(), Meta: req.Meta})
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.Document.Id, other.Document.Id)
+	calls -= 2
+
+	// a failed request releases its key
+	failKey := uuid.New().String()
+	failure = errors.New("database is down")
+	_, err = call(failKey, req)
+	assert.Error(t, err)
+	failure = nil
+	_, err = call(failKey, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, calls)
+
+	// a request in progress is not run twice
+	hash, err := requestHash(info.FullMethod, req)
+	assert.NoError(t, err)
+	pendingKey := uuid.New().String()
+	_, err = docStore.CreateIdempotencyKey(context.TODO(), &model.IdempotencyKey{Key: scoped(pendingKey, req), Method: info.FullMethod, RequestHash: hash, ExpiresAt: time.Now().Add(idempotencyLease)})
+	assert.NoError(t, err)
+	_, err = call(pendingKey, req)
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.Aborted, st.Code())
+
+	// a request abandoned past its lease is run again
+	abandonedKey := uuid.New().String()
+	_, err = docStore.CreateIdempotencyKey(context.TODO(), &model.IdempotencyKey{Key: scoped(abandonedKey, req), Method: info.FullMethod, RequestHash: hash, ExpiresAt: time.Now().Add(-time.Second)})
+	assert.NoError(t, err)
+	_, err = call(abandonedKey, req)
+	assert.NoError(t, err)
+	calls--
+
+	// the saved response is kept for the ttl, not the lease
+	record, err := docStore.GetIdempotencyKey(context.TODO(), scoped(abandonedKey, req))
+	assert.NoError(t, err)
+	assert.True(t, record.ExpiresAt.After(time.Now().Add(idempotencyLease)))
+
+	// an expired key runs the request again
+	expiredKey := uuid.New().String()
+	_, err = docStore.CreateIdempotencyKey(context.TODO(), &model.IdempotencyKey{Key: scoped(expiredKey, req), Method: info.FullMethod, RequestHash: "other", ExpiresAt: time.Now().Add(-time.Minute)})
+	assert.NoError(t, err)
+	_, err = call(expiredKey, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, calls)
+
+	deleted, err := docStore.DeleteExpiredIdempotencyKeys(context.TODO(), time.Now().Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, deleted, int64(4))
+}
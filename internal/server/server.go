@@ -16,7 +16,6 @@ import (
 	grpcvalidator "github.com/grpc-ecosystem/go-grpc-middleware/validator"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	_ "github.com/joho/godotenv/autoload"
-	"github.com/rs/cors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 	"google.golang.org/grpc"
@@ -83,6 +82,12 @@ func Start(grpcPort, httpPort string) error {
 	// TODO: user a public key manager with to verify the token
 	// TODO: in insecure mode, the token is not verified and project permission check is skipped
 
+	docStore := store.NewGormStore(rdb)
+	err = docStore.Migrate()
+	if err != nil {
+		return err
+	}
+
 	grpcServer := grpc.NewServer(
 		grpc.UnaryInterceptor(grpcmiddleware.ChainUnaryServer(
 			grpcvalidator.UnaryServerInterceptor(),
@@ -92,6 +97,8 @@ func Start(grpcPort, httpPort string) error {
 			//authbase.InjectPermissionInterceptor(memberClient),
 			// check if the user has permission to access the rpc method
 			//CheckPermissionInterceptor(),
+			// replay the responses of the mutating requests sent again with an idempotency key, the client streaming uploads are not covered
+			UnaryIdempotencyInterceptor(docStore, time.Duration(cnf.IdempotencyConfig.TTLHours)*time.Hour),
 			// log the request time
 			UnaryGrpcRequestTimeInterceptor(),
 		)),
@@ -112,6 +119,10 @@ func Start(grpcPort, httpPort string) error {
 			},
 		}),
 		gatewayfile.WithHTTPBodyMarshaler(),
+		withIncomingHeaderMatcher(),
+		gatewayfile.WithFileForwardResponseOption(),
+		withOutgoingHeaderMatcher(),
+		withStatusCodeResponseOption(),
 	)
 
 	opts := []grpc.DialOption{
@@ -126,19 +137,26 @@ func Start(grpcPort, httpPort string) error {
 		return err
 	}
 
-	docStore := store.NewGormStore(rdb)
-	err = docStore.Migrate()
-	if err != nil {
-		return err
-	}
-
 	compressor := compress.NewNop()
 
-	docs := service.NewDocumentService(compressor, docStore, redis)
+	searchIndex := config.GetSearchIndex(cnf)
+	defer searchIndex.Close()
+
+	objectStore := config.GetObjectStore(cnf)
+
+	docs := service.NewDocumentService(compressor, docStore, redis, searchIndex, objectStore)
+	// the documents saved before the child edges were tracked get their edges in the background
+	go func() {
+		if err := docs.BackfillChildEdges(context.Background()); err != nil {
+			logrus.Errorf("error backfilling the child edges: %v", err)
+		}
+	}()
+
 	// Register the grpc server
 	v1.RegisterDocumentServiceServer(grpcServer, docs)
 	v1.RegisterPublishedDocumentServiceServer(grpcServer, service.NewPublishedDocumentService(compressor, docStore, redis))
 	v1.RegisterDocumentBackupServiceServer(grpcServer, service.NewDocumentBackupService(compressor, docStore, docs))
+	v1.RegisterPublishScheduleServiceServer(grpcServer, service.NewPublishScheduleService(docStore))
 
 	// Register the rest gateway
 	if err = v1.RegisterDocumentServiceHandlerFromEndpoint(context.TODO(), mux, endpoint, opts); err != nil {
@@ -150,6 +168,9 @@ func Start(grpcPort, httpPort string) error {
 	if err = v1.RegisterDocumentBackupServiceHandlerFromEndpoint(context.TODO(), mux, endpoint, opts); err != nil {
 		return err
 	}
+	if err = v1.RegisterPublishScheduleServiceHandlerFromEndpoint(context.TODO(), mux, endpoint, opts); err != nil {
+		return err
+	}
 
 	apiMux := http.NewServeMux()
 	openapiDocs := packr.NewBox("../../docs/v1")
@@ -166,7 +187,7 @@ func Start(grpcPort, httpPort string) error {
 
 	restServer := &http.Server{
 		Addr:    httpPort,
-		Handler: cors.AllowAll().Handler(apiMux),
+		Handler: allowAllCors().Handler(apiMux),
 	}
 
 	// make sure to wait for the servers to stop before exiting
@@ -176,6 +197,24 @@ func Start(grpcPort, httpPort string) error {
 	cleaner := job.NewBackupCleaner(docStore)
 	go cleaner.Run()
 
+	// Start the backlink reconciler
+	reconciler := job.NewBacklinkReconciler(docStore)
+	go reconciler.Run()
+
+	// Start the trash cleaner, the deleted documents are kept forever without a retention
+	if cnf.TrashConfig.RetentionDays > 0 {
+		trashCleaner := job.NewTrashCleaner(docStore, docs, time.Duration(cnf.TrashConfig.RetentionDays)*24*time.Hour)
+		go trashCleaner.Run()
+	}
+
+	// Start the idempotency key cleaner
+	idempotencyCleaner := job.NewIdempotencyKeyCleaner(docStore)
+	go idempotencyCleaner.Run()
+
+	// Start the publish scheduler
+	scheduler := job.NewPublishScheduler(docStore, docs)
+	go scheduler.Run()
+
 	wg.Add(1)
 	// Start the grpc server
 	go func() {
@@ -0,0 +1,408 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	gatewayfile "github.com/black-06/grpc-gateway-file"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/objectstore"
+	"github.com/emrgen/document/internal/store"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// maxAttachmentSize is the largest attachment accepted by UploadAttachment
+const maxAttachmentSize = 1 << 30 // 1 GB
+
+// attachmentNameMetadata is the name of the attachment in the metadata of UploadAttachment
+const attachmentNameMetadata = "attachment-name"
+
+// uploadAttachmentField is the multipart form field holding the file of a rest upload
+const uploadAttachmentField = "file"
+
+// UploadAttachment attaches a file streamed in chunks to a document, the document gets a new version with the attachment.
+// The file is kept in the object store, a rest upload is a multipart form, a grpc upload streams the file as is.
+func (d DocumentService) UploadAttachment(server v1.DocumentService_UploadAttachmentServer) error {
+	ctx := server.Context()
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	docID, err := uuid.Parse(firstMetadata(md, documentIDMetadata))
+	if err != nil {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("invalid %s metadata: %v", documentIDMetadata, err))
+	}
+	var version *int64
+	if value := firstMetadata(md, documentVersionMetadata); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, fmt.Sprintf("invalid %s metadata: %v", documentVersionMetadata, err))
+		}
+		version = &parsed
+	}
+	name := firstMetadata(md, attachmentNameMetadata)
+
+	// the file is spooled to disk, so the size and the checksum are known before it is stored
+	file, err := os.CreateTemp("", "attachment-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	w := io.MultiWriter(file, hash)
+	contentType := ""
+	if _, err = gatewayfile.ParseBoundary(md); err == nil {
+		found := false
+		err = gatewayfile.ProcessMultipartUpload(server, func(part *multipart.Part) error {
+			if part.FormName() != uploadAttachmentField {
+				return nil
+			}
+			found = true
+			if name == "" {
+				name = part.FileName()
+			}
+			contentType = part.Header.Get("Content-Type")
+			_, err := io.Copy(w, part)
+			return err
+		}, maxAttachmentSize)
+		if err == nil && !found {
+			return status.Error(codes.InvalidArgument, fmt.Sprintf("missing the %s field", uploadAttachmentField))
+		}
+	} else {
+		contentType, err = receiveAttachment(server, w)
+	}
+	if errors.Is(err, gatewayfile.ErrSizeLimitExceeded) {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("attachment is larger than %d bytes", maxAttachmentSize))
+	}
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("missing the %s metadata", attachmentNameMetadata))
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if contentType == "" {
+		contentType, err = detectContentType(file, name)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	attachmentID := uuid.New().String()
+	attachment := &model.Attachment{
+		ID:          attachmentID,
+		DocumentID:  docID.String(),
+		Name:        name,
+		ContentType: contentType,
+		Size:        info.Size(),
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+		ObjectKey:   fmt.Sprintf("documents/%s/attachments/%s", docID, attachmentID),
+	}
+
+	// the object is stored first, it is deleted again when the document can not be updated
+	if err = d.objects.Put(ctx, attachment.ObjectKey, file, attachment.Size, attachment.ContentType); err != nil {
+		return err
+	}
+	doc, err := d.newAttachmentVersion(ctx, docID, version, func(tx store.Store, doc *model.Document) error {
+		attachment.AddedVersion = doc.Version
+		return tx.CreateAttachment(ctx, attachment)
+	})
+	if err != nil {
+		if err := d.objects.Delete(context.Background(), attachment.ObjectKey); err != nil {
+			logrus.Errorf("error deleting the object of attachment %s: %v", attachment.ID, err)
+		}
+		return err
+	}
+
+	return server.SendAndClose(&v1.UploadAttachmentResponse{
+		Attachment: attachmentProto(attachment),
+		Version:    doc.Version,
+	})
+}
+
+// GetAttachment streams an attachment of the current document version or of a published version.
+func (d DocumentService) GetAttachment(request *v1.GetAttachmentRequest, server v1.DocumentService_GetAttachmentServer) error {
+	ctx := server.Context()
+	docID, err := uuid.Parse(request.GetDocumentId())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	attachmentID, err := uuid.Parse(request.GetAttachmentId())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var attachments []*model.Attachment
+	if request.PublishedVersion != nil {
+		attachments, err = d.store.ListPublishedAttachments(ctx, docID, request.GetPublishedVersion())
+	} else {
+		var doc *model.Document
+		doc, err = d.store.GetDocument(ctx, docID)
+		if err != nil {
+			return err
+		}
+		attachments, err = d.store.ListAttachments(ctx, docID, doc.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	var attachment *model.Attachment
+	for _, a := range attachments {
+		if a.ID == attachmentID.String() {
+			attachment = a
+		}
+	}
+	if attachment == nil {
+		return status.Error(codes.NotFound, fmt.Sprintf("attachment %s not found", attachmentID))
+	}
+
+	object, err := d.objects.Get(ctx, attachment.ObjectKey)
+	if errors.Is(err, objectstore.ErrObjectNotFound) {
+		return status.Error(codes.NotFound, fmt.Sprintf("the file of attachment %s not found", attachmentID))
+	}
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	// the ranges are served by seeking, the objects of a store that can not seek are read in memory
+	content, ok := object.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(object)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(data)
+	}
+
+	return gatewayfile.ServeContent(server, content, attachment.ContentType, attachment.Name, attachment.CreatedAt, attachment.Size)
+}
+
+// ListAttachments lists the attachments of a document version, the current version by default.
+func (d DocumentService) ListAttachments(ctx context.Context, request *v1.ListAttachmentsRequest) (*v1.ListAttachmentsResponse, error) {
+	docID, err := uuid.Parse(request.GetDocumentId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var attachments []*model.Attachment
+	if request.PublishedVersion != nil {
+		if _, err = d.store.GetPublishedDocumentMetaByVersion(ctx, docID, request.GetPublishedVersion()); err != nil {
+			return nil, err
+		}
+		attachments, err = d.store.ListPublishedAttachments(ctx, docID, request.GetPublishedVersion())
+	} else {
+		doc, err := d.store.GetDocument(ctx, docID)
+		if err != nil {
+			return nil, err
+		}
+		version := doc.Version
+		if request.Version != nil {
+			if request.GetVersion() < 1 || request.GetVersion() > doc.Version {
+				return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("document %s has no version %d", docID, request.GetVersion()))
+			}
+			version = request.GetVersion()
+		}
+		attachments, err = d.store.ListAttachments(ctx, docID, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := &v1.ListAttachmentsResponse{}
+	for _, attachment := range attachments {
+		res.Attachments = append(res.Attachments, attachmentProto(attachment))
+	}
+
+	return res, nil
+}
+
+// DeleteAttachment removes an attachment from a document, the document gets a new version without the attachment.
+// The file is kept, the previous versions and the published versions still have the attachment.
+func (d DocumentService) DeleteAttachment(ctx context.Context, request *v1.DeleteAttachmentRequest) (*v1.DeleteAttachmentResponse, error) {
+	docID, err := uuid.Parse(request.GetDocumentId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	attachmentID, err := uuid.Parse(request.GetAttachmentId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	doc, err := d.newAttachmentVersion(ctx, docID, request.Version, func(tx store.Store, doc *model.Document) error {
+		attachment, err := tx.GetAttachment(ctx, docID, attachmentID)
+		if errors.Is(err, store.ErrAttachmentNotFound) || (err == nil && attachment.RemovedVersion != 0) {
+			return status.Error(codes.NotFound, fmt.Sprintf("attachment %s not found", attachmentID))
+		}
+		if err != nil {
+			return err
+		}
+		return tx.RemoveAttachment(ctx, attachmentID, doc.Version)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.DeleteAttachmentResponse{Version: doc.Version}, nil
+}
+
+// newAttachmentVersion saves a new version of the document with a backup of the current version, the change adds or removes an attachment.
+// The version is checked like the version of UpdateDocument when it is given.
+func (d DocumentService) newAttachmentVersion(ctx context.Context, docID uuid.UUID, version *int64, change func(tx store.Store, doc *model.Document) error) (*model.Document, error) {
+	var doc *model.Document
+	err := d.store.Transaction(ctx, func(tx store.Store) error {
+		var err error
+		doc, err = tx.GetDocument(ctx, docID)
+		if err != nil {
+			return err
+		}
+		if version != nil && *version != -1 && *version != doc.Version+1 {
+			return status.New(codes.FailedPrecondition, fmt.Sprintf("current version: %d, expected version %d, provider version: %d, ", doc.Version, doc.Version+1, *version)).Err()
+		}
+
+		content, _, err := d.assembleParts(ctx, tx, doc)
+		if err != nil {
+			return err
+		}
+		backup := &model.DocumentBackup{
+			ID:       doc.ID,
+			Version:  doc.Version,
+			Meta:     doc.Meta,
+			Content:  content,
+			Links:    doc.Links,
+			Children: doc.Children,
+		}
+
+		doc.Version = doc.Version + 1
+		saved, err := tx.UpdateDocumentVersion(ctx, doc, backup.Version)
+		if err != nil {
+			return err
+		}
+		if !saved {
+			return status.Error(codes.FailedPrecondition, fmt.Sprintf("document %s changed concurrently", docID))
+		}
+		if err = change(tx, doc); err != nil {
+			return err
+		}
+
+		return tx.CreateDocumentBackup(ctx, backup)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// savePublishedAttachments freezes the attachments of the draft into the published document version
+func savePublishedAttachments(ctx context.Context, tx store.Store, doc *model.PublishedDocument, attachments []*model.Attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	published := make([]*model.PublishedAttachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		published = append(published, &model.PublishedAttachment{
+			DocumentID:   doc.ID,
+			Version:      doc.Version,
+			AttachmentID: attachment.ID,
+		})
+	}
+
+	return tx.CreatePublishedAttachments(ctx, published)
+}
+
+// sameAttachments reports whether both lists hold the same attachments
+func sameAttachments(a, b []*model.Attachment) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	ids := make(map[string]bool, len(a))
+	for _, attachment := range a {
+		ids[attachment.ID] = true
+	}
+	for _, attachment := range b {
+		if !ids[attachment.ID] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// receiveAttachment writes the chunks of a grpc upload until the client closes the stream and returns the content type of the chunks
+func receiveAttachment(server v1.DocumentService_UploadAttachmentServer, w io.Writer) (string, error) {
+	contentType := ""
+	size := 0
+	for {
+		body, err := server.Recv()
+		if errors.Is(err, io.EOF) {
+			return contentType, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if contentType == "" {
+			contentType = body.GetContentType()
+		}
+		size += len(body.GetData())
+		if size > maxAttachmentSize {
+			return "", gatewayfile.ErrSizeLimitExceeded
+		}
+		if _, err = w.Write(body.GetData()); err != nil {
+			return "", err
+		}
+	}
+}
+
+// detectContentType guesses the content type of a file from its name, then from its first bytes
+func detectContentType(file *os.File, name string) (string, error) {
+	if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+		return contentType, nil
+	}
+
+	var buf [512]byte
+	n, err := file.ReadAt(buf[:], 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return http.DetectContentType(buf[:n]), nil
+}
+
+func attachmentProto(attachment *model.Attachment) *v1.Attachment {
+	return &v1.Attachment{
+		Id:           attachment.ID,
+		DocumentId:   attachment.DocumentID,
+		Name:         attachment.Name,
+		ContentType:  attachment.ContentType,
+		Size:         attachment.Size,
+		Checksum:     attachment.Checksum,
+		AddedVersion: attachment.AddedVersion,
+		CreatedAt:    timestamppb.New(attachment.CreatedAt),
+	}
+}
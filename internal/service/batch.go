@@ -0,0 +1,343 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/search"
+	"github.com/emrgen/document/internal/store"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+// BatchWrite runs the create, update, delete and link operations of the batch in order.
+// In the atomic mode the operations share a transaction and the first failed operation rolls back the batch,
+// in the best effort mode each operation is saved on its own and the batch goes on after a failure.
+func (d DocumentService) BatchWrite(ctx context.Context, request *v1.BatchWriteRequest) (*v1.BatchWriteResponse, error) {
+	operations := request.GetOperations()
+	tempIDs, err := batchTempIDs(operations)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &v1.BatchWriteResponse{TempIds: tempIDs}
+
+	if request.GetMode() == v1.BatchMode_BATCH_BEST_EFFORT {
+		for i, operation := range operations {
+			result, _, err := d.batchOperation(ctx, i, operation, tempIDs)
+			if err != nil {
+				res.Failed++
+			}
+			res.Results = append(res.Results, result)
+		}
+
+		return res, nil
+	}
+
+	// the index is updated after the commit, so a rolled back batch does not reach the index
+	var touched []string
+	failed := false
+	err = d.store.Transaction(ctx, func(tx store.Store) error {
+		docs := d
+		docs.store = tx
+		docs.index = search.NewNop()
+
+		for i, operation := range operations {
+			result, ids, err := docs.batchOperation(ctx, i, operation, tempIDs)
+			res.Results = append(res.Results, result)
+			if err != nil {
+				failed = true
+				return err
+			}
+			touched = append(touched, ids...)
+		}
+
+		return nil
+	})
+	if err != nil && !failed {
+		return nil, err
+	}
+
+	if failed {
+		res.Failed = 1
+		for _, result := range res.Results[:len(res.Results)-1] {
+			result.Code = int32(codes.Aborted)
+			result.Message = "rolled back"
+			result.Version = 0
+		}
+		for i := len(res.Results); i < len(operations); i++ {
+			res.Results = append(res.Results, &v1.BatchResult{
+				Index:   int32(i),
+				Code:    int32(codes.Aborted),
+				Message: "not run",
+			})
+		}
+
+		return res, nil
+	}
+
+	d.reindexDocuments(ctx, touched)
+
+	return res, nil
+}
+
+// batchOperation runs an operation of the batch and returns its result with the ids of the documents it changed
+func (d DocumentService) batchOperation(ctx context.Context, index int, operation *v1.BatchOperation, tempIDs map[string]string) (*v1.BatchResult, []string, error) {
+	result := &v1.BatchResult{Index: int32(index)}
+	var touched []string
+
+	err := func() error {
+		switch op := operation.GetOperation().(type) {
+		case *v1.BatchOperation_Create:
+			req := op.Create
+			if operation.GetTempId() != "" {
+				id := tempIDs[operation.GetTempId()]
+				req.DocumentId = &id
+			}
+			links, children, err := resolveTempReferences(req.GetLinks(), req.GetChildren(), tempIDs)
+			if err != nil {
+				return err
+			}
+			req.Links = links
+			req.Children = children
+
+			created, err := d.CreateDocument(ctx, req)
+			if err != nil {
+				return err
+			}
+			result.DocumentId = created.Document.Id
+		case *v1.BatchOperation_Update:
+			req := op.Update
+			id, err := resolveTempID(req.GetDocumentId(), tempIDs)
+			if err != nil {
+				return err
+			}
+			links, children, err := resolveTempReferences(req.GetLinks(), req.GetChildren(), tempIDs)
+			if err != nil {
+				return err
+			}
+			req.DocumentId = id
+			if req.Links != nil {
+				req.Links = links
+			}
+			if req.Children != nil {
+				req.Children = children
+			}
+			if err = req.Validate(); err != nil {
+				return status.Error(codes.InvalidArgument, err.Error())
+			}
+
+			updated, err := d.updateDocument(ctx, req, "")
+			if err != nil {
+				return err
+			}
+			result.DocumentId = id
+			result.Version = int64(updated.Version)
+		case *v1.BatchOperation_Delete:
+			req := op.Delete
+			id, err := resolveTempID(req.GetId(), tempIDs)
+			if err != nil {
+				return err
+			}
+			req.Id = id
+			if err = req.Validate(); err != nil {
+				return status.Error(codes.InvalidArgument, err.Error())
+			}
+
+			deleted, err := d.DeleteDocument(ctx, req)
+			if err != nil {
+				return err
+			}
+			result.DocumentId = id
+			touched = append(touched, deleted.Report.GetDeletedIds()...)
+			for _, doc := range deleted.Report.GetDetached() {
+				touched = append(touched, doc.Id)
+			}
+		case *v1.BatchOperation_Link:
+			id, version, err := d.batchLink(ctx, op.Link, tempIDs)
+			if err != nil {
+				return err
+			}
+			result.DocumentId = id
+			result.Version = version
+		default:
+			return status.Error(codes.InvalidArgument, "empty batch operation")
+		}
+
+		return nil
+	}()
+
+	if result.DocumentId != "" {
+		touched = append(touched, result.DocumentId)
+	}
+	if err != nil {
+		st := status.Convert(err)
+		result.Code = int32(st.Code())
+		result.Message = st.Message()
+		return result, nil, err
+	}
+
+	return result, touched, nil
+}
+
+// batchLink adds or removes a link of the source document, the document is not saved if the link is unchanged
+func (d DocumentService) batchLink(ctx context.Context, link *v1.BatchLink, tempIDs map[string]string) (string, int64, error) {
+	sourceID, err := resolveTempID(link.GetSourceId(), tempIDs)
+	if err != nil {
+		return "", 0, err
+	}
+	target, err := resolveTempRef(link.GetTarget(), tempIDs)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, _, err = parseIDVersion(target); err != nil {
+		return "", 0, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	doc, err := d.store.GetDocument(ctx, uuid.MustParse(sourceID))
+	if err != nil {
+		return "", 0, err
+	}
+	links, err := decodeLinks(d.compress, doc.Links)
+	if err != nil {
+		return "", 0, err
+	}
+
+	value, exists := links[target]
+	if link.GetRemove() {
+		if !exists {
+			return doc.ID, doc.Version, nil
+		}
+		delete(links, target)
+	} else {
+		if exists && value == link.GetValue() {
+			return doc.ID, doc.Version, nil
+		}
+		links[target] = link.GetValue()
+	}
+
+	updated, err := d.updateDocument(ctx, &v1.UpdateDocumentRequest{
+		DocumentId: doc.ID,
+		Links:      links,
+		Version:    doc.Version + 1,
+	}, "")
+	if err != nil {
+		return "", 0, err
+	}
+
+	return doc.ID, int64(updated.Version), nil
+}
+
+// reindexDocuments indexes the documents that still exist and removes the others from the index
+func (d DocumentService) reindexDocuments(ctx context.Context, ids []string) {
+	seen := make(map[string]bool)
+	var docIDs []uuid.UUID
+	for _, id := range ids {
+		if docID, err := uuid.Parse(id); err == nil && !seen[id] {
+			seen[id] = true
+			docIDs = append(docIDs, docID)
+		}
+	}
+	if len(docIDs) == 0 {
+		return
+	}
+
+	docs, err := d.store.ListDocumentsFromIDs(ctx, docIDs)
+	if err != nil {
+		return
+	}
+	for _, doc := range docs {
+		delete(seen, doc.ID)
+		d.indexDocument(ctx, doc)
+	}
+	for id := range seen {
+		d.removeDocumentFromIndex(ctx, id)
+	}
+}
+
+// batchTempIDs assigns the ids of the documents created with a temp id, a create with a document id keeps it
+func batchTempIDs(operations []*v1.BatchOperation) (map[string]string, error) {
+	tempIDs := make(map[string]string)
+	for i, operation := range operations {
+		tempID := operation.GetTempId()
+		if tempID == "" {
+			continue
+		}
+
+		create := operation.GetCreate()
+		if create == nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("operation %d: only a create operation can have a temp id", i))
+		}
+		if _, ok := tempIDs[tempID]; ok {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("operation %d: duplicate temp id %s", i, tempID))
+		}
+
+		if create.DocumentId != nil {
+			tempIDs[tempID] = create.GetDocumentId()
+		} else {
+			tempIDs[tempID] = uuid.New().String()
+		}
+	}
+
+	return tempIDs, nil
+}
+
+// resolveTempID replaces a $<temp_id> with the id of the document created in the batch
+func resolveTempID(id string, tempIDs map[string]string) (string, error) {
+	if strings.HasPrefix(id, "$") {
+		docID, ok := tempIDs[id[1:]]
+		if !ok {
+			return "", status.Error(codes.InvalidArgument, fmt.Sprintf("unknown temp id %s", id))
+		}
+		return docID, nil
+	}
+
+	if _, err := uuid.Parse(id); err != nil {
+		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("invalid document id %s", id))
+	}
+
+	return id, nil
+}
+
+// resolveTempRef replaces a $<temp_id> in a <id>@<version> reference
+func resolveTempRef(ref string, tempIDs map[string]string) (string, error) {
+	if !strings.HasPrefix(ref, "$") {
+		return ref, nil
+	}
+
+	id, version, err := parseIDVersion(ref)
+	if err != nil {
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	}
+	docID, err := resolveTempID(id, tempIDs)
+	if err != nil {
+		return "", err
+	}
+
+	return docID + "@" + version, nil
+}
+
+// resolveTempReferences replaces the temp ids in the link keys and children
+func resolveTempReferences(links map[string]string, children []string, tempIDs map[string]string) (map[string]string, []string, error) {
+	resolvedLinks := make(map[string]string, len(links))
+	for key, value := range links {
+		ref, err := resolveTempRef(key, tempIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+		resolvedLinks[ref] = value
+	}
+
+	resolvedChildren := make([]string, 0, len(children))
+	for _, child := range children {
+		ref, err := resolveTempRef(child, tempIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+		resolvedChildren = append(resolvedChildren, ref)
+	}
+
+	return resolvedLinks, resolvedChildren, nil
+}
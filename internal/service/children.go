@@ -0,0 +1,371 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/store"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sort"
+	"strings"
+)
+
+// fractionalDigits are the digits of the fractional index keys in sort order
+const fractionalDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// maxChildEditAttempts is the number of times a children edit is retried when a concurrent edit saved the document first
+const maxChildEditAttempts = 5
+
+// errChildrenConflict is returned inside the transaction when the document version changed while editing the children
+var errChildrenConflict = errors.New("children changed concurrently")
+
+// InsertChild inserts a child document at a position, the edit is applied on the latest version of the children.
+func (d DocumentService) InsertChild(ctx context.Context, request *v1.InsertChildRequest) (*v1.InsertChildResponse, error) {
+	child := request.GetChild()
+	childID, childVersion, err := parseIDVersion(child)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, ErrInvalidChildrenLinkFormat.Error())
+	}
+	if _, err = uuid.Parse(childID); err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("%s: %s", ErrInvalidLinkTarget, childID))
+	}
+
+	var key string
+	doc, children, err := d.editChildren(ctx, request.GetDocumentId(), request.Version, func(tx store.Store, children, keys []string) ([]string, []string, error) {
+		if indexOf(children, child) != -1 {
+			return nil, nil, status.Error(codes.AlreadyExists, fmt.Sprintf("%s is a child already", child))
+		}
+
+		if err := checkLinkTargets(ctx, tx, []*model.Link{{TargetID: childID, TargetVersion: childVersion}}); err != nil {
+			return nil, nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+
+		var err error
+		key, err = childPosition(children, keys, request.GetPosition())
+		if err != nil {
+			return nil, nil, err
+		}
+		children, keys = insertChild(children, keys, child, key)
+
+		return children, keys, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.InsertChildResponse{
+		DocumentId: doc.ID,
+		Version:    doc.Version,
+		Key:        key,
+		Children:   children,
+	}, nil
+}
+
+// MoveChild moves a child document to another position among its siblings.
+func (d DocumentService) MoveChild(ctx context.Context, request *v1.MoveChildRequest) (*v1.MoveChildResponse, error) {
+	child := request.GetChild()
+
+	var key string
+	doc, children, err := d.editChildren(ctx, request.GetDocumentId(), request.Version, func(tx store.Store, children, keys []string) ([]string, []string, error) {
+		index := indexOf(children, child)
+		if index == -1 {
+			return nil, nil, status.Error(codes.NotFound, fmt.Sprintf("%s is not a child", child))
+		}
+		position := request.GetPosition()
+		if position.GetAfter() == child || position.GetBefore() == child {
+			return nil, nil, status.Error(codes.InvalidArgument, "a child can not be moved next to itself")
+		}
+
+		children = append(children[:index:index], children[index+1:]...)
+		keys = append(keys[:index:index], keys[index+1:]...)
+
+		var err error
+		key, err = childPosition(children, keys, position)
+		if err != nil {
+			return nil, nil, err
+		}
+		children, keys = insertChild(children, keys, child, key)
+
+		return children, keys, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.MoveChildResponse{
+		DocumentId: doc.ID,
+		Version:    doc.Version,
+		Key:        key,
+		Children:   children,
+	}, nil
+}
+
+// RemoveChild removes a child document from the children.
+func (d DocumentService) RemoveChild(ctx context.Context, request *v1.RemoveChildRequest) (*v1.RemoveChildResponse, error) {
+	child := request.GetChild()
+
+	doc, children, err := d.editChildren(ctx, request.GetDocumentId(), request.Version, func(tx store.Store, children, keys []string) ([]string, []string, error) {
+		index := indexOf(children, child)
+		if index == -1 {
+			return nil, nil, status.Error(codes.NotFound, fmt.Sprintf("%s is not a child", child))
+		}
+
+		children = append(children[:index:index], children[index+1:]...)
+		keys = append(keys[:index:index], keys[index+1:]...)
+
+		return children, keys, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.RemoveChildResponse{
+		DocumentId: doc.ID,
+		Version:    doc.Version,
+		Children:   children,
+	}, nil
+}
+
+// editChildren applies the edit to the latest children of the document and saves them as a new version.
+// Without an expected version the edit is retried on the new children when a concurrent edit saved the document first,
+// with the version the edit fails like UpdateDocument when the version does not match.
+func (d DocumentService) editChildren(ctx context.Context, id string, version *int64, edit func(tx store.Store, children, keys []string) ([]string, []string, error)) (*model.Document, []string, error) {
+	docID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	for attempt := 0; attempt < maxChildEditAttempts; attempt++ {
+		var doc *model.Document
+		var children []string
+		err = d.store.Transaction(ctx, func(tx store.Store) error {
+			var err error
+			doc, err = tx.GetDocument(ctx, docID)
+			if err != nil {
+				return err
+			}
+			if version != nil && *version != doc.Version+1 {
+				return status.New(codes.FailedPrecondition, fmt.Sprintf("current version: %d, expected version %d, provider version: %d, ", doc.Version, doc.Version+1, *version)).Err()
+			}
+
+			children, err = decodeChildren(d.compress, doc.Children)
+			if err != nil {
+				return err
+			}
+			keys := childKeys(children, doc.ChildKeys)
+
+			children, keys, err = edit(tx, children, keys)
+			if err != nil {
+				return err
+			}
+
+			content, _, err := d.assembleParts(ctx, tx, doc)
+			if err != nil {
+				return err
+			}
+			backup := &model.DocumentBackup{
+				ID:       doc.ID,
+				Version:  doc.Version,
+				Meta:     doc.Meta,
+				Content:  content,
+				Links:    doc.Links,
+				Children: doc.Children,
+			}
+
+			if doc.Children, err = encodeChildren(d.compress, children); err != nil {
+				return err
+			}
+			keysData, err := json.Marshal(keys)
+			if err != nil {
+				return err
+			}
+			doc.ChildKeys = string(keysData)
+			doc.Version = doc.Version + 1
+
+			saved, err := tx.UpdateDocumentChildren(ctx, doc, backup.Version)
+			if err != nil {
+				return err
+			}
+			if !saved {
+				return errChildrenConflict
+			}
+			if err = d.saveChildEdges(ctx, tx, doc); err != nil {
+				return err
+			}
+
+			// the backup is created after the update, so a concurrent edit of the same version does not create it twice
+			return tx.CreateDocumentBackup(ctx, backup)
+		})
+		if errors.Is(err, errChildrenConflict) && version == nil {
+			continue
+		}
+		if errors.Is(err, errChildrenConflict) {
+			return nil, nil, status.Error(codes.FailedPrecondition, "document changed concurrently")
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		d.indexDocument(ctx, doc)
+		return doc, children, nil
+	}
+
+	return nil, nil, status.Error(codes.Aborted, "too many concurrent edits of the children, try again")
+}
+
+// childPosition returns the key for a child placed at the position among the children ordered by the keys
+func childPosition(children, keys []string, position *v1.ChildPosition) (string, error) {
+	if position == nil {
+		position = &v1.ChildPosition{}
+	}
+
+	switch {
+	case position.Key != nil:
+		key := position.GetKey()
+		if !validKey(key) {
+			return "", status.Error(codes.InvalidArgument, fmt.Sprintf("invalid child key %q", key))
+		}
+		// a key taken by a concurrent insert is placed right after it
+		index := sort.SearchStrings(keys, key)
+		if index < len(keys) && keys[index] == key {
+			return keyBetween(key, keyAt(keys, index+1)), nil
+		}
+		return key, nil
+	case position.After != nil:
+		index := indexOf(children, position.GetAfter())
+		if index == -1 {
+			return "", status.Error(codes.NotFound, fmt.Sprintf("%s is not a child", position.GetAfter()))
+		}
+		return keyBetween(keys[index], keyAt(keys, index+1)), nil
+	case position.Before != nil:
+		index := indexOf(children, position.GetBefore())
+		if index == -1 {
+			return "", status.Error(codes.NotFound, fmt.Sprintf("%s is not a child", position.GetBefore()))
+		}
+		return keyBetween(keyAt(keys, index-1), keys[index]), nil
+	default:
+		return keyBetween(keyAt(keys, len(keys)-1), ""), nil
+	}
+}
+
+// insertChild inserts the child at the place of the key
+func insertChild(children, keys []string, child, key string) ([]string, []string) {
+	index := sort.SearchStrings(keys, key)
+
+	children = append(children[:index:index], append([]string{child}, children[index:]...)...)
+	keys = append(keys[:index:index], append([]string{key}, keys[index:]...)...)
+
+	return children, keys
+}
+
+// childKeys decodes the keys of the children, new keys are generated if they do not match the children.
+// The children can be rewritten by UpdateDocument, so the keys are only kept while they still order the children.
+func childKeys(children []string, data string) []string {
+	var keys []string
+	if err := json.Unmarshal([]byte(data), &keys); err == nil && len(keys) == len(children) && sort.StringsAreSorted(keys) {
+		valid := true
+		for i, key := range keys {
+			if !validKey(key) || i > 0 && keys[i-1] == key {
+				valid = false
+				break
+			}
+		}
+		if valid {
+			return keys
+		}
+	}
+
+	keys = make([]string, 0, len(children))
+	key := ""
+	for range children {
+		key = keyBetween(key, "")
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// keyBetween returns a key that sorts between a and b, an empty a is the start and an empty b is the end.
+// The keys are fractions in base 62 without the leading zero point, they never end with a zero digit.
+func keyBetween(a, b string) string {
+	if b != "" {
+		// the common prefix is kept
+		n := 0
+		for n < len(b) && digitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + keyBetween(rest, b[n:])
+		}
+	}
+
+	digitA := 0
+	if a != "" {
+		digitA = strings.IndexByte(fractionalDigits, a[0])
+	}
+	digitB := len(fractionalDigits)
+	if b != "" {
+		digitB = strings.IndexByte(fractionalDigits, b[0])
+	}
+
+	if digitB-digitA > 1 {
+		return string(fractionalDigits[(digitA+digitB+1)/2])
+	}
+	if b != "" && len(b) > 1 {
+		return b[:1]
+	}
+
+	rest := ""
+	if a != "" {
+		rest = a[1:]
+	}
+	return string(fractionalDigits[digitA]) + keyBetween(rest, "")
+}
+
+// digitAt returns the digit of the key at the index, a key is padded with zeros
+func digitAt(key string, index int) byte {
+	if index < len(key) {
+		return key[index]
+	}
+	return fractionalDigits[0]
+}
+
+// keyAt returns the key at the index, empty outside the keys
+func keyAt(keys []string, index int) string {
+	if index < 0 || index >= len(keys) {
+		return ""
+	}
+	return keys[index]
+}
+
+// validKey checks the key only has fractional digits and does not end with a zero
+func validKey(key string) bool {
+	if key == "" || key[len(key)-1] == fractionalDigits[0] {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if strings.IndexByte(fractionalDigits, key[i]) == -1 {
+			return false
+		}
+	}
+	return true
+}
+
+// indexOf returns the index of the reference, -1 if it is not found
+func indexOf(refs []string, ref string) int {
+	for i, r := range refs {
+		if r == ref {
+			return i
+		}
+	}
+	return -1
+}
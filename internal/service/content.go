@@ -0,0 +1,141 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	gatewayfile "github.com/black-06/grpc-gateway-file"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"mime/multipart"
+	"strconv"
+)
+
+// maxUploadContentSize is the largest content accepted by UploadDocumentContent, the content is updated as a whole
+// so the update holds it several times over with the backup, the compressed copies and the search index
+const maxUploadContentSize = 16 << 20 // 16 MB
+
+// the metadata of UploadDocumentContent, rest clients send them as Grpc-Metadata-* headers
+const (
+	documentIDMetadata      = "document-id"
+	documentVersionMetadata = "document-version"
+)
+
+// uploadContentField is the multipart form field holding the content of a rest upload
+const uploadContentField = "content"
+
+// UploadDocumentContent replaces the content of a document with the content streamed in chunks.
+// The version in the metadata is checked like the version of UpdateDocument, -1 overwrites the document.
+// A rest upload is a multipart form, a grpc upload streams the content as is.
+func (d DocumentService) UploadDocumentContent(server v1.DocumentService_UploadDocumentContentServer) error {
+	ctx := server.Context()
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	docID := firstMetadata(md, documentIDMetadata)
+	if _, err := uuid.Parse(docID); err != nil {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("invalid %s metadata: %v", documentIDMetadata, err))
+	}
+	version, err := strconv.ParseInt(firstMetadata(md, documentVersionMetadata), 10, 64)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("invalid %s metadata: %v", documentVersionMetadata, err))
+	}
+
+	var buf bytes.Buffer
+	if _, err = gatewayfile.ParseBoundary(md); err == nil {
+		found := false
+		err = gatewayfile.ProcessMultipartUpload(server, func(part *multipart.Part) error {
+			if part.FormName() != uploadContentField {
+				return nil
+			}
+			found = true
+			_, err := io.Copy(&buf, part)
+			return err
+		}, maxUploadContentSize)
+		if err == nil && !found {
+			return status.Error(codes.InvalidArgument, fmt.Sprintf("missing the %s field", uploadContentField))
+		}
+	} else {
+		err = receiveContent(server, &buf)
+	}
+	if errors.Is(err, gatewayfile.ErrSizeLimitExceeded) {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("content is larger than %d bytes", maxUploadContentSize))
+	}
+	if err != nil {
+		return err
+	}
+
+	// the content is saved as a whole, the chunks only keep the messages under the grpc size limit.
+	// the buffer is dropped once copied so the update does not hold both
+	size := int64(buf.Len())
+	content := buf.String()
+	buf = bytes.Buffer{}
+	res, err := d.UpdateDocument(ctx, &v1.UpdateDocumentRequest{
+		DocumentId: docID,
+		Content:    &content,
+		Version:    version,
+	})
+	if err != nil {
+		return err
+	}
+
+	return server.SendAndClose(&v1.UploadDocumentContentResponse{
+		DocumentId: docID,
+		Version:    int64(res.Version),
+		Size:       size,
+	})
+}
+
+// DownloadDocumentContent streams the content of a document in chunks, the content type is detected from the content.
+func (d DocumentService) DownloadDocumentContent(request *v1.DownloadDocumentContentRequest, server v1.DocumentService_DownloadDocumentContentServer) error {
+	ctx := server.Context()
+	docID, err := uuid.Parse(request.GetDocumentId())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	doc, err := d.store.GetDocument(ctx, docID)
+	if err != nil {
+		return err
+	}
+	content, _, err := d.assembleParts(ctx, d.store, doc)
+	if err != nil {
+		return err
+	}
+	data, err := d.compress.Decode([]byte(content))
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s@%d", doc.ID, doc.Version)
+	return gatewayfile.ServeContent(server, bytes.NewReader(data), "", name, doc.UpdatedAt, int64(len(data)))
+}
+
+// receiveContent reads the chunks of a grpc upload until the client closes the stream
+func receiveContent(server v1.DocumentService_UploadDocumentContentServer, buf *bytes.Buffer) error {
+	for {
+		body, err := server.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if buf.Len()+len(body.GetData()) > maxUploadContentSize {
+			return gatewayfile.ErrSizeLimitExceeded
+		}
+		buf.Write(body.GetData())
+	}
+}
+
+// firstMetadata returns the first value of the metadata key
+func firstMetadata(md metadata.MD, key string) string {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -0,0 +1,332 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/store"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sort"
+)
+
+// deleteDocument soft deletes or erases the document following the delete policy and reports what changed.
+// Only the references to the current version are affected by a delete, the published versions stay as they are.
+func (d DocumentService) deleteDocument(ctx context.Context, id uuid.UUID, policy v1.DeletePolicy, erase bool) (*v1.DeleteReport, error) {
+	report := &v1.DeleteReport{}
+	var detached []*model.Document
+	var erasedAttachments []*model.Attachment
+
+	err := d.store.Transaction(ctx, func(tx store.Store) error {
+		var doc *model.Document
+		var err error
+		if erase {
+			// a soft deleted document can still be erased
+			doc, err = tx.GetDocumentIncludingDeleted(ctx, id)
+		} else {
+			doc, err = tx.GetDocument(ctx, id)
+		}
+		if err != nil {
+			return err
+		}
+
+		docs := []*model.Document{doc}
+		if policy == v1.DeletePolicy_DELETE_CASCADE {
+			docs, err = d.subtree(ctx, tx, doc)
+			if err != nil {
+				return err
+			}
+		}
+
+		deleting := make(map[string]bool)
+		for _, doc := range docs {
+			deleting[doc.ID] = true
+			report.DeletedIds = append(report.DeletedIds, doc.ID)
+		}
+
+		sources, refs, err := d.referencesTo(ctx, tx, docs, deleting)
+		if err != nil {
+			return err
+		}
+
+		switch policy {
+		case v1.DeletePolicy_DELETE_RESTRICT:
+			if len(refs) > 0 {
+				st, err := status.New(codes.FailedPrecondition, fmt.Sprintf("document %s is referenced by %d links or children", id, len(refs))).
+					WithDetails(&v1.DanglingReferences{References: refs})
+				if err != nil {
+					return err
+				}
+				return st.Err()
+			}
+		case v1.DeletePolicy_DELETE_DETACH:
+			detached, report.Detached, err = d.detachReferences(ctx, tx, sources, refs)
+			if err != nil {
+				return err
+			}
+		default:
+			report.Dangling = refs
+		}
+
+		for _, doc := range docs {
+			docID := uuid.MustParse(doc.ID)
+			if !erase {
+				if err = tx.DeleteDocument(ctx, docID); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err = tx.EraseDocument(ctx, docID); err != nil {
+				return err
+			}
+			links, err := tx.DeleteLinks(ctx, docID)
+			if err != nil {
+				return err
+			}
+			if err = tx.DeleteDocumentChildEdges(ctx, docID); err != nil {
+				return err
+			}
+			if err = tx.DeleteDocumentParts(ctx, docID); err != nil {
+				return err
+			}
+			backups, err := tx.EraseDocumentBackups(ctx, docID)
+			if err != nil {
+				return err
+			}
+			indexes, err := tx.EraseDocumentTreeIndexes(ctx, docID)
+			if err != nil {
+				return err
+			}
+			// the attachments frozen into a published version are kept with it
+			attachments, err := tx.EraseAttachments(ctx, docID)
+			if err != nil {
+				return err
+			}
+			erasedAttachments = append(erasedAttachments, attachments...)
+			report.ErasedLinks += int32(links)
+			report.ErasedBackups += int32(backups)
+			report.ErasedIndexes += int32(indexes)
+			report.ErasedAttachments += int32(len(attachments))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the files are deleted once the erase is committed, a failed delete leaves an unreferenced file behind
+	for _, attachment := range erasedAttachments {
+		if err := d.objects.Delete(ctx, attachment.ObjectKey); err != nil {
+			logrus.Errorf("error deleting the object of attachment %s: %v", attachment.ID, err)
+		}
+	}
+	for _, id := range report.DeletedIds {
+		d.removeDocumentFromIndex(ctx, id)
+	}
+	for _, doc := range detached {
+		d.indexDocument(ctx, doc)
+	}
+
+	return report, nil
+}
+
+// subtree returns the document and all the documents under it through the children, in breadth first order
+func (d DocumentService) subtree(ctx context.Context, tx store.Store, root *model.Document) ([]*model.Document, error) {
+	docs := []*model.Document{root}
+	seen := map[string]bool{root.ID: true}
+
+	for level := docs; len(level) > 0; {
+		var childIDs []uuid.UUID
+		for _, doc := range level {
+			children, err := decodeChildren(d.compress, doc.Children)
+			if err != nil {
+				return nil, err
+			}
+			for _, child := range children {
+				childID, _, err := parseIDVersion(child)
+				if err != nil {
+					return nil, ErrInvalidChildrenLinkFormat
+				}
+				if seen[childID] {
+					continue
+				}
+				seen[childID] = true
+				if id, err := uuid.Parse(childID); err == nil {
+					childIDs = append(childIDs, id)
+				}
+			}
+		}
+		if len(childIDs) == 0 {
+			break
+		}
+
+		// children already deleted or erased are skipped
+		next, err := tx.ListDocumentsFromIDs(ctx, childIDs)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, next...)
+		level = next
+	}
+
+	return docs, nil
+}
+
+// referencesTo returns the documents outside the deleted set that link to or list a deleted document as a child,
+// with the references to the current version of the deleted documents.
+// The sources are found from the links table and the child edges, in any project.
+func (d DocumentService) referencesTo(ctx context.Context, tx store.Store, docs []*model.Document, deleting map[string]bool) (map[string]*model.Document, []*v1.DanglingReference, error) {
+	sources := make(map[string]*model.Document)
+
+	var sourceIDs []uuid.UUID
+	seen := make(map[string]bool)
+	addSource := func(id string) {
+		if deleting[id] || seen[id] {
+			return
+		}
+		if sourceID, err := uuid.Parse(id); err == nil {
+			seen[id] = true
+			sourceIDs = append(sourceIDs, sourceID)
+		}
+	}
+
+	docIDs := make([]uuid.UUID, 0, len(docs))
+	for _, doc := range docs {
+		docID := uuid.MustParse(doc.ID)
+		docIDs = append(docIDs, docID)
+
+		backlinks, err := tx.ListBacklinks(ctx, docID)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, link := range backlinks {
+			addSource(link.SourceID)
+		}
+	}
+
+	edges, err := tx.ListDocumentParentEdgesFromIDs(ctx, docIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, edge := range edges {
+		addSource(edge.ParentID)
+	}
+
+	if len(sourceIDs) > 0 {
+		sourceDocs, err := tx.ListDocumentsFromIDs(ctx, sourceIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, doc := range sourceDocs {
+			sources[doc.ID] = doc
+		}
+	}
+
+	ids := make([]string, 0, len(sources))
+	for id := range sources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var refs []*v1.DanglingReference
+	for _, id := range ids {
+		doc := sources[id]
+		links, err := decodeLinks(d.compress, doc.Links)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys := make([]string, 0, len(links))
+		for key := range links {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if ref := deletedReference(doc.ID, key, v1.ReferenceKind_REFERENCE_LINK, deleting); ref != nil {
+				refs = append(refs, ref)
+			}
+		}
+
+		children, err := decodeChildren(d.compress, doc.Children)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, child := range children {
+			if ref := deletedReference(doc.ID, child, v1.ReferenceKind_REFERENCE_CHILD, deleting); ref != nil {
+				refs = append(refs, ref)
+			}
+		}
+	}
+
+	return sources, refs, nil
+}
+
+// deletedReference returns the reference if it points to the current version of a deleted document
+func deletedReference(sourceID, ref string, kind v1.ReferenceKind, deleting map[string]bool) *v1.DanglingReference {
+	targetID, targetVersion, err := parseIDVersion(ref)
+	if err != nil || targetVersion != model.CurrentDocumentVersion || !deleting[targetID] {
+		return nil
+	}
+
+	return &v1.DanglingReference{
+		SourceId:      sourceID,
+		TargetId:      targetID,
+		TargetVersion: targetVersion,
+		Kind:          kind,
+	}
+}
+
+// detachReferences removes the references from their source documents, each source is saved as a new version
+func (d DocumentService) detachReferences(ctx context.Context, tx store.Store, sources map[string]*model.Document, refs []*v1.DanglingReference) ([]*model.Document, []*v1.DetachedDocument, error) {
+	var sourceIDs []string
+	bySource := make(map[string][]*v1.DanglingReference)
+	for _, ref := range refs {
+		if _, ok := bySource[ref.SourceId]; !ok {
+			sourceIDs = append(sourceIDs, ref.SourceId)
+		}
+		bySource[ref.SourceId] = append(bySource[ref.SourceId], ref)
+	}
+
+	var detached []*model.Document
+	var report []*v1.DetachedDocument
+	for _, sourceID := range sourceIDs {
+		doc := sources[sourceID]
+		links, err := decodeLinks(d.compress, doc.Links)
+		if err != nil {
+			return nil, nil, err
+		}
+		children, err := decodeChildren(d.compress, doc.Children)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var droppedLinks []*model.Link
+		for _, ref := range bySource[sourceID] {
+			key := ref.TargetId + "@" + ref.TargetVersion
+			switch ref.Kind {
+			case v1.ReferenceKind_REFERENCE_LINK:
+				delete(links, key)
+				droppedLinks = append(droppedLinks, &model.Link{SourceID: sourceID, TargetID: ref.TargetId, TargetVersion: ref.TargetVersion})
+			case v1.ReferenceKind_REFERENCE_CHILD:
+				children = removeReference(children, key)
+			}
+		}
+
+		if err = d.writeReferences(ctx, tx, doc, links, children, droppedLinks); err != nil {
+			return nil, nil, err
+		}
+
+		detached = append(detached, doc)
+		report = append(report, &v1.DetachedDocument{
+			Id:         doc.ID,
+			Version:    doc.Version,
+			References: bySource[sourceID],
+		})
+	}
+
+	return detached, report, nil
+}
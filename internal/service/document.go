@@ -6,18 +6,20 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Masterminds/semver"
-	"github.com/emrgen/blocktree"
 	_ "github.com/emrgen/blocktree"
 	v1 "github.com/emrgen/document/apis/v1"
 	"github.com/emrgen/document/internal/cache"
 	"github.com/emrgen/document/internal/compress"
 	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/objectstore"
+	"github.com/emrgen/document/internal/search"
 	"github.com/emrgen/document/internal/store"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc/codes"
 	status "google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
+	"sort"
 	"strings"
 )
 
@@ -26,11 +28,13 @@ var (
 )
 
 // NewDocumentService creates a new DocumentService.
-func NewDocumentService(compress compress.Compress, store store.Store, redis *cache.Redis) *DocumentService {
+func NewDocumentService(compress compress.Compress, store store.Store, redis *cache.Redis, index search.Index, objects objectstore.ObjectStore) *DocumentService {
 	service := &DocumentService{
 		cache:    redis,
 		store:    store,
 		compress: compress,
+		index:    index,
+		objects:  objects,
 	}
 
 	return service
@@ -41,6 +45,8 @@ type DocumentService struct {
 	compress compress.Compress
 	cache    *cache.Redis
 	store    store.Store
+	index    search.Index
+	objects  objectstore.ObjectStore
 	v1.UnimplementedDocumentServiceServer
 }
 
@@ -63,7 +69,7 @@ func (d DocumentService) CreateDocument(ctx context.Context, request *v1.CreateD
 	if links == nil {
 		links = make(map[string]string)
 	}
-	linkData, err := json.Marshal(links)
+	linkData, err := encodeLinks(d.compress, links)
 	if err != nil {
 		return nil, err
 	}
@@ -86,8 +92,10 @@ func (d DocumentService) CreateDocument(ctx context.Context, request *v1.CreateD
 		ProjectID: projectID,
 		Meta:      string(metaData),
 		Content:   string(contentData),
-		Links:     string(linkData),
+		Links:     linkData,
 		Children:  string(childrenEncode),
+		Template:  request.GetTemplate(),
+		Kind:      documentKind(request.GetKind()),
 		Version:   0,
 	}
 
@@ -98,16 +106,55 @@ func (d DocumentService) CreateDocument(ctx context.Context, request *v1.CreateD
 		doc.ID = uuid.New().String()
 	}
 
+	// the backlinks of the new document, the targets are not checked so documents can be created in any order.
+	// the links are stored as given, only the <id>@<version> links get a backlink
+	var linkModels []*model.Link
+	for key, value := range links {
+		targetID, targetVersion, err := parseIDVersion(key)
+		if err != nil {
+			continue
+		}
+		annotation, err := parseLinkAnnotation(value)
+		if err != nil {
+			return nil, err
+		}
+		linkModels = append(linkModels, &model.Link{
+			SourceID:      doc.ID,
+			TargetID:      targetID,
+			TargetVersion: targetVersion,
+			Type:          annotation.Type,
+			Anchor:        annotation.Anchor,
+			Label:         annotation.Label,
+		})
+	}
+
 	// Create the document
-	err = d.store.CreateDocument(ctx, doc)
+	err = d.store.Transaction(ctx, func(tx store.Store) error {
+		if err := d.validateDocument(ctx, tx, doc, doc.Kind == jsonDocumentKind); err != nil {
+			return err
+		}
+		if err := tx.CreateDocument(ctx, doc); err != nil {
+			return err
+		}
+		if err := d.saveChildEdges(ctx, tx, doc); err != nil {
+			return err
+		}
+		if len(linkModels) != 0 {
+			return tx.CreateBacklinks(ctx, linkModels)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	d.indexDocument(ctx, doc)
 
 	return &v1.CreateDocumentResponse{
 		Document: &v1.Document{
 			Id:        doc.ID,
 			Meta:      request.GetMeta(),
+			Kind:      request.GetKind(),
+			Template:  doc.Template,
 			CreatedAt: timestamppb.New(doc.CreatedAt),
 			UpdatedAt: timestamppb.New(doc.UpdatedAt),
 		},
@@ -162,11 +209,20 @@ func (d DocumentService) ListBacklinks(ctx context.Context, request *v1.ListBack
 		return nil, err
 	}
 
+	match := linkTypeFilter(request.GetTypes())
 	var backlinksProto []*v1.Link
 	for _, source := range backlinks {
+		if !match(source.Type) {
+			continue
+		}
 		backlinksProto = append(backlinksProto, &v1.Link{
 			SourceId:      source.SourceID,
 			SourceVersion: model.CurrentDocumentVersion,
+			TargetId:      source.TargetID,
+			TargetVersion: source.TargetVersion,
+			Type:          source.Type,
+			Anchor:        source.Anchor,
+			Label:         source.Label,
 		})
 	}
 
@@ -182,58 +238,45 @@ func (d DocumentService) GetDocument(ctx context.Context, request *v1.GetDocumen
 	// if err == nil {
 	// 	return doc, nil
 	// }
-	// Get document from database
-	doc, err := d.store.GetDocument(ctx, uuid.MustParse(request.GetDocumentId()))
+	mask, err := newReadMask(request.GetReadMask(), &v1.Document{}, getDocumentFields)
 	if err != nil {
 		return nil, err
 	}
 
-	metaData, err := d.compress.Decode([]byte(doc.Meta))
-	if err != nil {
-		return nil, err
-	}
-
-	contentData, err := d.compress.Decode([]byte(doc.Content))
-	if err != nil {
-		return nil, err
-	}
+	docID := uuid.MustParse(request.GetDocumentId())
 
-	links := make(map[string]string)
-	if doc.Links != "" {
-		linksData, err := d.compress.Decode([]byte(doc.Links))
+	// an unchanged document is not loaded again, its etag only needs the version and the updated time
+	if ifNoneMatch := notModifiedHeader(ctx); ifNoneMatch != "" {
+		current, err := d.store.GetDocument(ctx, docID, "id", "version", "updated_at")
 		if err != nil {
 			return nil, err
 		}
-		err = json.Unmarshal(linksData, &links)
-		if err != nil {
-			return nil, err
+		if etag := documentETag(current); etagMatches(ifNoneMatch, etag, true) {
+			setNotModified(ctx, etag, draftCacheControl)
+			return &v1.GetDocumentResponse{}, nil
 		}
 	}
 
-	children := make([]string, 0)
+	// Get document from database, only the columns of the requested fields are loaded
+	doc, err := d.store.GetDocument(ctx, docID, mask.columns(documentColumns, "version", "updated_at")...)
+	if err != nil {
+		return nil, err
+	}
+	setCacheHeaders(ctx, documentETag(doc), draftCacheControl)
 
-	if doc.Children != "" {
-		childrenData, err := d.compress.Decode([]byte(doc.Children))
-		if err != nil {
-			return nil, err
-		}
-		err = json.Unmarshal(childrenData, &children)
-		if err != nil {
-			return nil, err
-		}
+	document, err := d.maskedDocumentProto(ctx, doc, mask)
+	if err != nil {
+		return nil, err
+	}
+
+	breadcrumbs, err := d.breadcrumbs(ctx, doc.ID)
+	if err != nil {
+		return nil, err
 	}
 
 	return &v1.GetDocumentResponse{
-		Document: &v1.Document{
-			Id:        doc.ID,
-			Content:   string(contentData),
-			Meta:      string(metaData),
-			Links:     links,
-			Children:  children,
-			Version:   doc.Version,
-			CreatedAt: timestamppb.New(doc.CreatedAt),
-			UpdatedAt: timestamppb.New(doc.UpdatedAt),
-		},
+		Document:    document,
+		Breadcrumbs: breadcrumbs,
 	}, nil
 }
 
@@ -253,20 +296,22 @@ func (d DocumentService) ListDocuments(ctx context.Context, request *v1.ListDocu
 			ids = append(ids, uuid.MustParse(id))
 		}
 
-		documents, err = d.store.ListDocumentsFromIDs(ctx, ids)
+		mask, err := newReadMask(request.GetReadMask(), &v1.Document{}, listDocumentsFromIDsFields)
+		if err != nil {
+			return nil, err
+		}
+		documents, err = d.store.ListDocumentsFromIDs(ctx, ids, mask.columns(documentColumns)...)
 		if err != nil {
 			return nil, err
 		}
 
 		var documentsProto []*v1.Document
 		for _, doc := range documents {
-			documentsProto = append(documentsProto, &v1.Document{
-				Id:        doc.ID,
-				Meta:      doc.Meta,
-				Version:   doc.Version,
-				CreatedAt: timestamppb.New(doc.CreatedAt),
-				UpdatedAt: timestamppb.New(doc.UpdatedAt),
-			})
+			document, err := d.maskedDocumentProto(ctx, doc, mask)
+			if err != nil {
+				return nil, err
+			}
+			documentsProto = append(documentsProto, document)
 		}
 
 		return &v1.ListDocumentsResponse{
@@ -275,42 +320,47 @@ func (d DocumentService) ListDocuments(ctx context.Context, request *v1.ListDocu
 		}, nil
 	}
 
+	mask, err := newReadMask(request.GetReadMask(), &v1.Document{}, listDocumentFields)
+	if err != nil {
+		return nil, err
+	}
+	// the filter and the order read their columns even when the fields are not requested
+	var extra []string
+	if request.GetTemplates() {
+		extra = append(extra, "template")
+	}
+	if request.GetOrder() == v1.DocumentOrder_ORDER_BACKLINK_COUNT {
+		extra = append(extra, "backlink_count")
+	}
+
 	// Get documents from database page by page
-	documents, total, err := d.store.ListDocuments(ctx, projectID)
+	documents, total, err := d.store.ListDocuments(ctx, projectID, mask.columns(documentColumns, extra...)...)
 	if err != nil {
 		return nil, err
 	}
+	if request.GetTemplates() {
+		templates := make([]*model.Document, 0)
+		for _, doc := range documents {
+			if doc.Template {
+				templates = append(templates, doc)
+			}
+		}
+		documents = templates
+		total = int64(len(templates))
+	}
+	if request.GetOrder() == v1.DocumentOrder_ORDER_BACKLINK_COUNT {
+		sort.SliceStable(documents, func(i, j int) bool {
+			return documents[i].BacklinkCount > documents[j].BacklinkCount
+		})
+	}
 
 	var documentsProto []*v1.Document
 	for _, doc := range documents {
-		linksData, err := d.compress.Decode([]byte(doc.Links))
-		if err != nil {
-			return nil, err
-		}
-		childrenData, err := d.compress.Decode([]byte(doc.Children))
-		if err != nil {
-			return nil, err
-		}
-
-		links, err := parseLinks(string(linksData))
+		document, err := d.maskedDocumentProto(ctx, doc, mask)
 		if err != nil {
 			return nil, err
 		}
-
-		children, err := parseChildren(string(childrenData))
-		if err != nil {
-			return nil, err
-		}
-
-		documentsProto = append(documentsProto, &v1.Document{
-			Id:        doc.ID,
-			Meta:      doc.Meta,
-			Version:   doc.Version,
-			Links:     links,
-			Children:  children,
-			CreatedAt: timestamppb.New(doc.CreatedAt),
-			UpdatedAt: timestamppb.New(doc.UpdatedAt),
-		})
+		documentsProto = append(documentsProto, document)
 	}
 
 	return &v1.ListDocumentsResponse{
@@ -320,40 +370,93 @@ func (d DocumentService) ListDocuments(ctx context.Context, request *v1.ListDocu
 }
 
 // UpdateDocument updates a document.
+// The meta and the content replace the current ones, or are applied to them as a JSON Patch or a JSON Merge Patch.
+// With an update mask only the masked fields are updated, the meta.<key> paths update single keys of the meta.
+// An If-Match header stands for the version, it holds the etag of the version the client read.
 func (d DocumentService) UpdateDocument(ctx context.Context, request *v1.UpdateDocumentRequest) (*v1.UpdateDocumentResponse, error) {
-	var err error
+	return d.updateDocument(ctx, request, conditionalHeader(ctx, ifMatchHeader))
+}
+
+// updateDocument updates a document, the version is checked against the etag when ifMatch is given
+func (d DocumentService) updateDocument(ctx context.Context, request *v1.UpdateDocumentRequest, ifMatch string) (*v1.UpdateDocumentResponse, error) {
+	request, metaKeys, err := maskedUpdateRequest(request)
+	if err != nil {
+		return nil, err
+	}
 	var doc *model.Document
 
 	err = d.store.Transaction(ctx, func(tx store.Store) error {
 		// Get document from database
 		doc, err = tx.GetDocument(ctx, uuid.MustParse(request.GetDocumentId()))
-		clone := &model.Document{
-			ID:      doc.ID,
-			Version: doc.Version,
-			Meta:    doc.Meta,
-			Content: doc.Content,
-			Links:   doc.Links,
+		if err != nil {
+			return err
 		}
+		// the content of a document with parts is assembled, so the backup keeps the whole content.
+		// a new content replaces the parts, otherwise the parts are kept and only the content before them is saved
+		head := doc.Content
+		content, parts, err := d.assembleParts(ctx, tx, doc)
 		if err != nil {
 			return err
 		}
+		doc.Content = content
+		hasParts := len(parts) != 0
+		// the json content includes the result of a json patch or a merge patch
+		jsonContent := doc.Kind == jsonDocumentKind || request.GetKind() != v1.UpdateKind_TEXT
+		saveDocument := func() error {
+			if request.Meta != nil || request.Content != nil {
+				if err := d.validateDocument(ctx, tx, doc, jsonContent); err != nil {
+					return err
+				}
+			}
+			if hasParts && request.Content == nil {
+				doc.Content = head
+			}
+			if hasParts && request.Content != nil {
+				doc.Parts = "[]"
+				if err := tx.DeleteDocumentParts(ctx, uuid.MustParse(doc.ID)); err != nil {
+					return err
+				}
+			}
+			return tx.UpdateDocument(ctx, doc)
+		}
+		clone := &model.Document{
+			ID:       doc.ID,
+			Version:  doc.Version,
+			Meta:     doc.Meta,
+			Content:  doc.Content,
+			Links:    doc.Links,
+			Children: doc.Children,
+			Template: doc.Template,
+		}
 
-		logrus.Infof("old version: %v, new version: %v", doc.Version, request.GetVersion())
+		version := request.GetVersion()
+		if ifMatch != "" {
+			if etag := documentETag(doc); !etagMatches(ifMatch, etag, false) {
+				return status.Error(codes.FailedPrecondition, fmt.Sprintf("current etag: %s, provided If-Match: %s", etag, ifMatch))
+			}
+			// the matching etag is the current version
+			version = doc.Version + 1
+		}
+
+		logrus.Infof("old version: %v, new version: %v", doc.Version, version)
 
-		overwrite := request.Version == -1
-		versionMatch := request.Version == doc.Version+1
+		overwrite := version == -1
+		versionMatch := version == doc.Version+1
 
 		if !overwrite && !versionMatch {
-			return status.New(codes.FailedPrecondition, fmt.Sprintf("current version: %d, expected version %d, provider version: %d, ", doc.Version, doc.Version+1, request.GetVersion())).Err()
+			return status.New(codes.FailedPrecondition, fmt.Sprintf("current version: %d, expected version %d, provider version: %d, ", doc.Version, doc.Version+1, version)).Err()
 		}
 
-		// compress the meta
+		if request.Template != nil {
+			doc.Template = request.GetTemplate()
+		}
+
+		// the meta is replaced, patched or only its masked keys are set
 		if request.Meta != nil {
-			metaContent, err := d.compress.Encode([]byte(request.GetMeta()))
+			doc.Meta, err = d.updateMeta(doc.Meta, request, metaKeys)
 			if err != nil {
 				return err
 			}
-			doc.Meta = string(metaContent)
 		}
 
 		// overwrite the links
@@ -384,12 +487,14 @@ func (d DocumentService) UpdateDocument(ctx context.Context, request *v1.UpdateD
 		}
 
 		createBackup := func() error {
+			// the backup keeps the current version, the changes of the request are already on the document
 			err = tx.CreateDocumentBackup(ctx, &model.DocumentBackup{
-				ID:      doc.ID,
-				Version: doc.Version,
-				Meta:    doc.Meta,
-				Content: doc.Content,
-				Links:   doc.Links,
+				ID:       clone.ID,
+				Version:  clone.Version,
+				Meta:     clone.Meta,
+				Content:  clone.Content,
+				Links:    clone.Links,
+				Children: clone.Children,
 			})
 
 			return err
@@ -401,132 +506,59 @@ func (d DocumentService) UpdateDocument(ctx context.Context, request *v1.UpdateD
 				logrus.Infof("old links: %v, new links: %v", clone.Links, request.GetLinks())
 
 				newLinks := request.GetLinks()
-				oldLinks := make(map[string]string)
-				err = json.Unmarshal([]byte(clone.Links), &oldLinks)
+				oldLinks, err := decodeLinks(d.compress, clone.Links)
 				if err != nil {
 					return err
 				}
 
 				// collect broken links
-				brokenLinks := make(map[string]string)
+				var brokenLinkModels []*model.Link
 				for key := range oldLinks {
-					tokens := strings.Split(key, "@")
-					if len(tokens) != 2 {
-						return ErrInvalidLinkFormat
-					}
-
-					if _, ok := newLinks[key]; !ok {
-						brokenLinks[tokens[0]] = tokens[1]
-					}
-				}
-
-				// collect new links
-				newLinksMap := make(map[string]string)
-				publishedDocLinks := make([]*model.PublishedDocument, 0)
-				unPublishedDocLinks := make([]*model.Document, 0)
-				for key := range newLinks {
-					tokens := strings.Split(key, "@")
-					if len(tokens) != 2 {
-						return ErrInvalidLinkFormat
-					}
-
-					targetID := tokens[0]
-					targetVersion := tokens[1]
-					if _, ok := oldLinks[key]; !ok || oldLinks[key] != targetVersion {
-						newLinksMap[targetID] = targetVersion
-
-						// check if the target document is unpublished
-						if targetVersion == model.CurrentDocumentVersion {
-							unPublishedDocLinks = append(unPublishedDocLinks, &model.Document{
-								ID: targetID,
-							})
-						}
-
-						publishedDocLinks = append(publishedDocLinks, &model.PublishedDocument{
-							ID:      targetID,
-							Version: targetVersion,
-						})
-
-					}
-				}
-
-				// check if the target unpublished documents exist, if not return an error
-				if len(unPublishedDocLinks) != 0 {
-					var ids []uuid.UUID
-					for _, doc := range unPublishedDocLinks {
-						ids = append(ids, uuid.MustParse(doc.ID))
-					}
-
-					projectIDs, err := tx.ListDocumentProjectIDs(ctx, ids)
+					targetID, targetVersion, err := parseIDVersion(key)
 					if err != nil {
 						return err
 					}
 
-					for _, link := range unPublishedDocLinks {
-						if projectID, ok := projectIDs[uuid.MustParse(link.ID)]; ok {
-							link.ProjectID = projectID.String()
-						} else {
-							return errors.New("target documents do not exist")
-						}
-					}
-
-					problem, err := tx.ExistsDocuments(ctx, unPublishedDocLinks)
-					if err != nil {
-						return err
-					}
-					if problem {
-						return errors.New("linked documents do not exist")
+					if _, ok := newLinks[key]; !ok {
+						brokenLinkModels = append(brokenLinkModels, &model.Link{
+							SourceID:      doc.ID,
+							TargetID:      targetID,
+							TargetVersion: targetVersion,
+						})
 					}
 				}
 
-				// check if the target published documents exist, if not return an error
-				if len(publishedDocLinks) != 0 {
-					var ids []uuid.UUID
-					for _, doc := range publishedDocLinks {
-						ids = append(ids, uuid.MustParse(doc.ID))
-					}
-
-					projectIDs, err := tx.ListDocumentProjectIDs(ctx, ids)
+				// collect the new links and the links with a changed type, anchor or label
+				var newLinkModels []*model.Link
+				for key, value := range newLinks {
+					targetID, targetVersion, err := parseIDVersion(key)
 					if err != nil {
 						return err
 					}
 
-					for _, link := range publishedDocLinks {
-						if projectID, ok := projectIDs[uuid.MustParse(link.ID)]; ok {
-							link.ProjectID = projectID.String()
-						} else {
-							return errors.New("linked published documents do not exist")
-						}
+					if oldValue, ok := oldLinks[key]; ok && oldValue == value {
+						continue
 					}
 
-					problem, err := tx.ExistsPublishedDocuments(ctx, publishedDocLinks)
+					annotation, err := parseLinkAnnotation(value)
 					if err != nil {
 						return err
 					}
-
-					if problem {
-						return errors.New("target documents do not exist")
-					}
-				}
-
-				// new link models
-				var newLinkModels []*model.Link
-				for key, version := range newLinksMap {
 					newLinkModels = append(newLinkModels, &model.Link{
 						SourceID:      doc.ID,
-						TargetID:      key,
-						TargetVersion: version,
+						TargetID:      targetID,
+						TargetVersion: targetVersion,
+						Type:          annotation.Type,
+						Anchor:        annotation.Anchor,
+						Label:         annotation.Label,
 					})
 				}
 
-				// old link models
-				var brokenLinkModels []*model.Link
-				for key, version := range brokenLinks {
-					brokenLinkModels = append(brokenLinkModels, &model.Link{
-						SourceID:      doc.ID,
-						TargetID:      key,
-						TargetVersion: version,
-					})
+				if err = checkLinkTargets(ctx, tx, newLinkModels); err != nil {
+					if errors.Is(err, ErrInvalidLinkTarget) {
+						return status.Error(codes.InvalidArgument, err.Error())
+					}
+					return err
 				}
 
 				logrus.Infof("broken links: %v, new links: %v", brokenLinkModels, newLinkModels)
@@ -551,86 +583,44 @@ func (d DocumentService) UpdateDocument(ctx context.Context, request *v1.UpdateD
 			return nil
 		}
 
-		// if the version clocks matches, update the document
-		// if the request contains a JSONDIFF, apply the patch
-		if versionMatch && request.GetKind() == v1.UpdateKind_JSONPATCH {
-			if overwrite {
-				return errors.New("overwrite not allowed for JSONDIFF")
-			}
-
-			err := createBackup()
-			if err != nil {
-				return err
-			}
-
-			// patch the content
-			if request.Content != nil {
-				contentData, err := d.compress.Encode([]byte(request.GetContent()))
-				if err != nil {
-					return err
-				}
-
-				jsonDoc := blocktree.NewJsonDoc(contentData)
-				patch := blocktree.JsonPatch(request.GetContent())
-
-				err = jsonDoc.Apply(patch)
-				if err != nil {
-					return err
-				}
-
-				data, err := d.compress.Encode([]byte(jsonDoc.String()))
-				if err != nil {
-					return err
-				}
-
-				doc.Content = string(data)
-			}
-			doc.Version = doc.Version + 1
-			logrus.Infof("updating document id with patch: %v, version: %v", doc.ID, doc.Version)
-			err = tx.UpdateDocument(ctx, doc)
-			if err != nil {
-				return err
-			}
-
-			err = updateLinks()
-			if err != nil {
-				return err
-			}
+		// a json patch depends on the state it was made against, so it needs the version clock to match
+		if overwrite && request.GetKind() == v1.UpdateKind_JSONPATCH {
+			return status.Error(codes.InvalidArgument, "overwrite not allowed for JSONPATCH")
 		}
 
-		// explicitly overwrite the document
-		// or the version matches and the kind is not JSONDIFF as JSONDIFF is handled above
-		if overwrite || versionMatch && request.GetKind() != v1.UpdateKind_JSONPATCH {
-			// TODO: check if document hash is the same
+		// Create a backup of the document
+		logrus.Infof("creating backup for document id: %v, version: %v", doc.ID, doc.Version)
+		err = createBackup()
+		if err != nil {
+			return err
+		}
 
-			// Create a backup of the document
-			logrus.Infof("creating backup for document id: %v, version: %v", doc.ID, doc.Version)
-			err := createBackup()
+		// the content is replaced or patched
+		if request.Content != nil {
+			doc.Content, err = d.updateContent(doc.Content, request)
 			if err != nil {
 				return err
 			}
+		}
+		doc.Version = doc.Version + 1
 
-			if request.Content != nil {
-				contentData, err := d.compress.Encode([]byte(request.GetContent()))
-				if err != nil {
-					return err
-				}
-				doc.Content = string(contentData)
-			}
-			doc.Version = doc.Version + 1
+		if clone.Meta == doc.Meta && clone.Content == doc.Content && clone.Links == doc.Links && clone.Children == doc.Children && clone.Template == doc.Template {
+			return errors.New("document is not changed, skipping update")
+		}
 
-			if clone.Meta == doc.Meta && clone.Content == doc.Content && clone.Links == doc.Links && clone.Children == doc.Children {
-				return errors.New("document is not changed, skipping update")
-			}
+		logrus.Infof("updating document id: %v, version: %v", doc.ID, doc.Version)
+		err = saveDocument()
+		if err != nil {
+			return err
+		}
 
-			logrus.Infof("updating document id: %v, version: %v", doc.ID, doc.Version)
-			err = tx.UpdateDocument(ctx, doc)
-			if err != nil {
-				return err
-			}
+		err = updateLinks()
+		if err != nil {
+			return err
+		}
 
-			err = updateLinks()
-			if err != nil {
+		if request.Children != nil {
+			if err := d.saveChildEdges(ctx, tx, doc); err != nil {
 				return err
 			}
 		}
@@ -643,6 +633,7 @@ func (d DocumentService) UpdateDocument(ctx context.Context, request *v1.UpdateD
 	if err != nil {
 		return nil, err
 	}
+	d.indexDocument(ctx, doc)
 
 	return &v1.UpdateDocumentResponse{
 		Id:      request.DocumentId,
@@ -658,7 +649,7 @@ func (d DocumentService) DeleteDocument(ctx context.Context, request *v1.DeleteD
 	}
 
 	// soft delete the document
-	err = d.store.DeleteDocument(ctx, id)
+	report, err := d.deleteDocument(ctx, id, request.GetPolicy(), false)
 	if err != nil {
 		return nil, err
 	}
@@ -667,6 +658,7 @@ func (d DocumentService) DeleteDocument(ctx context.Context, request *v1.DeleteD
 		Document: &v1.Document{
 			Id: id.String(),
 		},
+		Report: report,
 	}, nil
 }
 
@@ -677,8 +669,8 @@ func (d DocumentService) EraseDocument(ctx context.Context, request *v1.EraseDoc
 		return nil, err
 	}
 
-	// hard delete the document
-	err = d.store.EraseDocument(ctx, id)
+	// hard delete the document with its links, backups and tree indexes
+	report, err := d.deleteDocument(ctx, id, request.GetPolicy(), true)
 	if err != nil {
 		return nil, err
 	}
@@ -687,13 +679,15 @@ func (d DocumentService) EraseDocument(ctx context.Context, request *v1.EraseDoc
 		Document: &v1.Document{
 			Id: id.String(),
 		},
+		Report: report,
 	}, nil
 }
 
 // PublishDocuments publishes a document. This publishes multiple documents at once.
 // This is an atomic operation. If any of the documents fail to publish, the operation is rolled back.
 // This is useful for publishing documents that are linked to each other for example in a book.
-// TODO: A document is linked to another document. If the linked document is not published, the operation should fail. (optional feature)
+// With strict links, the publish fails if a linked or child document is not published,
+// the dangling references are attached to the FailedPrecondition status as details.
 func (d DocumentService) PublishDocuments(ctx context.Context, request *v1.PublishDocumentsRequest) (*v1.PublishDocumentsResponse, error) {
 	var docIDs []uuid.UUID
 	for _, id := range request.GetDocumentIds() {
@@ -706,9 +700,28 @@ func (d DocumentService) PublishDocuments(ctx context.Context, request *v1.Publi
 
 	var latestDoc *model.PublishedDocument
 	var documents []*v1.PublishedDocument
+	var release *model.Release
+	published := make(map[string]*model.PublishedDocument)
 
 	// Publish the document in a transaction
 	err := d.store.Transaction(ctx, func(tx store.Store) error {
+		// check the links and children before publishing anything
+		if request.GetStrictLinks() {
+			dangling, err := d.findDanglingReferences(ctx, tx, docIDs)
+			if err != nil {
+				return err
+			}
+
+			if len(dangling) > 0 {
+				st, err := status.New(codes.FailedPrecondition, fmt.Sprintf("found %d references to unpublished documents", len(dangling))).
+					WithDetails(&v1.DanglingReferences{References: dangling})
+				if err != nil {
+					return err
+				}
+				return st.Err()
+			}
+		}
+
 		var rootDocLatestVersion string
 		rootDocID := request.GetRootDocumentId()
 		for _, docID := range docIDs {
@@ -717,12 +730,33 @@ func (d DocumentService) PublishDocuments(ctx context.Context, request *v1.Publi
 			if err != nil {
 				return err
 			}
+			// the published version holds the whole content
+			doc.Content, _, err = d.assembleParts(ctx, tx, doc)
+			if err != nil {
+				return err
+			}
+			// the schemas may have changed since the document was saved
+			if err = d.validateDocument(ctx, tx, doc, doc.Kind == jsonDocumentKind); err != nil {
+				return err
+			}
+			attachments, err := tx.ListAttachments(ctx, docID, doc.Version)
+			if err != nil {
+				return err
+			}
 
 			// Get latest published document
 			lastPublishedDoc, err := tx.GetLatestPublishedDocument(ctx, docID)
 			if err != nil && !errors.Is(store.ErrLatestPublishedDocumentNotFound, err) {
 				return err
 			}
+			attachmentsPublished := true
+			if lastPublishedDoc != nil {
+				publishedAttachments, err := tx.ListPublishedAttachments(ctx, docID, lastPublishedDoc.Version)
+				if err != nil {
+					return err
+				}
+				attachmentsPublished = sameAttachments(attachments, publishedAttachments)
+			}
 
 			// Check if the document is already published with the same content and metadata
 			if !request.GetForce() &&
@@ -731,7 +765,8 @@ func (d DocumentService) PublishDocuments(ctx context.Context, request *v1.Publi
 				lastPublishedDoc.Meta == doc.Meta &&
 				lastPublishedDoc.Content == doc.Content &&
 				lastPublishedDoc.Links == doc.Links &&
-				lastPublishedDoc.Children == doc.Children {
+				lastPublishedDoc.Children == doc.Children &&
+				attachmentsPublished {
 				// return an error if the document is already published
 				return errors.New("document is already published with version: " + lastPublishedDoc.Version)
 			}
@@ -776,7 +811,7 @@ func (d DocumentService) PublishDocuments(ctx context.Context, request *v1.Publi
 				if err != nil {
 					return err
 				}
-				*nextVersion = nextVersion.IncPatch()
+				*nextVersion = bumpVersion(nextVersion, request.GetBump())
 
 				if request.GetVersion() != "" {
 					newVersion, err := semver.NewVersion(request.GetVersion())
@@ -813,37 +848,40 @@ func (d DocumentService) PublishDocuments(ctx context.Context, request *v1.Publi
 			if err != nil {
 				return err
 			}
+			if err = d.savePublishedChildEdges(ctx, tx, latestDoc); err != nil {
+				return err
+			}
+			if err = savePublishedAttachments(ctx, tx, latestDoc, attachments); err != nil {
+				return err
+			}
 
 			// get the links
-			links := make(map[string]interface{})
-			if latestDoc.Links != "" {
-				linksData, err := d.compress.Decode([]byte(doc.Links))
-				if err != nil {
-					return err
-				}
-				err = json.Unmarshal(linksData, &links)
-				if err != nil {
-					return err
-				}
+			links, err := decodeLinks(d.compress, doc.Links)
+			if err != nil {
+				return err
 			}
 
 			// create new links
 			newLinks := make([]*model.PublishedLink, 0)
 
-			for target := range links {
-				tokens := strings.Split(target, "@")
-				if len(tokens) != 2 {
-					return ErrInvalidLinkFormat
+			for target, value := range links {
+				targetID, targetVersion, err := parseIDVersion(target)
+				if err != nil {
+					return err
+				}
+				annotation, err := parseLinkAnnotation(value)
+				if err != nil {
+					return err
 				}
-
-				targetID := tokens[0]
-				targetVersion := tokens[1]
 
 				newLinks = append(newLinks, &model.PublishedLink{
 					SourceID:      doc.ID,
 					SourceVersion: latestDoc.Version,
 					TargetID:      targetID,
 					TargetVersion: targetVersion,
+					Type:          annotation.Type,
+					Anchor:        annotation.Anchor,
+					Label:         annotation.Label,
 				})
 			}
 
@@ -860,6 +898,7 @@ func (d DocumentService) PublishDocuments(ctx context.Context, request *v1.Publi
 				Id:      doc.ID,
 				Version: latestDoc.Version,
 			})
+			published[doc.ID] = latestDoc
 		}
 
 		indexContent := request.GetIndex()
@@ -876,15 +915,377 @@ func (d DocumentService) PublishDocuments(ctx context.Context, request *v1.Publi
 			}
 		}
 
+		// record the documents published along with the root document as a release
+		if root, ok := published[rootDocID]; ok {
+			var err error
+			release, err = d.createRelease(ctx, tx, root, request.GetReleaseName(), published)
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
+	d.indexPublishedDocuments(ctx, published)
 
-	return &v1.PublishDocumentsResponse{
+	res := &v1.PublishDocumentsResponse{
 		Documents: documents,
-	}, nil
+	}
+	if release != nil {
+		res.Release = releaseProto(release)
+	}
+
+	return res, nil
+}
+
+// createRelease records a release of the root document tree.
+// The members are the published descendants of the root document, the documents published in the same request
+// at their new version and the others at the version referenced by their parent.
+func (d DocumentService) createRelease(ctx context.Context, tx store.Store, root *model.PublishedDocument, name string, published map[string]*model.PublishedDocument) (*model.Release, error) {
+	release := &model.Release{
+		ID:             uuid.New().String(),
+		ProjectID:      root.ProjectID,
+		RootDocumentID: root.ID,
+		Version:        root.Version,
+		Name:           name,
+	}
+
+	members := map[string]string{root.ID: root.Version}
+	visited := map[string]bool{root.ID: true}
+	queue := []string{root.Children}
+	for len(queue) > 0 {
+		childrenData := queue[0]
+		queue = queue[1:]
+
+		children, err := decodeChildren(d.compress, childrenData)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, child := range children {
+			childID, childVersion, err := parseIDVersion(child)
+			if err != nil {
+				return nil, ErrInvalidChildrenLinkFormat
+			}
+			if visited[childID] {
+				continue
+			}
+			visited[childID] = true
+
+			// published in the same request
+			if doc, ok := published[childID]; ok {
+				members[doc.ID] = doc.Version
+				queue = append(queue, doc.Children)
+				continue
+			}
+
+			meta, err := resolvePublishedChild(ctx, tx, childID, childVersion)
+			if err != nil {
+				return nil, err
+			}
+			// unpublished children are not part of the release
+			if meta == nil {
+				continue
+			}
+
+			members[meta.ID] = meta.Version
+			queue = append(queue, meta.Children)
+		}
+	}
+
+	for id, version := range members {
+		release.Members = append(release.Members, &model.ReleaseMember{
+			ReleaseID:  release.ID,
+			DocumentID: id,
+			Version:    version,
+		})
+	}
+
+	err := tx.CreateRelease(ctx, release)
+	if err != nil {
+		return nil, err
+	}
+
+	return release, nil
+}
+
+// resolvePublishedChild returns the published meta of a child reference, current and latest resolve to the latest published version.
+// It returns nil if the child is not published at the referenced version.
+func resolvePublishedChild(ctx context.Context, tx store.Store, childID, childVersion string) (*model.PublishedDocumentMeta, error) {
+	id, err := uuid.Parse(childID)
+	if err != nil {
+		return nil, ErrInvalidChildrenLinkFormat
+	}
+
+	idVersions, err := tx.ListPublishedDocumentIDVersions(ctx, []uuid.UUID{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(idVersions) == 0 {
+		return nil, nil
+	}
+
+	switch childVersion {
+	case model.CurrentDocumentVersion, "latest", "":
+		latest, err := tx.GetLatestPublishedDocumentMeta(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return latest.IntoPublishedDocumentMeta(), nil
+	}
+
+	for _, idVersion := range idVersions {
+		if idVersion.Version == childVersion {
+			return tx.GetPublishedDocumentMetaByVersion(ctx, id, childVersion)
+		}
+	}
+
+	return nil, nil
+}
+
+// findDanglingReferences returns the links and children of the documents that do not point to a published document.
+// Documents in docIDs are about to be published, so references to them are not dangling.
+func (d DocumentService) findDanglingReferences(ctx context.Context, tx store.Store, docIDs []uuid.UUID) ([]*v1.DanglingReference, error) {
+	publishing := make(map[string]bool)
+	for _, docID := range docIDs {
+		publishing[docID.String()] = true
+	}
+
+	var refs []*v1.DanglingReference
+	for _, docID := range docIDs {
+		doc, err := tx.GetDocument(ctx, docID)
+		if err != nil {
+			return nil, err
+		}
+
+		links, err := decodeLinks(d.compress, doc.Links)
+		if err != nil {
+			return nil, err
+		}
+		for key := range links {
+			targetID, targetVersion, err := parseIDVersion(key)
+			if err != nil {
+				return nil, err
+			}
+			refs = append(refs, &v1.DanglingReference{
+				SourceId:      doc.ID,
+				TargetId:      targetID,
+				TargetVersion: targetVersion,
+				Kind:          v1.ReferenceKind_REFERENCE_LINK,
+			})
+		}
+
+		children, err := decodeChildren(d.compress, doc.Children)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			targetID, targetVersion, err := parseIDVersion(child)
+			if err != nil {
+				return nil, ErrInvalidChildrenLinkFormat
+			}
+			refs = append(refs, &v1.DanglingReference{
+				SourceId:      doc.ID,
+				TargetId:      targetID,
+				TargetVersion: targetVersion,
+				Kind:          v1.ReferenceKind_REFERENCE_CHILD,
+			})
+		}
+	}
+
+	// collect the targets outside the publish set
+	var targetIDs []uuid.UUID
+	for _, ref := range refs {
+		if publishing[ref.TargetId] {
+			continue
+		}
+		if targetID, err := uuid.Parse(ref.TargetId); err == nil {
+			targetIDs = append(targetIDs, targetID)
+		}
+	}
+
+	published := make(map[string]map[string]bool)
+	if len(targetIDs) > 0 {
+		idVersions, err := tx.ListPublishedDocumentIDVersions(ctx, targetIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, idVersion := range idVersions {
+			if _, ok := published[idVersion.ID]; !ok {
+				published[idVersion.ID] = make(map[string]bool)
+			}
+			published[idVersion.ID][idVersion.Version] = true
+		}
+	}
+
+	var dangling []*v1.DanglingReference
+	for _, ref := range refs {
+		if publishing[ref.TargetId] {
+			continue
+		}
+
+		versions, ok := published[ref.TargetId]
+		if !ok {
+			dangling = append(dangling, ref)
+			continue
+		}
+
+		// current and latest resolve to any published version
+		switch ref.TargetVersion {
+		case model.CurrentDocumentVersion, "latest", "":
+			continue
+		}
+
+		if !versions[ref.TargetVersion] {
+			dangling = append(dangling, ref)
+		}
+	}
+
+	return dangling, nil
+}
+
+// bumpVersion returns the next version of a published document
+func bumpVersion(version *semver.Version, bump v1.VersionBump) semver.Version {
+	switch bump {
+	case v1.VersionBump_BUMP_MAJOR:
+		return version.IncMajor()
+	case v1.VersionBump_BUMP_MINOR:
+		return version.IncMinor()
+	default:
+		return version.IncPatch()
+	}
+}
+
+// parseIDVersion splits a <id>@<version> reference into id and version.
+func parseIDVersion(ref string) (string, string, error) {
+	tokens := strings.Split(ref, "@")
+	if len(tokens) != 2 {
+		return "", "", ErrInvalidLinkFormat
+	}
+
+	return tokens[0], tokens[1], nil
+}
+
+// decodeLinks decompresses and parses the links of a document.
+func decodeLinks(c compress.Compress, data string) (map[string]string, error) {
+	links := make(map[string]string)
+	if data == "" {
+		return links, nil
+	}
+
+	linksData, err := c.Decode([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(linksData) == 0 {
+		return links, nil
+	}
+
+	err = json.Unmarshal(linksData, &links)
+	if err != nil {
+		return nil, ErrDocumentLinksCorrupted
+	}
+
+	return links, nil
+}
+
+// decodeChildren decompresses and parses the children of a document.
+func decodeChildren(c compress.Compress, data string) ([]string, error) {
+	children := make([]string, 0)
+	if data == "" {
+		return children, nil
+	}
+
+	childrenData, err := c.Decode([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(childrenData) == 0 {
+		return children, nil
+	}
+
+	err = json.Unmarshal(childrenData, &children)
+	if err != nil {
+		return nil, ErrDocumentChildrenCorrupted
+	}
+
+	return children, nil
+}
+
+// encodeLinks serializes and compresses the links of a document.
+func encodeLinks(c compress.Compress, links map[string]string) (string, error) {
+	linksData, err := json.Marshal(links)
+	if err != nil {
+		return "", err
+	}
+	linksContent, err := c.Encode(linksData)
+	if err != nil {
+		return "", err
+	}
+
+	return string(linksContent), nil
+}
+
+// encodeChildren serializes and compresses the children of a document.
+func encodeChildren(c compress.Compress, children []string) (string, error) {
+	childrenData, err := json.Marshal(children)
+	if err != nil {
+		return "", err
+	}
+	childrenContent, err := c.Encode(childrenData)
+	if err != nil {
+		return "", err
+	}
+
+	return string(childrenContent), nil
+}
+
+// writeReferences saves the links and children of the document as a new version, the current version is kept as a backup.
+// The references are only removed or added to existing documents, so the links are not checked as in UpdateDocument.
+func (d DocumentService) writeReferences(ctx context.Context, tx store.Store, doc *model.Document, links map[string]string, children []string, droppedLinks []*model.Link) error {
+	content, _, err := d.assembleParts(ctx, tx, doc)
+	if err != nil {
+		return err
+	}
+	err = tx.CreateDocumentBackup(ctx, &model.DocumentBackup{
+		ID:       doc.ID,
+		Version:  doc.Version,
+		Meta:     doc.Meta,
+		Content:  content,
+		Links:    doc.Links,
+		Children: doc.Children,
+	})
+	if err != nil {
+		return err
+	}
+
+	linksContent, err := encodeLinks(d.compress, links)
+	if err != nil {
+		return err
+	}
+	childrenContent, err := encodeChildren(d.compress, children)
+	if err != nil {
+		return err
+	}
+
+	doc.Links = linksContent
+	doc.Children = childrenContent
+	doc.Version = doc.Version + 1
+	if err = tx.UpdateDocument(ctx, doc); err != nil {
+		return err
+	}
+	if err = d.saveChildEdges(ctx, tx, doc); err != nil {
+		return err
+	}
+
+	if len(droppedLinks) != 0 {
+		return tx.DeleteBacklinks(ctx, droppedLinks)
+	}
+
+	return nil
 }
 
 func parseLinks(links string) (map[string]string, error) {
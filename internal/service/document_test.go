@@ -1,21 +1,39 @@
 package service
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
 	v1 "github.com/emrgen/document/apis/v1"
 	"github.com/emrgen/document/internal/compress"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/objectstore"
+	"github.com/emrgen/document/internal/search"
 	"github.com/emrgen/document/internal/store"
 	"github.com/emrgen/document/internal/tester"
 	"github.com/google/uuid"
+	grpcvalidator "github.com/grpc-ecosystem/go-grpc-middleware/validator"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDocumentService_CreateDocument(t *testing.T) {
 	tester.RemoveDBFile()
 	tester.Setup()
 
-	client := NewDocumentService(compress.NewNop(), store.NewGormStore(tester.TestDB()), tester.Redis())
+	client := NewDocumentService(compress.NewNop(), store.NewGormStore(tester.TestDB()), tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
 	tests := []struct {
 		name      string
 		projectID string
@@ -91,7 +109,7 @@ func TestDocumentService_UpdateDocument(t *testing.T) {
 	tester.RemoveDBFile()
 	tester.Setup()
 
-	client := NewDocumentService(compress.NewNop(), store.NewGormStore(tester.TestDB()), tester.Redis())
+	client := NewDocumentService(compress.NewNop(), store.NewGormStore(tester.TestDB()), tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
 
 	type Document struct {
 		name      string
@@ -231,3 +249,1954 @@ func TestDocumentService_UpdateDocument(t *testing.T) {
 		}
 	}
 }
+
+func TestDocumentService_PublishDocumentsStrictLinks(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	client := NewDocumentService(compress.NewNop(), store.NewGormStore(tester.TestDB()), tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+
+	projectID := uuid.New().String()
+	targetID := uuid.New().String()
+	sourceID := uuid.New().String()
+
+	_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{
+		ProjectId:  projectID,
+		DocumentId: &targetID,
+		Content:    "target",
+	})
+	assert.NoError(t, err)
+
+	_, err = client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{
+		ProjectId:  projectID,
+		DocumentId: &sourceID,
+		Content:    "source",
+		Links:      map[string]string{targetID + "@current": ""},
+	})
+	assert.NoError(t, err)
+
+	// the target is not published yet
+	_, err = client.PublishDocuments(context.TODO(), &v1.PublishDocumentsRequest{
+		DocumentIds: []string{sourceID},
+		StrictLinks: true,
+	})
+	assert.Error(t, err)
+
+	st, ok := status.FromError(err)
+	assert.True(t, ok)
+	assert.Equal(t, codes.FailedPrecondition, st.Code())
+	assert.Len(t, st.Details(), 1)
+
+	dangling, ok := st.Details()[0].(*v1.DanglingReferences)
+	assert.True(t, ok)
+	assert.Len(t, dangling.References, 1)
+	assert.Equal(t, sourceID, dangling.References[0].SourceId)
+	assert.Equal(t, targetID, dangling.References[0].TargetId)
+
+	// the target is published in the same batch
+	res, err := client.PublishDocuments(context.TODO(), &v1.PublishDocumentsRequest{
+		DocumentIds: []string{targetID, sourceID},
+		StrictLinks: true,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, res.Documents, 2)
+}
+
+func TestPublishScheduleService(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	docStore := store.NewGormStore(tester.TestDB())
+	client := NewDocumentService(compress.NewNop(), docStore, tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+	schedules := NewPublishScheduleService(docStore)
+
+	projectID := uuid.New().String()
+	docID := uuid.New().String()
+	otherID := uuid.New().String()
+
+	_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: projectID, DocumentId: &docID, Content: "scheduled"})
+	assert.NoError(t, err)
+	_, err = client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: uuid.New().String(), DocumentId: &otherID, Content: "other"})
+	assert.NoError(t, err)
+
+	publishAt := timestamppb.New(time.Now().Add(time.Hour))
+	for _, tt := range []struct {
+		name      string
+		docIDs    []string
+		publishAt *timestamppb.Timestamp
+		code      codes.Code
+	}{
+		{name: "missing document", docIDs: []string{docID, uuid.New().String()}, publishAt: publishAt, code: codes.NotFound},
+		{name: "document of another project", docIDs: []string{docID, otherID}, publishAt: publishAt, code: codes.InvalidArgument},
+		{name: "past publish time", docIDs: []string{docID}, publishAt: timestamppb.New(time.Now().Add(-time.Hour)), code: codes.InvalidArgument},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := schedules.SchedulePublish(context.TODO(), &v1.SchedulePublishRequest{ProjectId: projectID, DocumentIds: tt.docIDs, PublishAt: tt.publishAt})
+			st, _ := status.FromError(err)
+			assert.Equal(t, tt.code, st.Code())
+		})
+	}
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		res, err := schedules.SchedulePublish(context.TODO(), &v1.SchedulePublishRequest{
+			ProjectId:   projectID,
+			DocumentIds: []string{docID},
+			PublishAt:   timestamppb.New(time.Now().Add(time.Duration(i+1) * time.Hour)),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, v1.PublishScheduleStatus_SCHEDULE_PENDING, res.Schedule.Status)
+		ids = append(ids, res.Schedule.Id)
+	}
+
+	// the schedules are paged in publish order
+	list, err := schedules.ListPublishSchedules(context.TODO(), &v1.ListPublishSchedulesRequest{ProjectId: projectID, Page: 2, PerPage: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), list.Total)
+	assert.Len(t, list.Schedules, 1)
+	assert.Equal(t, ids[2], list.Schedules[0].Id)
+
+	// a pending schedule is cancelled once
+	cancelled, err := schedules.CancelPublishSchedule(context.TODO(), &v1.CancelPublishScheduleRequest{Id: ids[0]})
+	assert.NoError(t, err)
+	assert.Equal(t, v1.PublishScheduleStatus_SCHEDULE_CANCELLED, cancelled.Schedule.Status)
+	_, err = schedules.CancelPublishSchedule(context.TODO(), &v1.CancelPublishScheduleRequest{Id: ids[0]})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.FailedPrecondition, st.Code())
+
+	// a schedule claimed by the scheduler can not be cancelled
+	claimed, err := docStore.ClaimPublishSchedule(context.TODO(), uuid.MustParse(ids[1]), time.Now())
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+	_, err = schedules.CancelPublishSchedule(context.TODO(), &v1.CancelPublishScheduleRequest{Id: ids[1]})
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.FailedPrecondition, st.Code())
+
+	_, err = schedules.CancelPublishSchedule(context.TODO(), &v1.CancelPublishScheduleRequest{Id: uuid.New().String()})
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.NotFound, st.Code())
+
+	list, err = schedules.ListPublishSchedules(context.TODO(), &v1.ListPublishSchedulesRequest{ProjectId: projectID, PendingOnly: true})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), list.Total)
+	assert.Equal(t, ids[2], list.Schedules[0].Id)
+}
+
+func TestDocumentService_PublishDocumentsRelease(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	docStore := store.NewGormStore(tester.TestDB())
+	client := NewDocumentService(compress.NewNop(), docStore, tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+	published := NewPublishedDocumentService(compress.NewNop(), docStore, tester.Redis())
+
+	projectID := uuid.New().String()
+	rootID := uuid.New().String()
+	childID := uuid.New().String()
+	otherID := uuid.New().String()
+
+	_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{
+		ProjectId:  projectID,
+		DocumentId: &childID,
+		Content:    "child",
+	})
+	assert.NoError(t, err)
+
+	_, err = client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{
+		ProjectId:  projectID,
+		DocumentId: &otherID,
+		Content:    "outside the tree",
+	})
+	assert.NoError(t, err)
+
+	_, err = client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{
+		ProjectId:  projectID,
+		DocumentId: &rootID,
+		Content:    "root",
+		Children:   []string{childID + "@current"},
+	})
+	assert.NoError(t, err)
+
+	// the child is published before the root
+	_, err = client.PublishDocuments(context.TODO(), &v1.PublishDocumentsRequest{
+		DocumentIds: []string{childID},
+	})
+	assert.NoError(t, err)
+
+	releaseName := "first edition"
+	res, err := client.PublishDocuments(context.TODO(), &v1.PublishDocumentsRequest{
+		RootDocumentId: rootID,
+		DocumentIds:    []string{rootID, otherID},
+		ReleaseName:    &releaseName,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, res.Release)
+	assert.Equal(t, "0.0.1", res.Release.Version)
+	// the document published along with the root is not part of its tree
+	assert.Len(t, res.Release.Members, 2)
+	for _, member := range res.Release.Members {
+		assert.NotEqual(t, otherID, member.Id)
+	}
+
+	got, err := published.GetRelease(context.TODO(), &v1.GetReleaseRequest{
+		RootDocumentId:   rootID,
+		Version:          "0.0.1",
+		IncludeDocuments: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, releaseName, got.Release.Name)
+	assert.Len(t, got.Documents, 2)
+}
+
+func TestPublishedDocumentService_GetPublishedChangelog(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	docStore := store.NewGormStore(tester.TestDB())
+	client := NewDocumentService(compress.NewNop(), docStore, tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+	published := NewPublishedDocumentService(compress.NewNop(), docStore, tester.Redis())
+
+	projectID := uuid.New().String()
+	rootID := uuid.New().String()
+	childID := uuid.New().String()
+	addedID := uuid.New().String()
+
+	update := func(id, content string, children ...string) {
+		got, err := client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: id})
+		assert.NoError(t, err)
+		request := &v1.UpdateDocumentRequest{DocumentId: id, Version: got.Document.Version + 1, Content: &content}
+		if len(children) > 0 {
+			request.Children = children
+		}
+		_, err = client.UpdateDocument(context.TODO(), request)
+		assert.NoError(t, err)
+	}
+	publish := func(index string, ids ...string) {
+		_, err := client.PublishDocuments(context.TODO(), &v1.PublishDocumentsRequest{RootDocumentId: rootID, DocumentIds: ids, Index: index})
+		assert.NoError(t, err)
+	}
+
+	_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: projectID, DocumentId: &childID, Content: "child 1"})
+	assert.NoError(t, err)
+	_, err = client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: projectID, DocumentId: &addedID, Content: "added 1"})
+	assert.NoError(t, err)
+	_, err = client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{
+		ProjectId:  projectID,
+		DocumentId: &rootID,
+		Content:    "root",
+		Children:   []string{childID + "@current"},
+	})
+	assert.NoError(t, err)
+
+	// 0.0.1 has the child, 0.0.2 adds a document and a new child version
+	publish(`{"id": "`+rootID+`", "children": [{"id": "`+childID+`"}]}`, childID, rootID)
+	update(childID, "child 2\nmore")
+	update(rootID, "root", childID+"@current", addedID+"@current")
+	publish(`{"id": "`+rootID+`", "children": [{"id": "`+childID+`"}, {"id": "`+addedID+`@0.0.1"}]}`, childID, addedID, rootID)
+
+	// the child is published again after the tree
+	update(childID, "child 3")
+	_, err = client.PublishDocuments(context.TODO(), &v1.PublishDocumentsRequest{DocumentIds: []string{childID}})
+	assert.NoError(t, err)
+
+	check := func() {
+		res, err := published.GetPublishedChangelog(context.TODO(), &v1.GetPublishedChangelogRequest{RootDocumentId: rootID, FromVersion: "0.0.1", ToVersion: "0.0.2"})
+		assert.NoError(t, err)
+
+		changes := make(map[string]*v1.DocumentChange)
+		for _, change := range res.Changes {
+			changes[change.DocumentId] = change
+		}
+		assert.Len(t, changes, 3)
+		assert.Equal(t, v1.ChangeKind_CHANGE_ADDED, changes[addedID].Kind)
+		assert.Equal(t, v1.ChangeKind_CHANGE_MODIFIED, changes[rootID].Kind)
+		assert.True(t, changes[rootID].ChildrenChanged)
+		// the child is diffed at the version published with the tree, not at its latest version
+		assert.Equal(t, "0.0.1", changes[childID].FromVersion)
+		assert.Equal(t, "0.0.2", changes[childID].ToVersion)
+		assert.Equal(t, int32(2), changes[childID].LinesAdded)
+		assert.Equal(t, int32(1), changes[childID].LinesRemoved)
+	}
+
+	// the trees are read from the releases
+	check()
+
+	// the trees published before the releases are read from their tree indexes
+	err = tester.TestDB().Where("root_document_id = ?", rootID).Delete(&model.Release{}).Error
+	assert.NoError(t, err)
+	check()
+
+	err = tester.TestDB().Where("document_id = ? AND version = ?", rootID, "0.0.1").Delete(&model.DocumentIndex{}).Error
+	assert.NoError(t, err)
+	_, err = published.GetPublishedChangelog(context.TODO(), &v1.GetPublishedChangelogRequest{RootDocumentId: rootID, FromVersion: "0.0.1", ToVersion: "0.0.2"})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.NotFound, st.Code())
+}
+
+func TestPublishedDocumentService_ExportPublishedSite(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	docStore := store.NewGormStore(tester.TestDB())
+	client := NewDocumentService(compress.NewNop(), docStore, tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+	published := NewPublishedDocumentService(compress.NewNop(), docStore, tester.Redis())
+
+	projectID := uuid.New().String()
+	rootID := uuid.New().String()
+	childID := uuid.New().String()
+
+	_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: projectID, DocumentId: &childID, Meta: `{"title": "Child"}`, Content: strings.Repeat("child line\n", 10000)})
+	assert.NoError(t, err)
+	_, err = client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{
+		ProjectId:  projectID,
+		DocumentId: &rootID,
+		Meta:       `{"title": "Root"}`,
+		Content:    "see " + childID + "@current",
+		Children:   []string{childID + "@current"},
+	})
+	assert.NoError(t, err)
+
+	// the index is not a navigation, the site is navigated by the children
+	_, err = client.PublishDocuments(context.TODO(), &v1.PublishDocumentsRequest{RootDocumentId: rootID, DocumentIds: []string{childID, rootID}, Index: "chapters"})
+	assert.NoError(t, err)
+
+	stream := &contentStream{ctx: context.TODO()}
+	err = published.ExportPublishedSite(&v1.ExportPublishedSiteRequest{RootDocumentId: rootID}, stream)
+	assert.NoError(t, err)
+
+	archive, err := zip.NewReader(bytes.NewReader(stream.sent), int64(len(stream.sent)))
+	assert.NoError(t, err)
+	files := make(map[string]string)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		assert.NoError(t, err)
+		data, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		files[file.Name] = string(data)
+	}
+
+	assert.Len(t, files, 3)
+	assert.Contains(t, files[rootID+".md"], "./"+childID+".md")
+	assert.Equal(t, 10000, strings.Count(files[childID+".md"], "child line"))
+	assert.Contains(t, files["index.md"], "Child")
+}
+
+func TestDocumentService_TraverseLinks(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	docStore := store.NewGormStore(tester.TestDB())
+	client := NewDocumentService(compress.NewNop(), docStore, tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+
+	projectID := uuid.New().String()
+	aID, bID, cID, dID := uuid.New().String(), uuid.New().String(), uuid.New().String(), uuid.New().String()
+	for _, id := range []string{bID, cID, dID} {
+		docID := id
+		_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: projectID, DocumentId: &docID})
+		assert.NoError(t, err)
+	}
+	_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{
+		ProjectId:  projectID,
+		DocumentId: &aID,
+		Meta:       `{"title": "A"}`,
+		Children:   []string{cID + "@current"},
+	})
+	assert.NoError(t, err)
+
+	// a -> b -> d, c is a child of a
+	err = docStore.CreateBacklinks(context.TODO(), []*model.Link{
+		{SourceID: aID, TargetID: bID, TargetVersion: model.CurrentDocumentVersion},
+		{SourceID: bID, TargetID: dID, TargetVersion: model.CurrentDocumentVersion},
+	})
+	assert.NoError(t, err)
+
+	nodeIDs := func(res *v1.TraverseLinksResponse) []string {
+		var ids []string
+		for _, node := range res.Nodes {
+			ids = append(ids, node.Id)
+		}
+		return ids
+	}
+
+	res, err := client.TraverseLinks(context.TODO(), &v1.TraverseLinksRequest{
+		DocumentId: bID,
+		Follow:     []v1.TraverseEdge{v1.TraverseEdge_TRAVERSE_LINKS, v1.TraverseEdge_TRAVERSE_BACKLINKS},
+		MaxDepth:   1,
+	})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{bID, aID, dID}, nodeIDs(res))
+	assert.Len(t, res.Edges, 2)
+	assert.False(t, res.Truncated)
+
+	res, err = client.TraverseLinks(context.TODO(), &v1.TraverseLinksRequest{DocumentId: aID})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{aID, bID, cID, dID}, nodeIDs(res))
+	assert.Equal(t, "A", res.Nodes[0].Title)
+	for _, node := range res.Nodes {
+		if node.Id == dID {
+			assert.Equal(t, int32(2), node.Depth)
+		}
+	}
+
+	res, err = client.TraverseLinks(context.TODO(), &v1.TraverseLinksRequest{DocumentId: aID, Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, res.Nodes, 2)
+	assert.True(t, res.Truncated)
+
+	// the published graph follows the published children of the version
+	_, err = client.PublishDocuments(context.TODO(), &v1.PublishDocumentsRequest{DocumentIds: []string{cID, aID}})
+	assert.NoError(t, err)
+
+	version := "0.0.1"
+	res, err = client.TraverseLinks(context.TODO(), &v1.TraverseLinksRequest{DocumentId: aID, Version: &version})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{aID, cID}, nodeIDs(res))
+	if assert.Len(t, res.Edges, 1) {
+		assert.Equal(t, v1.ReferenceKind_REFERENCE_CHILD, res.Edges[0].Kind)
+		assert.Equal(t, "0.0.1", res.Edges[0].TargetVersion)
+	}
+
+	_, err = client.TraverseLinks(context.TODO(), &v1.TraverseLinksRequest{DocumentId: "not-a-uuid"})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+
+	// the depth and the limit are clamped to the maximums, the validator rejects them before
+	child := ""
+	for i := 0; i < 12; i++ {
+		docID := uuid.New().String()
+		req := &v1.CreateDocumentRequest{ProjectId: projectID, DocumentId: &docID}
+		if child != "" {
+			req.Children = []string{child + "@current"}
+		}
+		_, err = client.CreateDocument(context.TODO(), req)
+		assert.NoError(t, err)
+		child = docID
+	}
+	deep := &v1.TraverseLinksRequest{DocumentId: child, Follow: []v1.TraverseEdge{v1.TraverseEdge_TRAVERSE_CHILDREN}, MaxDepth: 100, Limit: 100000}
+	assert.Error(t, deep.Validate())
+	res, err = client.TraverseLinks(context.TODO(), deep)
+	assert.NoError(t, err)
+	assert.Len(t, res.Nodes, maxTraverseDepth+1)
+}
+
+func TestDocumentService_ValidateProject(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	docStore := store.NewGormStore(tester.TestDB())
+	client := NewDocumentService(compress.NewNop(), docStore, tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+
+	projectID := uuid.New().String()
+	ids := make([]string, 8)
+	for i := range ids {
+		ids[i] = uuid.New().String()
+	}
+	rID, aID, fID, bID, cID, dID, eID, xID := ids[0], ids[1], ids[2], ids[3], ids[4], ids[5], ids[6], ids[7]
+
+	create := func(id string, links map[string]string, children []string) {
+		_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{
+			ProjectId:  projectID,
+			DocumentId: &id,
+			Links:      links,
+			Children:   children,
+		})
+		assert.NoError(t, err)
+	}
+
+	// r -> a -> f -> a is a cycle, b -> c is detached from the root r
+	create(rID, nil, []string{aID + "@current", xID + "@current"})
+	create(aID, map[string]string{dID + "@current": "", eID + "@current": "", rID + "@0.0.9": ""}, []string{fID + "@current"})
+	create(fID, nil, []string{aID + "@current"})
+	create(bID, nil, []string{cID + "@current"})
+	create(cID, nil, nil)
+	create(dID, nil, nil)
+	create(eID, nil, nil)
+	create(xID, nil, nil)
+
+	_, err := client.DeleteDocument(context.TODO(), &v1.DeleteDocumentRequest{Id: dID})
+	assert.NoError(t, err)
+	for _, id := range []string{eID, xID} {
+		_, err = client.EraseDocument(context.TODO(), &v1.EraseDocumentRequest{Id: id})
+		assert.NoError(t, err)
+	}
+
+	findingKinds := func(res *v1.ValidateProjectResponse) map[v1.FindingKind][]*v1.Finding {
+		kinds := make(map[v1.FindingKind][]*v1.Finding)
+		for _, finding := range res.Findings {
+			kinds[finding.Kind] = append(kinds[finding.Kind], finding)
+		}
+		return kinds
+	}
+
+	req := &v1.ValidateProjectRequest{ProjectId: projectID, RootIds: []string{rID}}
+	res, err := client.ValidateProject(context.TODO(), req)
+	assert.NoError(t, err)
+	kinds := findingKinds(res)
+
+	if assert.Len(t, kinds[v1.FindingKind_FINDING_LINK_TO_DELETED], 1) {
+		finding := kinds[v1.FindingKind_FINDING_LINK_TO_DELETED][0]
+		assert.Equal(t, aID, finding.DocumentId)
+		assert.Equal(t, v1.Severity_SEVERITY_WARNING, finding.Severity)
+	}
+	if assert.Len(t, kinds[v1.FindingKind_FINDING_LINK_TO_ERASED], 1) {
+		assert.Equal(t, eID+"@current", kinds[v1.FindingKind_FINDING_LINK_TO_ERASED][0].Reference)
+	}
+	if assert.Len(t, kinds[v1.FindingKind_FINDING_LINK_TO_MISSING_VERSION], 1) {
+		assert.Equal(t, rID+"@0.0.9", kinds[v1.FindingKind_FINDING_LINK_TO_MISSING_VERSION][0].Reference)
+	}
+	if assert.Len(t, kinds[v1.FindingKind_FINDING_MISSING_CHILD], 1) {
+		finding := kinds[v1.FindingKind_FINDING_MISSING_CHILD][0]
+		assert.Equal(t, rID, finding.DocumentId)
+		assert.Equal(t, v1.Severity_SEVERITY_ERROR, finding.Severity)
+	}
+	assert.Len(t, kinds[v1.FindingKind_FINDING_CHILDREN_CYCLE], 1)
+
+	// only the top of the detached subtree gets a fix
+	orphans := map[string]*v1.Finding{}
+	for _, finding := range kinds[v1.FindingKind_FINDING_ORPHAN] {
+		orphans[finding.DocumentId] = finding
+	}
+	assert.Len(t, orphans, 2)
+	if assert.NotNil(t, orphans[bID]) && assert.NotNil(t, orphans[bID].Fix) {
+		assert.Equal(t, v1.FixAction_FIX_ADD_CHILD, orphans[bID].Fix.Action)
+		assert.Equal(t, rID, orphans[bID].Fix.DocumentId)
+	}
+	if assert.NotNil(t, orphans[cID]) {
+		assert.Nil(t, orphans[cID].Fix)
+	}
+
+	// the report does not change the documents
+	assert.Zero(t, res.Fixed)
+	for _, finding := range res.Findings {
+		assert.False(t, finding.Fixed)
+	}
+
+	req.ApplyFixes = true
+	res, err = client.ValidateProject(context.TODO(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(len(res.Findings)-1), res.Fixed)
+
+	req.ApplyFixes = false
+	res, err = client.ValidateProject(context.TODO(), req)
+	assert.NoError(t, err)
+	kinds = findingKinds(res)
+	assert.Empty(t, kinds[v1.FindingKind_FINDING_LINK_TO_DELETED])
+	assert.Empty(t, kinds[v1.FindingKind_FINDING_LINK_TO_ERASED])
+	assert.Empty(t, kinds[v1.FindingKind_FINDING_LINK_TO_MISSING_VERSION])
+	assert.Empty(t, kinds[v1.FindingKind_FINDING_MISSING_CHILD])
+	assert.Empty(t, kinds[v1.FindingKind_FINDING_CHILDREN_CYCLE])
+	for _, finding := range kinds[v1.FindingKind_FINDING_ORPHAN] {
+		assert.NotEqual(t, bID, finding.DocumentId)
+		assert.NotEqual(t, cID, finding.DocumentId)
+	}
+
+	// without a root the documents without a parent are the roots, a detached cycle gets a single fix
+	otherProjectID := uuid.New().String()
+	topID, leafID, cycleAID, cycleBID := uuid.New().String(), uuid.New().String(), uuid.New().String(), uuid.New().String()
+	for id, children := range map[string][]string{
+		topID:    {leafID + "@current"},
+		leafID:   nil,
+		cycleAID: {cycleBID + "@current"},
+		cycleBID: {cycleAID + "@current"},
+	} {
+		_, err = client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: otherProjectID, DocumentId: &id, Children: children})
+		assert.NoError(t, err)
+	}
+
+	res, err = client.ValidateProject(context.TODO(), &v1.ValidateProjectRequest{ProjectId: otherProjectID})
+	assert.NoError(t, err)
+	kinds = findingKinds(res)
+	var orphanIDs []string
+	var fixes []*v1.Fix
+	for _, finding := range kinds[v1.FindingKind_FINDING_ORPHAN] {
+		orphanIDs = append(orphanIDs, finding.DocumentId)
+		if finding.Fix != nil {
+			fixes = append(fixes, finding.Fix)
+		}
+	}
+	assert.ElementsMatch(t, []string{cycleAID, cycleBID}, orphanIDs)
+	if assert.Len(t, fixes, 1) {
+		assert.Equal(t, topID, fixes[0].DocumentId)
+	}
+}
+
+func TestDocumentService_ListDocumentsByBacklinkCount(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	docStore := store.NewGormStore(tester.TestDB())
+	client := NewDocumentService(compress.NewNop(), docStore, tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+
+	projectID := uuid.New().String()
+	aID, bID, cID := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	for _, id := range []string{aID, bID, cID} {
+		docID := id
+		_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: projectID, DocumentId: &docID})
+		assert.NoError(t, err)
+	}
+
+	// c is linked twice, b once
+	err := docStore.CreateBacklinks(context.TODO(), []*model.Link{
+		{SourceID: aID, TargetID: cID, TargetVersion: model.CurrentDocumentVersion},
+		{SourceID: bID, TargetID: cID, TargetVersion: model.CurrentDocumentVersion},
+		{SourceID: aID, TargetID: bID, TargetVersion: model.CurrentDocumentVersion},
+	})
+	assert.NoError(t, err)
+
+	links, err := docStore.ListPendingLinks(context.TODO(), 10)
+	assert.NoError(t, err)
+	assert.Len(t, links, 3)
+	assert.NoError(t, docStore.UpdateBacklinkCounts(context.TODO(), []string{bID, cID}))
+	assert.NoError(t, docStore.ClearPendingLinks(context.TODO(), links))
+
+	links, err = docStore.ListPendingLinks(context.TODO(), 10)
+	assert.NoError(t, err)
+	assert.Empty(t, links)
+
+	res, err := client.ListDocuments(context.TODO(), &v1.ListDocumentsRequest{
+		ProjectId: projectID,
+		Order:     v1.DocumentOrder_ORDER_BACKLINK_COUNT,
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Documents, 3) {
+		assert.Equal(t, cID, res.Documents[0].Id)
+		assert.Equal(t, int64(2), res.Documents[0].BacklinkCount)
+		assert.Equal(t, bID, res.Documents[1].Id)
+		assert.Equal(t, int64(1), res.Documents[1].BacklinkCount)
+	}
+
+	// a removed link leaves no pending row, the stale count is recounted
+	err = docStore.DeleteBacklinks(context.TODO(), []*model.Link{{SourceID: aID, TargetID: cID, TargetVersion: model.CurrentDocumentVersion}})
+	assert.NoError(t, err)
+	updated, err := docStore.UpdateStaleBacklinkCounts(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), updated)
+
+	doc, err := client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: cID})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), doc.Document.BacklinkCount)
+}
+
+func TestDocumentService_TypedLinks(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	client := NewDocumentService(compress.NewNop(), store.NewGormStore(tester.TestDB()), tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+	published := NewPublishedDocumentService(compress.NewNop(), store.NewGormStore(tester.TestDB()), tester.Redis())
+
+	projectID := uuid.New().String()
+	aID, bID, cID := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	for _, id := range []string{aID, bID, cID} {
+		docID := id
+		_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: projectID, DocumentId: &docID})
+		assert.NoError(t, err)
+	}
+
+	links := map[string]string{
+		bID + "@current": `{"type": "embeds", "anchor": "block-1", "label": "intro"}`,
+		cID + "@current": "",
+	}
+	_, err := client.UpdateDocument(context.TODO(), &v1.UpdateDocumentRequest{DocumentId: aID, Links: links, Version: 1})
+	assert.NoError(t, err)
+
+	res, err := client.ListBacklinks(context.TODO(), &v1.ListBacklinksRequest{DocumentId: bID, Types: []string{model.LinkTypeEmbeds}})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Links, 1) {
+		assert.Equal(t, aID, res.Links[0].SourceId)
+		assert.Equal(t, model.LinkTypeEmbeds, res.Links[0].Type)
+		assert.Equal(t, "block-1", res.Links[0].Anchor)
+		assert.Equal(t, "intro", res.Links[0].Label)
+	}
+
+	// an empty value is a reference
+	res, err = client.ListBacklinks(context.TODO(), &v1.ListBacklinksRequest{DocumentId: cID, Types: []string{model.LinkTypeEmbeds}})
+	assert.NoError(t, err)
+	assert.Empty(t, res.Links)
+	res, err = client.ListBacklinks(context.TODO(), &v1.ListBacklinksRequest{DocumentId: cID, Types: []string{model.LinkTypeReferences}})
+	assert.NoError(t, err)
+	assert.Len(t, res.Links, 1)
+
+	// changing the type of an existing link updates the link
+	links[cID+"@current"] = model.LinkTypeSupersedes
+	_, err = client.UpdateDocument(context.TODO(), &v1.UpdateDocumentRequest{DocumentId: aID, Links: links, Version: 2})
+	assert.NoError(t, err)
+	res, err = client.ListBacklinks(context.TODO(), &v1.ListBacklinksRequest{DocumentId: cID})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Links, 1) {
+		assert.Equal(t, model.LinkTypeSupersedes, res.Links[0].Type)
+	}
+
+	links[cID+"@current"] = "Not A Type"
+	_, err = client.UpdateDocument(context.TODO(), &v1.UpdateDocumentRequest{DocumentId: aID, Links: links, Version: 3})
+	assert.ErrorIs(t, err, ErrInvalidLinkAnnotation)
+
+	// the published links keep the annotation
+	_, err = client.PublishDocuments(context.TODO(), &v1.PublishDocumentsRequest{DocumentIds: []string{aID}})
+	assert.NoError(t, err)
+	publishedRes, err := published.ListPublishedBacklinks(context.TODO(), &v1.ListPublishedBacklinksRequest{
+		DocumentId: bID,
+		Version:    model.CurrentDocumentVersion,
+		Types:      []string{model.LinkTypeEmbeds},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, publishedRes.Links, 1) {
+		assert.Equal(t, "block-1", publishedRes.Links[0].Anchor)
+	}
+}
+
+func TestDocumentService_DeletePolicy(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	client := NewDocumentService(compress.NewNop(), store.NewGormStore(tester.TestDB()), tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+
+	projectID := uuid.New().String()
+	create := func(children ...string) string {
+		docID := uuid.New().String()
+		_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: projectID, DocumentId: &docID, Children: children})
+		assert.NoError(t, err)
+		return docID
+	}
+
+	// p -> a -> c, s links to a
+	cID := create()
+	aID := create(cID + "@current")
+	pID := create(aID + "@current")
+	sID := create()
+	_, err := client.UpdateDocument(context.TODO(), &v1.UpdateDocumentRequest{DocumentId: sID, Links: map[string]string{aID + "@current": ""}, Version: 1})
+	assert.NoError(t, err)
+
+	_, err = client.DeleteDocument(context.TODO(), &v1.DeleteDocumentRequest{Id: aID, Policy: v1.DeletePolicy_DELETE_RESTRICT})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.FailedPrecondition, st.Code())
+	if assert.Len(t, st.Details(), 1) {
+		assert.Len(t, st.Details()[0].(*v1.DanglingReferences).References, 2)
+	}
+
+	res, err := client.DeleteDocument(context.TODO(), &v1.DeleteDocumentRequest{Id: aID, Policy: v1.DeletePolicy_DELETE_DETACH})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{aID}, res.Report.DeletedIds)
+	assert.Len(t, res.Report.Detached, 2)
+	assert.Empty(t, res.Report.Dangling)
+
+	parent, err := client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: pID})
+	assert.NoError(t, err)
+	assert.Empty(t, parent.Document.Children)
+	assert.Equal(t, int64(1), parent.Document.Version)
+	source, err := client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: sID})
+	assert.NoError(t, err)
+	assert.Empty(t, source.Document.Links)
+	assert.Equal(t, int64(2), source.Document.Version)
+	backlinks, err := client.ListBacklinks(context.TODO(), &v1.ListBacklinksRequest{DocumentId: aID})
+	assert.NoError(t, err)
+	assert.Empty(t, backlinks.Links)
+
+	// a soft deleted document can be erased with its backups
+	_, err = client.UpdateDocument(context.TODO(), &v1.UpdateDocumentRequest{DocumentId: cID, Children: []string{}, Content: &projectID, Version: 1})
+	assert.NoError(t, err)
+	erased, err := client.EraseDocument(context.TODO(), &v1.EraseDocumentRequest{Id: aID})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{aID}, erased.Report.DeletedIds)
+
+	// x -> y -> c, w links to x
+	yID := create(cID + "@current")
+	xID := create(yID + "@current")
+	wID := create()
+	_, err = client.UpdateDocument(context.TODO(), &v1.UpdateDocumentRequest{DocumentId: wID, Links: map[string]string{xID + "@current": ""}, Version: 1})
+	assert.NoError(t, err)
+
+	erased, err = client.EraseDocument(context.TODO(), &v1.EraseDocumentRequest{Id: xID, Policy: v1.DeletePolicy_DELETE_CASCADE})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{xID, yID, cID}, erased.Report.DeletedIds)
+	assert.Equal(t, int32(1), erased.Report.ErasedBackups)
+	if assert.Len(t, erased.Report.Dangling, 1) {
+		assert.Equal(t, wID, erased.Report.Dangling[0].SourceId)
+		assert.Equal(t, v1.ReferenceKind_REFERENCE_LINK, erased.Report.Dangling[0].Kind)
+	}
+
+	docs, err := client.ListDocuments(context.TODO(), &v1.ListDocumentsRequest{ProjectId: projectID})
+	assert.NoError(t, err)
+	var ids []string
+	for _, doc := range docs.Documents {
+		ids = append(ids, doc.Id)
+	}
+	assert.ElementsMatch(t, []string{pID, sID, wID}, ids)
+
+	// a parent in another project is found from the child edges
+	zID := create()
+	otherID := uuid.New().String()
+	_, err = client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: uuid.New().String(), DocumentId: &otherID, Children: []string{zID + "@current"}})
+	assert.NoError(t, err)
+	res, err = client.DeleteDocument(context.TODO(), &v1.DeleteDocumentRequest{Id: zID, Policy: v1.DeletePolicy_DELETE_DETACH})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Report.Detached, 1) {
+		assert.Equal(t, otherID, res.Report.Detached[0].Id)
+	}
+	other, err := client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: otherID})
+	assert.NoError(t, err)
+	assert.Empty(t, other.Document.Children)
+}
+
+func TestDocumentService_Trash(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	docStore := store.NewGormStore(tester.TestDB())
+	client := NewDocumentService(compress.NewNop(), docStore, tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+
+	projectID := uuid.New().String()
+	aID, bID := uuid.New().String(), uuid.New().String()
+	for _, id := range []string{aID, bID} {
+		docID := id
+		_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: projectID, DocumentId: &docID, Meta: `{"title": "trash"}`})
+		assert.NoError(t, err)
+	}
+
+	_, err := client.DeleteDocument(context.TODO(), &v1.DeleteDocumentRequest{Id: aID})
+	assert.NoError(t, err)
+
+	trash, err := client.ListDeletedDocuments(context.TODO(), &v1.ListDeletedDocumentsRequest{ProjectId: projectID})
+	assert.NoError(t, err)
+	if assert.Len(t, trash.Documents, 1) {
+		assert.Equal(t, aID, trash.Documents[0].Id)
+		assert.Equal(t, `{"title": "trash"}`, trash.Documents[0].Meta)
+		assert.NotNil(t, trash.Documents[0].DeletedAt)
+	}
+
+	restored, err := client.UndeleteDocument(context.TODO(), &v1.UndeleteDocumentRequest{Id: aID})
+	assert.NoError(t, err)
+	assert.Equal(t, aID, restored.Document.Id)
+	assert.Nil(t, restored.Document.DeletedAt)
+
+	docs, err := client.ListDocuments(context.TODO(), &v1.ListDocumentsRequest{ProjectId: projectID})
+	assert.NoError(t, err)
+	assert.Len(t, docs.Documents, 2)
+
+	// only a deleted document can be restored
+	_, err = client.UndeleteDocument(context.TODO(), &v1.UndeleteDocumentRequest{Id: aID})
+	assert.ErrorIs(t, err, store.ErrDocumentNotFound)
+
+	// the retention job erases the documents deleted before the retention
+	_, err = client.DeleteDocument(context.TODO(), &v1.DeleteDocumentRequest{Id: bID})
+	assert.NoError(t, err)
+	expired, err := docStore.ListDocumentsDeletedBefore(context.TODO(), time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, expired)
+	expired, err = docStore.ListDocumentsDeletedBefore(context.TODO(), time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	if assert.Len(t, expired, 1) {
+		_, err = client.EraseDocument(context.TODO(), &v1.EraseDocumentRequest{Id: expired[0].ID})
+		assert.NoError(t, err)
+	}
+
+	trash, err = client.ListDeletedDocuments(context.TODO(), &v1.ListDeletedDocumentsRequest{ProjectId: projectID})
+	assert.NoError(t, err)
+	assert.Empty(t, trash.Documents)
+}
+
+func TestDocumentService_MoveCopyDocuments(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	client := NewDocumentService(compress.NewNop(), store.NewGormStore(tester.TestDB()), tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+
+	sourceProjectID := uuid.New().String()
+	targetProjectID := uuid.New().String()
+	create := func(projectID string, children ...string) string {
+		docID := uuid.New().String()
+		_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: projectID, DocumentId: &docID, Children: children})
+		assert.NoError(t, err)
+		return docID
+	}
+
+	// p -> r -> c, r links to c, t is the parent in the target project
+	cID := create(sourceProjectID)
+	rID := create(sourceProjectID, cID+"@current")
+	pID := create(sourceProjectID, rID+"@current")
+	tID := create(targetProjectID)
+	_, err := client.UpdateDocument(context.TODO(), &v1.UpdateDocumentRequest{DocumentId: rID, Links: map[string]string{cID + "@current": "embeds"}, Version: 1})
+	assert.NoError(t, err)
+
+	copied, err := client.CopyDocuments(context.TODO(), &v1.CopyDocumentsRequest{DocumentIds: []string{rID}, ProjectId: targetProjectID, ParentId: &tID})
+	assert.NoError(t, err)
+	assert.Len(t, copied.CopiedIds, 2)
+	rCopyID, cCopyID := copied.CopiedIds[rID], copied.CopiedIds[cID]
+
+	rCopy, err := client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: rCopyID})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{cCopyID + "@current": "embeds"}, rCopy.Document.Links)
+	assert.Equal(t, []string{cCopyID + "@current"}, rCopy.Document.Children)
+	backlinks, err := client.ListBacklinks(context.TODO(), &v1.ListBacklinksRequest{DocumentId: cCopyID})
+	assert.NoError(t, err)
+	if assert.Len(t, backlinks.Links, 1) {
+		assert.Equal(t, rCopyID, backlinks.Links[0].SourceId)
+	}
+	parent, err := client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: tID})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{rCopyID + "@current"}, parent.Document.Children)
+
+	moved, err := client.MoveDocuments(context.TODO(), &v1.MoveDocumentsRequest{DocumentIds: []string{rID}, ProjectId: targetProjectID, ParentId: &tID})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{rID, cID}, moved.MovedIds)
+	if assert.Len(t, moved.Detached, 1) {
+		assert.Equal(t, pID, moved.Detached[0].Id)
+	}
+
+	oldParent, err := client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: pID})
+	assert.NoError(t, err)
+	assert.Empty(t, oldParent.Document.Children)
+	parent, err = client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: tID})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{rCopyID + "@current", rID + "@current"}, parent.Document.Children)
+
+	sourceDocs, err := client.ListDocuments(context.TODO(), &v1.ListDocumentsRequest{ProjectId: sourceProjectID})
+	assert.NoError(t, err)
+	assert.Len(t, sourceDocs.Documents, 1)
+	targetDocs, err := client.ListDocuments(context.TODO(), &v1.ListDocumentsRequest{ProjectId: targetProjectID})
+	assert.NoError(t, err)
+	assert.Len(t, targetDocs.Documents, 5)
+
+	// a document with a link to a deleted document can not be moved
+	gID := create(sourceProjectID)
+	lID := create(sourceProjectID)
+	_, err = client.UpdateDocument(context.TODO(), &v1.UpdateDocumentRequest{DocumentId: lID, Links: map[string]string{gID + "@current": ""}, Version: 1})
+	assert.NoError(t, err)
+	_, err = client.DeleteDocument(context.TODO(), &v1.DeleteDocumentRequest{Id: gID})
+	assert.NoError(t, err)
+	_, err = client.MoveDocuments(context.TODO(), &v1.MoveDocumentsRequest{DocumentIds: []string{lID}, ProjectId: targetProjectID})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.FailedPrecondition, st.Code())
+
+	// the parent must be in the target project
+	_, err = client.CopyDocuments(context.TODO(), &v1.CopyDocumentsRequest{DocumentIds: []string{lID}, ProjectId: targetProjectID, ParentId: &pID})
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+}
+
+func TestDocumentService_DuplicateAndTemplates(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	client := NewDocumentService(compress.NewNop(), store.NewGormStore(tester.TestDB()), tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+
+	projectID := uuid.New().String()
+	cID := uuid.New().String()
+	_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: projectID, DocumentId: &cID, Content: `{"text": "{{title}} notes"}`})
+	assert.NoError(t, err)
+	tID := uuid.New().String()
+	_, err = client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{
+		ProjectId:  projectID,
+		DocumentId: &tID,
+		Meta:       `{"title": "{{title}}"}`,
+		Content:    "# {{ title }} by {{owner}}",
+		Children:   []string{cID + "@current"},
+		Template:   true,
+	})
+	assert.NoError(t, err)
+
+	templates, err := client.ListDocuments(context.TODO(), &v1.ListDocumentsRequest{ProjectId: projectID, Templates: true})
+	assert.NoError(t, err)
+	if assert.Len(t, templates.Documents, 1) {
+		assert.Equal(t, tID, templates.Documents[0].Id)
+	}
+
+	// every placeholder needs a variable
+	_, err = client.InstantiateTemplate(context.TODO(), &v1.InstantiateTemplateRequest{TemplateId: tID, Variables: map[string]string{"title": "Spec"}})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	assert.Contains(t, st.Message(), "owner")
+
+	variables := map[string]string{"title": `Say "hi"`, "owner": "me"}
+	created, err := client.InstantiateTemplate(context.TODO(), &v1.InstantiateTemplateRequest{TemplateId: tID, Variables: variables, WithChildren: true})
+	assert.NoError(t, err)
+	assert.Len(t, created.CreatedIds, 2)
+	assert.Equal(t, created.CreatedIds[tID], created.Document.Id)
+
+	doc, err := client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: created.Document.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"title": "Say \"hi\""}`, doc.Document.Meta)
+	assert.Equal(t, `# Say "hi" by me`, doc.Document.Content)
+	assert.False(t, doc.Document.Template)
+	assert.Equal(t, []string{created.CreatedIds[cID] + "@current"}, doc.Document.Children)
+	child, err := client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: created.CreatedIds[cID]})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"text": "Say \"hi\" notes"}`, child.Document.Content)
+
+	shallow, err := client.InstantiateTemplate(context.TODO(), &v1.InstantiateTemplateRequest{TemplateId: tID, Variables: variables})
+	assert.NoError(t, err)
+	assert.Len(t, shallow.CreatedIds, 1)
+	doc, err = client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: shallow.Document.Id})
+	assert.NoError(t, err)
+	assert.Empty(t, doc.Document.Children)
+
+	_, err = client.InstantiateTemplate(context.TODO(), &v1.InstantiateTemplateRequest{TemplateId: cID, Variables: variables})
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.FailedPrecondition, st.Code())
+
+	// a shallow duplicate keeps the children, a deep duplicate copies them
+	duplicate, err := client.DuplicateDocument(context.TODO(), &v1.DuplicateDocumentRequest{Id: tID})
+	assert.NoError(t, err)
+	assert.True(t, duplicate.Document.Template)
+	doc, err = client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: duplicate.Document.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{cID + "@current"}, doc.Document.Children)
+	assert.Equal(t, "# {{ title }} by {{owner}}", doc.Document.Content)
+
+	deep, err := client.DuplicateDocument(context.TODO(), &v1.DuplicateDocumentRequest{Id: tID, Deep: true})
+	assert.NoError(t, err)
+	assert.Len(t, deep.CopiedIds, 2)
+	doc, err = client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: deep.Document.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{deep.CopiedIds[cID] + "@current"}, doc.Document.Children)
+}
+
+func TestDocumentService_BatchWrite(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	client := NewDocumentService(compress.NewNop(), store.NewGormStore(tester.TestDB()), tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+
+	projectID := uuid.New().String()
+	existingID := uuid.New().String()
+	_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: projectID, DocumentId: &existingID})
+	assert.NoError(t, err)
+
+	// a links to b created later in the batch, the existing document links to a
+	res, err := client.BatchWrite(context.TODO(), &v1.BatchWriteRequest{Operations: []*v1.BatchOperation{
+		{TempId: "a", Operation: &v1.BatchOperation_Create{Create: &v1.CreateDocumentRequest{ProjectId: projectID, Links: map[string]string{"$b@current": "embeds"}}}},
+		{TempId: "b", Operation: &v1.BatchOperation_Create{Create: &v1.CreateDocumentRequest{ProjectId: projectID}}},
+		{Operation: &v1.BatchOperation_Link{Link: &v1.BatchLink{SourceId: existingID, Target: "$a@current"}}},
+		{Operation: &v1.BatchOperation_Update{Update: &v1.UpdateDocumentRequest{DocumentId: "$b", Children: []string{"$a@current"}, Version: 1}}},
+	}})
+	assert.NoError(t, err)
+	assert.Zero(t, res.Failed)
+	assert.Len(t, res.Results, 4)
+	aID, bID := res.TempIds["a"], res.TempIds["b"]
+	assert.Equal(t, aID, res.Results[0].DocumentId)
+	assert.Equal(t, int64(1), res.Results[2].Version)
+
+	a, err := client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: aID})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{bID + "@current": "embeds"}, a.Document.Links)
+	b, err := client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: bID})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{aID + "@current"}, b.Document.Children)
+	backlinks, err := client.ListBacklinks(context.TODO(), &v1.ListBacklinksRequest{DocumentId: aID})
+	assert.NoError(t, err)
+	assert.Len(t, backlinks.Links, 1)
+	backlinks, err = client.ListBacklinks(context.TODO(), &v1.ListBacklinksRequest{DocumentId: bID})
+	assert.NoError(t, err)
+	assert.Len(t, backlinks.Links, 1)
+
+	// the atomic mode rolls back the batch on the first failure
+	res, err = client.BatchWrite(context.TODO(), &v1.BatchWriteRequest{Operations: []*v1.BatchOperation{
+		{TempId: "c", Operation: &v1.BatchOperation_Create{Create: &v1.CreateDocumentRequest{ProjectId: projectID}}},
+		{Operation: &v1.BatchOperation_Delete{Delete: &v1.DeleteDocumentRequest{Id: aID}}},
+		{Operation: &v1.BatchOperation_Link{Link: &v1.BatchLink{SourceId: "$c", Target: uuid.New().String() + "@current"}}},
+		{Operation: &v1.BatchOperation_Delete{Delete: &v1.DeleteDocumentRequest{Id: bID}}},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), res.Failed)
+	codesOf := func(results []*v1.BatchResult) []codes.Code {
+		var list []codes.Code
+		for _, result := range results {
+			list = append(list, codes.Code(result.Code))
+		}
+		return list
+	}
+	assert.Equal(t, []codes.Code{codes.Aborted, codes.Aborted, codes.Unknown, codes.Aborted}, codesOf(res.Results))
+	docs, err := client.ListDocuments(context.TODO(), &v1.ListDocumentsRequest{ProjectId: projectID})
+	assert.NoError(t, err)
+	assert.Len(t, docs.Documents, 3)
+
+	// the best effort mode saves the operations that succeed
+	res, err = client.BatchWrite(context.TODO(), &v1.BatchWriteRequest{Mode: v1.BatchMode_BATCH_BEST_EFFORT, Operations: []*v1.BatchOperation{
+		{TempId: "c", Operation: &v1.BatchOperation_Create{Create: &v1.CreateDocumentRequest{ProjectId: projectID}}},
+		{Operation: &v1.BatchOperation_Update{Update: &v1.UpdateDocumentRequest{DocumentId: "$missing", Version: 1}}},
+		{Operation: &v1.BatchOperation_Delete{Delete: &v1.DeleteDocumentRequest{Id: aID}}},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), res.Failed)
+	assert.Equal(t, []codes.Code{codes.OK, codes.InvalidArgument, codes.OK}, codesOf(res.Results))
+	docs, err = client.ListDocuments(context.TODO(), &v1.ListDocumentsRequest{ProjectId: projectID})
+	assert.NoError(t, err)
+	assert.Len(t, docs.Documents, 3)
+
+	// the temp ids of the update and delete operations pass the request validation, the resolved requests are validated
+	validate := grpcvalidator.UnaryServerInterceptor()
+	batchWrite := func(request *v1.BatchWriteRequest) (*v1.BatchWriteResponse, error) {
+		res, err := validate(context.TODO(), request, &grpc.UnaryServerInfo{FullMethod: "/apis.v1.DocumentService/BatchWrite"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return client.BatchWrite(ctx, req.(*v1.BatchWriteRequest))
+		})
+		if err != nil {
+			return nil, err
+		}
+		return res.(*v1.BatchWriteResponse), nil
+	}
+	meta := `{"title": "Tomatoes"}`
+	res, err = batchWrite(&v1.BatchWriteRequest{Operations: []*v1.BatchOperation{
+		{TempId: "d", Operation: &v1.BatchOperation_Create{Create: &v1.CreateDocumentRequest{ProjectId: projectID}}},
+		{Operation: &v1.BatchOperation_Update{Update: &v1.UpdateDocumentRequest{DocumentId: "$d", Meta: &meta, Version: 1}}},
+		{Operation: &v1.BatchOperation_Delete{Delete: &v1.DeleteDocumentRequest{Id: "$d"}}},
+	}})
+	assert.NoError(t, err)
+	assert.Zero(t, res.Failed)
+	res, err = batchWrite(&v1.BatchWriteRequest{Mode: v1.BatchMode_BATCH_BEST_EFFORT, Operations: []*v1.BatchOperation{
+		{Operation: &v1.BatchOperation_Delete{Delete: &v1.DeleteDocumentRequest{Id: "not-a-uuid"}}},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, []codes.Code{codes.InvalidArgument}, codesOf(res.Results))
+
+	// a temp id names a create operation only once
+	_, err = client.BatchWrite(context.TODO(), &v1.BatchWriteRequest{Operations: []*v1.BatchOperation{
+		{TempId: "c", Operation: &v1.BatchOperation_Create{Create: &v1.CreateDocumentRequest{ProjectId: projectID}}},
+		{TempId: "c", Operation: &v1.BatchOperation_Create{Create: &v1.CreateDocumentRequest{ProjectId: projectID}}},
+	}})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+}
+
+func TestDocumentService_Children(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	client := NewDocumentService(compress.NewNop(), store.NewGormStore(tester.TestDB()), tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+
+	projectID := uuid.New().String()
+	create := func() string {
+		docID := uuid.New().String()
+		_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: projectID, DocumentId: &docID})
+		assert.NoError(t, err)
+		return docID + "@current"
+	}
+	parentID := strings.TrimSuffix(create(), "@current")
+	a, b, c, d := create(), create(), create(), create()
+
+	insert := func(child string, position *v1.ChildPosition) []string {
+		res, err := client.InsertChild(context.TODO(), &v1.InsertChildRequest{DocumentId: parentID, Child: child, Position: position})
+		assert.NoError(t, err)
+		return res.Children
+	}
+	insert(a, nil)
+	insert(b, nil)
+	insert(c, &v1.ChildPosition{Before: &b})
+	assert.Equal(t, []string{a, d, c, b}, insert(d, &v1.ChildPosition{After: &a}))
+
+	_, err := client.InsertChild(context.TODO(), &v1.InsertChildRequest{DocumentId: parentID, Child: a})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.AlreadyExists, st.Code())
+	_, err = client.InsertChild(context.TODO(), &v1.InsertChildRequest{DocumentId: parentID, Child: uuid.New().String() + "@current"})
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.FailedPrecondition, st.Code())
+
+	moved, err := client.MoveChild(context.TODO(), &v1.MoveChildRequest{DocumentId: parentID, Child: b, Position: &v1.ChildPosition{Before: &a}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{b, a, d, c}, moved.Children)
+	moved, err = client.MoveChild(context.TODO(), &v1.MoveChildRequest{DocumentId: parentID, Child: a})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{b, d, c, a}, moved.Children)
+
+	removed, err := client.RemoveChild(context.TODO(), &v1.RemoveChildRequest{DocumentId: parentID, Child: d})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{b, c, a}, removed.Children)
+	assert.Equal(t, int64(7), removed.Version)
+
+	// with a version the edit fails on a stale version
+	stale := removed.Version
+	_, err = client.RemoveChild(context.TODO(), &v1.RemoveChildRequest{DocumentId: parentID, Child: c, Version: &stale})
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.FailedPrecondition, st.Code())
+
+	// a child or a link target that is not a document id is an invalid argument
+	_, err = client.InsertChild(context.TODO(), &v1.InsertChildRequest{DocumentId: parentID, Child: "foo@current"})
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	_, err = client.UpdateDocument(context.TODO(), &v1.UpdateDocumentRequest{DocumentId: parentID, Links: map[string]string{"foo@current": ""}, Version: removed.Version + 1})
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+
+	// a client key is kept and the keys order the children
+	key := "0V"
+	inserted, err := client.InsertChild(context.TODO(), &v1.InsertChildRequest{DocumentId: parentID, Child: d, Position: &v1.ChildPosition{Key: &key}})
+	assert.NoError(t, err)
+	assert.Equal(t, key, inserted.Key)
+	doc, err := client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: parentID})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{d, b, c, a}, doc.Document.Children)
+	assert.True(t, sort.StringsAreSorted(doc.Document.ChildKeys))
+	assert.Len(t, doc.Document.ChildKeys, 4)
+
+	// the keys are regenerated when the children are rewritten
+	_, err = client.UpdateDocument(context.TODO(), &v1.UpdateDocumentRequest{DocumentId: parentID, Children: []string{c, a}, Version: doc.Document.Version + 1})
+	assert.NoError(t, err)
+	doc, err = client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: parentID})
+	assert.NoError(t, err)
+	assert.Len(t, doc.Document.ChildKeys, 2)
+	assert.True(t, sort.StringsAreSorted(doc.Document.ChildKeys))
+
+	// a key can always be placed between two keys
+	keys := []string{keyBetween("", "")}
+	for i := 0; i < 200; i++ {
+		index := i % len(keys)
+		next := keyBetween(keyAt(keys, index-1), keys[index])
+		assert.True(t, validKey(next))
+		keys = append(keys[:index:index], append([]string{next}, keys[index:]...)...)
+		assert.True(t, sort.StringsAreSorted(keys))
+	}
+}
+
+func TestDocumentService_ListParents(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	client := NewDocumentService(compress.NewNop(), store.NewGormStore(tester.TestDB()), tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+
+	projectID := uuid.New().String()
+	create := func(title string, children ...string) string {
+		docID := uuid.New().String()
+		_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{
+			ProjectId:  projectID,
+			DocumentId: &docID,
+			Meta:       `{"title": "` + title + `"}`,
+			Children:   children,
+		})
+		assert.NoError(t, err)
+		return docID
+	}
+	childID := create("Child")
+	folderID := create("Folder", childID+"@current")
+	rootID := create("Root", folderID+"@current")
+	otherID := create("Other")
+
+	// the second parent is added by an update
+	_, err := client.UpdateDocument(context.TODO(), &v1.UpdateDocumentRequest{
+		DocumentId: otherID,
+		Children:   []string{childID + "@current"},
+		Version:    1,
+	})
+	assert.NoError(t, err)
+
+	parents, err := client.ListParents(context.TODO(), &v1.ListParentsRequest{DocumentId: childID})
+	assert.NoError(t, err)
+	titles := map[string]string{}
+	for _, parent := range parents.Parents {
+		titles[parent.Id] = parent.Title
+		assert.Equal(t, "current", parent.ChildVersion)
+	}
+	assert.Equal(t, map[string]string{folderID: "Folder", otherID: "Other"}, titles)
+
+	doc, err := client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: childID})
+	assert.NoError(t, err)
+	var paths []string
+	for _, breadcrumb := range doc.Breadcrumbs {
+		var path []string
+		for _, item := range breadcrumb.Items {
+			path = append(path, item.Title)
+		}
+		paths = append(paths, strings.Join(path, "/"))
+	}
+	sort.Strings(paths)
+	assert.Equal(t, []string{"Other", "Root/Folder"}, paths)
+
+	// a removed child and a deleted parent are not listed
+	_, err = client.RemoveChild(context.TODO(), &v1.RemoveChildRequest{DocumentId: otherID, Child: childID + "@current"})
+	assert.NoError(t, err)
+	_, err = client.DeleteDocument(context.TODO(), &v1.DeleteDocumentRequest{Id: rootID})
+	assert.NoError(t, err)
+	parents, err = client.ListParents(context.TODO(), &v1.ListParentsRequest{DocumentId: childID})
+	assert.NoError(t, err)
+	assert.Len(t, parents.Parents, 1)
+	assert.Equal(t, folderID, parents.Parents[0].Id)
+	parents, err = client.ListParents(context.TODO(), &v1.ListParentsRequest{DocumentId: folderID})
+	assert.NoError(t, err)
+	assert.Len(t, parents.Parents, 0)
+
+	published, err := client.PublishDocuments(context.TODO(), &v1.PublishDocumentsRequest{DocumentIds: []string{childID, folderID}})
+	assert.NoError(t, err)
+	versions := map[string]string{}
+	for _, doc := range published.Documents {
+		versions[doc.Id] = doc.Version
+	}
+
+	parents, err = client.ListParents(context.TODO(), &v1.ListParentsRequest{DocumentId: childID, Published: true})
+	assert.NoError(t, err)
+	assert.Len(t, parents.Parents, 1)
+	assert.Equal(t, folderID, parents.Parents[0].Id)
+	assert.Equal(t, versions[folderID], parents.Parents[0].Version)
+
+	// the parent follows the current version, so it is only listed for the latest published version
+	latest := versions[childID]
+	parents, err = client.ListParents(context.TODO(), &v1.ListParentsRequest{DocumentId: childID, Published: true, Version: &latest})
+	assert.NoError(t, err)
+	assert.Len(t, parents.Parents, 1)
+	older := "0.0.0-old"
+	parents, err = client.ListParents(context.TODO(), &v1.ListParentsRequest{DocumentId: childID, Published: true, Version: &older})
+	assert.NoError(t, err)
+	assert.Len(t, parents.Parents, 0)
+}
+
+func TestDocumentService_Parts(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	docStore := store.NewGormStore(tester.TestDB())
+	client := NewDocumentService(compress.NewNop(), docStore, tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+
+	docID := uuid.New().String()
+	_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: uuid.New().String(), DocumentId: &docID, Content: "head;"})
+	assert.NoError(t, err)
+
+	updated, err := client.UpdateDocumentPart(context.TODO(), &v1.UpdateDocumentPartRequest{DocumentId: docID, PartId: "p1", Content: "one;", Version: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), updated.Version)
+	first := ""
+	updated, err = client.UpdateDocumentPart(context.TODO(), &v1.UpdateDocumentPartRequest{DocumentId: docID, PartId: "p2", Content: "two;", Version: 1, After: &first})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"p2", "p1"}, updated.Parts)
+
+	updated, err = client.UpdateDocumentPart(context.TODO(), &v1.UpdateDocumentPartRequest{DocumentId: docID, PartId: "p1", Content: "ONE;", Version: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), updated.Version)
+	_, err = client.UpdateDocumentPart(context.TODO(), &v1.UpdateDocumentPartRequest{DocumentId: docID, PartId: "p1", Content: "stale;", Version: 2})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.FailedPrecondition, st.Code())
+
+	part, err := client.GetDocumentPart(context.TODO(), &v1.GetDocumentPartRequest{DocumentId: docID, PartId: "p1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ONE;", part.Part.Content)
+	_, err = client.GetDocumentPart(context.TODO(), &v1.GetDocumentPartRequest{DocumentId: docID, PartId: "p3"})
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.NotFound, st.Code())
+
+	// the part edits do not change the document version
+	doc, err := client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: docID})
+	assert.NoError(t, err)
+	assert.Equal(t, "head;two;ONE;", doc.Document.Content)
+	assert.Equal(t, int64(0), doc.Document.Version)
+	assert.Len(t, doc.Document.Parts, 2)
+
+	_, err = client.PublishDocuments(context.TODO(), &v1.PublishDocumentsRequest{DocumentIds: []string{docID}})
+	assert.NoError(t, err)
+	published, err := docStore.GetLatestPublishedDocument(context.TODO(), uuid.MustParse(docID))
+	assert.NoError(t, err)
+	assert.Equal(t, "head;two;ONE;", published.Content)
+
+	// a meta update keeps the parts, a content update replaces them
+	meta := `{"title": "large"}`
+	_, err = client.UpdateDocument(context.TODO(), &v1.UpdateDocumentRequest{DocumentId: docID, Meta: &meta, Version: 1})
+	assert.NoError(t, err)
+	doc, err = client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: docID})
+	assert.NoError(t, err)
+	assert.Equal(t, "head;two;ONE;", doc.Document.Content)
+
+	_, err = client.UpdateDocumentPart(context.TODO(), &v1.UpdateDocumentPartRequest{DocumentId: docID, PartId: "p2", Version: 2, Remove: true})
+	assert.NoError(t, err)
+	doc, err = client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: docID})
+	assert.NoError(t, err)
+	assert.Equal(t, "head;ONE;", doc.Document.Content)
+
+	content := "whole"
+	_, err = client.UpdateDocument(context.TODO(), &v1.UpdateDocumentRequest{DocumentId: docID, Content: &content, Version: 2})
+	assert.NoError(t, err)
+	doc, err = client.GetDocument(context.TODO(), &v1.GetDocumentRequest{DocumentId: docID})
+	assert.NoError(t, err)
+	assert.Equal(t, "whole", doc.Document.Content)
+	assert.Len(t, doc.Document.Parts, 0)
+
+	// the backup of the document with parts keeps the whole content
+	backup, err := docStore.GetDocumentBackup(context.TODO(), uuid.MustParse(docID), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "head;ONE;", backup.Content)
+}
+
+// contentStream is an in memory upload and download stream of the document content
+type contentStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	chunks   [][]byte
+	sent     []byte
+	uploaded *v1.UploadDocumentContentResponse
+}
+
+func (s *contentStream) Context() context.Context { return s.ctx }
+
+func (s *contentStream) SendHeader(metadata.MD) error { return nil }
+
+func (s *contentStream) Recv() (*httpbody.HttpBody, error) {
+	if len(s.chunks) == 0 {
+		return nil, io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return &httpbody.HttpBody{Data: chunk}, nil
+}
+
+func (s *contentStream) Send(body *httpbody.HttpBody) error {
+	s.sent = append(s.sent, body.Data...)
+	return nil
+}
+
+func (s *contentStream) SendAndClose(res *v1.UploadDocumentContentResponse) error {
+	s.uploaded = res
+	return nil
+}
+
+func TestDocumentService_StreamContent(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	client := NewDocumentService(compress.NewNop(), store.NewGormStore(tester.TestDB()), tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+
+	docID := uuid.New().String()
+	_, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: uuid.New().String(), DocumentId: &docID, Content: "small"})
+	assert.NoError(t, err)
+
+	large := strings.Repeat("0123456789", 300000)
+	upload := &contentStream{
+		ctx:    metadata.NewIncomingContext(context.TODO(), metadata.Pairs("document-id", docID, "document-version", "1")),
+		chunks: [][]byte{[]byte(large[:1000000]), []byte(large[1000000:2000000]), []byte(large[2000000:])},
+	}
+	err = client.UploadDocumentContent(upload)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), upload.uploaded.Version)
+	assert.Equal(t, int64(len(large)), upload.uploaded.Size)
+
+	// the version is checked like an update
+	stale := &contentStream{ctx: metadata.NewIncomingContext(context.TODO(), metadata.Pairs("document-id", docID, "document-version", "1"))}
+	err = client.UploadDocumentContent(stale)
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.FailedPrecondition, st.Code())
+	missing := &contentStream{ctx: metadata.NewIncomingContext(context.TODO(), metadata.Pairs("document-id", docID))}
+	err = client.UploadDocumentContent(missing)
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+
+	// the content is updated as a whole, so its size is limited
+	chunk := make([]byte, 1<<20)
+	tooLarge := &contentStream{ctx: metadata.NewIncomingContext(context.TODO(), metadata.Pairs("document-id", docID, "document-version", "2"))}
+	for i := 0; i <= maxUploadContentSize>>20; i++ {
+		tooLarge.chunks = append(tooLarge.chunks, chunk)
+	}
+	err = client.UploadDocumentContent(tooLarge)
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+
+	download := &contentStream{ctx: context.TODO()}
+	err = client.DownloadDocumentContent(&v1.DownloadDocumentContentRequest{DocumentId: docID}, download)
+	assert.NoError(t, err)
+	assert.Equal(t, large, string(download.sent))
+
+	// a range of the content is streamed on its own
+	ranged := &contentStream{ctx: metadata.NewIncomingContext(context.TODO(), metadata.Pairs("grpcgateway-range", "bytes=10-19"))}
+	err = client.DownloadDocumentContent(&v1.DownloadDocumentContentRequest{DocumentId: docID}, ranged)
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789", string(ranged.sent))
+}
+
+// attachmentStream is an in memory upload and download stream of an attachment
+type attachmentStream struct {
+	*contentStream
+	uploaded *v1.UploadAttachmentResponse
+}
+
+func (s *attachmentStream) SendAndClose(res *v1.UploadAttachmentResponse) error {
+	s.uploaded = res
+	return nil
+}
+
+func TestDocumentService_Attachments(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	objects := objectstore.NewMemoryObjectStore()
+	client := NewDocumentService(compress.NewNop(), store.NewGormStore(tester.TestDB()), tester.Redis(), search.NewNop(), objects)
+	ctx := context.TODO()
+
+	docID := uuid.New().String()
+	_, err := client.CreateDocument(ctx, &v1.CreateDocumentRequest{ProjectId: uuid.New().String(), DocumentId: &docID, Content: "report"})
+	assert.NoError(t, err)
+
+	upload := func(name string, chunks ...string) (*v1.UploadAttachmentResponse, error) {
+		stream := &attachmentStream{contentStream: &contentStream{
+			ctx: metadata.NewIncomingContext(ctx, metadata.Pairs("document-id", docID, "attachment-name", name)),
+		}}
+		for _, chunk := range chunks {
+			stream.chunks = append(stream.chunks, []byte(chunk))
+		}
+		err := client.UploadAttachment(stream)
+		return stream.uploaded, err
+	}
+
+	// every attachment is a new version of the document
+	notes, err := upload("notes.txt", "hello ", "world")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), notes.Version)
+	assert.Equal(t, int64(11), notes.Attachment.Size)
+	assert.Equal(t, "text/plain; charset=utf-8", notes.Attachment.ContentType)
+	assert.Equal(t, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", notes.Attachment.Checksum)
+	image, err := upload("image", "\x89PNG\r\n\x1a\n")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), image.Version)
+	assert.Equal(t, "image/png", image.Attachment.ContentType)
+
+	_, err = upload("")
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+
+	listed, err := client.ListAttachments(ctx, &v1.ListAttachmentsRequest{DocumentId: docID})
+	assert.NoError(t, err)
+	assert.Len(t, listed.Attachments, 2)
+	version := int64(1)
+	listed, err = client.ListAttachments(ctx, &v1.ListAttachmentsRequest{DocumentId: docID, Version: &version})
+	assert.NoError(t, err)
+	assert.Len(t, listed.Attachments, 1)
+
+	download := &contentStream{ctx: ctx}
+	err = client.GetAttachment(&v1.GetAttachmentRequest{DocumentId: docID, AttachmentId: notes.Attachment.Id}, download)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(download.sent))
+
+	// the attachments are frozen into the published version
+	published, err := client.PublishDocuments(ctx, &v1.PublishDocumentsRequest{DocumentIds: []string{docID}})
+	assert.NoError(t, err)
+	publishedVersion := published.Documents[0].Version
+	_, err = client.PublishDocuments(ctx, &v1.PublishDocumentsRequest{DocumentIds: []string{docID}})
+	assert.Error(t, err)
+
+	// the deleted attachment is kept by the earlier versions
+	deleted, err := client.DeleteAttachment(ctx, &v1.DeleteAttachmentRequest{DocumentId: docID, AttachmentId: notes.Attachment.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), deleted.Version)
+	_, err = client.DeleteAttachment(ctx, &v1.DeleteAttachmentRequest{DocumentId: docID, AttachmentId: notes.Attachment.Id})
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.NotFound, st.Code())
+
+	listed, err = client.ListAttachments(ctx, &v1.ListAttachmentsRequest{DocumentId: docID})
+	assert.NoError(t, err)
+	assert.Len(t, listed.Attachments, 1)
+	assert.Equal(t, image.Attachment.Id, listed.Attachments[0].Id)
+	err = client.GetAttachment(&v1.GetAttachmentRequest{DocumentId: docID, AttachmentId: notes.Attachment.Id}, &contentStream{ctx: ctx})
+	st, _ = status.FromError(err)
+	assert.Equal(t, codes.NotFound, st.Code())
+
+	download = &contentStream{ctx: ctx}
+	err = client.GetAttachment(&v1.GetAttachmentRequest{DocumentId: docID, AttachmentId: notes.Attachment.Id, PublishedVersion: &publishedVersion}, download)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(download.sent))
+	listed, err = client.ListAttachments(ctx, &v1.ListAttachmentsRequest{DocumentId: docID, PublishedVersion: &publishedVersion})
+	assert.NoError(t, err)
+	assert.Len(t, listed.Attachments, 2)
+
+	// removing an attachment is a change to publish
+	_, err = client.PublishDocuments(ctx, &v1.PublishDocumentsRequest{DocumentIds: []string{docID}})
+	assert.NoError(t, err)
+
+	// erasing the document erases the attachments that were never published
+	draft, err := upload("draft.txt", "draft")
+	assert.NoError(t, err)
+	erased, err := client.EraseDocument(ctx, &v1.EraseDocumentRequest{Id: docID})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), erased.Report.ErasedAttachments)
+	_, err = objects.Get(ctx, "documents/"+docID+"/attachments/"+draft.Attachment.Id)
+	assert.ErrorIs(t, err, objectstore.ErrObjectNotFound)
+	_, err = objects.Get(ctx, "documents/"+docID+"/attachments/"+notes.Attachment.Id)
+	assert.NoError(t, err)
+}
+
+func TestDocumentService_Schemas(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	client := NewDocumentService(compress.NewNop(), store.NewGormStore(tester.TestDB()), tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+	ctx := context.TODO()
+	projectID := uuid.New().String()
+
+	// the field violations are the details of the InvalidArgument status
+	violations := func(err error) []string {
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.InvalidArgument, st.Code())
+		var fields []string
+		for _, detail := range st.Details() {
+			if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+				for _, violation := range badRequest.FieldViolations {
+					fields = append(fields, violation.Field)
+				}
+			}
+		}
+		return fields
+	}
+
+	_, err := client.PutDocumentSchema(ctx, &v1.PutDocumentSchemaRequest{ProjectId: projectID, Type: "article", MetaSchema: `{"type": 5}`})
+	assert.Equal(t, []string{"meta_schema"}, violations(err))
+
+	_, err = client.PutDocumentSchema(ctx, &v1.PutDocumentSchemaRequest{
+		ProjectId:     projectID,
+		Type:          "article",
+		MetaSchema:    `{"type": "object", "required": ["title"], "properties": {"title": {"type": "string"}}}`,
+		ContentSchema: `{"type": "object", "required": ["blocks"], "properties": {"blocks": {"type": "array"}}}`,
+	})
+	assert.NoError(t, err)
+
+	_, err = client.CreateDocument(ctx, &v1.CreateDocumentRequest{ProjectId: projectID, Meta: `{"type": "article"}`, Content: `{"blocks": []}`})
+	assert.Equal(t, []string{"meta.title"}, violations(err))
+	_, err = client.CreateDocument(ctx, &v1.CreateDocumentRequest{ProjectId: projectID, Meta: `{"type": "article", "title": 1}`, Content: `{}`})
+	assert.Equal(t, []string{"meta.title", "content.blocks"}, violations(err))
+
+	// json content must be json even without a schema
+	_, err = client.CreateDocument(ctx, &v1.CreateDocumentRequest{ProjectId: projectID, Content: "not json", Kind: v1.DocumentKind_DOC_JSON})
+	assert.Equal(t, []string{"content"}, violations(err))
+
+	created, err := client.CreateDocument(ctx, &v1.CreateDocumentRequest{
+		ProjectId: projectID,
+		Meta:      `{"type": "article", "title": "Tomatoes"}`,
+		Content:   `{"blocks": []}`,
+		Kind:      v1.DocumentKind_DOC_JSON,
+	})
+	assert.NoError(t, err)
+	docID := created.Document.Id
+	got, err := client.GetDocument(ctx, &v1.GetDocumentRequest{DocumentId: docID})
+	assert.NoError(t, err)
+	assert.Equal(t, v1.DocumentKind_DOC_JSON, got.Document.Kind)
+
+	content := `{"blocks": 5}`
+	_, err = client.UpdateDocument(ctx, &v1.UpdateDocumentRequest{DocumentId: docID, Content: &content, Version: 1})
+	assert.Equal(t, []string{"content.blocks"}, violations(err))
+
+	// a document of a type without a schema is not validated
+	meta := `{"type": "note"}`
+	_, err = client.UpdateDocument(ctx, &v1.UpdateDocumentRequest{DocumentId: docID, Meta: &meta, Content: &content, Version: 1})
+	assert.NoError(t, err)
+
+	// the schemas are checked again on publish
+	_, err = client.PutDocumentSchema(ctx, &v1.PutDocumentSchemaRequest{ProjectId: projectID, Type: "note", MetaSchema: `{"required": ["title"]}`})
+	assert.NoError(t, err)
+	_, err = client.PublishDocuments(ctx, &v1.PublishDocumentsRequest{DocumentIds: []string{docID}})
+	assert.Equal(t, []string{"meta.title"}, violations(err))
+
+	// a replaced schema is compiled again
+	_, err = client.PutDocumentSchema(ctx, &v1.PutDocumentSchemaRequest{ProjectId: projectID, Type: "note", MetaSchema: `{"required": ["summary"]}`})
+	assert.NoError(t, err)
+	_, err = client.PublishDocuments(ctx, &v1.PublishDocumentsRequest{DocumentIds: []string{docID}})
+	assert.Equal(t, []string{"meta.summary"}, violations(err))
+
+	// only the $refs inside the schema are allowed, the server does not load a url or a file
+	for _, ref := range []string{"http://localhost:1/schema.json", "file:///etc/passwd", "other.json#/definitions/title"} {
+		_, err = client.PutDocumentSchema(ctx, &v1.PutDocumentSchemaRequest{ProjectId: projectID, Type: "page", ContentSchema: `{"properties": {"title": {"$ref": "` + ref + `"}}}`})
+		assert.Equal(t, []string{"content_schema"}, violations(err))
+	}
+	_, err = client.PutDocumentSchema(ctx, &v1.PutDocumentSchemaRequest{ProjectId: projectID, Type: "page", ContentSchema: `{"definitions": {"title": {"type": "string"}}, "properties": {"title": {"$ref": "#/definitions/title"}}}`})
+	assert.NoError(t, err)
+
+	schemas, err := client.ListDocumentSchemas(ctx, &v1.ListDocumentSchemasRequest{ProjectId: projectID})
+	assert.NoError(t, err)
+	assert.Len(t, schemas.Schemas, 3)
+	_, err = client.DeleteDocumentSchema(ctx, &v1.DeleteDocumentSchemaRequest{ProjectId: projectID, Type: "note"})
+	assert.NoError(t, err)
+	_, err = client.GetDocumentSchema(ctx, &v1.GetDocumentSchemaRequest{ProjectId: projectID, Type: "note"})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.NotFound, st.Code())
+
+	_, err = client.PublishDocuments(ctx, &v1.PublishDocumentsRequest{DocumentIds: []string{docID}})
+	assert.NoError(t, err)
+}
+
+func TestDocumentService_ReadMask(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	// gzip makes a field that is returned without being decompressed show up
+	docStore := store.NewGormStore(tester.TestDB())
+	client := NewDocumentService(compress.NewGZip(), docStore, tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+	published := NewPublishedDocumentService(compress.NewGZip(), docStore, tester.Redis())
+	ctx := context.TODO()
+	projectID := uuid.New().String()
+
+	child, err := client.CreateDocument(ctx, &v1.CreateDocumentRequest{ProjectId: projectID, Meta: `{"title": "child"}`, Content: "child content"})
+	assert.NoError(t, err)
+	parent, err := client.CreateDocument(ctx, &v1.CreateDocumentRequest{
+		ProjectId: projectID,
+		Meta:      `{"title": "parent"}`,
+		Content:   "parent content",
+		Children:  []string{child.Document.Id},
+	})
+	assert.NoError(t, err)
+	parentID := parent.Document.Id
+
+	got, err := client.GetDocument(ctx, &v1.GetDocumentRequest{
+		DocumentId: parentID,
+		ReadMask:   &fieldmaskpb.FieldMask{Paths: []string{"meta", "children"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, parentID, got.Document.Id)
+	assert.Equal(t, `{"title": "parent"}`, got.Document.Meta)
+	assert.Equal(t, []string{child.Document.Id}, got.Document.Children)
+	assert.Empty(t, got.Document.Content)
+	assert.Nil(t, got.Document.CreatedAt)
+
+	// without a mask all the fields are returned
+	got, err = client.GetDocument(ctx, &v1.GetDocumentRequest{DocumentId: parentID})
+	assert.NoError(t, err)
+	assert.Equal(t, "parent content", got.Document.Content)
+	assert.NotNil(t, got.Document.CreatedAt)
+
+	_, err = client.GetDocument(ctx, &v1.GetDocumentRequest{
+		DocumentId: parentID,
+		ReadMask:   &fieldmaskpb.FieldMask{Paths: []string{"title"}},
+	})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+
+	// the listed meta is decompressed
+	list, err := client.ListDocuments(ctx, &v1.ListDocumentsRequest{ProjectId: projectID})
+	assert.NoError(t, err)
+	assert.Len(t, list.Documents, 2)
+	for _, doc := range list.Documents {
+		assert.Contains(t, doc.Meta, "title")
+	}
+	list, err = client.ListDocuments(ctx, &v1.ListDocumentsRequest{
+		ProjectId: projectID,
+		Order:     v1.DocumentOrder_ORDER_BACKLINK_COUNT,
+		ReadMask:  &fieldmaskpb.FieldMask{Paths: []string{"meta"}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, list.Documents, 2)
+	for _, doc := range list.Documents {
+		assert.Contains(t, doc.Meta, "title")
+		assert.Empty(t, doc.Children)
+		assert.Zero(t, doc.Version)
+	}
+	list, err = client.ListDocuments(ctx, &v1.ListDocumentsRequest{ProjectId: projectID, DocumentIds: []string{parentID}})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"title": "parent"}`, list.Documents[0].Meta)
+
+	_, err = client.PublishDocuments(ctx, &v1.PublishDocumentsRequest{DocumentIds: []string{child.Document.Id, parentID}})
+	assert.NoError(t, err)
+
+	pub, err := published.GetPublishedDocument(ctx, &v1.GetPublishedDocumentRequest{Id: parentID})
+	assert.NoError(t, err)
+	assert.Equal(t, "parent content", pub.Document.Content)
+	assert.NotNil(t, pub.Document.LatestVersion)
+	version := pub.Document.Version
+
+	pub, err = published.GetPublishedDocument(ctx, &v1.GetPublishedDocumentRequest{
+		Id:       parentID,
+		Version:  version,
+		ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"meta"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"title": "parent"}`, pub.Document.Meta)
+	assert.Empty(t, pub.Document.Content)
+	assert.Nil(t, pub.Document.LatestVersion)
+
+	pubList, err := published.ListPublishedDocuments(ctx, &v1.ListPublishedDocumentsRequest{
+		ProjectId:  projectID,
+		IdVersions: []*v1.DocumentVersionId{{Id: parentID, Version: version}},
+		ReadMask:   &fieldmaskpb.FieldMask{Paths: []string{"content", "children"}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, pubList.Documents, 1)
+	assert.Equal(t, "parent content", pubList.Documents[0].Content)
+	assert.Equal(t, []string{child.Document.Id}, pubList.Documents[0].Children)
+	assert.Empty(t, pubList.Documents[0].Meta)
+
+	pubList, err = published.ListPublishedDocuments(ctx, &v1.ListPublishedDocumentsRequest{
+		ProjectId: projectID,
+		ReadMask:  &fieldmaskpb.FieldMask{Paths: []string{"meta", "content"}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, pubList.Documents, 2)
+	for _, doc := range pubList.Documents {
+		assert.Contains(t, doc.Meta, "title")
+		assert.Contains(t, doc.Content, "content")
+	}
+}
+
+func TestDocumentService_PatchUpdates(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	docStore := store.NewGormStore(tester.TestDB())
+	client := NewDocumentService(compress.NewGZip(), docStore, tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+	backups := NewDocumentBackupService(compress.NewGZip(), docStore, client)
+	ctx := context.TODO()
+
+	created, err := client.CreateDocument(ctx, &v1.CreateDocumentRequest{
+		ProjectId: uuid.New().String(),
+		Meta:      `{"title": "Tomatoes", "tags": ["red"], "seo": {"title": "tomatoes", "index": true}}`,
+		Content:   `{"blocks": [1, 2], "theme": "dark"}`,
+	})
+	assert.NoError(t, err)
+	docID := created.Document.Id
+	get := func() *v1.Document {
+		res, err := client.GetDocument(ctx, &v1.GetDocumentRequest{DocumentId: docID})
+		assert.NoError(t, err)
+		return res.Document
+	}
+
+	// the merge patch keeps the keys it does not name and removes the null ones
+	meta := `{"tags": null, "seo": {"index": false}}`
+	content := `{"theme": null, "width": 80}`
+	_, err = client.UpdateDocument(ctx, &v1.UpdateDocumentRequest{DocumentId: docID, Meta: &meta, Content: &content, Version: 1, Kind: v1.UpdateKind_MERGEPATCH})
+	assert.NoError(t, err)
+	doc := get()
+	assert.JSONEq(t, `{"title": "Tomatoes", "seo": {"title": "tomatoes", "index": false}}`, doc.Meta)
+	assert.JSONEq(t, `{"blocks": [1, 2], "width": 80}`, doc.Content)
+	assert.Equal(t, int64(1), doc.Version)
+
+	invalid := `{"width": `
+	_, err = client.UpdateDocument(ctx, &v1.UpdateDocumentRequest{DocumentId: docID, Content: &invalid, Version: 2, Kind: v1.UpdateKind_MERGEPATCH})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+
+	// a masked update sets the meta keys without the version clock, the other keys are kept
+	meta = `{"title": "Cherry tomatoes", "seo": {"title": "cherry"}}`
+	_, err = client.UpdateDocument(ctx, &v1.UpdateDocumentRequest{
+		DocumentId: docID,
+		Meta:       &meta,
+		Content:    &content,
+		Version:    -1,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"meta.title", "meta.seo.title", "meta.summary"}},
+	})
+	assert.NoError(t, err)
+	doc = get()
+	assert.JSONEq(t, `{"title": "Cherry tomatoes", "seo": {"title": "cherry", "index": false}}`, doc.Meta)
+	assert.JSONEq(t, `{"blocks": [1, 2], "width": 80}`, doc.Content)
+	assert.Equal(t, int64(2), doc.Version)
+
+	// a masked meta key missing from the request meta is removed
+	meta = `{}`
+	_, err = client.UpdateDocument(ctx, &v1.UpdateDocumentRequest{
+		DocumentId: docID,
+		Meta:       &meta,
+		Version:    3,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"meta.seo"}},
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"title": "Cherry tomatoes"}`, get().Meta)
+
+	for _, paths := range [][]string{{"meta", "meta.title"}, {"title"}, {"meta..title"}} {
+		_, err = client.UpdateDocument(ctx, &v1.UpdateDocumentRequest{
+			DocumentId: docID,
+			Meta:       &meta,
+			Version:    -1,
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: paths},
+		})
+		st, _ = status.FromError(err)
+		assert.Equal(t, codes.InvalidArgument, st.Code(), paths)
+	}
+
+	// the backup keeps the previous meta
+	backup, err := backups.GetDocumentBackup(ctx, &v1.GetDocumentBackupRequest{DocumentId: docID, Version: 1})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"title": "Tomatoes", "seo": {"title": "tomatoes", "index": false}}`, backup.Document.Meta)
+
+	// the backup keeps the children, so the restore brings them back
+	first, second := uuid.New().String()+"@current", uuid.New().String()+"@current"
+	parent, err := client.CreateDocument(ctx, &v1.CreateDocumentRequest{ProjectId: uuid.New().String(), Children: []string{first}})
+	assert.NoError(t, err)
+	_, err = client.UpdateDocument(ctx, &v1.UpdateDocumentRequest{DocumentId: parent.Document.Id, Children: []string{second}, Version: 1})
+	assert.NoError(t, err)
+	_, err = backups.RestoreDocumentBackup(ctx, &v1.RestoreDocumentBackupRequest{DocumentId: parent.Document.Id, Version: 0})
+	assert.NoError(t, err)
+	restored, err := client.GetDocument(ctx, &v1.GetDocumentRequest{DocumentId: parent.Document.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{first}, restored.Document.Children)
+}
+
+// headerStream records the headers set by a unary rpc
+type headerStream struct {
+	header metadata.MD
+}
+
+func (s *headerStream) Method() string { return "" }
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *headerStream) SendHeader(md metadata.MD) error { return s.SetHeader(md) }
+
+func (s *headerStream) SetTrailer(metadata.MD) error { return nil }
+
+func TestDocumentService_ETags(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	docStore := store.NewGormStore(tester.TestDB())
+	client := NewDocumentService(compress.NewNop(), docStore, tester.Redis(), search.NewNop(), objectstore.NewMemoryObjectStore())
+	published := NewPublishedDocumentService(compress.NewNop(), docStore, tester.Redis())
+
+	// call runs an rpc with the forwarded http headers and returns the headers of its response
+	call := func(headers ...string) (context.Context, *headerStream) {
+		stream := &headerStream{}
+		ctx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs(headers...))
+		return grpc.NewContextWithServerTransportStream(ctx, stream), stream
+	}
+
+	created, err := client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{ProjectId: uuid.New().String(), Meta: `{"title": "Tomatoes"}`, Content: "red"})
+	assert.NoError(t, err)
+	docID := created.Document.Id
+
+	ctx, stream := call()
+	got, err := client.GetDocument(ctx, &v1.GetDocumentRequest{DocumentId: docID})
+	assert.NoError(t, err)
+	assert.Equal(t, "red", got.Document.Content)
+	etag := stream.header.Get("etag")[0]
+	assert.Equal(t, []string{"private, no-cache"}, stream.header.Get("cache-control"))
+	assert.Empty(t, stream.header.Get("code"))
+
+	ctx, stream = call("grpcgateway-if-none-match", `"other", W/`+etag)
+	got, err = client.GetDocument(ctx, &v1.GetDocumentRequest{DocumentId: docID})
+	assert.NoError(t, err)
+	assert.Nil(t, got.Document)
+	assert.Equal(t, []string{"304"}, stream.header.Get("code"))
+
+	// only the rest gateway sends a 304, a grpc request gets the whole document
+	ctx, stream = call("if-none-match", etag)
+	got, err = client.GetDocument(ctx, &v1.GetDocumentRequest{DocumentId: docID})
+	assert.NoError(t, err)
+	assert.Equal(t, "red", got.Document.Content)
+	assert.Empty(t, stream.header.Get("code"))
+
+	// the etag stands for the version of the update
+	content := "green"
+	ctx, _ = call("grpcgateway-if-match", etag)
+	updated, err := client.UpdateDocument(ctx, &v1.UpdateDocumentRequest{DocumentId: docID, Content: &content})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), updated.Version)
+	_, err = client.UpdateDocument(ctx, &v1.UpdateDocumentRequest{DocumentId: docID, Content: &content})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.FailedPrecondition, st.Code())
+
+	ctx, stream = call("grpcgateway-if-none-match", etag)
+	got, err = client.GetDocument(ctx, &v1.GetDocumentRequest{DocumentId: docID})
+	assert.NoError(t, err)
+	assert.Equal(t, "green", got.Document.Content)
+	assert.NotEqual(t, etag, stream.header.Get("etag")[0])
+	assert.Empty(t, stream.header.Get("code"))
+
+	_, err = client.PublishDocuments(context.TODO(), &v1.PublishDocumentsRequest{DocumentIds: []string{docID}})
+	assert.NoError(t, err)
+
+	ctx, stream = call()
+	pub, err := published.GetPublishedDocument(ctx, &v1.GetPublishedDocumentRequest{Id: docID})
+	assert.NoError(t, err)
+	version := pub.Document.Version
+	assert.Equal(t, []string{`"` + version + `"`}, stream.header.Get("etag"))
+	assert.Equal(t, []string{"public, no-cache"}, stream.header.Get("cache-control"))
+
+	// a published version is immutable
+	ctx, stream = call()
+	_, err = published.GetPublishedDocument(ctx, &v1.GetPublishedDocumentRequest{Id: docID, Version: version})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"public, max-age=31536000, immutable"}, stream.header.Get("cache-control"))
+
+	for _, request := range []*v1.GetPublishedDocumentRequest{{Id: docID}, {Id: docID, Version: version}} {
+		ctx, stream = call("grpcgateway-if-none-match", `"`+version+`"`)
+		pub, err = published.GetPublishedDocument(ctx, request)
+		assert.NoError(t, err)
+		assert.Nil(t, pub.Document)
+		assert.Equal(t, []string{"304"}, stream.header.Get("code"))
+	}
+}
@@ -13,4 +13,8 @@ var (
 	ErrDocumentChildrenCorrupted = errors.New("document children are corrupted")
 	// ErrDocumentLinksCorrupted is returned when a document is not found.
 	ErrDocumentLinksCorrupted = errors.New("document links are corrupted")
+	// ErrInvalidLinkTarget is returned when the target of a link is not a document id.
+	ErrInvalidLinkTarget = errors.New("invalid link target, expected a document id")
+	// ErrInvalidLinkAnnotation is returned when the value of a link is not a link type or a json annotation.
+	ErrInvalidLinkAnnotation = errors.New("invalid link annotation, expected a link type or a json object with type, anchor and label")
 )
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/emrgen/document/internal/model"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"strings"
+)
+
+// the conditional request headers, the rest gateway forwards them with the grpcgateway- prefix
+const (
+	ifMatchHeader     = "if-match"
+	ifNoneMatchHeader = "if-none-match"
+)
+
+// the response headers written as http headers by the rest gateway, the code replaces the status code of the response
+const (
+	ETagHeader         = "etag"
+	CacheControlHeader = "cache-control"
+	StatusCodeHeader   = "code"
+)
+
+// the cache control of the drafts and of the published versions, a published version never changes
+const (
+	draftCacheControl           = "private, no-cache"
+	latestPublishedCacheControl = "public, no-cache"
+	publishedCacheControl       = "public, max-age=31536000, immutable"
+)
+
+// documentETag is the etag of a draft, the updated time follows the parts that change without a new version
+func documentETag(doc *model.Document) string {
+	return fmt.Sprintf(`"%d-%d"`, doc.Version, doc.UpdatedAt.UnixMicro())
+}
+
+// publishedDocumentETag is the etag of a published version
+func publishedDocumentETag(version string) string {
+	return fmt.Sprintf(`"%s"`, version)
+}
+
+// conditionalHeader returns the conditional header of a grpc request or of a rest request forwarded by the gateway
+func conditionalHeader(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if value := firstMetadata(md, key); value != "" {
+		return value
+	}
+
+	return firstMetadata(md, runtime.MetadataPrefix+key)
+}
+
+// notModifiedHeader returns the If-None-Match of a rest request, only the rest gateway turns the empty response into a 304
+// so a grpc request sending the header gets the whole response
+func notModifiedHeader(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return firstMetadata(md, runtime.MetadataPrefix+ifNoneMatchHeader)
+}
+
+// etagMatches reports whether the etag is listed in the header, the weak comparison ignores the W/ prefix of the listed etags
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setCacheHeaders sets the etag and the cache control of the response, the calls made without a grpc stream have no headers
+func setCacheHeaders(ctx context.Context, etag, cacheControl string) {
+	_ = grpc.SetHeader(ctx, metadata.Pairs(ETagHeader, etag, CacheControlHeader, cacheControl))
+}
+
+// setNotModified turns the response into a 304 of the rest gateway, the response is sent without a body
+func setNotModified(ctx context.Context, etag, cacheControl string) {
+	_ = grpc.SetHeader(ctx, metadata.Pairs(ETagHeader, etag, CacheControlHeader, cacheControl, StatusCodeHeader, "304"))
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/compress"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/store"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultTraverseDepth = 2
+	defaultTraverseLimit = 100
+	// the maximums match the validate rules of the request, a larger request is clamped
+	maxTraverseDepth = 10
+	maxTraverseLimit = 1000
+)
+
+// TraverseLinks walks the link graph breadth first from a document and returns the visited subgraph.
+// The draft graph follows the links table and the draft children,
+// the published graph follows the published_links table and the published children of the given version.
+func (d DocumentService) TraverseLinks(ctx context.Context, request *v1.TraverseLinksRequest) (*v1.TraverseLinksResponse, error) {
+	docID, err := uuid.Parse(request.GetDocumentId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var graph linkGraph = &draftGraph{store: d.store, compress: d.compress}
+	version := model.CurrentDocumentVersion
+	if request.Version != nil {
+		graph = &publishedGraph{store: d.store, compress: d.compress}
+		version = request.GetVersion()
+	}
+
+	follow := map[v1.TraverseEdge]bool{}
+	for _, edge := range request.GetFollow() {
+		follow[edge] = true
+	}
+	if len(follow) == 0 {
+		follow[v1.TraverseEdge_TRAVERSE_LINKS] = true
+		follow[v1.TraverseEdge_TRAVERSE_BACKLINKS] = true
+		follow[v1.TraverseEdge_TRAVERSE_CHILDREN] = true
+	}
+
+	maxDepth := request.GetMaxDepth()
+	if maxDepth <= 0 {
+		maxDepth = defaultTraverseDepth
+	}
+	maxDepth = min(maxDepth, maxTraverseDepth)
+	limit := int(request.GetLimit())
+	if limit <= 0 {
+		limit = defaultTraverseLimit
+	}
+	limit = min(limit, maxTraverseLimit)
+
+	start, err := graph.node(ctx, docID.String(), version)
+	if err != nil {
+		return nil, err
+	}
+	if start == nil {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("document %s@%s not found", docID, version))
+	}
+
+	res := &v1.TraverseLinksResponse{Nodes: []*v1.GraphNode{start}}
+	visited := map[string]*v1.GraphNode{nodeKey(start.Id, start.Version): start}
+	// resolved caches the node of each id@version reference, the version of a reference may be an alias like current
+	resolved := map[string]*v1.GraphNode{nodeKey(docID.String(), version): start}
+	edges := map[string]bool{}
+
+	resolve := func(id, version string) (*v1.GraphNode, error) {
+		key := nodeKey(id, version)
+		if node, ok := resolved[key]; ok {
+			return node, nil
+		}
+
+		node, err := graph.node(ctx, id, version)
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			if existing, ok := visited[nodeKey(node.Id, node.Version)]; ok {
+				node = existing
+			}
+		}
+		resolved[key] = node
+		return node, nil
+	}
+
+	queue := []*v1.GraphNode{start}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current.Depth >= maxDepth {
+			continue
+		}
+
+		neighbours, err := graph.edges(ctx, current, follow)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ref := range neighbours {
+			other, err := resolve(ref.id, ref.version)
+			if err != nil {
+				return nil, err
+			}
+			// dangling reference to a missing document
+			if other == nil {
+				continue
+			}
+
+			if _, ok := visited[nodeKey(other.Id, other.Version)]; !ok {
+				if len(res.Nodes) >= limit {
+					res.Truncated = true
+					continue
+				}
+
+				other.Depth = current.Depth + 1
+				visited[nodeKey(other.Id, other.Version)] = other
+				res.Nodes = append(res.Nodes, other)
+				queue = append(queue, other)
+			}
+
+			// the edge points to the resolved nodes so that the edges match the returned nodes
+			source, target := current, other
+			if ref.incoming {
+				source, target = other, current
+			}
+			key := fmt.Sprintf("%s|%s|%s", ref.kind, nodeKey(source.Id, source.Version), nodeKey(target.Id, target.Version))
+			if !edges[key] {
+				edges[key] = true
+				res.Edges = append(res.Edges, &v1.GraphEdge{
+					SourceId:      source.Id,
+					SourceVersion: source.Version,
+					TargetId:      target.Id,
+					TargetVersion: target.Version,
+					Kind:          ref.kind,
+				})
+			}
+		}
+	}
+
+	return res, nil
+}
+
+func nodeKey(id, version string) string {
+	return id + "@" + version
+}
+
+// graphReference is a reference from or to a node, the version may be an alias resolved by the graph
+type graphReference struct {
+	id       string
+	version  string
+	kind     v1.ReferenceKind
+	incoming bool // the reference points to the node, as a backlink does
+}
+
+// linkGraph is a link graph the traversal walks over
+type linkGraph interface {
+	// node returns the node of the document version, nil if the document does not exist
+	node(ctx context.Context, id, version string) (*v1.GraphNode, error)
+	// edges returns the references of the node of the followed kinds
+	edges(ctx context.Context, node *v1.GraphNode, follow map[v1.TraverseEdge]bool) ([]*graphReference, error)
+}
+
+// draftGraph is the link graph of the current documents
+type draftGraph struct {
+	store    store.Store
+	compress compress.Compress
+}
+
+func (g *draftGraph) node(ctx context.Context, id, version string) (*v1.GraphNode, error) {
+	docID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrInvalidLinkFormat
+	}
+
+	docs, err := g.store.ListDocumentsFromIDs(ctx, []uuid.UUID{docID})
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, nil
+	}
+	doc := docs[0]
+
+	meta, err := g.compress.Decode([]byte(doc.Meta))
+	if err != nil {
+		return nil, err
+	}
+
+	// all the references to a document lead to its current version in the draft graph
+	return &v1.GraphNode{
+		Id:      doc.ID,
+		Version: model.CurrentDocumentVersion,
+		Title:   documentTitle(string(meta)),
+	}, nil
+}
+
+func (g *draftGraph) edges(ctx context.Context, node *v1.GraphNode, follow map[v1.TraverseEdge]bool) ([]*graphReference, error) {
+	docID := uuid.MustParse(node.Id)
+	var refs []*graphReference
+
+	if follow[v1.TraverseEdge_TRAVERSE_LINKS] {
+		links, err := g.store.ListLinks(ctx, docID)
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range links {
+			refs = append(refs, &graphReference{id: link.TargetID, version: link.TargetVersion, kind: v1.ReferenceKind_REFERENCE_LINK})
+		}
+	}
+
+	if follow[v1.TraverseEdge_TRAVERSE_BACKLINKS] {
+		backlinks, err := g.store.ListBacklinks(ctx, docID)
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range backlinks {
+			refs = append(refs, &graphReference{id: link.SourceID, version: model.CurrentDocumentVersion, kind: v1.ReferenceKind_REFERENCE_LINK, incoming: true})
+		}
+	}
+
+	if follow[v1.TraverseEdge_TRAVERSE_CHILDREN] {
+		doc, err := g.store.GetDocument(ctx, docID)
+		if err != nil {
+			return nil, err
+		}
+		children, err := decodeChildren(g.compress, doc.Children)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			childID, childVersion, err := parseIDVersion(child)
+			if err != nil {
+				return nil, ErrInvalidChildrenLinkFormat
+			}
+			refs = append(refs, &graphReference{id: childID, version: childVersion, kind: v1.ReferenceKind_REFERENCE_CHILD})
+		}
+	}
+
+	return refs, nil
+}
+
+// publishedGraph is the link graph of the published document versions
+type publishedGraph struct {
+	store    store.Store
+	compress compress.Compress
+}
+
+func (g *publishedGraph) node(ctx context.Context, id, version string) (*v1.GraphNode, error) {
+	meta, err := resolvePublishedChild(ctx, g.store, id, version)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, nil
+	}
+
+	metaData, err := g.compress.Decode([]byte(meta.Meta))
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.GraphNode{
+		Id:      meta.ID,
+		Version: meta.Version,
+		Title:   documentTitle(string(metaData)),
+	}, nil
+}
+
+func (g *publishedGraph) edges(ctx context.Context, node *v1.GraphNode, follow map[v1.TraverseEdge]bool) ([]*graphReference, error) {
+	docID := uuid.MustParse(node.Id)
+	var refs []*graphReference
+
+	if follow[v1.TraverseEdge_TRAVERSE_LINKS] {
+		links, err := g.store.ListPublishedLinks(ctx, docID, node.Version)
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range links {
+			refs = append(refs, &graphReference{id: link.TargetID, version: link.TargetVersion, kind: v1.ReferenceKind_REFERENCE_LINK})
+		}
+	}
+
+	if follow[v1.TraverseEdge_TRAVERSE_BACKLINKS] {
+		backlinks, err := g.store.ListPublishedBacklinks(ctx, docID, node.Version)
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range backlinks {
+			refs = append(refs, &graphReference{id: link.SourceID, version: link.SourceVersion, kind: v1.ReferenceKind_REFERENCE_LINK, incoming: true})
+		}
+	}
+
+	if follow[v1.TraverseEdge_TRAVERSE_CHILDREN] {
+		meta, err := g.store.GetPublishedDocumentMetaByVersion(ctx, docID, node.Version)
+		if err != nil {
+			return nil, err
+		}
+		children, err := decodeChildren(g.compress, meta.Children)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			childID, childVersion, err := parseIDVersion(child)
+			if err != nil {
+				return nil, ErrInvalidChildrenLinkFormat
+			}
+			refs = append(refs, &graphReference{id: childID, version: childVersion, kind: v1.ReferenceKind_REFERENCE_CHILD})
+		}
+	}
+
+	return refs, nil
+}
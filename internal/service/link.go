@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	goset "github.com/deckarep/golang-set/v2"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/store"
+	"github.com/google/uuid"
+	"regexp"
+	"strings"
+)
+
+var linkTypePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// linkAnnotation is the value of a document link, the link key is the <id>@<version> of the target.
+// The value is either empty for a reference, a link type like embeds, or a json object with the type,
+// the anchor block inside the target and a label.
+type linkAnnotation struct {
+	Type   string `json:"type,omitempty"`
+	Anchor string `json:"anchor,omitempty"`
+	Label  string `json:"label,omitempty"`
+}
+
+// parseLinkAnnotation parses the value of a document link
+func parseLinkAnnotation(value string) (*linkAnnotation, error) {
+	annotation := &linkAnnotation{}
+
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "{") {
+		if err := json.Unmarshal([]byte(value), annotation); err != nil {
+			return nil, ErrInvalidLinkAnnotation
+		}
+	} else {
+		annotation.Type = value
+	}
+
+	if annotation.Type == "" {
+		annotation.Type = model.LinkTypeReferences
+	}
+	if !linkTypePattern.MatchString(annotation.Type) {
+		return nil, ErrInvalidLinkAnnotation
+	}
+
+	return annotation, nil
+}
+
+// linkTypeFilter returns a filter matching the given link types, all the types match when none is given
+func linkTypeFilter(types []string) func(linkType string) bool {
+	if len(types) == 0 {
+		return func(string) bool { return true }
+	}
+
+	allowed := goset.NewSet[string](types...)
+	return func(linkType string) bool {
+		if linkType == "" {
+			linkType = model.LinkTypeReferences
+		}
+		return allowed.Contains(linkType)
+	}
+}
+
+// checkLinkTargets checks that the targets of the links exist.
+// A link to the current version needs the target document, a link to a published version needs that version
+// and a link to the latest version is resolved when the link is read.
+func checkLinkTargets(ctx context.Context, tx store.Store, links []*model.Link) error {
+	publishedDocLinks := make([]*model.PublishedDocument, 0)
+	unPublishedDocLinks := make([]*model.Document, 0)
+	seen := goset.NewSet[string]()
+	targetIDs := make(map[string]uuid.UUID)
+	for _, link := range links {
+		// the existence checks count the matches, so a target is checked once
+		if !seen.Add(link.TargetID + "@" + link.TargetVersion) {
+			continue
+		}
+
+		targetID, err := uuid.Parse(link.TargetID)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidLinkTarget, link.TargetID)
+		}
+		targetIDs[link.TargetID] = targetID
+
+		switch link.TargetVersion {
+		case model.CurrentDocumentVersion:
+			unPublishedDocLinks = append(unPublishedDocLinks, &model.Document{
+				ID: link.TargetID,
+			})
+		case "latest":
+		default:
+			publishedDocLinks = append(publishedDocLinks, &model.PublishedDocument{
+				ID:      link.TargetID,
+				Version: link.TargetVersion,
+			})
+		}
+	}
+
+	// check if the target unpublished documents exist, if not return an error
+	if len(unPublishedDocLinks) != 0 {
+		var ids []uuid.UUID
+		for _, doc := range unPublishedDocLinks {
+			ids = append(ids, targetIDs[doc.ID])
+		}
+
+		projectIDs, err := tx.ListDocumentProjectIDs(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		for _, link := range unPublishedDocLinks {
+			if projectID, ok := projectIDs[targetIDs[link.ID]]; ok {
+				link.ProjectID = projectID.String()
+			} else {
+				return errors.New("target documents do not exist")
+			}
+		}
+
+		exists, err := tx.ExistsDocuments(ctx, unPublishedDocLinks)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errors.New("linked documents do not exist")
+		}
+	}
+
+	// check if the target published documents exist, if not return an error
+	if len(publishedDocLinks) != 0 {
+		var ids []uuid.UUID
+		for _, doc := range publishedDocLinks {
+			ids = append(ids, targetIDs[doc.ID])
+		}
+
+		projectIDs, err := tx.ListDocumentProjectIDs(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		for _, link := range publishedDocLinks {
+			if projectID, ok := projectIDs[targetIDs[link.ID]]; ok {
+				link.ProjectID = projectID.String()
+			} else {
+				return errors.New("linked published documents do not exist")
+			}
+		}
+
+		exists, err := tx.ExistsPublishedDocuments(ctx, publishedDocLinks)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return errors.New("target documents do not exist")
+		}
+	}
+
+	return nil
+}
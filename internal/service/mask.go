@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	goset "github.com/deckarep/golang-set/v2"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/compress"
+	"github.com/emrgen/document/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"sort"
+	"strings"
+)
+
+// documentColumns are the columns loaded for each field of a document
+var documentColumns = map[string][]string{
+	"version":        {"version"},
+	"meta":           {"meta"},
+	"content":        {"content", "parts"},
+	"links":          {"links"},
+	"children":       {"children"},
+	"kind":           {"kind"},
+	"backlink_count": {"backlink_count"},
+	"template":       {"template"},
+	"child_keys":     {"children", "child_keys"},
+	"parts":          {"parts"},
+	"created_at":     {"created_at"},
+	"updated_at":     {"updated_at"},
+	"project_id":     {"project_id"},
+	"deleted_at":     {"deleted_at"},
+}
+
+// publishedDocumentColumns are the columns loaded for each field of a published document,
+// the latest version is read from the latest published document
+var publishedDocumentColumns = map[string][]string{
+	"version":        {"version"},
+	"meta":           {"meta"},
+	"content":        {"content"},
+	"links":          {"links"},
+	"children":       {"children"},
+	"latest_version": {},
+	"project_id":     {"project_id"},
+}
+
+// the fields returned by the reads without a read mask
+var (
+	getDocumentFields          = []string{"version", "meta", "content", "links", "children", "kind", "backlink_count", "template", "child_keys", "parts", "created_at", "updated_at"}
+	listDocumentFields         = []string{"version", "meta", "links", "children", "backlink_count", "template", "child_keys", "created_at", "updated_at"}
+	listDocumentsFromIDsFields = []string{"version", "meta", "backlink_count", "template", "created_at", "updated_at"}
+	getPublishedDocumentFields = []string{"version", "meta", "content", "links", "children", "latest_version"}
+	listPublishedFields        = []string{"version", "meta", "links", "children"}
+	listPublishedByIDFields    = []string{"version", "meta", "content", "links", "children"}
+)
+
+// readMask is the set of top level fields requested by a read
+type readMask struct {
+	fields goset.Set[string]
+}
+
+// newReadMask checks the paths of the mask against the message, an empty mask requests the default fields
+func newReadMask(mask *fieldmaskpb.FieldMask, message proto.Message, defaults []string) (readMask, error) {
+	if len(mask.GetPaths()) == 0 {
+		return readMask{fields: goset.NewSet[string](defaults...)}, nil
+	}
+	if !mask.IsValid(message) {
+		return readMask{}, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid read_mask paths: %s", strings.Join(mask.GetPaths(), ",")))
+	}
+
+	fields := goset.NewSet[string]()
+	for _, path := range mask.GetPaths() {
+		if strings.Contains(path, ".") {
+			return readMask{}, status.Error(codes.InvalidArgument, fmt.Sprintf("read_mask path %s is nested, only top level fields are supported", path))
+		}
+		fields.Add(path)
+	}
+
+	return readMask{fields: fields}, nil
+}
+
+// has reports whether the field is requested
+func (m readMask) has(field string) bool {
+	return m.fields.Contains(field)
+}
+
+// columns returns the sorted columns to load for the requested fields along with the extra columns, the id is always loaded
+func (m readMask) columns(fieldColumns map[string][]string, extra ...string) []string {
+	columns := goset.NewSet[string]("id")
+	columns.Append(extra...)
+	for _, field := range m.fields.ToSlice() {
+		columns.Append(fieldColumns[field]...)
+	}
+
+	sorted := columns.ToSlice()
+	sort.Strings(sorted)
+	return sorted
+}
+
+// maskedDocumentProto decompresses the requested fields of a document into proto, the other fields are left empty
+func (d DocumentService) maskedDocumentProto(ctx context.Context, doc *model.Document, mask readMask) (*v1.Document, error) {
+	document := &v1.Document{Id: doc.ID}
+	if mask.has("version") {
+		document.Version = doc.Version
+	}
+	if mask.has("meta") {
+		metaData, err := d.compress.Decode([]byte(doc.Meta))
+		if err != nil {
+			return nil, err
+		}
+		document.Meta = string(metaData)
+	}
+
+	if mask.has("content") {
+		content, parts, err := d.assembleParts(ctx, d.store, doc)
+		if err != nil {
+			return nil, err
+		}
+		contentData, err := d.compress.Decode([]byte(content))
+		if err != nil {
+			return nil, err
+		}
+		document.Content = string(contentData)
+		if mask.has("parts") {
+			document.Parts = partsProto(parts)
+		}
+	} else if mask.has("parts") {
+		parts, err := orderedParts(ctx, d.store, doc)
+		if err != nil {
+			return nil, err
+		}
+		document.Parts = partsProto(parts)
+	}
+
+	if mask.has("links") {
+		links, err := decodeLinks(d.compress, doc.Links)
+		if err != nil {
+			return nil, err
+		}
+		document.Links = links
+	}
+	if mask.has("children") || mask.has("child_keys") {
+		children, err := decodeChildren(d.compress, doc.Children)
+		if err != nil {
+			return nil, err
+		}
+		if mask.has("children") {
+			document.Children = children
+		}
+		if mask.has("child_keys") {
+			document.ChildKeys = childKeys(children, doc.ChildKeys)
+		}
+	}
+
+	if mask.has("kind") {
+		document.Kind = documentKindProto(doc.Kind)
+	}
+	if mask.has("backlink_count") {
+		document.BacklinkCount = int64(doc.BacklinkCount)
+	}
+	if mask.has("template") {
+		document.Template = doc.Template
+	}
+	if mask.has("created_at") {
+		document.CreatedAt = timestamppb.New(doc.CreatedAt)
+	}
+	if mask.has("updated_at") {
+		document.UpdatedAt = timestamppb.New(doc.UpdatedAt)
+	}
+	if mask.has("project_id") {
+		document.ProjectId = doc.ProjectID
+	}
+	if mask.has("deleted_at") && doc.DeletedAt.Valid {
+		document.DeletedAt = timestamppb.New(doc.DeletedAt.Time)
+	}
+
+	return document, nil
+}
+
+// maskedPublishedDocumentProto decompresses the requested fields of a published document into proto,
+// the latest version is left to the caller
+func maskedPublishedDocumentProto(c compress.Compress, doc *model.PublishedDocument, mask readMask) (*v1.PublishedDocument, error) {
+	document := &v1.PublishedDocument{Id: doc.ID}
+	if mask.has("version") {
+		document.Version = doc.Version
+	}
+	if mask.has("meta") {
+		metaData, err := c.Decode([]byte(doc.Meta))
+		if err != nil {
+			return nil, err
+		}
+		document.Meta = string(metaData)
+	}
+	if mask.has("content") {
+		contentData, err := c.Decode([]byte(doc.Content))
+		if err != nil {
+			return nil, err
+		}
+		document.Content = string(contentData)
+	}
+	if mask.has("links") {
+		links, err := decodeLinks(c, doc.Links)
+		if err != nil {
+			return nil, err
+		}
+		document.Links = links
+	}
+	if mask.has("children") {
+		children, err := decodeChildren(c, doc.Children)
+		if err != nil {
+			return nil, err
+		}
+		document.Children = children
+	}
+	if mask.has("project_id") {
+		document.ProjectId = doc.ProjectID
+	}
+
+	return document, nil
+}
+
+// partsProto lists the parts without their content
+func partsProto(parts []*model.DocumentPart) []*v1.DocumentPart {
+	partList := make([]*v1.DocumentPart, 0, len(parts))
+	for _, part := range parts {
+		partList = append(partList, &v1.DocumentPart{Id: part.PartID, Version: part.Version})
+	}
+
+	return partList
+}
@@ -0,0 +1,431 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	goset "github.com/deckarep/golang-set/v2"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/store"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MoveDocuments moves the documents with all the documents under them to another project.
+// The ids and versions are kept, the parents left behind stop listing the moved documents as children.
+func (d DocumentService) MoveDocuments(ctx context.Context, request *v1.MoveDocumentsRequest) (*v1.MoveDocumentsResponse, error) {
+	projectID, err := uuid.Parse(request.GetProjectId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	res := &v1.MoveDocumentsResponse{}
+	var moved, updated []*model.Document
+
+	err = d.store.Transaction(ctx, func(tx store.Store) error {
+		docs, roots, err := d.subtrees(ctx, tx, request.GetDocumentIds())
+		if err != nil {
+			return err
+		}
+		moved = docs
+
+		moving := make(map[string]bool)
+		var ids []uuid.UUID
+		for _, doc := range moved {
+			moving[doc.ID] = true
+			ids = append(ids, uuid.MustParse(doc.ID))
+			res.MovedIds = append(res.MovedIds, doc.ID)
+		}
+
+		parent, err := d.targetParent(ctx, tx, request.ParentId, projectID, moving)
+		if err != nil {
+			return err
+		}
+
+		// the links of the moved documents must hold in the target project
+		if err = d.checkDocumentLinks(ctx, tx, moved); err != nil {
+			return err
+		}
+
+		// the links to the moved documents are kept, only the parents left behind are updated
+		sources, refs, err := d.referencesTo(ctx, tx, moved, moving)
+		if err != nil {
+			return err
+		}
+		var childRefs []*v1.DanglingReference
+		for _, ref := range refs {
+			if ref.Kind == v1.ReferenceKind_REFERENCE_CHILD {
+				childRefs = append(childRefs, ref)
+			}
+		}
+		updated, res.Detached, err = d.detachReferences(ctx, tx, sources, childRefs)
+		if err != nil {
+			return err
+		}
+
+		if err = tx.MoveDocuments(ctx, ids, projectID); err != nil {
+			return err
+		}
+		for _, doc := range moved {
+			doc.ProjectID = projectID.String()
+		}
+
+		if parent != nil {
+			// the parent may be saved already by the detach
+			if source, ok := sources[parent.ID]; ok {
+				parent = source
+			}
+			if err = d.addChildren(ctx, tx, parent, roots); err != nil {
+				return err
+			}
+			updated = append(updated, parent)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range moved {
+		d.indexDocument(ctx, doc)
+	}
+	for _, doc := range updated {
+		d.indexDocument(ctx, doc)
+	}
+
+	return res, nil
+}
+
+// CopyDocuments copies the current version of the documents with all the documents under them to another project.
+// The links and children between the copied documents point to the copies, other references are kept as they are.
+func (d DocumentService) CopyDocuments(ctx context.Context, request *v1.CopyDocumentsRequest) (*v1.CopyDocumentsResponse, error) {
+	projectID, err := uuid.Parse(request.GetProjectId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var copied *copiedDocuments
+	err = d.store.Transaction(ctx, func(tx store.Store) error {
+		copied, err = d.copyDocuments(ctx, tx, request.GetDocumentIds(), projectID, request.ParentId, true, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.indexCopies(ctx, copied)
+
+	return &v1.CopyDocumentsResponse{
+		CopiedIds: copied.ids,
+	}, nil
+}
+
+// copiedDocuments is the result of a copy, the parent is set if the copies are added to a parent
+type copiedDocuments struct {
+	ids     map[string]string
+	created []*model.Document
+	roots   []*model.Document
+	parent  *model.Document
+}
+
+// copyDocuments copies the current version of the documents to the project, with all the documents under them if deep.
+// The fill function can change each copy before it is created.
+func (d DocumentService) copyDocuments(ctx context.Context, tx store.Store, ids []string, projectID uuid.UUID, parentID *string, deep bool, fill func(doc *model.Document) error) (*copiedDocuments, error) {
+	var docs, roots []*model.Document
+	var err error
+	if deep {
+		docs, roots, err = d.subtrees(ctx, tx, ids)
+	} else {
+		docs, err = d.documents(ctx, tx, ids)
+		roots = docs
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := d.targetParent(ctx, tx, parentID, projectID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := &copiedDocuments{ids: make(map[string]string), parent: parent}
+	for _, doc := range docs {
+		copied.ids[doc.ID] = uuid.New().String()
+	}
+
+	var links []*model.Link
+	for _, doc := range docs {
+		// the copy gets the whole content, its parts are not copied
+		if doc.Content, _, err = d.assembleParts(ctx, tx, doc); err != nil {
+			return nil, err
+		}
+		doc.Parts = "[]"
+
+		copyDoc, copyLinks, err := d.copyDocument(doc, projectID, copied.ids)
+		if err != nil {
+			return nil, err
+		}
+		if fill != nil {
+			if err = fill(copyDoc); err != nil {
+				return nil, err
+			}
+		}
+		if err = tx.CreateDocument(ctx, copyDoc); err != nil {
+			return nil, err
+		}
+		if err = d.saveChildEdges(ctx, tx, copyDoc); err != nil {
+			return nil, err
+		}
+		copied.created = append(copied.created, copyDoc)
+		links = append(links, copyLinks...)
+	}
+
+	// checked after the copies are created, so the links between the copies hold
+	if err = d.checkDocumentLinks(ctx, tx, copied.created); err != nil {
+		return nil, err
+	}
+	if len(links) != 0 {
+		if err = tx.CreateBacklinks(ctx, links); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, root := range roots {
+		copied.roots = append(copied.roots, &model.Document{ID: copied.ids[root.ID]})
+	}
+	if parent != nil {
+		if err = d.addChildren(ctx, tx, parent, copied.roots); err != nil {
+			return nil, err
+		}
+	}
+
+	return copied, nil
+}
+
+// indexCopies indexes the created copies and the parent they are added to
+func (d DocumentService) indexCopies(ctx context.Context, copied *copiedDocuments) {
+	for _, doc := range copied.created {
+		d.indexDocument(ctx, doc)
+	}
+	if copied.parent != nil {
+		d.indexDocument(ctx, copied.parent)
+	}
+}
+
+// documents returns the documents of the ids in the same order
+func (d DocumentService) documents(ctx context.Context, tx store.Store, ids []string) ([]*model.Document, error) {
+	var docs []*model.Document
+	for _, id := range ids {
+		docID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		doc, err := tx.GetDocument(ctx, docID)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+
+	return docs, nil
+}
+
+// subtrees returns the documents with all the documents under them, and the documents that are not under another one.
+func (d DocumentService) subtrees(ctx context.Context, tx store.Store, ids []string) ([]*model.Document, []*model.Document, error) {
+	requested, err := d.documents(ctx, tx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var docs []*model.Document
+	seen := make(map[string]bool)
+	for _, doc := range requested {
+		if seen[doc.ID] {
+			continue
+		}
+
+		subtree, err := d.subtree(ctx, tx, doc)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, doc := range subtree {
+			if !seen[doc.ID] {
+				seen[doc.ID] = true
+				docs = append(docs, doc)
+			}
+		}
+	}
+
+	// a requested document listed as a child of another document of the set is not a root
+	isChild := make(map[string]bool)
+	for _, doc := range docs {
+		children, err := decodeChildren(d.compress, doc.Children)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, child := range children {
+			if childID, _, err := parseIDVersion(child); err == nil && childID != doc.ID {
+				isChild[childID] = true
+			}
+		}
+	}
+
+	var roots []*model.Document
+	for _, doc := range requested {
+		if !isChild[doc.ID] {
+			isChild[doc.ID] = true
+			roots = append(roots, doc)
+		}
+	}
+
+	return docs, roots, nil
+}
+
+// targetParent returns the document of the target project the moved or copied documents are added to
+func (d DocumentService) targetParent(ctx context.Context, tx store.Store, parentID *string, projectID uuid.UUID, moving map[string]bool) (*model.Document, error) {
+	if parentID == nil {
+		return nil, nil
+	}
+
+	id, err := uuid.Parse(*parentID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	parent, err := tx.GetDocument(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if parent.ProjectID != projectID.String() {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("parent %s is not in project %s", parent.ID, projectID))
+	}
+	if moving[parent.ID] {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("parent %s is moved along", parent.ID))
+	}
+
+	return parent, nil
+}
+
+// checkDocumentLinks checks that the link targets of the documents exist
+func (d DocumentService) checkDocumentLinks(ctx context.Context, tx store.Store, docs []*model.Document) error {
+	var links []*model.Link
+	for _, doc := range docs {
+		docLinks, err := decodeLinks(d.compress, doc.Links)
+		if err != nil {
+			return err
+		}
+		for key := range docLinks {
+			targetID, targetVersion, err := parseIDVersion(key)
+			if err != nil {
+				return err
+			}
+			links = append(links, &model.Link{SourceID: doc.ID, TargetID: targetID, TargetVersion: targetVersion})
+		}
+	}
+
+	if err := checkLinkTargets(ctx, tx, links); err != nil {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	return nil
+}
+
+// copyDocument returns a copy of the current version of the document in the project with the references remapped to the copies
+func (d DocumentService) copyDocument(doc *model.Document, projectID uuid.UUID, copies map[string]string) (*model.Document, []*model.Link, error) {
+	copyID := copies[doc.ID]
+
+	links, err := decodeLinks(d.compress, doc.Links)
+	if err != nil {
+		return nil, nil, err
+	}
+	copyLinks := make(map[string]string, len(links))
+	var linkModels []*model.Link
+	for key, value := range links {
+		key = remapReference(key, copies)
+		copyLinks[key] = value
+
+		targetID, targetVersion, err := parseIDVersion(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		annotation, err := parseLinkAnnotation(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		linkModels = append(linkModels, &model.Link{
+			SourceID:      copyID,
+			TargetID:      targetID,
+			TargetVersion: targetVersion,
+			Type:          annotation.Type,
+			Anchor:        annotation.Anchor,
+			Label:         annotation.Label,
+		})
+	}
+
+	children, err := decodeChildren(d.compress, doc.Children)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, child := range children {
+		children[i] = remapReference(child, copies)
+	}
+
+	linksContent, err := encodeLinks(d.compress, copyLinks)
+	if err != nil {
+		return nil, nil, err
+	}
+	childrenContent, err := encodeChildren(d.compress, children)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &model.Document{
+		ID:          copyID,
+		ProjectID:   projectID.String(),
+		Meta:        doc.Meta,
+		Content:     doc.Content,
+		Parts:       doc.Parts,
+		Links:       linksContent,
+		Children:    childrenContent,
+		ChildKeys:   doc.ChildKeys,
+		Template:    doc.Template,
+		Kind:        doc.Kind,
+		Compression: doc.Compression,
+	}, linkModels, nil
+}
+
+// remapReference points a reference to the current version of a copied document to the copy.
+// The copies have no published versions, so the other references keep pointing to the original.
+func remapReference(ref string, copies map[string]string) string {
+	id, version, err := parseIDVersion(ref)
+	if err != nil || version != model.CurrentDocumentVersion {
+		return ref
+	}
+	if copyID, ok := copies[id]; ok {
+		return copyID + "@" + version
+	}
+
+	return ref
+}
+
+// addChildren appends the current version of the documents to the children of the parent, saved as a new version
+func (d DocumentService) addChildren(ctx context.Context, tx store.Store, parent *model.Document, docs []*model.Document) error {
+	links, err := decodeLinks(d.compress, parent.Links)
+	if err != nil {
+		return err
+	}
+	children, err := decodeChildren(d.compress, parent.Children)
+	if err != nil {
+		return err
+	}
+
+	existing := goset.NewSet[string](children...)
+	for _, doc := range docs {
+		ref := doc.ID + "@" + model.CurrentDocumentVersion
+		if existing.Add(ref) {
+			children = append(children, ref)
+		}
+	}
+
+	return d.writeReferences(ctx, tx, parent, links, children, nil)
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"errors"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/store"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strconv"
+)
+
+// maxBreadcrumbs is the number of parent chains returned with a document
+const maxBreadcrumbs = 10
+
+// maxBreadcrumbDepth stops a parent chain that is deeper than any sane document tree
+const maxBreadcrumbDepth = 32
+
+// childEdgeBackfillPageSize is the number of documents read at once when the child edges are backfilled
+const childEdgeBackfillPageSize = 500
+
+// ListParents lists the documents that have the document as a child.
+// The draft parents are the documents that are not deleted, the published parents are the published versions that are not unpublished.
+func (d DocumentService) ListParents(ctx context.Context, request *v1.ListParentsRequest) (*v1.ListParentsResponse, error) {
+	docID, err := uuid.Parse(request.GetDocumentId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if request.GetPublished() {
+		parents, err := d.publishedParents(ctx, docID, request.Version)
+		if err != nil {
+			return nil, err
+		}
+		return &v1.ListParentsResponse{Parents: parents}, nil
+	}
+
+	edges, err := d.store.ListDocumentParentEdges(ctx, docID)
+	if err != nil {
+		return nil, err
+	}
+	if len(edges) == 0 {
+		return &v1.ListParentsResponse{}, nil
+	}
+
+	parentIDs := make([]uuid.UUID, 0, len(edges))
+	for _, edge := range edges {
+		parentIDs = append(parentIDs, uuid.MustParse(edge.ParentID))
+	}
+	docs, err := d.store.ListDocumentsFromIDs(ctx, parentIDs, "id", "version", "meta")
+	if err != nil {
+		return nil, err
+	}
+	parentDocs := make(map[string]*model.Document, len(docs))
+	for _, doc := range docs {
+		parentDocs[doc.ID] = doc
+	}
+
+	parents := make([]*v1.DocumentParent, 0, len(edges))
+	for _, edge := range edges {
+		doc, ok := parentDocs[edge.ParentID]
+		if !ok {
+			continue
+		}
+		parents = append(parents, &v1.DocumentParent{
+			Id:           doc.ID,
+			Version:      strconv.FormatInt(doc.Version, 10),
+			ChildVersion: edge.ChildVersion,
+			Title:        d.title(doc.Meta),
+		})
+	}
+
+	return &v1.ListParentsResponse{Parents: parents}, nil
+}
+
+// publishedParents returns the published parent versions of the document.
+// With a version only the parents listing the version are returned, the parents following the latest version are included when it is the latest.
+func (d DocumentService) publishedParents(ctx context.Context, docID uuid.UUID, version *string) ([]*v1.DocumentParent, error) {
+	edges, err := d.store.ListPublishedParentEdges(ctx, docID)
+	if err != nil {
+		return nil, err
+	}
+	if len(edges) == 0 {
+		return nil, nil
+	}
+
+	latest := false
+	if version != nil {
+		meta, err := d.store.GetLatestPublishedDocumentMeta(ctx, docID)
+		latest = err == nil && meta.Version == *version
+	}
+
+	parentIDs := make([]uuid.UUID, 0, len(edges))
+	for _, edge := range edges {
+		parentIDs = append(parentIDs, uuid.MustParse(edge.ParentID))
+	}
+	idVersions, err := d.store.ListPublishedDocumentIDVersions(ctx, parentIDs)
+	if err != nil {
+		return nil, err
+	}
+	published := make(map[string]bool, len(idVersions))
+	for _, idVersion := range idVersions {
+		published[idVersion.ID+"@"+idVersion.Version] = true
+	}
+
+	var parents []*v1.DocumentParent
+	for _, edge := range edges {
+		if !published[edge.ParentID+"@"+edge.ParentVersion] {
+			continue
+		}
+		if version != nil {
+			switch edge.ChildVersion {
+			case model.CurrentDocumentVersion, "latest", "":
+				if !latest {
+					continue
+				}
+			default:
+				if edge.ChildVersion != *version {
+					continue
+				}
+			}
+		}
+
+		meta, err := d.store.GetPublishedDocumentMetaByVersion(ctx, uuid.MustParse(edge.ParentID), edge.ParentVersion)
+		if err != nil {
+			return nil, err
+		}
+		parents = append(parents, &v1.DocumentParent{
+			Id:           edge.ParentID,
+			Version:      edge.ParentVersion,
+			ChildVersion: edge.ChildVersion,
+			Title:        d.title(meta.Meta),
+		})
+	}
+
+	return parents, nil
+}
+
+// breadcrumbs returns the chains of draft parents from the root documents down to the parent of the document.
+// A document with several parents gets a chain per parent, the chains stop at a cycle.
+func (d DocumentService) breadcrumbs(ctx context.Context, docID string) ([]*v1.Breadcrumb, error) {
+	parentEdges := make(map[string][]string)
+	parentsOf := func(id string) ([]string, error) {
+		if parents, ok := parentEdges[id]; ok {
+			return parents, nil
+		}
+		edges, err := d.store.ListDocumentParentEdges(ctx, uuid.MustParse(id))
+		if err != nil {
+			return nil, err
+		}
+		var parents []string
+		for _, edge := range edges {
+			if indexOf(parents, edge.ParentID) == -1 {
+				parents = append(parents, edge.ParentID)
+			}
+		}
+		parentEdges[id] = parents
+		return parents, nil
+	}
+
+	// the chains are collected from the document up, the root is last
+	var chains [][]string
+	var walk func(id string, chain []string) error
+	walk = func(id string, chain []string) error {
+		if len(chains) >= maxBreadcrumbs {
+			return nil
+		}
+		parents, err := parentsOf(id)
+		if err != nil {
+			return err
+		}
+		if len(parents) == 0 || len(chain) >= maxBreadcrumbDepth {
+			if len(chain) > 0 {
+				chains = append(chains, chain)
+			}
+			return nil
+		}
+
+		for _, parentID := range parents {
+			if parentID == docID || indexOf(chain, parentID) != -1 {
+				chains = append(chains, chain)
+				continue
+			}
+			next := append(chain[:len(chain):len(chain)], parentID)
+			if err = walk(parentID, next); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(docID, nil); err != nil {
+		return nil, err
+	}
+	if len(chains) > maxBreadcrumbs {
+		chains = chains[:maxBreadcrumbs]
+	}
+
+	seen := make(map[string]bool)
+	var ids []uuid.UUID
+	for _, chain := range chains {
+		for _, id := range chain {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, uuid.MustParse(id))
+			}
+		}
+	}
+	titles := make(map[string]string, len(ids))
+	if len(ids) != 0 {
+		docs, err := d.store.ListDocumentsFromIDs(ctx, ids, "id", "meta")
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			titles[doc.ID] = d.title(doc.Meta)
+		}
+	}
+
+	breadcrumbs := make([]*v1.Breadcrumb, 0, len(chains))
+	for _, chain := range chains {
+		if len(chain) == 0 {
+			continue
+		}
+		breadcrumb := &v1.Breadcrumb{}
+		for i := len(chain) - 1; i >= 0; i-- {
+			breadcrumb.Items = append(breadcrumb.Items, &v1.BreadcrumbItem{Id: chain[i], Title: titles[chain[i]]})
+		}
+		breadcrumbs = append(breadcrumbs, breadcrumb)
+	}
+
+	return breadcrumbs, nil
+}
+
+// saveChildEdges replaces the child edges of the document with its children, the malformed children get no edge
+func (d DocumentService) saveChildEdges(ctx context.Context, tx store.Store, doc *model.Document) error {
+	children, err := decodeChildren(d.compress, doc.Children)
+	if err != nil {
+		return err
+	}
+
+	return tx.ReplaceDocumentChildEdges(ctx, uuid.MustParse(doc.ID), childEdges(doc.ID, children))
+}
+
+// savePublishedChildEdges creates the child edges of a published document version
+func (d DocumentService) savePublishedChildEdges(ctx context.Context, tx store.Store, doc *model.PublishedDocument) error {
+	children, err := decodeChildren(d.compress, doc.Children)
+	if err != nil {
+		return err
+	}
+
+	var edges []*model.PublishedDocumentChild
+	for _, edge := range childEdges(doc.ID, children) {
+		edges = append(edges, &model.PublishedDocumentChild{
+			ParentID:      doc.ID,
+			ParentVersion: doc.Version,
+			ChildID:       edge.ChildID,
+			ChildVersion:  edge.ChildVersion,
+		})
+	}
+	if len(edges) == 0 {
+		return nil
+	}
+
+	return tx.CreatePublishedChildEdges(ctx, edges)
+}
+
+// BackfillChildEdges creates the child edges of the documents saved before the edges were tracked.
+// The edges are only backfilled while there are none, so a restart does not scan the documents again.
+func (d DocumentService) BackfillChildEdges(ctx context.Context) error {
+	count, err := d.store.CountDocumentChildEdges(ctx)
+	if err != nil || count != 0 {
+		return err
+	}
+
+	afterID := ""
+	total := 0
+	for {
+		docs, err := d.store.ListDocumentsAfter(ctx, afterID, childEdgeBackfillPageSize)
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			break
+		}
+
+		err = d.store.Transaction(ctx, func(tx store.Store) error {
+			for _, doc := range docs {
+				err := d.saveChildEdges(ctx, tx, doc)
+				if errors.Is(err, ErrDocumentChildrenCorrupted) {
+					logrus.Warnf("skipping the child edges of document %s: %v", doc.ID, err)
+					continue
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		total += len(docs)
+		afterID = docs[len(docs)-1].ID
+	}
+	logrus.Infof("backfilled the child edges of %d documents", total)
+
+	return nil
+}
+
+// title returns the title from the compressed meta of a document
+func (d DocumentService) title(meta string) string {
+	data, err := d.compress.Decode([]byte(meta))
+	if err != nil {
+		return ""
+	}
+
+	return documentTitle(string(data))
+}
+
+// childEdges returns the edges from the parent to its children, a child listed twice gets one edge
+func childEdges(parentID string, children []string) []*model.DocumentChild {
+	seen := make(map[string]bool)
+	var edges []*model.DocumentChild
+	for _, child := range children {
+		childID, childVersion, err := parseIDVersion(child)
+		if err != nil || seen[child] {
+			continue
+		}
+		if _, err = uuid.Parse(childID); err != nil {
+			continue
+		}
+		seen[child] = true
+		edges = append(edges, &model.DocumentChild{
+			ParentID:     parentID,
+			ChildID:      childID,
+			ChildVersion: childVersion,
+		})
+	}
+
+	return edges
+}
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/store"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GetDocumentPart gets a part of the content of a document with its version.
+func (d DocumentService) GetDocumentPart(ctx context.Context, request *v1.GetDocumentPartRequest) (*v1.GetDocumentPartResponse, error) {
+	docID, err := uuid.Parse(request.GetDocumentId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// the part of a deleted document is not found
+	if _, err = d.store.GetDocument(ctx, docID); err != nil {
+		return nil, err
+	}
+	part, err := d.store.GetDocumentPart(ctx, docID, request.GetPartId())
+	if errors.Is(err, store.ErrDocumentPartNotFound) {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("part %s not found", request.GetPartId()))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := d.compress.Decode([]byte(part.Content))
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.GetDocumentPartResponse{
+		Part: &v1.DocumentPart{
+			Id:      part.PartID,
+			Version: part.Version,
+			Content: string(content),
+		},
+	}, nil
+}
+
+// UpdateDocumentPart creates, updates or removes a part of a document.
+// The part version is checked like the document version in UpdateDocument, the document version does not change,
+// so the parts of a large document are edited without rewriting its content and without conflicting with each other.
+func (d DocumentService) UpdateDocumentPart(ctx context.Context, request *v1.UpdateDocumentPartRequest) (*v1.UpdateDocumentPartResponse, error) {
+	docID, err := uuid.Parse(request.GetDocumentId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	partID := request.GetPartId()
+	version := request.GetVersion()
+
+	var doc *model.Document
+	var partIDs []string
+	var partVersion int64
+	err = d.store.Transaction(ctx, func(tx store.Store) error {
+		var err error
+		doc, err = tx.GetDocument(ctx, docID)
+		if err != nil {
+			return err
+		}
+		partIDs, err = decodePartIDs(doc.Parts)
+		if err != nil {
+			return err
+		}
+
+		index := indexOf(partIDs, partID)
+		var part *model.DocumentPart
+		if index != -1 {
+			part, err = tx.GetDocumentPart(ctx, docID, partID)
+			if err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case request.GetRemove():
+			if part == nil {
+				return status.Error(codes.NotFound, fmt.Sprintf("part %s not found", partID))
+			}
+			if version != -1 && version != part.Version+1 {
+				return partVersionMismatch(part.Version, version)
+			}
+			if err = tx.DeleteDocumentPart(ctx, docID, partID); err != nil {
+				return err
+			}
+			partIDs = append(partIDs[:index:index], partIDs[index+1:]...)
+		case part == nil:
+			if version != -1 && version != 1 {
+				return partVersionMismatch(0, version)
+			}
+			content, err := d.compress.Encode([]byte(request.GetContent()))
+			if err != nil {
+				return err
+			}
+			part = &model.DocumentPart{
+				DocumentID: doc.ID,
+				PartID:     partID,
+				Version:    1,
+				Content:    string(content),
+			}
+			if err = tx.CreateDocumentPart(ctx, part); err != nil {
+				return err
+			}
+
+			index = len(partIDs)
+			if request.After != nil {
+				index = 0
+				if request.GetAfter() != "" {
+					after := indexOf(partIDs, request.GetAfter())
+					if after == -1 {
+						return status.Error(codes.NotFound, fmt.Sprintf("part %s not found", request.GetAfter()))
+					}
+					index = after + 1
+				}
+			}
+			partIDs = append(partIDs[:index:index], append([]string{partID}, partIDs[index:]...)...)
+			partVersion = part.Version
+		default:
+			if version != -1 && version != part.Version+1 {
+				return partVersionMismatch(part.Version, version)
+			}
+			content, err := d.compress.Encode([]byte(request.GetContent()))
+			if err != nil {
+				return err
+			}
+			previous := part.Version
+			part.Content = string(content)
+			part.Version = previous + 1
+
+			saved, err := tx.UpdateDocumentPart(ctx, part, previous)
+			if err != nil {
+				return err
+			}
+			if !saved {
+				return status.Error(codes.FailedPrecondition, fmt.Sprintf("part %s changed concurrently", partID))
+			}
+			partVersion = part.Version
+		}
+
+		// the part ids are saved on every change, so the updated time of the document follows its parts
+		doc.Parts, err = encodePartIDs(partIDs)
+		if err != nil {
+			return err
+		}
+		return tx.UpdateDocumentPartIDs(ctx, docID, doc.Parts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.indexDocument(ctx, doc)
+
+	return &v1.UpdateDocumentPartResponse{
+		DocumentId: doc.ID,
+		PartId:     partID,
+		Version:    partVersion,
+		Parts:      partIDs,
+	}, nil
+}
+
+// assembleParts returns the compressed content of the document with its parts appended in order, along with the parts.
+// A document without parts returns its content as is.
+func (d DocumentService) assembleParts(ctx context.Context, tx store.Store, doc *model.Document) (string, []*model.DocumentPart, error) {
+	ordered, err := orderedParts(ctx, tx, doc)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(ordered) == 0 {
+		return doc.Content, nil, nil
+	}
+
+	content, err := d.compress.Decode([]byte(doc.Content))
+	if err != nil {
+		return "", nil, err
+	}
+	var buf bytes.Buffer
+	buf.Write(content)
+
+	for _, part := range ordered {
+		partContent, err := d.compress.Decode([]byte(part.Content))
+		if err != nil {
+			return "", nil, err
+		}
+		buf.Write(partContent)
+	}
+
+	assembled, err := d.compress.Encode(buf.Bytes())
+	if err != nil {
+		return "", nil, err
+	}
+
+	return string(assembled), ordered, nil
+}
+
+// orderedParts returns the parts of the document in the order of its part ids, the parts that are missing are skipped
+func orderedParts(ctx context.Context, tx store.Store, doc *model.Document) ([]*model.DocumentPart, error) {
+	partIDs, err := decodePartIDs(doc.Parts)
+	if err != nil {
+		return nil, err
+	}
+	if len(partIDs) == 0 {
+		return nil, nil
+	}
+
+	parts, err := tx.ListDocumentParts(ctx, uuid.MustParse(doc.ID))
+	if err != nil {
+		return nil, err
+	}
+	partsByID := make(map[string]*model.DocumentPart, len(parts))
+	for _, part := range parts {
+		partsByID[part.PartID] = part
+	}
+
+	ordered := make([]*model.DocumentPart, 0, len(partIDs))
+	for _, partID := range partIDs {
+		if part, ok := partsByID[partID]; ok {
+			ordered = append(ordered, part)
+		}
+	}
+
+	return ordered, nil
+}
+
+// partVersionMismatch is the error of a part update with a version that does not follow the part version
+func partVersionMismatch(current, provided int64) error {
+	return status.Error(codes.FailedPrecondition, fmt.Sprintf("current part version: %d, expected version %d, provider version: %d", current, current+1, provided))
+}
+
+// decodePartIDs parses the part ids of a document
+func decodePartIDs(data string) ([]string, error) {
+	partIDs := make([]string, 0)
+	if data == "" {
+		return partIDs, nil
+	}
+	if err := json.Unmarshal([]byte(data), &partIDs); err != nil {
+		return nil, err
+	}
+
+	return partIDs, nil
+}
+
+// encodePartIDs serializes the part ids of a document, the ids are not compressed as they are small
+func encodePartIDs(partIDs []string) (string, error) {
+	data, err := json.Marshal(partIDs)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
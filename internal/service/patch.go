@@ -0,0 +1,247 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	goset "github.com/deckarep/golang-set/v2"
+	"github.com/emrgen/blocktree"
+	v1 "github.com/emrgen/document/apis/v1"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"strings"
+)
+
+// updateMaskFields are the fields of a document replaced by an update mask, the meta keys are set with meta.<key>
+var updateMaskFields = goset.NewSet[string]("meta", "content", "links", "children", "template")
+
+// maskedUpdateRequest returns the request with only the fields of its update mask, along with the meta keys of the mask.
+// A masked field missing from the request is cleared, a masked meta key missing from the request meta is removed.
+func maskedUpdateRequest(request *v1.UpdateDocumentRequest) (*v1.UpdateDocumentRequest, [][]string, error) {
+	paths := request.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		return request, nil, nil
+	}
+	if request.GetKind() == v1.UpdateKind_JSONPATCH || request.GetKind() == v1.UpdateKind_MERGEPATCH {
+		return nil, nil, status.Error(codes.InvalidArgument, "update_mask is not supported with the patch update kinds")
+	}
+
+	fields := goset.NewSet[string]()
+	var metaKeys [][]string
+	for _, path := range paths {
+		if key, ok := strings.CutPrefix(path, "meta."); ok {
+			keys := strings.Split(key, ".")
+			for _, k := range keys {
+				if k == "" {
+					return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid update_mask path: %s", path))
+				}
+			}
+			metaKeys = append(metaKeys, keys)
+			continue
+		}
+		if !updateMaskFields.Contains(path) {
+			return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid update_mask path: %s", path))
+		}
+		fields.Add(path)
+	}
+	if fields.Contains("meta") && len(metaKeys) != 0 {
+		return nil, nil, status.Error(codes.InvalidArgument, "update_mask can not replace the meta and set its keys at once")
+	}
+
+	masked := proto.Clone(request).(*v1.UpdateDocumentRequest)
+	masked.UpdateMask = nil
+	if fields.Contains("meta") || len(metaKeys) != 0 {
+		if masked.Meta == nil {
+			masked.Meta = proto.String("{}")
+		}
+	} else {
+		masked.Meta = nil
+	}
+	if fields.Contains("content") {
+		if masked.Content == nil {
+			masked.Content = proto.String("")
+		}
+	} else {
+		masked.Content = nil
+	}
+	if fields.Contains("links") {
+		if masked.Links == nil {
+			masked.Links = map[string]string{}
+		}
+	} else {
+		masked.Links = nil
+	}
+	if fields.Contains("children") {
+		if masked.Children == nil {
+			masked.Children = []string{}
+		}
+	} else {
+		masked.Children = nil
+	}
+	if fields.Contains("template") {
+		if masked.Template == nil {
+			masked.Template = proto.Bool(false)
+		}
+	} else {
+		masked.Template = nil
+	}
+
+	return masked, metaKeys, nil
+}
+
+// updateMeta returns the compressed meta of the update, the meta of the request replaces, patches or merges into the current meta
+func (d DocumentService) updateMeta(current string, request *v1.UpdateDocumentRequest, metaKeys [][]string) (string, error) {
+	data := []byte(request.GetMeta())
+	if len(metaKeys) != 0 || request.GetKind() == v1.UpdateKind_JSONPATCH || request.GetKind() == v1.UpdateKind_MERGEPATCH {
+		currentData, err := d.compress.Decode([]byte(current))
+		if err != nil {
+			return "", err
+		}
+		if len(currentData) == 0 {
+			currentData = []byte("{}")
+		}
+
+		switch {
+		case len(metaKeys) != 0:
+			data, err = setMetaKeys(currentData, request.GetMeta(), metaKeys)
+		case request.GetKind() == v1.UpdateKind_JSONPATCH:
+			data, err = applyJSONPatch("meta", currentData, request.GetMeta())
+		default:
+			data, err = applyMergePatch("meta", currentData, request.GetMeta())
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	meta, err := d.compress.Encode(data)
+	if err != nil {
+		return "", err
+	}
+
+	return string(meta), nil
+}
+
+// updateContent returns the compressed content of the update, the content of the request replaces, patches or merges into the current content
+func (d DocumentService) updateContent(current string, request *v1.UpdateDocumentRequest) (string, error) {
+	data := []byte(request.GetContent())
+	if request.GetKind() == v1.UpdateKind_JSONPATCH || request.GetKind() == v1.UpdateKind_MERGEPATCH {
+		currentData, err := d.compress.Decode([]byte(current))
+		if err != nil {
+			return "", err
+		}
+		if len(currentData) == 0 {
+			currentData = []byte("{}")
+		}
+
+		if request.GetKind() == v1.UpdateKind_JSONPATCH {
+			data, err = applyJSONPatch("content", currentData, request.GetContent())
+		} else {
+			data, err = applyMergePatch("content", currentData, request.GetContent())
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	content, err := d.compress.Encode(data)
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+// applyJSONPatch applies a RFC 6902 JSON Patch to the field
+func applyJSONPatch(field string, target []byte, patch string) ([]byte, error) {
+	jsonDoc := blocktree.NewJsonDoc(target)
+	if err := jsonDoc.Apply(blocktree.JsonPatch(patch)); err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("failed to apply the %s json patch: %v", field, err))
+	}
+
+	return []byte(jsonDoc.String()), nil
+}
+
+// applyMergePatch applies a RFC 7396 JSON Merge Patch to the field, the null values of the patch remove their keys
+func applyMergePatch(field string, target []byte, patch string) ([]byte, error) {
+	if !json.Valid(target) {
+		return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("the %s is not json, it can not be merge patched", field))
+	}
+	data, err := jsonpatch.MergePatch(target, []byte(patch))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("failed to apply the %s merge patch: %v", field, err))
+	}
+
+	return data, nil
+}
+
+// setMetaKeys sets the keys in the meta to their values in the source meta, a key missing from the source is removed.
+// A nested key is a list of object keys, the missing objects on its path are created.
+func setMetaKeys(meta []byte, source string, keys [][]string) ([]byte, error) {
+	target := make(map[string]any)
+	if err := decodeJSONObject(meta, &target); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "the meta is not a json object, its keys can not be updated")
+	}
+	values := make(map[string]any)
+	if err := decodeJSONObject([]byte(source), &values); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "the meta of a masked update must be a json object")
+	}
+
+	for _, key := range keys {
+		last := key[len(key)-1]
+		value, found := lookupKey(values, key)
+		if !found {
+			if parent, ok := lookupKey(target, key[:len(key)-1]); ok {
+				if object, ok := parent.(map[string]any); ok {
+					delete(object, last)
+				}
+			}
+			continue
+		}
+
+		parent := target
+		for _, k := range key[:len(key)-1] {
+			child, ok := parent[k].(map[string]any)
+			if !ok {
+				child = make(map[string]any)
+				parent[k] = child
+			}
+			parent = child
+		}
+		parent[last] = value
+	}
+
+	return json.Marshal(target)
+}
+
+// lookupKey returns the value of the nested key in the object
+func lookupKey(object map[string]any, key []string) (any, bool) {
+	var value any = object
+	for _, k := range key {
+		current, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = current[k]; !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// decodeJSONObject decodes a json object keeping its numbers as they are
+func decodeJSONObject(data []byte, object *map[string]any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(object); err != nil {
+		return err
+	}
+	if *object == nil {
+		return fmt.Errorf("not a json object")
+	}
+
+	return nil
+}
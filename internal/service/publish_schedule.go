@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Masterminds/semver"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/store"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+)
+
+// NewPublishScheduleService creates a new PublishScheduleService.
+func NewPublishScheduleService(store store.Store) *PublishScheduleService {
+	return &PublishScheduleService{
+		store: store,
+	}
+}
+
+var _ v1.PublishScheduleServiceServer = (*PublishScheduleService)(nil)
+
+// PublishScheduleService manages the scheduled publishes, the schedules are run by the publish scheduler job.
+type PublishScheduleService struct {
+	store store.Store
+	v1.UnimplementedPublishScheduleServiceServer
+}
+
+var publishScheduleStatus = map[string]v1.PublishScheduleStatus{
+	model.PublishSchedulePending:   v1.PublishScheduleStatus_SCHEDULE_PENDING,
+	model.PublishScheduleRunning:   v1.PublishScheduleStatus_SCHEDULE_RUNNING,
+	model.PublishSchedulePublished: v1.PublishScheduleStatus_SCHEDULE_PUBLISHED,
+	model.PublishScheduleCancelled: v1.PublishScheduleStatus_SCHEDULE_CANCELLED,
+	model.PublishScheduleFailed:    v1.PublishScheduleStatus_SCHEDULE_FAILED,
+}
+
+// SchedulePublish schedules a publish of a document set at a future time.
+func (p *PublishScheduleService) SchedulePublish(ctx context.Context, request *v1.SchedulePublishRequest) (*v1.SchedulePublishResponse, error) {
+	projectID, err := uuid.Parse(request.GetProjectId())
+	if err != nil {
+		return nil, err
+	}
+
+	publishAt := request.GetPublishAt().AsTime()
+	if !publishAt.After(time.Now()) {
+		return nil, status.Error(codes.InvalidArgument, "publish_at must be in the future")
+	}
+
+	if request.Version != nil {
+		if _, err := semver.NewVersion(request.GetVersion()); err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid version: %v", err))
+		}
+	}
+
+	var docIDs []uuid.UUID
+	for _, id := range request.GetDocumentIds() {
+		docID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, err
+		}
+		docIDs = append(docIDs, docID)
+	}
+
+	// the scheduled documents must exist in the project
+	docs, err := p.store.ListDocumentsFromIDs(ctx, docIDs, "id", "project_id")
+	if err != nil {
+		return nil, err
+	}
+	projectIDs := make(map[string]string)
+	for _, doc := range docs {
+		projectIDs[doc.ID] = doc.ProjectID
+	}
+	for _, docID := range docIDs {
+		docProjectID, ok := projectIDs[docID.String()]
+		if !ok {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("document %s not found", docID))
+		}
+		if docProjectID != projectID.String() {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("document %s does not belong to project %s", docID, projectID))
+		}
+	}
+
+	documentIDs, err := json.Marshal(request.GetDocumentIds())
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := &model.PublishSchedule{
+		ID:             uuid.New().String(),
+		ProjectID:      projectID.String(),
+		RootDocumentID: request.GetRootDocumentId(),
+		DocumentIDs:    string(documentIDs),
+		Version:        request.GetVersion(),
+		Bump:           request.GetBump().String(),
+		Index:          request.GetIndex(),
+		Force:          request.GetForce(),
+		StrictLinks:    request.GetStrictLinks(),
+		PublishAt:      publishAt,
+		Status:         model.PublishSchedulePending,
+	}
+
+	err = p.store.CreatePublishSchedule(ctx, schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduleProto, err := publishScheduleProto(schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.SchedulePublishResponse{
+		Schedule: scheduleProto,
+	}, nil
+}
+
+// ListPublishSchedules lists the publish schedules of a project along with their audit records.
+func (p *PublishScheduleService) ListPublishSchedules(ctx context.Context, request *v1.ListPublishSchedulesRequest) (*v1.ListPublishSchedulesResponse, error) {
+	projectID, err := uuid.Parse(request.GetProjectId())
+	if err != nil {
+		return nil, err
+	}
+
+	var scheduleStatus string
+	if request.GetPendingOnly() {
+		scheduleStatus = model.PublishSchedulePending
+	}
+
+	var offset, limit int
+	if request.GetPerPage() > 0 {
+		limit = int(request.GetPerPage())
+		if request.GetPage() > 1 {
+			offset = int((request.GetPage() - 1) * request.GetPerPage())
+		}
+	}
+
+	schedules, total, err := p.store.ListPublishSchedules(ctx, projectID, scheduleStatus, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var schedulesProto []*v1.PublishSchedule
+	for _, schedule := range schedules {
+		scheduleProto, err := publishScheduleProto(schedule)
+		if err != nil {
+			return nil, err
+		}
+		schedulesProto = append(schedulesProto, scheduleProto)
+	}
+
+	return &v1.ListPublishSchedulesResponse{
+		Schedules: schedulesProto,
+		Total:     int32(total),
+	}, nil
+}
+
+// CancelPublishSchedule cancels a pending publish schedule.
+func (p *PublishScheduleService) CancelPublishSchedule(ctx context.Context, request *v1.CancelPublishScheduleRequest) (*v1.CancelPublishScheduleResponse, error) {
+	id, err := uuid.Parse(request.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	schedule, err := p.store.GetPublishSchedule(ctx, id)
+	if err != nil {
+		if errors.Is(err, store.ErrPublishScheduleNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, err
+	}
+
+	cancelled, err := p.store.UpdatePublishScheduleStatus(ctx, id, model.PublishSchedulePending, model.PublishScheduleCancelled)
+	if err != nil {
+		return nil, err
+	}
+	if !cancelled {
+		return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("only pending schedules can be cancelled, schedule is %s", schedule.Status))
+	}
+	schedule.Status = model.PublishScheduleCancelled
+
+	scheduleProto, err := publishScheduleProto(schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.CancelPublishScheduleResponse{
+		Schedule: scheduleProto,
+	}, nil
+}
+
+// publishScheduleProto converts a publish schedule model to proto
+func publishScheduleProto(schedule *model.PublishSchedule) (*v1.PublishSchedule, error) {
+	var documentIDs []string
+	err := json.Unmarshal([]byte(schedule.DocumentIDs), &documentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduleProto := &v1.PublishSchedule{
+		Id:             schedule.ID,
+		ProjectId:      schedule.ProjectID,
+		RootDocumentId: schedule.RootDocumentID,
+		DocumentIds:    documentIDs,
+		Bump:           v1.VersionBump(v1.VersionBump_value[schedule.Bump]),
+		Index:          schedule.Index,
+		Force:          schedule.Force,
+		StrictLinks:    schedule.StrictLinks,
+		PublishAt:      timestamppb.New(schedule.PublishAt),
+		Status:         publishScheduleStatus[schedule.Status],
+		Error:          schedule.Error,
+		CreatedAt:      timestamppb.New(schedule.CreatedAt),
+	}
+
+	if schedule.Version != "" {
+		scheduleProto.Version = &schedule.Version
+	}
+
+	if schedule.PublishedAt != nil {
+		scheduleProto.PublishedAt = timestamppb.New(*schedule.PublishedAt)
+	}
+
+	for _, audit := range schedule.Audits {
+		scheduleProto.Published = append(scheduleProto.Published, &v1.PublishedDocumentVersionId{
+			Id:          audit.DocumentID,
+			Version:     audit.Version,
+			PublishedAt: timestamppb.New(audit.CreatedAt),
+		})
+	}
+
+	return scheduleProto, nil
+}
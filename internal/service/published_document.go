@@ -3,14 +3,27 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/Masterminds/semver"
+	goset "github.com/deckarep/golang-set/v2"
 	v1 "github.com/emrgen/document/apis/v1"
 	"github.com/emrgen/document/internal/cache"
 	"github.com/emrgen/document/internal/compress"
+	"github.com/emrgen/document/internal/diff"
+	"github.com/emrgen/document/internal/export"
 	"github.com/emrgen/document/internal/model"
 	"github.com/emrgen/document/internal/store"
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -42,6 +55,9 @@ func (p *PublishedDocumentService) GetPublishedDocumentTreeIndex(ctx context.Con
 
 	index, err := p.store.GetDocumentTreeIndex(ctx, docID, version)
 	if err != nil {
+		if errors.Is(err, store.ErrDocumentTreeIndexNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
 		return nil, err
 	}
 
@@ -134,13 +150,20 @@ func (p *PublishedDocumentService) ListPublishedBacklinks(ctx context.Context, r
 		return nil, err
 	}
 
+	match := linkTypeFilter(request.GetTypes())
 	var backlinksProto []*v1.Link
 	for _, link := range backlinks {
+		if !match(link.Type) {
+			continue
+		}
 		backlinksProto = append(backlinksProto, &v1.Link{
 			SourceId:      link.SourceID,
 			SourceVersion: link.SourceVersion,
 			TargetId:      link.TargetID,
 			TargetVersion: link.TargetVersion,
+			Type:          link.Type,
+			Anchor:        link.Anchor,
+			Label:         link.Label,
 		})
 	}
 
@@ -156,215 +179,678 @@ func (p *PublishedDocumentService) GetPublishedDocument(ctx context.Context, req
 		return nil, err
 	}
 
+	mask, err := newReadMask(request.GetReadMask(), &v1.PublishedDocument{}, getPublishedDocumentFields)
+	if err != nil {
+		return nil, err
+	}
+	columns := mask.columns(publishedDocumentColumns, "version")
+
 	version := request.GetVersion()
-	var publishedDocument *model.PublishedDocument
+	latest := version == "latest" || version == ""
+	// the latest version is revalidated, a published version never changes
+	cacheControl := publishedCacheControl
+	if latest {
+		cacheControl = latestPublishedCacheControl
+	}
+
+	// an unchanged version is not loaded again
+	if ifNoneMatch := notModifiedHeader(ctx); ifNoneMatch != "" {
+		current := version
+		if latest {
+			latestMeta, err := p.store.GetLatestPublishedDocumentMeta(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			current = latestMeta.Version
+		}
+		if etag := publishedDocumentETag(current); etagMatches(ifNoneMatch, etag, true) {
+			setNotModified(ctx, etag, cacheControl)
+			return &v1.GetPublishedDocumentResponse{}, nil
+		}
+	}
 
-	if version == "latest" || version == "" {
+	var publishedDocument *model.PublishedDocument
+	if latest {
 		// get the latest published publishedDocument
-		doc, err := p.store.GetLatestPublishedDocument(ctx, id)
+		doc, err := p.store.GetLatestPublishedDocument(ctx, id, columns...)
 		if err != nil {
 			return nil, err
 		}
 		publishedDocument = doc.IntoPublishedDocument()
 	} else {
 		// get the published publishedDocument by version
-		doc, err := p.store.GetPublishedDocumentByVersion(ctx, id, version)
+		doc, err := p.store.GetPublishedDocumentByVersion(ctx, id, version, columns...)
 		if err != nil {
 			return nil, err
 		}
 		publishedDocument = doc
 	}
 
-	metaData, err := p.compress.Decode([]byte(publishedDocument.Meta))
+	document, err := maskedPublishedDocumentProto(p.compress, publishedDocument, mask)
 	if err != nil {
 		return nil, err
 	}
+	setCacheHeaders(ctx, publishedDocumentETag(publishedDocument.Version), cacheControl)
+	if mask.has("latest_version") {
+		latestDoc, err := p.store.GetLatestPublishedDocumentMeta(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		document.LatestVersion = &v1.PublishedDocumentVersion{
+			Version:   latestDoc.Version,
+			CreatedAt: timestamppb.New(latestDoc.UpdatedAt),
+		}
+	}
 
-	latestDoc, err := p.store.GetLatestPublishedDocumentMeta(ctx, id)
+	return &v1.GetPublishedDocumentResponse{
+		Document: document,
+	}, nil
+}
+
+// ListPublishedDocuments retrieves a list of published documents by project ID.
+func (p *PublishedDocumentService) ListPublishedDocuments(ctx context.Context, request *v1.ListPublishedDocumentsRequest) (*v1.ListPublishedDocumentsResponse, error) {
+	projectID, err := uuid.Parse(request.GetProjectId())
 	if err != nil {
 		return nil, err
 	}
 
-	linkData, err := p.compress.Decode([]byte(publishedDocument.Links))
+	// get full document when idVersions are provided
+	if len(request.GetIdVersions()) > 0 {
+		mask, err := newReadMask(request.GetReadMask(), &v1.PublishedDocument{}, listPublishedByIDFields)
+		if err != nil {
+			return nil, err
+		}
+
+		var idVersions []*model.IDVersion
+		for _, idVersion := range request.GetIdVersions() {
+			idVersions = append(idVersions, &model.IDVersion{
+				ID:      idVersion.GetId(),
+				Version: idVersion.GetVersion(),
+			})
+		}
+
+		docs, err := p.store.ListPublishedDocumentsByIdVersion(ctx, projectID, idVersions, mask.columns(publishedDocumentColumns)...)
+		if err != nil {
+			return nil, err
+		}
+
+		documents := make([]*v1.PublishedDocument, 0, len(docs))
+		for _, doc := range docs {
+			document, err := maskedPublishedDocumentProto(p.compress, doc, mask)
+			if err != nil {
+				return nil, err
+			}
+			documents = append(documents, document)
+		}
+
+		return &v1.ListPublishedDocumentsResponse{
+			Documents: documents,
+			Total:     int32(len(documents)),
+		}, nil
+	}
+
+	mask, err := newReadMask(request.GetReadMask(), &v1.PublishedDocument{}, listPublishedFields)
 	if err != nil {
 		return nil, err
 	}
-	links, err := parseLinks(string(linkData))
+	docs, err := p.store.ListLatestPublishedDocuments(ctx, projectID, mask.columns(publishedDocumentColumns)...)
 	if err != nil {
 		return nil, err
 	}
 
-	childrenData, err := p.compress.Decode([]byte(publishedDocument.Children))
+	documents := make([]*v1.PublishedDocument, 0, len(docs))
+	for _, doc := range docs {
+		document, err := maskedPublishedDocumentProto(p.compress, doc.IntoPublishedDocument(), mask)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+
+	return &v1.ListPublishedDocumentsResponse{
+		Documents: documents,
+	}, nil
+
+}
+
+// ListPublishedDocumentVersions retrieves a list of published document versions by ID.
+func (p *PublishedDocumentService) ListPublishedDocumentVersions(ctx context.Context, request *v1.ListPublishedDocumentVersionsRequest) (*v1.ListPublishedDocumentVersionsResponse, error) {
+	docID, err := uuid.Parse(request.GetId())
 	if err != nil {
 		return nil, err
 	}
-	children, err := parseChildren(string(childrenData))
+
+	metaList, err := p.store.ListPublishedDocumentVersions(ctx, docID)
 	if err != nil {
 		return nil, err
 	}
 
-	latestVersion := &v1.PublishedDocumentVersion{
-		Version:   latestDoc.Version,
-		CreatedAt: timestamppb.New(latestDoc.UpdatedAt),
+	var versions []*v1.PublishedDocumentVersion
+	for _, meta := range metaList {
+		versions = append(versions, &v1.PublishedDocumentVersion{
+			Version:   meta.Version,
+			CreatedAt: timestamppb.New(meta.CreatedAt),
+		})
+	}
+
+	req := &v1.ListPublishedDocumentVersionsResponse{
+		Id:       docID.String(),
+		Versions: versions,
 	}
-	document := &v1.PublishedDocument{
-		Id:            publishedDocument.ID,
-		Meta:          string(metaData),
-		Version:       publishedDocument.Version,
-		Content:       publishedDocument.Content,
-		Links:         links,
-		Children:      children,
-		LatestVersion: latestVersion,
+
+	// get the latest version if there are versions available
+	// this is useful for clients that want to get the latest version along with the versions list
+	if len(versions) > 0 {
+		latestMeta, err := p.store.GetLatestPublishedDocumentMeta(ctx, docID)
+		if err != nil {
+			return nil, err
+		}
+		req.LatestVersion = latestMeta.Version
 	}
 
-	return &v1.GetPublishedDocumentResponse{
-		Document: document,
-	}, nil
+	return req, nil
 }
 
-// ListPublishedDocuments retrieves a list of published documents by project ID.
-func (p *PublishedDocumentService) ListPublishedDocuments(ctx context.Context, request *v1.ListPublishedDocumentsRequest) (*v1.ListPublishedDocumentsResponse, error) {
-	projectID, err := uuid.Parse(request.GetProjectId())
+// GetRelease retrieves a release of a published document tree, optionally with the published member documents.
+func (p *PublishedDocumentService) GetRelease(ctx context.Context, request *v1.GetReleaseRequest) (*v1.GetReleaseResponse, error) {
+	rootID, err := uuid.Parse(request.GetRootDocumentId())
 	if err != nil {
 		return nil, err
 	}
 
-	// get full document when idVersions are provided
-	if len(request.GetIdVersions()) > 0 {
+	var release *model.Release
+	version := request.GetVersion()
+	if version == "latest" || version == "" {
+		release, err = p.store.GetLatestRelease(ctx, rootID)
+	} else {
+		// partial versions like 2.1 are resolved to 2.1.0
+		releaseVersion, parseErr := semver.NewVersion(version)
+		if parseErr != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid release version: %v", parseErr))
+		}
+		release, err = p.store.GetRelease(ctx, rootID, releaseVersion.String())
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrReleaseNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, err
+	}
+
+	res := &v1.GetReleaseResponse{
+		Release: releaseProto(release),
+	}
+
+	if request.GetIncludeDocuments() && len(release.Members) > 0 {
 		var idVersions []*model.IDVersion
-		for _, idVersion := range request.GetIdVersions() {
+		for _, member := range release.Members {
 			idVersions = append(idVersions, &model.IDVersion{
-				ID:      idVersion.GetId(),
-				Version: idVersion.GetVersion(),
+				ID:      member.DocumentID,
+				Version: member.Version,
 			})
 		}
 
-		docs, err := p.store.ListPublishedDocumentsByIdVersion(ctx, projectID, idVersions)
+		docs, err := p.store.ListPublishedDocumentsByIdVersion(ctx, uuid.MustParse(release.ProjectID), idVersions)
 		if err != nil {
 			return nil, err
 		}
 
-		var documents []*v1.PublishedDocument
 		for _, doc := range docs {
-			metaData, err := p.compress.Decode([]byte(doc.Meta))
+			document, err := publishedDocumentProto(p.compress, doc)
 			if err != nil {
 				return nil, err
 			}
+			res.Documents = append(res.Documents, document)
+		}
+	}
 
-			linksData, err := p.compress.Decode([]byte(doc.Links))
-			if err != nil {
-				return nil, err
-			}
-			childrenData, err := p.compress.Decode([]byte(doc.Children))
-			if err != nil {
-				return nil, err
-			}
+	return res, nil
+}
 
-			links, err := parseLinks(string(linksData))
-			if err != nil {
-				return nil, err
-			}
+// ListReleases lists the releases of a published document tree, newest first.
+func (p *PublishedDocumentService) ListReleases(ctx context.Context, request *v1.ListReleasesRequest) (*v1.ListReleasesResponse, error) {
+	rootID, err := uuid.Parse(request.GetRootDocumentId())
+	if err != nil {
+		return nil, err
+	}
 
-			children, err := parseChildren(string(childrenData))
-			if err != nil {
-				return nil, err
-			}
+	releases, err := p.store.ListReleases(ctx, rootID)
+	if err != nil {
+		return nil, err
+	}
 
-			content, err := p.compress.Decode([]byte(doc.Content))
+	var releasesProto []*v1.Release
+	for _, release := range releases {
+		releasesProto = append(releasesProto, releaseProto(release))
+	}
 
-			documents = append(documents, &v1.PublishedDocument{
-				Id:       doc.ID,
-				Meta:     string(metaData),
-				Links:    links,
-				Children: children,
-				Version:  doc.Version,
-				Content:  string(content),
-			})
-		}
+	return &v1.ListReleasesResponse{
+		Releases: releasesProto,
+		Total:    int32(len(releasesProto)),
+	}, nil
+}
+
+// GetPublishedChangelog reports the documents added, removed or modified between two versions of a published tree.
+func (p *PublishedDocumentService) GetPublishedChangelog(ctx context.Context, request *v1.GetPublishedChangelogRequest) (*v1.GetPublishedChangelogResponse, error) {
+	rootID, err := uuid.Parse(request.GetRootDocumentId())
+	if err != nil {
+		return nil, err
 	}
 
-	docs, err := p.store.ListLatestPublishedDocuments(ctx, projectID)
+	fromVersion, err := semver.NewVersion(request.GetFromVersion())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid from version: %v", err))
+	}
+	toVersion, err := semver.NewVersion(request.GetToVersion())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid to version: %v", err))
+	}
+
+	from, err := p.publishedTree(ctx, rootID, fromVersion.String())
+	if err != nil {
+		return nil, err
+	}
+	to, err := p.publishedTree(ctx, rootID, toVersion.String())
 	if err != nil {
 		return nil, err
 	}
 
-	var documents []*v1.PublishedDocument
-	for _, doc := range docs {
-		metaData, err := p.compress.Decode([]byte(doc.Meta))
+	ids := goset.NewSet[string]()
+	for id := range from {
+		ids.Add(id)
+	}
+	for id := range to {
+		ids.Add(id)
+	}
+	sortedIDs := ids.ToSlice()
+	sort.Strings(sortedIDs)
+
+	var changes []*v1.DocumentChange
+	for _, id := range sortedIDs {
+		fromDocVersion, inFrom := from[id]
+		toDocVersion, inTo := to[id]
+		if inFrom && inTo && fromDocVersion == toDocVersion {
+			continue
+		}
+
+		change, err := p.documentChange(ctx, uuid.MustParse(id), fromDocVersion, toDocVersion)
 		if err != nil {
 			return nil, err
 		}
+		changes = append(changes, change)
+	}
+
+	return &v1.GetPublishedChangelogResponse{
+		RootDocumentId: rootID.String(),
+		FromVersion:    fromVersion.String(),
+		ToVersion:      toVersion.String(),
+		Changes:        changes,
+	}, nil
+}
+
+// exportChunkSize is the size of the zip chunks sent by ExportPublishedSite
+const exportChunkSize = 32 * 1024
+
+// ExportPublishedSite streams the published tree of the root document as a zip of static files.
+// The tree index saved with the root document is used for the navigation, otherwise the published children are used.
+func (p *PublishedDocumentService) ExportPublishedSite(request *v1.ExportPublishedSiteRequest, server v1.PublishedDocumentService_ExportPublishedSiteServer) error {
+	ctx := server.Context()
+	rootID, err := uuid.Parse(request.GetRootDocumentId())
+	if err != nil {
+		return err
+	}
+
+	root, err := resolvePublishedChild(ctx, p.store, rootID.String(), request.GetVersion())
+	if err != nil {
+		return err
+	}
+	if root == nil {
+		return status.Error(codes.NotFound, fmt.Sprintf("document %s is not published with version %s", rootID, request.GetVersion()))
+	}
 
-		linksData, err := p.compress.Decode([]byte(doc.Links))
+	members, err := p.publishedTree(ctx, rootID, root.Version)
+	if status.Code(err) == codes.NotFound {
+		// the latest tree published without a release or a tree index is read from its children,
+		// an older version can not be as its current children have been published again since
+		latest, latestErr := p.store.GetLatestPublishedDocumentMeta(ctx, rootID)
+		if latestErr != nil {
+			return latestErr
+		}
+		if latest.Version == root.Version {
+			members, err = p.publishedChildrenTree(ctx, root)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(members))
+	for id := range members {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	site := &export.Site{}
+	docs := make(map[string]*v1.PublishedDocument)
+	for _, id := range ids {
+		doc, err := p.store.GetPublishedDocumentByVersion(ctx, uuid.MustParse(id), members[id])
 		if err != nil {
-			return nil, err
+			return err
 		}
-		childrenData, err := p.compress.Decode([]byte(doc.Children))
+		docProto, err := publishedDocumentProto(p.compress, doc)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		docs[id] = docProto
+
+		page := &export.Page{
+			ID:      doc.ID,
+			Version: doc.Version,
+			Title:   documentTitle(docProto.Meta),
+			Content: docProto.Content,
 		}
+		if id == rootID.String() {
+			site.Title = page.Title
+		}
+		site.Pages = append(site.Pages, page)
+	}
 
-		links, err := parseLinks(string(linksData))
+	index, err := p.store.GetDocumentTreeIndex(ctx, rootID, root.Version)
+	if err == nil {
+		site.Nav, err = export.ParseIndex(index.Content)
 		if err != nil {
-			return nil, err
+			logrus.Warnf("navigating the site of document %s version %s by its children, the tree index is not a navigation: %v", rootID, root.Version, err)
 		}
+	} else if !errors.Is(err, store.ErrDocumentTreeIndexNotFound) {
+		return err
+	}
+	if len(site.Nav) == 0 {
+		site.Nav = childrenNav(rootID.String(), docs, goset.NewSet[string]())
+	}
+
+	format := export.Markdown
+	if request.GetFormat() == v1.ExportFormat_EXPORT_HTML {
+		format = export.HTML
+	}
+
+	// the zip is sent while it is written, its size is not known up front so the ranges are not supported
+	name := fmt.Sprintf("%s@%s.zip", rootID, root.Version)
+	err = server.SendHeader(metadata.Pairs(
+		"content-disposition", fmt.Sprintf("attachment; filename=%s", name),
+		"last-modified", root.UpdatedAt.UTC().Format(time.RFC1123),
+	))
+	if err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	defer func() { _ = reader.Close() }() // stops the writing goroutine when the stream fails
+	go func() {
+		_ = writer.CloseWithError(site.WriteZip(writer, format))
+	}()
 
-		children, err := parseChildren(string(childrenData))
+	chunk := make([]byte, exportChunkSize)
+	for {
+		n, err := io.ReadFull(reader, chunk)
+		if n > 0 {
+			if err := server.Send(&httpbody.HttpBody{ContentType: "application/zip", Data: chunk[:n]}); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
 		if err != nil {
-			return nil, err
+			return err
 		}
+	}
+}
 
-		documents = append(documents, &v1.PublishedDocument{
-			Id:       doc.ID,
-			Meta:     string(metaData),
-			Links:    links,
-			Children: children,
-			Version:  doc.Version,
-		})
+// childrenNav builds the site navigation by following the children of the published documents
+func childrenNav(id string, docs map[string]*v1.PublishedDocument, visited goset.Set[string]) []*export.NavNode {
+	doc, ok := docs[id]
+	if !ok || visited.Contains(id) {
+		return nil
 	}
+	visited.Add(id)
 
-	return &v1.ListPublishedDocumentsResponse{
-		Documents: documents,
-	}, nil
+	node := &export.NavNode{ID: id}
+	for _, child := range doc.Children {
+		childID, _, err := parseIDVersion(child)
+		if err != nil {
+			continue
+		}
+		node.Children = append(node.Children, childrenNav(childID, docs, visited)...)
+	}
 
+	return []*export.NavNode{node}
 }
 
-// ListPublishedDocumentVersions retrieves a list of published document versions by ID.
-func (p *PublishedDocumentService) ListPublishedDocumentVersions(ctx context.Context, request *v1.ListPublishedDocumentVersionsRequest) (*v1.ListPublishedDocumentVersionsResponse, error) {
-	docID, err := uuid.Parse(request.GetId())
-	if err != nil {
+// publishedTree returns the documents of a published tree mapped to their published version.
+// The tree is read from the release of the root document version, or from the tree index published with it
+// for the versions published before the releases were recorded.
+func (p *PublishedDocumentService) publishedTree(ctx context.Context, rootID uuid.UUID, version string) (map[string]string, error) {
+	members := make(map[string]string)
+
+	release, err := p.store.GetRelease(ctx, rootID, version)
+	if err == nil {
+		for _, member := range release.Members {
+			members[member.DocumentID] = member.Version
+		}
+		return members, nil
+	}
+	if !errors.Is(err, store.ErrReleaseNotFound) {
 		return nil, err
 	}
 
-	metaList, err := p.store.ListPublishedDocumentVersions(ctx, docID)
+	index, err := p.store.GetDocumentTreeIndex(ctx, rootID, version)
+	if errors.Is(err, store.ErrDocumentTreeIndexNotFound) {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("document %s has no release or tree index with version %s", rootID, version))
+	}
 	if err != nil {
 		return nil, err
 	}
+	nav, err := export.ParseIndex(index.Content)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("tree index of document %s version %s is corrupted: %v", rootID, version, err))
+	}
+
+	members[rootID.String()] = version
+	var walk func(nodes []*export.NavNode) error
+	walk = func(nodes []*export.NavNode) error {
+		for _, node := range nodes {
+			id, nodeVersion, _ := strings.Cut(node.ID, "@")
+			// the nodes without a document only group their children
+			if docID, err := uuid.Parse(id); err == nil {
+				if _, ok := members[docID.String()]; !ok {
+					nodeVersion, err = p.publishedVersionAt(ctx, docID, nodeVersion, index.CreatedAt)
+					if err != nil {
+						return err
+					}
+					if nodeVersion != "" {
+						members[docID.String()] = nodeVersion
+					}
+				}
+			}
 
-	var versions []*v1.PublishedDocumentVersion
-	for _, meta := range metaList {
-		versions = append(versions, &v1.PublishedDocumentVersion{
-			Version:   meta.Version,
-			CreatedAt: timestamppb.New(meta.CreatedAt),
-		})
+			if err := walk(node.Children); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(nav); err != nil {
+		return nil, err
 	}
 
-	req := &v1.ListPublishedDocumentVersionsResponse{
-		Id:       docID.String(),
-		Versions: versions,
+	return members, nil
+}
+
+// publishedVersionAt returns the version of a tree index node, an unpinned node is the version that was the latest at the given time.
+// It returns an empty version if the document was not published then.
+func (p *PublishedDocumentService) publishedVersionAt(ctx context.Context, id uuid.UUID, version string, at time.Time) (string, error) {
+	switch version {
+	case model.CurrentDocumentVersion, "latest", "":
+	default:
+		return version, nil
 	}
 
-	// get the latest version if there are versions available
-	// this is useful for clients that want to get the latest version along with the versions list
-	if len(versions) > 0 {
-		latestMeta, err := p.store.GetLatestPublishedDocumentMeta(ctx, docID)
+	versions, err := p.store.ListPublishedDocumentVersions(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	// the versions are listed from the newest
+	for _, meta := range versions {
+		if !meta.CreatedAt.After(at) {
+			return meta.Version, nil
+		}
+	}
+
+	return "", nil
+}
+
+// publishedChildrenTree returns the documents reachable from the published children of the root document,
+// the current and latest children resolve to the latest published versions.
+func (p *PublishedDocumentService) publishedChildrenTree(ctx context.Context, root *model.PublishedDocumentMeta) (map[string]string, error) {
+	members := map[string]string{root.ID: root.Version}
+	queue := []string{root.Children}
+	for len(queue) > 0 {
+		children, err := decodeChildren(p.compress, queue[0])
 		if err != nil {
 			return nil, err
 		}
-		req.LatestVersion = latestMeta.Version
+		queue = queue[1:]
+
+		for _, child := range children {
+			childID, childVersion, err := parseIDVersion(child)
+			if err != nil {
+				return nil, ErrInvalidChildrenLinkFormat
+			}
+			if _, ok := members[childID]; ok {
+				continue
+			}
+
+			meta, err := resolvePublishedChild(ctx, p.store, childID, childVersion)
+			if err != nil {
+				return nil, err
+			}
+			if meta == nil {
+				continue
+			}
+
+			members[meta.ID] = meta.Version
+			queue = append(queue, meta.Children)
+		}
 	}
 
-	return req, nil
+	return members, nil
+}
+
+// documentChange summarizes the change of a document between two published versions,
+// an empty version means the document is not part of the tree at that version.
+func (p *PublishedDocumentService) documentChange(ctx context.Context, id uuid.UUID, fromVersion, toVersion string) (*v1.DocumentChange, error) {
+	change := &v1.DocumentChange{
+		DocumentId:  id.String(),
+		FromVersion: fromVersion,
+		ToVersion:   toVersion,
+	}
+
+	var fromDoc, toDoc *model.PublishedDocument
+	var err error
+	if fromVersion != "" {
+		fromDoc, err = p.store.GetPublishedDocumentByVersion(ctx, id, fromVersion)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if toVersion != "" {
+		toDoc, err = p.store.GetPublishedDocumentByVersion(ctx, id, toVersion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var fromContent, toContent string
+	if fromDoc != nil {
+		content, err := p.compress.Decode([]byte(fromDoc.Content))
+		if err != nil {
+			return nil, err
+		}
+		fromContent = string(content)
+	}
+	if toDoc != nil {
+		content, err := p.compress.Decode([]byte(toDoc.Content))
+		if err != nil {
+			return nil, err
+		}
+		toContent = string(content)
+	}
+
+	switch {
+	case fromDoc == nil:
+		change.Kind = v1.ChangeKind_CHANGE_ADDED
+	case toDoc == nil:
+		change.Kind = v1.ChangeKind_CHANGE_REMOVED
+	default:
+		change.Kind = v1.ChangeKind_CHANGE_MODIFIED
+		change.MetaChanged = fromDoc.Meta != toDoc.Meta
+		change.LinksChanged = fromDoc.Links != toDoc.Links
+		change.ChildrenChanged = fromDoc.Children != toDoc.Children
+	}
+
+	summary := diff.Lines(fromContent, toContent)
+	change.LinesAdded = int32(summary.Added)
+	change.LinesRemoved = int32(summary.Removed)
+
+	// the title is taken from the newest version of the document
+	titleDoc := toDoc
+	if titleDoc == nil {
+		titleDoc = fromDoc
+	}
+	meta, err := p.compress.Decode([]byte(titleDoc.Meta))
+	if err != nil {
+		return nil, err
+	}
+	change.Title = documentTitle(string(meta))
+
+	return change, nil
+}
+
+// documentTitle returns the title from the document meta
+func documentTitle(meta string) string {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(meta), &m); err != nil {
+		return ""
+	}
+
+	title, _ := m["title"].(string)
+	return title
+}
+
+// releaseProto converts a release model to proto
+func releaseProto(release *model.Release) *v1.Release {
+	releaseProto := &v1.Release{
+		Id:             release.ID,
+		ProjectId:      release.ProjectID,
+		RootDocumentId: release.RootDocumentID,
+		Version:        release.Version,
+		Name:           release.Name,
+		CreatedAt:      timestamppb.New(release.CreatedAt),
+	}
+
+	for _, member := range release.Members {
+		releaseProto.Members = append(releaseProto.Members, &v1.DocumentVersionId{
+			Id:      member.DocumentID,
+			Version: member.Version,
+		})
+	}
+
+	return releaseProto
+}
+
+// publishedDocumentProto decompresses a published document into proto
+func publishedDocumentProto(c compress.Compress, doc *model.PublishedDocument) (*v1.PublishedDocument, error) {
+	return maskedPublishedDocumentProto(c, doc, readMask{fields: goset.NewSet[string]("version", "meta", "content", "links", "children", "project_id")})
 }
 
 func getPublishedDocumentByVersion(ctx context.Context, cache *cache.Redis, id uuid.UUID, version string) (*v1.PublishedDocument, error) {
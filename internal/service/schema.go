@@ -0,0 +1,328 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/store"
+	"github.com/google/uuid"
+	"github.com/xeipuuv/gojsonschema"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jsonDocumentKind is the kind of the documents with json content
+const jsonDocumentKind = "json"
+
+// PutDocumentSchema creates or replaces the schemas of a document type, the schemas must compile and only use local $refs.
+func (d DocumentService) PutDocumentSchema(ctx context.Context, request *v1.PutDocumentSchemaRequest) (*v1.PutDocumentSchemaResponse, error) {
+	projectID, err := uuid.Parse(request.GetProjectId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, field := range []struct{ name, schema string }{
+		{"meta_schema", request.GetMetaSchema()},
+		{"content_schema", request.GetContentSchema()},
+	} {
+		if field.schema == "" {
+			continue
+		}
+		if err := checkSchemaRefs(field.schema); err != nil {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: field.name, Description: err.Error()})
+			continue
+		}
+		if _, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(field.schema)); err != nil {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: field.name, Description: err.Error()})
+		}
+	}
+	if len(violations) != 0 {
+		return nil, badRequest(fmt.Sprintf("invalid %s: %s", violations[0].Field, violations[0].Description), violations)
+	}
+
+	schema := &model.DocumentSchema{
+		ProjectID:     projectID.String(),
+		Type:          request.GetType(),
+		MetaSchema:    request.GetMetaSchema(),
+		ContentSchema: request.GetContentSchema(),
+	}
+	if err = d.store.SaveDocumentSchema(ctx, schema); err != nil {
+		return nil, err
+	}
+	// the created time of a replaced schema is the time it was first saved
+	schema, err = d.store.GetDocumentSchema(ctx, projectID, request.GetType())
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.PutDocumentSchemaResponse{Schema: documentSchemaProto(schema)}, nil
+}
+
+// GetDocumentSchema gets the schemas of a document type.
+func (d DocumentService) GetDocumentSchema(ctx context.Context, request *v1.GetDocumentSchemaRequest) (*v1.GetDocumentSchemaResponse, error) {
+	projectID, err := uuid.Parse(request.GetProjectId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	schema, err := d.store.GetDocumentSchema(ctx, projectID, request.GetType())
+	if errors.Is(err, store.ErrDocumentSchemaNotFound) {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("schema of type %s not found", request.GetType()))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.GetDocumentSchemaResponse{Schema: documentSchemaProto(schema)}, nil
+}
+
+// ListDocumentSchemas lists the schemas of the document types of a project.
+func (d DocumentService) ListDocumentSchemas(ctx context.Context, request *v1.ListDocumentSchemasRequest) (*v1.ListDocumentSchemasResponse, error) {
+	projectID, err := uuid.Parse(request.GetProjectId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	schemas, err := d.store.ListDocumentSchemas(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &v1.ListDocumentSchemasResponse{}
+	for _, schema := range schemas {
+		res.Schemas = append(res.Schemas, documentSchemaProto(schema))
+	}
+
+	return res, nil
+}
+
+// DeleteDocumentSchema deletes the schemas of a document type, the documents of the type are no longer validated.
+func (d DocumentService) DeleteDocumentSchema(ctx context.Context, request *v1.DeleteDocumentSchemaRequest) (*v1.DeleteDocumentSchemaResponse, error) {
+	projectID, err := uuid.Parse(request.GetProjectId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err = d.store.DeleteDocumentSchema(ctx, projectID, request.GetType())
+	if errors.Is(err, store.ErrDocumentSchemaNotFound) {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("schema of type %s not found", request.GetType()))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.DeleteDocumentSchemaResponse{}, nil
+}
+
+// validateDocument validates the meta and the content of the document against the schemas of its type.
+// The type is the "type" field of the meta, a document without a type or without a schema for its type is not validated,
+// except that json content must be valid json. The violations are returned as the BadRequest details of an InvalidArgument status.
+func (d DocumentService) validateDocument(ctx context.Context, tx store.Store, doc *model.Document, jsonContent bool) error {
+	meta, err := d.compress.Decode([]byte(doc.Meta))
+	if err != nil {
+		return err
+	}
+	content, err := d.compress.Decode([]byte(doc.Content))
+	if err != nil {
+		return err
+	}
+
+	var violations []*errdetails.BadRequest_FieldViolation
+	contentValid := true
+	if jsonContent && len(content) != 0 && !json.Valid(content) {
+		contentValid = false
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: "content", Description: "content is not valid json"})
+	}
+
+	var schema *model.DocumentSchema
+	if docType := documentType(meta); docType != "" {
+		projectID, err := uuid.Parse(doc.ProjectID)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		schema, err = tx.GetDocumentSchema(ctx, projectID, docType)
+		if err != nil && !errors.Is(err, store.ErrDocumentSchemaNotFound) {
+			return err
+		}
+	}
+	if schema != nil {
+		metaViolations, err := schemaViolations(schema, "meta", schema.MetaSchema, meta)
+		if err != nil {
+			return err
+		}
+		violations = append(violations, metaViolations...)
+		if contentValid {
+			contentViolations, err := schemaViolations(schema, "content", schema.ContentSchema, content)
+			if err != nil {
+				return err
+			}
+			violations = append(violations, contentViolations...)
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+
+	message := fmt.Sprintf("document %s is invalid, %s: %s", doc.ID, violations[0].Field, violations[0].Description)
+	if len(violations) > 1 {
+		message += fmt.Sprintf(" (and %d more)", len(violations)-1)
+	}
+	return badRequest(message, violations)
+}
+
+// schemaViolations validates the data against the schema, the field paths start with the field.
+// The schemas are checked when they are saved, so a schema that does not compile is an internal error.
+func schemaViolations(schema *model.DocumentSchema, field, schemaData string, data []byte) ([]*errdetails.BadRequest_FieldViolation, error) {
+	if schemaData == "" {
+		return nil, nil
+	}
+	if !json.Valid(data) {
+		return []*errdetails.BadRequest_FieldViolation{{Field: field, Description: field + " is not valid json"}}, nil
+	}
+
+	compiled, err := compileSchema(schema, field, schemaData)
+	if err != nil {
+		return nil, err
+	}
+	result, err := compiled.Validate(gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, resultErr := range result.Errors() {
+		path := field
+		if resultErr.Field() != gojsonschema.STRING_ROOT_SCHEMA_PROPERTY {
+			path += "." + resultErr.Field()
+		}
+		// a missing property is reported on its parent
+		if property, ok := resultErr.Details()["property"].(string); ok && resultErr.Type() == "required" {
+			path += "." + property
+		}
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: path, Description: resultErr.Description()})
+	}
+
+	return violations, nil
+}
+
+// compiledSchema is a compiled schema with the updated time of the schema it was compiled from
+type compiledSchema struct {
+	updatedAt time.Time
+	schema    *gojsonschema.Schema
+}
+
+// compiledSchemas caches the compiled schemas by project, type and field, a replaced schema is compiled again
+var compiledSchemas sync.Map
+
+// compileSchema returns the compiled schema of the field, the schema is compiled once per update
+func compileSchema(schema *model.DocumentSchema, field, schemaData string) (*gojsonschema.Schema, error) {
+	key := schema.ProjectID + "/" + schema.Type + "/" + field
+	if cached, ok := compiledSchemas.Load(key); ok && cached.(*compiledSchema).updatedAt.Equal(schema.UpdatedAt) {
+		return cached.(*compiledSchema).schema, nil
+	}
+
+	// a schema saved before the $refs were checked is not allowed to load a remote or file reference either
+	if err := checkSchemaRefs(schemaData); err != nil {
+		return nil, err
+	}
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schemaData))
+	if err != nil {
+		return nil, err
+	}
+	compiledSchemas.Store(key, &compiledSchema{updatedAt: schema.UpdatedAt, schema: compiled})
+
+	return compiled, nil
+}
+
+// checkSchemaRefs returns an error for a $ref outside the schema, a remote or file reference would be loaded by the server
+func checkSchemaRefs(schemaData string) error {
+	var schema interface{}
+	if err := json.Unmarshal([]byte(schemaData), &schema); err != nil {
+		return err
+	}
+
+	return checkRefs(schema)
+}
+
+// checkRefs checks the $refs of the schema value and of the values under it
+func checkRefs(value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if ref, ok := item.(string); ok && key == "$ref" && !strings.HasPrefix(ref, "#") {
+				return fmt.Errorf("$ref %s is not allowed, only the references inside the schema starting with # are", ref)
+			}
+			if err := checkRefs(item); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := checkRefs(item); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// documentType returns the "type" field of the meta, empty if the meta is not a json object with a string type
+func documentType(meta []byte) string {
+	var typed struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(meta, &typed); err != nil {
+		return ""
+	}
+
+	return typed.Type
+}
+
+// badRequest returns an InvalidArgument status with the field violations as details
+func badRequest(message string, violations []*errdetails.BadRequest_FieldViolation) error {
+	st, err := status.New(codes.InvalidArgument, message).WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return err
+	}
+
+	return st.Err()
+}
+
+// documentKind returns the stored kind of a document, the documents saved without a kind are text
+func documentKind(kind v1.DocumentKind) string {
+	if kind == v1.DocumentKind_DOC_JSON {
+		return jsonDocumentKind
+	}
+
+	return "text"
+}
+
+// documentKindProto returns the kind of a stored document
+func documentKindProto(kind string) v1.DocumentKind {
+	if kind == jsonDocumentKind {
+		return v1.DocumentKind_DOC_JSON
+	}
+
+	return v1.DocumentKind_DOC_TEXT
+}
+
+func documentSchemaProto(schema *model.DocumentSchema) *v1.DocumentSchema {
+	return &v1.DocumentSchema{
+		ProjectId:     schema.ProjectID,
+		Type:          schema.Type,
+		MetaSchema:    schema.MetaSchema,
+		ContentSchema: schema.ContentSchema,
+		CreatedAt:     timestamppb.New(schema.CreatedAt),
+		UpdatedAt:     timestamppb.New(schema.UpdatedAt),
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/search"
+	"github.com/sirupsen/logrus"
+	"strconv"
+)
+
+// SearchDocuments searches the content and meta of the draft and latest published documents.
+func (d DocumentService) SearchDocuments(ctx context.Context, request *v1.SearchDocumentsRequest) (*v1.SearchDocumentsResponse, error) {
+	query := &search.Query{
+		Text:      request.GetQuery(),
+		ProjectID: request.GetProjectId(),
+		Tags:      request.GetTags(),
+		Limit:     int(request.GetPerPage()),
+	}
+
+	switch request.GetKind() {
+	case v1.SearchKind_SEARCH_DRAFT:
+		query.Kinds = []search.Kind{search.Draft}
+	case v1.SearchKind_SEARCH_PUBLISHED:
+		query.Kinds = []search.Kind{search.Published}
+	}
+
+	// pages start from 1
+	if request.GetPage() > 1 && request.GetPerPage() > 0 {
+		query.Offset = int((request.GetPage() - 1) * request.GetPerPage())
+	}
+
+	result, err := d.index.Search(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var hits []*v1.SearchHit
+	for _, hit := range result.Hits {
+		kind := v1.SearchKind_SEARCH_DRAFT
+		if hit.Kind == search.Published {
+			kind = v1.SearchKind_SEARCH_PUBLISHED
+		}
+
+		hits = append(hits, &v1.SearchHit{
+			DocumentId:     hit.ID,
+			ProjectId:      hit.ProjectID,
+			Kind:           kind,
+			Version:        hit.Version,
+			Title:          hit.Title,
+			TitleHighlight: hit.TitleHighlight,
+			Snippet:        hit.Snippet,
+			Score:          hit.Score,
+		})
+	}
+
+	return &v1.SearchDocumentsResponse{
+		Hits:  hits,
+		Total: int32(result.Total),
+	}, nil
+}
+
+// indexDocument updates the draft document in the search index.
+// The index is derived from the store, a failure is logged and does not fail the request.
+func (d DocumentService) indexDocument(ctx context.Context, doc *model.Document) {
+	content, _, err := d.assembleParts(ctx, d.store, doc)
+	var searchDoc *search.Document
+	if err == nil {
+		searchDoc, err = d.searchDocument(doc.ID, doc.ProjectID, search.Draft, strconv.FormatInt(doc.Version, 10), doc.Meta, content)
+	}
+	if err == nil {
+		err = d.index.Index(ctx, searchDoc)
+	}
+	if err != nil {
+		logrus.Errorf("error indexing document %s: %v", doc.ID, err)
+	}
+}
+
+// indexPublishedDocuments replaces the published documents in the search index with their latest version
+func (d DocumentService) indexPublishedDocuments(ctx context.Context, docs map[string]*model.PublishedDocument) {
+	var searchDocs []*search.Document
+	for _, doc := range docs {
+		searchDoc, err := d.searchDocument(doc.ID, doc.ProjectID, search.Published, doc.Version, doc.Meta, doc.Content)
+		if err != nil {
+			logrus.Errorf("error indexing published document %s: %v", doc.ID, err)
+			continue
+		}
+		searchDocs = append(searchDocs, searchDoc)
+	}
+
+	if err := d.index.Index(ctx, searchDocs...); err != nil {
+		logrus.Errorf("error indexing published documents: %v", err)
+	}
+}
+
+// removeDocumentFromIndex removes the draft document from the search index, the published versions stay searchable
+func (d DocumentService) removeDocumentFromIndex(ctx context.Context, id string) {
+	if err := d.index.Delete(ctx, search.Draft, id); err != nil {
+		logrus.Errorf("error removing document %s from index: %v", id, err)
+	}
+}
+
+// searchDocument decompresses the meta and content of a document for the search index
+func (d DocumentService) searchDocument(id, projectID string, kind search.Kind, version, meta, content string) (*search.Document, error) {
+	metaData, err := d.compress.Decode([]byte(meta))
+	if err != nil {
+		return nil, err
+	}
+	contentData, err := d.compress.Decode([]byte(content))
+	if err != nil {
+		return nil, err
+	}
+
+	title, tags := search.ParseMeta(string(metaData))
+	return &search.Document{
+		ID:        id,
+		ProjectID: projectID,
+		Kind:      kind,
+		Version:   version,
+		Title:     title,
+		Meta:      string(metaData),
+		Content:   string(contentData),
+		Tags:      tags,
+	}, nil
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/compress"
+	"github.com/emrgen/document/internal/objectstore"
+	"github.com/emrgen/document/internal/search"
+	"github.com/emrgen/document/internal/store"
+	"github.com/emrgen/document/internal/tester"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDocumentService_SearchDocuments(t *testing.T) {
+	tester.RemoveDBFile()
+	tester.Setup()
+
+	index, err := search.NewSqlite(filepath.Join(t.TempDir(), "search.db"))
+	if err != nil && strings.Contains(err.Error(), "fts5") {
+		t.Skip("sqlite is built without fts5, run the tests with -tags sqlite_fts5")
+	}
+	assert.NoError(t, err)
+	defer index.Close()
+
+	client := NewDocumentService(compress.NewNop(), store.NewGormStore(tester.TestDB()), tester.Redis(), index, objectstore.NewMemoryObjectStore())
+
+	projectID := uuid.New().String()
+	docID := uuid.New().String()
+	_, err = client.CreateDocument(context.TODO(), &v1.CreateDocumentRequest{
+		ProjectId:  projectID,
+		DocumentId: &docID,
+		Meta:       `{"title": "Garden", "tags": ["outdoor"]}`,
+		Content:    "planting tomatoes",
+	})
+	assert.NoError(t, err)
+
+	res, err := client.SearchDocuments(context.TODO(), &v1.SearchDocumentsRequest{Query: "tomato", ProjectId: &projectID})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Hits, 1) {
+		assert.Equal(t, docID, res.Hits[0].DocumentId)
+		assert.Equal(t, v1.SearchKind_SEARCH_DRAFT, res.Hits[0].Kind)
+		assert.Contains(t, res.Hits[0].Snippet, "<mark>tomatoes</mark>")
+	}
+
+	// the published version is indexed separately from the draft
+	_, err = client.PublishDocuments(context.TODO(), &v1.PublishDocumentsRequest{DocumentIds: []string{docID}})
+	assert.NoError(t, err)
+
+	content := "planting potatoes"
+	_, err = client.UpdateDocument(context.TODO(), &v1.UpdateDocumentRequest{DocumentId: docID, Version: 1, Content: &content})
+	assert.NoError(t, err)
+
+	res, err = client.SearchDocuments(context.TODO(), &v1.SearchDocumentsRequest{Query: "tomato", Tags: []string{"outdoor"}})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Hits, 1) {
+		assert.Equal(t, v1.SearchKind_SEARCH_PUBLISHED, res.Hits[0].Kind)
+		assert.Equal(t, "0.0.1", res.Hits[0].Version)
+	}
+
+	res, err = client.SearchDocuments(context.TODO(), &v1.SearchDocumentsRequest{Query: "potato", Kind: v1.SearchKind_SEARCH_DRAFT})
+	assert.NoError(t, err)
+	assert.Len(t, res.Hits, 1)
+
+	_, err = client.DeleteDocument(context.TODO(), &v1.DeleteDocumentRequest{Id: docID})
+	assert.NoError(t, err)
+
+	res, err = client.SearchDocuments(context.TODO(), &v1.SearchDocumentsRequest{Query: "planting"})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Hits, 1) {
+		assert.Equal(t, v1.SearchKind_SEARCH_PUBLISHED, res.Hits[0].Kind)
+	}
+}
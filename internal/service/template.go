@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	goset "github.com/deckarep/golang-set/v2"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/store"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// placeholderPattern matches the {{name}} placeholders of a template, spaces around the name are allowed
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([a-zA-Z_][a-zA-Z0-9_.-]*)\s*\}\}`)
+
+// DuplicateDocument copies the current version of a document in its project with a new id.
+// A deep copy also copies the documents under it, a shallow copy keeps the children of the original.
+func (d DocumentService) DuplicateDocument(ctx context.Context, request *v1.DuplicateDocumentRequest) (*v1.DuplicateDocumentResponse, error) {
+	docID, err := uuid.Parse(request.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var copied *copiedDocuments
+	err = d.store.Transaction(ctx, func(tx store.Store) error {
+		doc, err := tx.GetDocument(ctx, docID)
+		if err != nil {
+			return err
+		}
+
+		copied, err = d.copyDocuments(ctx, tx, []string{doc.ID}, uuid.MustParse(doc.ProjectID), request.ParentId, request.GetDeep(), nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.indexCopies(ctx, copied)
+
+	return &v1.DuplicateDocumentResponse{
+		Document:  copiedDocument(copied),
+		CopiedIds: copied.ids,
+	}, nil
+}
+
+// InstantiateTemplate creates a document from a template with the placeholders of the meta and content filled.
+// The created documents are not templates, a placeholder without a variable fails the request.
+func (d DocumentService) InstantiateTemplate(ctx context.Context, request *v1.InstantiateTemplateRequest) (*v1.InstantiateTemplateResponse, error) {
+	templateID, err := uuid.Parse(request.GetTemplateId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var copied *copiedDocuments
+	err = d.store.Transaction(ctx, func(tx store.Store) error {
+		template, err := tx.GetDocument(ctx, templateID)
+		if err != nil {
+			return err
+		}
+		if !template.Template {
+			return status.Error(codes.FailedPrecondition, fmt.Sprintf("document %s is not a template", template.ID))
+		}
+
+		projectID, err := uuid.Parse(template.ProjectID)
+		if request.ProjectId != nil {
+			projectID, err = uuid.Parse(request.GetProjectId())
+		}
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		missing := goset.NewSet[string]()
+		fill := func(doc *model.Document) error {
+			meta, err := d.fillPlaceholders(doc.Meta, request.GetVariables(), missing)
+			if err != nil {
+				return err
+			}
+			content, err := d.fillPlaceholders(doc.Content, request.GetVariables(), missing)
+			if err != nil {
+				return err
+			}
+			doc.Meta = meta
+			doc.Content = content
+			doc.Template = false
+
+			// without the children the new document does not list the children of the template
+			if !request.GetWithChildren() {
+				doc.Children, err = encodeChildren(d.compress, []string{})
+			}
+			return err
+		}
+
+		copied, err = d.copyDocuments(ctx, tx, []string{template.ID}, projectID, request.ParentId, request.GetWithChildren(), fill)
+		if err != nil {
+			return err
+		}
+
+		if missing.Cardinality() > 0 {
+			names := missing.ToSlice()
+			sort.Strings(names)
+			return status.Error(codes.InvalidArgument, fmt.Sprintf("missing template variables: %s", strings.Join(names, ", ")))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.indexCopies(ctx, copied)
+
+	return &v1.InstantiateTemplateResponse{
+		Document:   copiedDocument(copied),
+		CreatedIds: copied.ids,
+	}, nil
+}
+
+// fillPlaceholders replaces the placeholders of the compressed text with the variables and collects the missing ones.
+// The values are escaped as json strings when the text is json, so a placeholder inside a json string stays valid.
+func (d DocumentService) fillPlaceholders(data string, variables map[string]string, missing goset.Set[string]) (string, error) {
+	text, err := d.compress.Decode([]byte(data))
+	if err != nil {
+		return "", err
+	}
+
+	escape := json.Valid(text)
+	filled := placeholderPattern.ReplaceAllStringFunc(string(text), func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		value, ok := variables[name]
+		if !ok {
+			missing.Add(name)
+			return placeholder
+		}
+		if escape {
+			quoted, _ := json.Marshal(value)
+			return string(quoted[1 : len(quoted)-1])
+		}
+		return value
+	})
+
+	encoded, err := d.compress.Encode([]byte(filled))
+	if err != nil {
+		return "", err
+	}
+
+	return string(encoded), nil
+}
+
+// copiedDocument returns the first root copy
+func copiedDocument(copied *copiedDocuments) *v1.Document {
+	rootID := copied.roots[0].ID
+	for _, doc := range copied.created {
+		if doc.ID == rootID {
+			return &v1.Document{
+				Id:        doc.ID,
+				ProjectId: doc.ProjectID,
+				Version:   doc.Version,
+				Template:  doc.Template,
+				CreatedAt: timestamppb.New(doc.CreatedAt),
+				UpdatedAt: timestamppb.New(doc.UpdatedAt),
+			}
+		}
+	}
+
+	return nil
+}
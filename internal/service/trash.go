@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/model"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ListDeletedDocuments lists the soft deleted documents of a project, the last deleted first.
+func (d DocumentService) ListDeletedDocuments(ctx context.Context, request *v1.ListDeletedDocumentsRequest) (*v1.ListDeletedDocumentsResponse, error) {
+	projectID, err := uuid.Parse(request.GetProjectId())
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := d.store.ListDeletedDocuments(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []*v1.Document
+	for _, doc := range docs {
+		document, err := d.trashedDocument(doc)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+
+	return &v1.ListDeletedDocumentsResponse{
+		Documents: documents,
+		Total:     int32(len(documents)),
+	}, nil
+}
+
+// UndeleteDocument restores a soft deleted document.
+// The links and children removed from other documents by a detach delete are not restored.
+func (d DocumentService) UndeleteDocument(ctx context.Context, request *v1.UndeleteDocumentRequest) (*v1.UndeleteDocumentResponse, error) {
+	id, err := uuid.Parse(request.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = d.store.UndeleteDocument(ctx, id); err != nil {
+		return nil, err
+	}
+
+	doc, err := d.store.GetDocument(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	d.indexDocument(ctx, doc)
+
+	document, err := d.trashedDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.UndeleteDocumentResponse{
+		Document: document,
+	}, nil
+}
+
+// trashedDocument converts a soft deleted document without its content
+func (d DocumentService) trashedDocument(doc *model.Document) (*v1.Document, error) {
+	meta, err := d.compress.Decode([]byte(doc.Meta))
+	if err != nil {
+		return nil, err
+	}
+
+	document := &v1.Document{
+		Id:        doc.ID,
+		ProjectId: doc.ProjectID,
+		Meta:      string(meta),
+		Version:   doc.Version,
+		CreatedAt: timestamppb.New(doc.CreatedAt),
+		UpdatedAt: timestamppb.New(doc.UpdatedAt),
+	}
+	if doc.DeletedAt.Valid {
+		document.DeletedAt = timestamppb.New(doc.DeletedAt.Time)
+	}
+
+	return document, nil
+}
@@ -0,0 +1,480 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	goset "github.com/deckarep/golang-set/v2"
+	v1 "github.com/emrgen/document/apis/v1"
+	"github.com/emrgen/document/internal/model"
+	"github.com/emrgen/document/internal/store"
+	"github.com/google/uuid"
+	"sort"
+)
+
+// ValidateProject scans the documents of a project for broken links, missing children,
+// cycles in the children graph and orphan documents no root reaches.
+// With apply_fixes the automatic fixes are applied with one update per document.
+func (d DocumentService) ValidateProject(ctx context.Context, request *v1.ValidateProjectRequest) (*v1.ValidateProjectResponse, error) {
+	projectID, err := uuid.Parse(request.GetProjectId())
+	if err != nil {
+		return nil, err
+	}
+
+	docs, _, err := d.store.ListDocuments(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].ID < docs[j].ID
+	})
+
+	projectDocs := goset.NewSet[string]()
+	links := make(map[string]map[string]string)
+	children := make(map[string][]string)
+	referenced := goset.NewSet[string]()
+	for _, doc := range docs {
+		projectDocs.Add(doc.ID)
+
+		docLinks, err := decodeLinks(d.compress, doc.Links)
+		if err != nil {
+			return nil, err
+		}
+		docChildren, err := decodeChildren(d.compress, doc.Children)
+		if err != nil {
+			return nil, err
+		}
+		links[doc.ID] = docLinks
+		children[doc.ID] = docChildren
+
+		for ref := range docLinks {
+			if id, _, err := parseIDVersion(ref); err == nil {
+				referenced.Add(id)
+			}
+		}
+		for _, ref := range docChildren {
+			if id, _, err := parseIDVersion(ref); err == nil {
+				referenced.Add(id)
+			}
+		}
+	}
+
+	states, err := d.documentStates(ctx, projectDocs, referenced)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uuid.UUID
+	for _, id := range referenced.ToSlice() {
+		if docID, err := uuid.Parse(id); err == nil {
+			ids = append(ids, docID)
+		}
+	}
+	publishedVersions := goset.NewSet[string]()
+	publishedIDs := goset.NewSet[string]()
+	if len(ids) > 0 {
+		idVersions, err := d.store.ListPublishedDocumentIDVersions(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, idVersion := range idVersions {
+			publishedVersions.Add(idVersion.ID + "@" + idVersion.Version)
+			publishedIDs.Add(idVersion.ID)
+		}
+	}
+
+	var findings []*v1.Finding
+	for _, doc := range docs {
+		refs := make([]string, 0, len(links[doc.ID]))
+		for ref := range links[doc.ID] {
+			refs = append(refs, ref)
+		}
+		sort.Strings(refs)
+
+		for _, ref := range refs {
+			id, version, err := parseIDVersion(ref)
+			if err != nil {
+				continue
+			}
+			if finding := linkFinding(doc.ID, ref, id, version, states[id], publishedVersions, publishedIDs); finding != nil {
+				findings = append(findings, finding)
+			}
+		}
+
+		for _, ref := range children[doc.ID] {
+			id, _, err := parseIDVersion(ref)
+			if err != nil {
+				continue
+			}
+
+			switch states[id] {
+			case documentDeleted:
+				findings = append(findings, newFinding(v1.FindingKind_FINDING_MISSING_CHILD, v1.Severity_SEVERITY_WARNING, doc.ID, ref,
+					fmt.Sprintf("child %s is deleted", id), v1.FixAction_FIX_DROP_CHILD))
+			case documentErased:
+				findings = append(findings, newFinding(v1.FindingKind_FINDING_MISSING_CHILD, v1.Severity_SEVERITY_ERROR, doc.ID, ref,
+					fmt.Sprintf("child %s does not exist", id), v1.FixAction_FIX_DROP_CHILD))
+			}
+		}
+	}
+
+	findings = append(findings, childrenCycles(docs, children, projectDocs)...)
+
+	orphans, err := d.orphanFindings(ctx, request, docs, children, projectDocs)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, orphans...)
+
+	res := &v1.ValidateProjectResponse{Findings: findings}
+	if request.GetApplyFixes() {
+		fixed, err := d.applyFixes(ctx, findings)
+		if err != nil {
+			return nil, err
+		}
+		res.Fixed = int32(fixed)
+	}
+
+	return res, nil
+}
+
+type documentState int
+
+const (
+	documentErased documentState = iota
+	documentExists
+	documentDeleted
+)
+
+// documentStates returns whether each referenced document exists, is soft deleted or is erased
+func (d DocumentService) documentStates(ctx context.Context, projectDocs, referenced goset.Set[string]) (map[string]documentState, error) {
+	states := make(map[string]documentState)
+	var others []uuid.UUID
+	for _, id := range referenced.ToSlice() {
+		if projectDocs.Contains(id) {
+			states[id] = documentExists
+			continue
+		}
+		if docID, err := uuid.Parse(id); err == nil {
+			others = append(others, docID)
+		}
+	}
+	if len(others) == 0 {
+		return states, nil
+	}
+
+	// documents in other projects
+	existing, err := d.store.ListDocumentsFromIDs(ctx, others)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range existing {
+		states[doc.ID] = documentExists
+	}
+
+	deleted, err := d.store.ListDeletedDocumentIDs(ctx, others)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range deleted {
+		states[id] = documentDeleted
+	}
+
+	return states, nil
+}
+
+// linkFinding checks a link of the document, links to the current version need the target document,
+// links to a published version need the version to be published.
+func linkFinding(docID, ref, targetID, version string, state documentState, publishedVersions, publishedIDs goset.Set[string]) *v1.Finding {
+	if state == documentErased {
+		return newFinding(v1.FindingKind_FINDING_LINK_TO_ERASED, v1.Severity_SEVERITY_ERROR, docID, ref,
+			fmt.Sprintf("linked document %s does not exist", targetID), v1.FixAction_FIX_DROP_LINK)
+	}
+
+	switch version {
+	case model.CurrentDocumentVersion:
+		if state == documentDeleted {
+			return newFinding(v1.FindingKind_FINDING_LINK_TO_DELETED, v1.Severity_SEVERITY_WARNING, docID, ref,
+				fmt.Sprintf("linked document %s is deleted", targetID), v1.FixAction_FIX_DROP_LINK)
+		}
+	case "latest":
+		if !publishedIDs.Contains(targetID) {
+			return newFinding(v1.FindingKind_FINDING_LINK_TO_MISSING_VERSION, v1.Severity_SEVERITY_ERROR, docID, ref,
+				fmt.Sprintf("linked document %s is not published", targetID), v1.FixAction_FIX_DROP_LINK)
+		}
+	default:
+		if !publishedVersions.Contains(ref) {
+			return newFinding(v1.FindingKind_FINDING_LINK_TO_MISSING_VERSION, v1.Severity_SEVERITY_ERROR, docID, ref,
+				fmt.Sprintf("linked version %s of document %s is not published", version, targetID), v1.FixAction_FIX_DROP_LINK)
+		}
+	}
+
+	return nil
+}
+
+// childrenCycles finds the children that close a cycle with a depth first search over the project documents
+func childrenCycles(docs []*model.Document, children map[string][]string, projectDocs goset.Set[string]) []*v1.Finding {
+	const (
+		white = iota
+		grey
+		black
+	)
+
+	var findings []*v1.Finding
+	colors := make(map[string]int)
+	var visit func(id string)
+	visit = func(id string) {
+		colors[id] = grey
+		for _, ref := range children[id] {
+			childID, _, err := parseIDVersion(ref)
+			if err != nil || !projectDocs.Contains(childID) {
+				continue
+			}
+
+			switch colors[childID] {
+			case grey:
+				findings = append(findings, newFinding(v1.FindingKind_FINDING_CHILDREN_CYCLE, v1.Severity_SEVERITY_ERROR, id, ref,
+					fmt.Sprintf("child %s is an ancestor of %s", childID, id), v1.FixAction_FIX_DROP_CHILD))
+			case white:
+				visit(childID)
+			}
+		}
+		colors[id] = black
+	}
+
+	for _, doc := range docs {
+		if colors[doc.ID] == white {
+			visit(doc.ID)
+		}
+	}
+
+	return findings
+}
+
+// orphanFindings reports the documents not reachable from any root through the children.
+// Without a known root the documents without a parent are the roots, so only the detached cycles are orphans.
+// One orphan per detached subtree or cycle gets a fix that moves it under the orphan parent, the others move along with it.
+func (d DocumentService) orphanFindings(ctx context.Context, request *v1.ValidateProjectRequest, docs []*model.Document, children map[string][]string, projectDocs goset.Set[string]) ([]*v1.Finding, error) {
+	roots := goset.NewSet[string]()
+	for _, id := range request.GetRootIds() {
+		roots.Add(id)
+	}
+	if roots.Cardinality() == 0 {
+		projectID := uuid.MustParse(request.GetProjectId())
+		releaseRoots, err := d.store.ListReleaseRootIDs(ctx, projectID)
+		if err != nil {
+			return nil, err
+		}
+		roots.Append(releaseRoots...)
+
+		var ids []uuid.UUID
+		for _, doc := range docs {
+			ids = append(ids, uuid.MustParse(doc.ID))
+		}
+		if len(ids) > 0 {
+			indexRoots, err := d.store.ListDocumentTreeIndexIDs(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			roots.Append(indexRoots...)
+		}
+	}
+	roots = roots.Intersect(projectDocs)
+	if roots.Cardinality() == 0 {
+		roots = projectDocs.Difference(childIDs(projectDocs, children))
+	}
+	// when the project is only cycles the first document is the root
+	if roots.Cardinality() == 0 && len(docs) > 0 {
+		roots.Add(docs[0].ID)
+	}
+	if roots.Cardinality() == 0 {
+		return nil, nil
+	}
+
+	sortedRoots := roots.ToSlice()
+	sort.Strings(sortedRoots)
+	parentID := request.GetOrphanParentId()
+	if parentID == "" {
+		parentID = sortedRoots[0]
+	}
+
+	reached := reachableChildren(sortedRoots, children, projectDocs)
+	orphans := projectDocs.Difference(reached)
+
+	// the orphans without an orphan parent are fixed first, a cycle no fixed orphan reaches is fixed by its first document
+	orphanChildren := childIDs(orphans, children)
+	var fixOrder []string
+	for _, doc := range docs {
+		if orphans.Contains(doc.ID) && !orphanChildren.Contains(doc.ID) {
+			fixOrder = append(fixOrder, doc.ID)
+		}
+	}
+	for _, doc := range docs {
+		if orphans.Contains(doc.ID) && orphanChildren.Contains(doc.ID) {
+			fixOrder = append(fixOrder, doc.ID)
+		}
+	}
+	fixed := goset.NewSet[string]()
+	moved := goset.NewSet[string]()
+	for _, id := range fixOrder {
+		if moved.Contains(id) {
+			continue
+		}
+		fixed.Add(id)
+		moved = moved.Union(reachableChildren([]string{id}, children, orphans))
+	}
+
+	var findings []*v1.Finding
+	for _, doc := range docs {
+		if !orphans.Contains(doc.ID) {
+			continue
+		}
+
+		finding := &v1.Finding{
+			Kind:       v1.FindingKind_FINDING_ORPHAN,
+			Severity:   v1.Severity_SEVERITY_WARNING,
+			DocumentId: doc.ID,
+			Message:    fmt.Sprintf("document %s is not reachable from any root", doc.ID),
+		}
+		if fixed.Contains(doc.ID) {
+			finding.Fix = &v1.Fix{
+				Action:     v1.FixAction_FIX_ADD_CHILD,
+				DocumentId: parentID,
+				Reference:  doc.ID + "@" + model.CurrentDocumentVersion,
+			}
+		}
+		findings = append(findings, finding)
+	}
+
+	return findings, nil
+}
+
+// childIDs returns the documents of the set that are a child of another document of the set
+func childIDs(ids goset.Set[string], children map[string][]string) goset.Set[string] {
+	childSet := goset.NewSet[string]()
+	for _, id := range ids.ToSlice() {
+		for _, ref := range children[id] {
+			if childID, _, err := parseIDVersion(ref); err == nil && ids.Contains(childID) {
+				childSet.Add(childID)
+			}
+		}
+	}
+
+	return childSet
+}
+
+// reachableChildren returns the documents of the set reached from the start documents through the children, the start included
+func reachableChildren(start []string, children map[string][]string, ids goset.Set[string]) goset.Set[string] {
+	reached := goset.NewSet[string](start...)
+	queue := append([]string(nil), start...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, ref := range children[id] {
+			childID, _, err := parseIDVersion(ref)
+			if err != nil || !ids.Contains(childID) || reached.Contains(childID) {
+				continue
+			}
+			reached.Add(childID)
+			queue = append(queue, childID)
+		}
+	}
+
+	return reached
+}
+
+// applyFixes updates each fixed document once with all of its fixes in a single transaction and marks the findings as fixed.
+func (d DocumentService) applyFixes(ctx context.Context, findings []*v1.Finding) (int, error) {
+	fixes := make(map[string][]*v1.Finding)
+	var docIDs []string
+	for _, finding := range findings {
+		if finding.Fix == nil {
+			continue
+		}
+		if _, ok := fixes[finding.Fix.DocumentId]; !ok {
+			docIDs = append(docIDs, finding.Fix.DocumentId)
+		}
+		fixes[finding.Fix.DocumentId] = append(fixes[finding.Fix.DocumentId], finding)
+	}
+
+	var updated []*model.Document
+	err := d.store.Transaction(ctx, func(tx store.Store) error {
+		for _, docID := range docIDs {
+			doc, err := tx.GetDocument(ctx, uuid.MustParse(docID))
+			if err != nil {
+				return err
+			}
+			links, err := decodeLinks(d.compress, doc.Links)
+			if err != nil {
+				return err
+			}
+			children, err := decodeChildren(d.compress, doc.Children)
+			if err != nil {
+				return err
+			}
+
+			var droppedLinks []*model.Link
+			for _, finding := range fixes[docID] {
+				switch finding.Fix.Action {
+				case v1.FixAction_FIX_DROP_LINK:
+					delete(links, finding.Fix.Reference)
+					if targetID, targetVersion, err := parseIDVersion(finding.Fix.Reference); err == nil {
+						droppedLinks = append(droppedLinks, &model.Link{SourceID: docID, TargetID: targetID, TargetVersion: targetVersion})
+					}
+				case v1.FixAction_FIX_DROP_CHILD:
+					children = removeReference(children, finding.Fix.Reference)
+				case v1.FixAction_FIX_ADD_CHILD:
+					children = append(removeReference(children, finding.Fix.Reference), finding.Fix.Reference)
+				}
+			}
+
+			if err = d.writeReferences(ctx, tx, doc, links, children, droppedLinks); err != nil {
+				return err
+			}
+
+			updated = append(updated, doc)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	fixed := 0
+	for _, doc := range updated {
+		d.indexDocument(ctx, doc)
+		for _, finding := range fixes[doc.ID] {
+			finding.Fixed = true
+			fixed++
+		}
+	}
+
+	return fixed, nil
+}
+
+func newFinding(kind v1.FindingKind, severity v1.Severity, docID, ref, message string, action v1.FixAction) *v1.Finding {
+	return &v1.Finding{
+		Kind:       kind,
+		Severity:   severity,
+		DocumentId: docID,
+		Reference:  ref,
+		Message:    message,
+		Fix: &v1.Fix{
+			Action:     action,
+			DocumentId: docID,
+			Reference:  ref,
+		},
+	}
+}
+
+// removeReference removes all the occurrences of the reference
+func removeReference(refs []string, ref string) []string {
+	kept := make([]string, 0, len(refs))
+	for _, r := range refs {
+		if r != ref {
+			kept = append(kept, r)
+		}
+	}
+
+	return kept
+}
@@ -31,7 +31,27 @@ func (g *GormStore) SaveDocumentTreeIndex(ctx context.Context, index *model.Docu
 func (g *GormStore) GetDocumentTreeIndex(ctx context.Context, docID uuid.UUID, version string) (*model.DocumentIndex, error) {
 	var index model.DocumentIndex
 	err := g.db.Where("document_id = ? AND version = ?", docID, version).First(&index).Error
-	return &index, err
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDocumentTreeIndexNotFound
+		}
+		return nil, err
+	}
+
+	return &index, nil
+}
+
+// ListDocumentTreeIndexIDs returns the ids of the documents with a saved tree index
+func (g *GormStore) ListDocumentTreeIndexIDs(ctx context.Context, docIDs []uuid.UUID) ([]string, error) {
+	var ids []string
+	err := g.db.Model(&model.DocumentIndex{}).Distinct("document_id").Where("document_id in (?)", docIDs).Pluck("document_id", &ids).Error
+	return ids, err
+}
+
+// EraseDocumentTreeIndexes erases the tree indexes of all the versions of the document
+func (g *GormStore) EraseDocumentTreeIndexes(ctx context.Context, docID uuid.UUID) (int64, error) {
+	res := g.db.Unscoped().Where("document_id = ?", docID.String()).Delete(&model.DocumentIndex{})
+	return res.RowsAffected, res.Error
 }
 
 func (g *GormStore) ListPublishedDocumentProjectIDs(ctx context.Context, docIDs []*model.IDVersion) (map[uuid.UUID]uuid.UUID, error) {
@@ -73,14 +93,14 @@ func (g *GormStore) ListDocumentProjectIDs(ctx context.Context, docIDs []uuid.UU
 	return projects, nil
 }
 
-func (g *GormStore) ListPublishedDocumentsByIdVersion(ctx context.Context, projectID uuid.UUID, idVersions []*model.IDVersion) ([]*model.PublishedDocument, error) {
+func (g *GormStore) ListPublishedDocumentsByIdVersion(ctx context.Context, projectID uuid.UUID, idVersions []*model.IDVersion, columns ...string) ([]*model.PublishedDocument, error) {
 	var docs []*model.PublishedDocument
 	var query [][]interface{}
 	for _, idVersion := range idVersions {
 		query = append(query, []interface{}{projectID.String(), idVersion.ID, idVersion.Version})
 	}
 
-	err := g.db.Where("(project_id, id, version) IN ?", query).Find(&docs).Error
+	err := g.selectColumns(columns).Where("(project_id, id, version) IN ?", query).Find(&docs).Error
 
 	return docs, err
 }
@@ -100,6 +120,12 @@ func (g *GormStore) DeleteDocumentBackups(ctx context.Context, backups map[strin
 	return groupErr
 }
 
+// EraseDocumentBackups erases all the backup versions of the document
+func (g *GormStore) EraseDocumentBackups(ctx context.Context, docID uuid.UUID) (int64, error) {
+	res := g.db.Unscoped().Where("id = ?", docID.String()).Delete(&model.DocumentBackup{})
+	return res.RowsAffected, res.Error
+}
+
 func (g *GormStore) GetDocumentByUpdatedTime(start time.Time, end time.Time) ([]*model.DocumentBackup, error) {
 	var docs []*model.DocumentBackup
 	err := g.db.Where("updated_at > ? AND updated_at < ?", start, end).Order("updated_at asc").Find(&docs).Error
@@ -134,7 +160,7 @@ func (g *GormStore) ExistsDocuments(ctx context.Context, docs []*model.Document)
 		return false, err
 	}
 
-	return count > 0, nil
+	return count == int64(len(query)), nil
 }
 
 // ExistsPublishedDocuments checks if a published document exists by ID@Version. It returns true if all documents exist otherwise false.
@@ -150,20 +176,20 @@ func (g *GormStore) ExistsPublishedDocuments(ctx context.Context, docs []*model.
 		return false, err
 	}
 
-	return count > 0, nil
+	return count == int64(len(query)), nil
 }
 
 func (g *GormStore) CreatePublishedLinks(ctx context.Context, links []*model.PublishedLink) error {
 	return g.db.Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "source_id"}, {Name: "target_id"}, {Name: "target_version"}, {Name: "source_version"}},
-		DoUpdates: clause.AssignmentColumns([]string{"source_id", "target_id", "target_version", "source_version"}),
+		DoUpdates: clause.AssignmentColumns([]string{"source_id", "target_id", "target_version", "source_version", "type", "anchor", "label"}),
 	}).Create(links).Error
 }
 
 func (g *GormStore) CreateBacklinks(ctx context.Context, links []*model.Link) error {
 	return g.db.Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "source_id"}, {Name: "target_id"}, {Name: "target_version"}},
-		DoUpdates: clause.AssignmentColumns([]string{"source_id", "target_id", "target_version"}),
+		DoUpdates: clause.AssignmentColumns([]string{"source_id", "target_id", "target_version", "type", "anchor", "label"}),
 	}).Create(links).Error
 }
 
@@ -184,6 +210,265 @@ func (g *GormStore) ListBacklinks(ctx context.Context, targetID uuid.UUID) ([]*m
 	return backlinks, err
 }
 
+// DeleteLinks deletes the links from the source document
+func (g *GormStore) DeleteLinks(ctx context.Context, sourceID uuid.UUID) (int64, error) {
+	res := g.db.Where("source_id = ?", sourceID.String()).Delete(&model.Link{})
+	return res.RowsAffected, res.Error
+}
+
+// ListPendingLinks returns the links whose target backlink count is not updated yet
+func (g *GormStore) ListPendingLinks(ctx context.Context, limit int) ([]*model.Link, error) {
+	var links []*model.Link
+	err := g.db.Where("pending = ?", true).Limit(limit).Find(&links).Error
+	return links, err
+}
+
+// ClearPendingLinks marks the links as counted in the target backlink count
+func (g *GormStore) ClearPendingLinks(ctx context.Context, links []*model.Link) error {
+	for _, link := range links {
+		err := g.db.Model(link).Where("source_id = ? AND target_id = ? AND target_version = ?", link.SourceID, link.TargetID, link.TargetVersion).
+			UpdateColumn("pending", false).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateBacklinkCounts sets the backlink count of the documents to the number of links pointing to them, any version
+func (g *GormStore) UpdateBacklinkCounts(ctx context.Context, targetIDs []string) error {
+	return g.db.Unscoped().Model(&model.Document{}).
+		Where("id in (?)", targetIDs).
+		UpdateColumn("backlink_count", gorm.Expr("(SELECT count(*) FROM links WHERE links.target_id = documents.id)")).Error
+}
+
+// UpdateStaleBacklinkCounts recounts the documents with more backlinks counted than links pointing to them,
+// deleted links leave no pending row behind so the counts are decreased by comparing with the links table.
+func (g *GormStore) UpdateStaleBacklinkCounts(ctx context.Context) (int64, error) {
+	count := "(SELECT count(*) FROM links WHERE links.target_id = documents.id)"
+	res := g.db.Unscoped().Model(&model.Document{}).
+		Where("backlink_count > "+count).
+		UpdateColumn("backlink_count", gorm.Expr(count))
+	return res.RowsAffected, res.Error
+}
+
+// ListDeletedDocuments returns the soft deleted documents of the project, the last deleted first
+func (g *GormStore) ListDeletedDocuments(ctx context.Context, projectID uuid.UUID) ([]*model.Document, error) {
+	var docs []*model.Document
+	err := g.db.Unscoped().Where("project_id = ? AND deleted_at IS NOT NULL", projectID.String()).Order("deleted_at desc").Find(&docs).Error
+	return docs, err
+}
+
+// ListDocumentsDeletedBefore returns the soft deleted documents of all the projects deleted before the given time
+func (g *GormStore) ListDocumentsDeletedBefore(ctx context.Context, before time.Time) ([]*model.Document, error) {
+	var docs []*model.Document
+	err := g.db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Find(&docs).Error
+	return docs, err
+}
+
+// UndeleteDocument clears the deleted_at of a soft deleted document
+func (g *GormStore) UndeleteDocument(ctx context.Context, id uuid.UUID) error {
+	res := g.db.Unscoped().Model(&model.Document{}).Where("id = ? AND deleted_at IS NOT NULL", id.String()).Update("deleted_at", nil)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+// ListDeletedDocumentIDs returns the ids of the soft deleted documents, erased documents are not returned
+func (g *GormStore) ListDeletedDocumentIDs(ctx context.Context, ids []uuid.UUID) ([]string, error) {
+	var deleted []string
+	err := g.db.Unscoped().Model(&model.Document{}).Where("id in (?) AND deleted_at IS NOT NULL", ids).Pluck("id", &deleted).Error
+	return deleted, err
+}
+
+// UpdateDocumentChildren saves the children and the new version of the document, false if the version changed meanwhile
+func (g *GormStore) UpdateDocumentChildren(ctx context.Context, doc *model.Document, version int64) (bool, error) {
+	res := g.db.Model(&model.Document{}).Where("id = ? AND version = ?", doc.ID, version).Updates(map[string]interface{}{
+		"children":   doc.Children,
+		"child_keys": doc.ChildKeys,
+		"version":    doc.Version,
+	})
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	return res.RowsAffected == 1, nil
+}
+
+// UpdateDocumentVersion saves the new version of the document, false if the version changed meanwhile
+func (g *GormStore) UpdateDocumentVersion(ctx context.Context, doc *model.Document, version int64) (bool, error) {
+	res := g.db.Model(&model.Document{}).Where("id = ? AND version = ?", doc.ID, version).Update("version", doc.Version)
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	return res.RowsAffected == 1, nil
+}
+
+// MoveDocuments changes the project of the documents, the published versions and the releases rooted at the documents
+func (g *GormStore) MoveDocuments(ctx context.Context, ids []uuid.UUID, projectID uuid.UUID) error {
+	err := g.db.Model(&model.Document{}).Where("id in (?)", ids).Update("project_id", projectID.String()).Error
+	if err != nil {
+		return err
+	}
+
+	published := []interface{}{
+		&model.PublishedDocument{},
+		&model.PublishedDocumentMeta{},
+		&model.LatestPublishedDocument{},
+		&model.LatestPublishedDocumentMeta{},
+	}
+	for _, table := range published {
+		err = g.db.Unscoped().Model(table).Where("id in (?)", ids).Update("project_id", projectID.String()).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return g.db.Unscoped().Model(&model.Release{}).Where("root_document_id in (?)", ids).Update("project_id", projectID.String()).Error
+}
+
+// ListLinks returns the links from the source document
+func (g *GormStore) ListLinks(ctx context.Context, sourceID uuid.UUID) ([]*model.Link, error) {
+	var links []*model.Link
+	err := g.db.Where("source_id = ?", sourceID).Find(&links).Error
+	return links, err
+}
+
+// ListPublishedDocumentIDVersions returns the id@version pairs of the published documents with the given ids
+func (g *GormStore) ListPublishedDocumentIDVersions(ctx context.Context, ids []uuid.UUID) ([]*model.IDVersion, error) {
+	var idVersions []*model.IDVersion
+	err := g.db.Model(&model.PublishedDocumentMeta{}).
+		Select("id", "version").
+		Where("id in (?) AND unpublished = ?", ids, false).
+		Find(&idVersions).Error
+	return idVersions, err
+}
+
+// ReplaceDocumentChildEdges deletes the child edges of the parent and creates the given edges
+func (g *GormStore) ReplaceDocumentChildEdges(ctx context.Context, parentID uuid.UUID, edges []*model.DocumentChild) error {
+	if err := g.DeleteDocumentChildEdges(ctx, parentID); err != nil {
+		return err
+	}
+	if len(edges) == 0 {
+		return nil
+	}
+
+	return g.db.Create(edges).Error
+}
+
+// DeleteDocumentChildEdges deletes the child edges of the parent
+func (g *GormStore) DeleteDocumentChildEdges(ctx context.Context, parentID uuid.UUID) error {
+	return g.db.Where("parent_id = ?", parentID.String()).Delete(&model.DocumentChild{}).Error
+}
+
+// ListDocumentParentEdges returns the edges to the child from the parents that are not deleted
+func (g *GormStore) ListDocumentParentEdges(ctx context.Context, childID uuid.UUID) ([]*model.DocumentChild, error) {
+	var edges []*model.DocumentChild
+	err := g.db.Joins("JOIN documents ON documents.id = document_children.parent_id AND documents.deleted_at IS NULL").
+		Where("document_children.child_id = ?", childID.String()).
+		Order("document_children.parent_id").
+		Find(&edges).Error
+	return edges, err
+}
+
+func (g *GormStore) ListDocumentParentEdgesFromIDs(ctx context.Context, childIDs []uuid.UUID) ([]*model.DocumentChild, error) {
+	ids := make([]string, 0, len(childIDs))
+	for _, id := range childIDs {
+		ids = append(ids, id.String())
+	}
+
+	var edges []*model.DocumentChild
+	err := g.db.Joins("JOIN documents ON documents.id = document_children.parent_id AND documents.deleted_at IS NULL").
+		Where("document_children.child_id IN ?", ids).
+		Order("document_children.parent_id").
+		Find(&edges).Error
+	return edges, err
+}
+
+// CountDocumentChildEdges returns the number of child edges
+func (g *GormStore) CountDocumentChildEdges(ctx context.Context) (int64, error) {
+	var count int64
+	err := g.db.Model(&model.DocumentChild{}).Count(&count).Error
+	return count, err
+}
+
+// ListDocumentsAfter returns a page of the documents ordered by id
+func (g *GormStore) ListDocumentsAfter(ctx context.Context, afterID string, limit int) ([]*model.Document, error) {
+	var docs []*model.Document
+	err := g.db.Where("id > ?", afterID).Order("id").Limit(limit).Find(&docs).Error
+	return docs, err
+}
+
+// GetDocumentPart returns a part of the document
+func (g *GormStore) GetDocumentPart(ctx context.Context, docID uuid.UUID, partID string) (*model.DocumentPart, error) {
+	var part model.DocumentPart
+	err := g.db.Where("document_id = ? AND part_id = ?", docID.String(), partID).First(&part).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDocumentPartNotFound
+		}
+		return nil, err
+	}
+
+	return &part, nil
+}
+
+// ListDocumentParts returns the parts of the document, the order is kept by the document
+func (g *GormStore) ListDocumentParts(ctx context.Context, docID uuid.UUID) ([]*model.DocumentPart, error) {
+	var parts []*model.DocumentPart
+	err := g.db.Where("document_id = ?", docID.String()).Find(&parts).Error
+	return parts, err
+}
+
+func (g *GormStore) CreateDocumentPart(ctx context.Context, part *model.DocumentPart) error {
+	return g.db.Create(part).Error
+}
+
+// UpdateDocumentPart saves the content and the new version of the part, false if the version changed meanwhile
+func (g *GormStore) UpdateDocumentPart(ctx context.Context, part *model.DocumentPart, version int64) (bool, error) {
+	res := g.db.Model(&model.DocumentPart{}).Where("document_id = ? AND part_id = ? AND version = ?", part.DocumentID, part.PartID, version).Updates(map[string]interface{}{
+		"content": part.Content,
+		"version": part.Version,
+	})
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	return res.RowsAffected == 1, nil
+}
+
+func (g *GormStore) DeleteDocumentPart(ctx context.Context, docID uuid.UUID, partID string) error {
+	return g.db.Where("document_id = ? AND part_id = ?", docID.String(), partID).Delete(&model.DocumentPart{}).Error
+}
+
+func (g *GormStore) DeleteDocumentParts(ctx context.Context, docID uuid.UUID) error {
+	return g.db.Where("document_id = ?", docID.String()).Delete(&model.DocumentPart{}).Error
+}
+
+// UpdateDocumentPartIDs saves the part ids of the document, the updated time changes but the version does not
+func (g *GormStore) UpdateDocumentPartIDs(ctx context.Context, docID uuid.UUID, parts string) error {
+	return g.db.Model(&model.Document{}).Where("id = ?", docID.String()).Update("parts", parts).Error
+}
+
+// CreatePublishedChildEdges creates the child edges of a published document version, existing edges are kept
+func (g *GormStore) CreatePublishedChildEdges(ctx context.Context, edges []*model.PublishedDocumentChild) error {
+	return g.db.Clauses(clause.OnConflict{DoNothing: true}).Create(edges).Error
+}
+
+// ListPublishedParentEdges returns the edges to the child from the published document versions
+func (g *GormStore) ListPublishedParentEdges(ctx context.Context, childID uuid.UUID) ([]*model.PublishedDocumentChild, error) {
+	var edges []*model.PublishedDocumentChild
+	err := g.db.Where("child_id = ?", childID.String()).Order("parent_id, parent_version").Find(&edges).Error
+	return edges, err
+}
+
 // ListPublishedBacklinks returns a list of backlinks for a published document
 func (g *GormStore) ListPublishedBacklinks(ctx context.Context, targetID uuid.UUID, targetVersion string) ([]*model.PublishedLink, error) {
 	var backlinks []*model.PublishedLink
@@ -191,14 +476,21 @@ func (g *GormStore) ListPublishedBacklinks(ctx context.Context, targetID uuid.UU
 	return backlinks, err
 }
 
-func (g *GormStore) ListDocumentsFromIDs(ctx context.Context, ids []uuid.UUID) ([]*model.Document, error) {
+// ListPublishedLinks returns the links from the source document version
+func (g *GormStore) ListPublishedLinks(ctx context.Context, sourceID uuid.UUID, sourceVersion string) ([]*model.PublishedLink, error) {
+	var links []*model.PublishedLink
+	err := g.db.Where("source_id = ? AND source_version = ?", sourceID, sourceVersion).Find(&links).Error
+	return links, err
+}
+
+func (g *GormStore) ListDocumentsFromIDs(ctx context.Context, ids []uuid.UUID, columns ...string) ([]*model.Document, error) {
 	var docs []*model.Document
-	err := g.db.Where("id in (?)", ids).Find(&docs).Error
+	err := g.selectColumns(columns).Where("id in (?)", ids).Find(&docs).Error
 	return docs, err
 }
 
 func (g *GormStore) EraseDocument(ctx context.Context, id uuid.UUID) error {
-	return g.db.WithContext(ctx).Unscoped().Delete(&model.Document{}, id.String()).Error
+	return g.db.WithContext(ctx).Unscoped().Where("id = ?", id.String()).Delete(&model.Document{}).Error
 }
 
 func (g *GormStore) ListPublishedDocumentVersions(ctx context.Context, id uuid.UUID) ([]*model.PublishedDocumentMeta, error) {
@@ -222,9 +514,9 @@ func (g *GormStore) GetLatestPublishedDocumentMeta(ctx context.Context, id uuid.
 }
 
 // GetLatestPublishedDocument retrieves the latest published document
-func (g *GormStore) GetLatestPublishedDocument(ctx context.Context, id uuid.UUID) (*model.LatestPublishedDocument, error) {
+func (g *GormStore) GetLatestPublishedDocument(ctx context.Context, id uuid.UUID, columns ...string) (*model.LatestPublishedDocument, error) {
 	var doc model.LatestPublishedDocument
-	err := g.db.Where("id = ?", id.String()).First(&doc).Error
+	err := g.selectColumns(columns).Where("id = ?", id.String()).First(&doc).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, ErrLatestPublishedDocumentNotFound
@@ -300,19 +592,19 @@ func (g *GormStore) PublishDocument(ctx context.Context, doc *model.PublishedDoc
 }
 
 // GetPublishedDocumentByVersion creates a new project
-func (g *GormStore) GetPublishedDocumentByVersion(ctx context.Context, id uuid.UUID, version string) (*model.PublishedDocument, error) {
+func (g *GormStore) GetPublishedDocumentByVersion(ctx context.Context, id uuid.UUID, version string, columns ...string) (*model.PublishedDocument, error) {
 	var doc model.PublishedDocument
-	err := g.db.Where("id = ? AND version = ?", id, version).First(&doc).Error
+	err := g.selectColumns(columns).Where("id = ? AND version = ?", id, version).First(&doc).Error
 	if err != nil {
 		return nil, err
 	}
 	return &doc, err
 }
 
-// ListLatestPublishedDocuments returns a list of published documents for a project
-func (g *GormStore) ListLatestPublishedDocuments(ctx context.Context, projectID uuid.UUID) ([]*model.LatestPublishedDocumentMeta, error) {
-	var docs []*model.LatestPublishedDocumentMeta
-	err := g.db.Where("project_id = ?", projectID).Find(&docs).Error
+// ListLatestPublishedDocuments returns the latest published documents of a project
+func (g *GormStore) ListLatestPublishedDocuments(ctx context.Context, projectID uuid.UUID, columns ...string) ([]*model.LatestPublishedDocument, error) {
+	var docs []*model.LatestPublishedDocument
+	err := g.selectColumns(columns).Where("project_id = ?", projectID).Find(&docs).Error
 	return docs, err
 }
 
@@ -351,17 +643,24 @@ func (g *GormStore) CreateDocument(ctx context.Context, doc *model.Document) err
 	return g.db.Create(doc).Error
 }
 
-func (g *GormStore) GetDocument(ctx context.Context, id uuid.UUID) (*model.Document, error) {
+func (g *GormStore) GetDocument(ctx context.Context, id uuid.UUID, columns ...string) (*model.Document, error) {
 	var doc model.Document
-	err := g.db.Where("id = ?", id).First(&doc).Error
+	err := g.selectColumns(columns).Where("id = ?", id).First(&doc).Error
+	return &doc, err
+}
+
+// GetDocumentIncludingDeleted returns the document even if it is soft deleted
+func (g *GormStore) GetDocumentIncludingDeleted(ctx context.Context, id uuid.UUID) (*model.Document, error) {
+	var doc model.Document
+	err := g.db.Unscoped().Where("id = ?", id).First(&doc).Error
 	return &doc, err
 }
 
 // ListDocuments returns a list of documents for a project
-func (g *GormStore) ListDocuments(ctx context.Context, projectID uuid.UUID) ([]*model.Document, int64, error) {
+func (g *GormStore) ListDocuments(ctx context.Context, projectID uuid.UUID, columns ...string) ([]*model.Document, int64, error) {
 	var docs []*model.Document
 	// TODO: it should be paginated
-	err := g.db.Where("project_id = ?", projectID).Find(&docs).Error
+	err := g.selectColumns(columns).Where("project_id = ?", projectID).Find(&docs).Error
 	if err != nil {
 		return nil, 0, err
 	}
@@ -375,18 +674,323 @@ func (g *GormStore) ListDocuments(ctx context.Context, projectID uuid.UUID) ([]*
 	return docs, total, nil
 }
 
+// UpdateDocument saves the document, the backlink count is owned by the backlink reconciler and is not overwritten
 func (g *GormStore) UpdateDocument(ctx context.Context, doc *model.Document) error {
-	return g.db.Save(doc).Error
+	return g.db.Omit("BacklinkCount").Save(doc).Error
 }
 
 func (g *GormStore) DeleteDocument(ctx context.Context, id uuid.UUID) error {
 	return g.db.Where("id = ?", id).Delete(&model.Document{}).Error
 }
 
+func (g *GormStore) CreatePublishSchedule(ctx context.Context, schedule *model.PublishSchedule) error {
+	return g.db.Create(schedule).Error
+}
+
+func (g *GormStore) GetPublishSchedule(ctx context.Context, id uuid.UUID) (*model.PublishSchedule, error) {
+	var schedule model.PublishSchedule
+	err := g.db.Preload("Audits").Where("id = ?", id.String()).First(&schedule).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPublishScheduleNotFound
+		}
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+// ListPublishSchedules returns a page of the publish schedules of a project ordered by the publish time, a zero limit returns all of them
+func (g *GormStore) ListPublishSchedules(ctx context.Context, projectID uuid.UUID, status string, offset, limit int) ([]*model.PublishSchedule, int64, error) {
+	query := g.db.Model(&model.PublishSchedule{}).Where("project_id = ?", projectID.String())
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	err := query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var schedules []*model.PublishSchedule
+	page := query.Preload("Audits").Order("publish_at asc").Order("id")
+	if limit > 0 {
+		page = page.Offset(offset).Limit(limit)
+	}
+	err = page.Find(&schedules).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return schedules, total, nil
+}
+
+// ListDuePublishSchedules returns the pending schedules that should be published by now
+func (g *GormStore) ListDuePublishSchedules(ctx context.Context, before time.Time) ([]*model.PublishSchedule, error) {
+	var schedules []*model.PublishSchedule
+	err := g.db.Where("status = ? AND publish_at <= ?", model.PublishSchedulePending, before).Order("publish_at asc").Find(&schedules).Error
+	return schedules, err
+}
+
+// UpdatePublishScheduleStatus is a compare and swap on the schedule status,
+// it makes sure a schedule is run or cancelled only once.
+func (g *GormStore) UpdatePublishScheduleStatus(ctx context.Context, id uuid.UUID, from, to string) (bool, error) {
+	res := g.db.Model(&model.PublishSchedule{}).Where("id = ? AND status = ?", id.String(), from).Update("status", to)
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	return res.RowsAffected == 1, nil
+}
+
+// ClaimPublishSchedule is a compare and swap from pending to running, the claim time lets a lost run be found
+func (g *GormStore) ClaimPublishSchedule(ctx context.Context, id uuid.UUID, claimedAt time.Time) (bool, error) {
+	res := g.db.Model(&model.PublishSchedule{}).Where("id = ? AND status = ?", id.String(), model.PublishSchedulePending).Updates(map[string]interface{}{
+		"status":     model.PublishScheduleRunning,
+		"claimed_at": claimedAt,
+	})
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	return res.RowsAffected == 1, nil
+}
+
+func (g *GormStore) FailStalePublishSchedules(ctx context.Context, claimedBefore time.Time, reason string) (int64, error) {
+	res := g.db.Model(&model.PublishSchedule{}).Where("status = ? AND claimed_at < ?", model.PublishScheduleRunning, claimedBefore).Updates(map[string]interface{}{
+		"status": model.PublishScheduleFailed,
+		"error":  reason,
+	})
+
+	return res.RowsAffected, res.Error
+}
+
+func (g *GormStore) FinishPublishSchedule(ctx context.Context, schedule *model.PublishSchedule, audits []*model.PublishAudit) (bool, error) {
+	finished := false
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.PublishSchedule{}).Where("id = ? AND status = ? AND claimed_at = ?", schedule.ID, model.PublishScheduleRunning, schedule.ClaimedAt).Updates(map[string]interface{}{
+			"status":       schedule.Status,
+			"error":        schedule.Error,
+			"published_at": schedule.PublishedAt,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		// the lease of the run is over and the schedule was failed, or it was claimed again
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		finished = true
+
+		if len(audits) == 0 {
+			return nil
+		}
+
+		return tx.Create(audits).Error
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return finished, nil
+}
+
+func (g *GormStore) CreateRelease(ctx context.Context, release *model.Release) error {
+	return g.db.Create(release).Error
+}
+
+func (g *GormStore) GetRelease(ctx context.Context, rootID uuid.UUID, version string) (*model.Release, error) {
+	var release model.Release
+	err := g.db.Preload("Members").Where("root_document_id = ? AND version = ?", rootID.String(), version).First(&release).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReleaseNotFound
+		}
+		return nil, err
+	}
+
+	return &release, nil
+}
+
+func (g *GormStore) GetLatestRelease(ctx context.Context, rootID uuid.UUID) (*model.Release, error) {
+	var release model.Release
+	err := g.db.Preload("Members").Where("root_document_id = ?", rootID.String()).Order("created_at desc").First(&release).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReleaseNotFound
+		}
+		return nil, err
+	}
+
+	return &release, nil
+}
+
+func (g *GormStore) ListReleases(ctx context.Context, rootID uuid.UUID) ([]*model.Release, error) {
+	var releases []*model.Release
+	err := g.db.Preload("Members").Where("root_document_id = ?", rootID.String()).Order("created_at desc").Find(&releases).Error
+	return releases, err
+}
+
+// ListReleaseRootIDs returns the distinct root documents of the releases in a project
+func (g *GormStore) ListReleaseRootIDs(ctx context.Context, projectID uuid.UUID) ([]string, error) {
+	var ids []string
+	err := g.db.Model(&model.Release{}).Distinct("root_document_id").Where("project_id = ?", projectID.String()).Pluck("root_document_id", &ids).Error
+	return ids, err
+}
+
+func (g *GormStore) CreateAttachment(ctx context.Context, attachment *model.Attachment) error {
+	return g.db.Create(attachment).Error
+}
+
+func (g *GormStore) GetAttachment(ctx context.Context, docID, id uuid.UUID) (*model.Attachment, error) {
+	var attachment model.Attachment
+	err := g.db.Where("id = ? AND document_id = ?", id.String(), docID.String()).First(&attachment).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, err
+	}
+
+	return &attachment, nil
+}
+
+// ListAttachments returns the attachments added at or before the version and not removed by the version
+func (g *GormStore) ListAttachments(ctx context.Context, docID uuid.UUID, version int64) ([]*model.Attachment, error) {
+	var attachments []*model.Attachment
+	err := g.db.Where("document_id = ? AND added_version <= ? AND (removed_version = 0 OR removed_version > ?)", docID.String(), version, version).
+		Order("created_at, id").Find(&attachments).Error
+	return attachments, err
+}
+
+func (g *GormStore) RemoveAttachment(ctx context.Context, id uuid.UUID, version int64) error {
+	return g.db.Model(&model.Attachment{}).Where("id = ?", id.String()).Update("removed_version", version).Error
+}
+
+func (g *GormStore) CreatePublishedAttachments(ctx context.Context, attachments []*model.PublishedAttachment) error {
+	return g.db.Clauses(clause.OnConflict{DoNothing: true}).Create(attachments).Error
+}
+
+func (g *GormStore) ListPublishedAttachments(ctx context.Context, docID uuid.UUID, version string) ([]*model.Attachment, error) {
+	var attachments []*model.Attachment
+	err := g.db.Joins("JOIN published_attachments ON published_attachments.attachment_id = attachments.id").
+		Where("published_attachments.document_id = ? AND published_attachments.version = ?", docID.String(), version).
+		Order("attachments.created_at, attachments.id").Find(&attachments).Error
+	return attachments, err
+}
+
+// EraseAttachments deletes the attachments of the document that no published version refers to, the published ones outlive the draft
+func (g *GormStore) EraseAttachments(ctx context.Context, docID uuid.UUID) ([]*model.Attachment, error) {
+	var attachments []*model.Attachment
+	err := g.db.Where("document_id = ? AND id NOT IN (?)", docID.String(), g.db.Model(&model.PublishedAttachment{}).Select("attachment_id")).
+		Find(&attachments).Error
+	if err != nil || len(attachments) == 0 {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(attachments))
+	for _, attachment := range attachments {
+		ids = append(ids, attachment.ID)
+	}
+	if err = g.db.Where("id IN (?)", ids).Delete(&model.Attachment{}).Error; err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// SaveDocumentSchema upserts the schema, the created time of a replaced schema is kept
+func (g *GormStore) SaveDocumentSchema(ctx context.Context, schema *model.DocumentSchema) error {
+	return g.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "project_id"}, {Name: "type"}},
+		DoUpdates: clause.AssignmentColumns([]string{"meta_schema", "content_schema", "updated_at"}),
+	}).Create(schema).Error
+}
+
+func (g *GormStore) GetDocumentSchema(ctx context.Context, projectID uuid.UUID, docType string) (*model.DocumentSchema, error) {
+	var schema model.DocumentSchema
+	err := g.db.Where("project_id = ? AND type = ?", projectID.String(), docType).First(&schema).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDocumentSchemaNotFound
+		}
+		return nil, err
+	}
+
+	return &schema, nil
+}
+
+func (g *GormStore) ListDocumentSchemas(ctx context.Context, projectID uuid.UUID) ([]*model.DocumentSchema, error) {
+	var schemas []*model.DocumentSchema
+	err := g.db.Where("project_id = ?", projectID.String()).Order("type").Find(&schemas).Error
+	return schemas, err
+}
+
+func (g *GormStore) DeleteDocumentSchema(ctx context.Context, projectID uuid.UUID, docType string) error {
+	res := g.db.Where("project_id = ? AND type = ?", projectID.String(), docType).Delete(&model.DocumentSchema{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrDocumentSchemaNotFound
+	}
+
+	return nil
+}
+
+// CreateIdempotencyKey inserts the key, a concurrent request with the same key does not insert it again
+func (g *GormStore) CreateIdempotencyKey(ctx context.Context, key *model.IdempotencyKey) (bool, error) {
+	res := g.db.Clauses(clause.OnConflict{DoNothing: true}).Create(key)
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	return res.RowsAffected == 1, nil
+}
+
+func (g *GormStore) GetIdempotencyKey(ctx context.Context, key string) (*model.IdempotencyKey, error) {
+	var record model.IdempotencyKey
+	err := g.db.Where("key = ?", key).First(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrIdempotencyKeyNotFound
+		}
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+func (g *GormStore) SaveIdempotencyResponse(ctx context.Context, key string, response []byte, expiresAt time.Time) error {
+	return g.db.Model(&model.IdempotencyKey{}).Where("key = ?", key).Updates(map[string]interface{}{
+		"response":   response,
+		"expires_at": expiresAt,
+	}).Error
+}
+
+func (g *GormStore) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	return g.db.Where("key = ?", key).Delete(&model.IdempotencyKey{}).Error
+}
+
+func (g *GormStore) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	res := g.db.Where("expires_at < ?", before).Delete(&model.IdempotencyKey{})
+	return res.RowsAffected, res.Error
+}
+
 func (g *GormStore) Migrate() error {
 	return model.Migrate(g.db)
 }
 
+// selectColumns limits the columns loaded by a query, all the columns are loaded without columns
+func (g *GormStore) selectColumns(columns []string) *gorm.DB {
+	if len(columns) == 0 {
+		return g.db
+	}
+
+	return g.db.Select(columns)
+}
+
 func (g *GormStore) Transaction(ctx context.Context, f func(tx Store) error) error {
 	return g.db.Transaction(func(tx *gorm.DB) error {
 		return f(&GormStore{db: tx})
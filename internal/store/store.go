@@ -24,6 +24,20 @@ var (
 	ErrPublishedDocumentVersionExists = errors.New("published document version already exists")
 	// ErrPublishedDocumentMetaExists is returned when a published document meta already exists.
 	ErrPublishedDocumentMetaExists = errors.New("published document meta already exists")
+	// ErrPublishScheduleNotFound is returned when a publish schedule is not found.
+	ErrPublishScheduleNotFound = errors.New("publish schedule not found")
+	// ErrReleaseNotFound is returned when a release is not found.
+	ErrReleaseNotFound = errors.New("release not found")
+	// ErrDocumentTreeIndexNotFound is returned when a document tree index is not found.
+	ErrDocumentTreeIndexNotFound = errors.New("document tree index not found")
+	// ErrDocumentPartNotFound is returned when a document part is not found.
+	ErrDocumentPartNotFound = errors.New("document part not found")
+	// ErrAttachmentNotFound is returned when an attachment is not found.
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	// ErrDocumentSchemaNotFound is returned when a document schema is not found.
+	ErrDocumentSchemaNotFound = errors.New("document schema not found")
+	// ErrIdempotencyKeyNotFound is returned when an idempotency key is not found.
+	ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
 )
 
 type Store interface {
@@ -31,6 +45,11 @@ type Store interface {
 	DocumentIndexStore
 	DocumentBackupStore
 	PublishedDocumentStore
+	PublishScheduleStore
+	ReleaseStore
+	AttachmentStore
+	DocumentSchemaStore
+	IdempotencyKeyStore
 	Transaction(ctx context.Context, f func(tx Store) error) error
 	Migrate() error
 }
@@ -41,6 +60,10 @@ type DocumentIndexStore interface {
 	SaveDocumentTreeIndex(ctx context.Context, index *model.DocumentIndex) error
 	// GetDocumentTreeIndex retrieves a document index by ID and version.
 	GetDocumentTreeIndex(ctx context.Context, docID uuid.UUID, version string) (*model.DocumentIndex, error)
+	// ListDocumentTreeIndexIDs retrieves the ids of the given documents that have a tree index.
+	ListDocumentTreeIndexIDs(ctx context.Context, docIDs []uuid.UUID) ([]string, error)
+	// EraseDocumentTreeIndexes erases the tree indexes of a document and returns the number of erased indexes.
+	EraseDocumentTreeIndexes(ctx context.Context, docID uuid.UUID) (int64, error)
 }
 
 type DocumentStore interface {
@@ -48,12 +71,14 @@ type DocumentStore interface {
 	ExistsDocuments(ctx context.Context, docs []*model.Document) (bool, error)
 	// CreateDocument creates a new document.
 	CreateDocument(ctx context.Context, doc *model.Document) error
-	// GetDocument retrieves a document by ID.
-	GetDocument(ctx context.Context, id uuid.UUID) (*model.Document, error)
-	// ListDocuments retrieves a list of documents by project ID.
-	ListDocuments(ctx context.Context, projectID uuid.UUID) ([]*model.Document, int64, error)
-	// ListDocumentsFromIDs retrieves a list of documents by IDs.
-	ListDocumentsFromIDs(ctx context.Context, ids []uuid.UUID) ([]*model.Document, error)
+	// GetDocument retrieves a document by ID, only the given columns are loaded when any are given.
+	GetDocument(ctx context.Context, id uuid.UUID, columns ...string) (*model.Document, error)
+	// GetDocumentIncludingDeleted retrieves a document by ID, soft deleted documents included.
+	GetDocumentIncludingDeleted(ctx context.Context, id uuid.UUID) (*model.Document, error)
+	// ListDocuments retrieves a list of documents by project ID, only the given columns are loaded when any are given.
+	ListDocuments(ctx context.Context, projectID uuid.UUID, columns ...string) ([]*model.Document, int64, error)
+	// ListDocumentsFromIDs retrieves a list of documents by IDs, only the given columns are loaded when any are given.
+	ListDocumentsFromIDs(ctx context.Context, ids []uuid.UUID, columns ...string) ([]*model.Document, error)
 	// UpdateDocument updates a document.
 	UpdateDocument(ctx context.Context, doc *model.Document) error
 	// DeleteDocument deletes a document by ID.
@@ -68,8 +93,60 @@ type DocumentStore interface {
 	DeleteBacklinks(ctx context.Context, links []*model.Link) error
 	//	ListBacklinks retrieves a list of backlinks by target ID.
 	ListBacklinks(ctx context.Context, targetID uuid.UUID) ([]*model.Link, error)
+	// ListPendingLinks retrieves the links not yet counted in the backlink count of their target.
+	ListPendingLinks(ctx context.Context, limit int) ([]*model.Link, error)
+	// ClearPendingLinks marks the links as counted.
+	ClearPendingLinks(ctx context.Context, links []*model.Link) error
+	// UpdateBacklinkCounts recounts the backlinks of the target documents.
+	UpdateBacklinkCounts(ctx context.Context, targetIDs []string) error
+	// UpdateStaleBacklinkCounts recounts the backlinks of the documents that lost backlinks and returns the number of updated documents.
+	UpdateStaleBacklinkCounts(ctx context.Context) (int64, error)
+	// ListLinks retrieves the outgoing links of a document.
+	ListLinks(ctx context.Context, sourceID uuid.UUID) ([]*model.Link, error)
+	// DeleteLinks deletes the outgoing links of a document and returns the number of deleted links.
+	DeleteLinks(ctx context.Context, sourceID uuid.UUID) (int64, error)
 	// ListDocumentProjectIDs retrieves a list of project IDs by document ID.
 	ListDocumentProjectIDs(ctx context.Context, docIDs []uuid.UUID) (map[uuid.UUID]uuid.UUID, error)
+	// ListDeletedDocuments retrieves the soft deleted documents of a project.
+	ListDeletedDocuments(ctx context.Context, projectID uuid.UUID) ([]*model.Document, error)
+	// ListDocumentsDeletedBefore retrieves the documents soft deleted before the given time.
+	ListDocumentsDeletedBefore(ctx context.Context, before time.Time) ([]*model.Document, error)
+	// UndeleteDocument restores a soft deleted document.
+	UndeleteDocument(ctx context.Context, id uuid.UUID) error
+	// ListDeletedDocumentIDs retrieves the ids of the given documents that are soft deleted.
+	ListDeletedDocumentIDs(ctx context.Context, ids []uuid.UUID) ([]string, error)
+	// UpdateDocumentChildren saves the children of the document if the stored version is still the given version.
+	UpdateDocumentChildren(ctx context.Context, doc *model.Document, version int64) (bool, error)
+	// UpdateDocumentVersion saves the version of the document if the stored version is still the given version.
+	UpdateDocumentVersion(ctx context.Context, doc *model.Document, version int64) (bool, error)
+	// MoveDocuments moves the documents with their published versions and releases to another project.
+	MoveDocuments(ctx context.Context, ids []uuid.UUID, projectID uuid.UUID) error
+	// ReplaceDocumentChildEdges replaces the child edges of the parent document.
+	ReplaceDocumentChildEdges(ctx context.Context, parentID uuid.UUID, edges []*model.DocumentChild) error
+	// DeleteDocumentChildEdges deletes the child edges of the parent document.
+	DeleteDocumentChildEdges(ctx context.Context, parentID uuid.UUID) error
+	// ListDocumentParentEdges retrieves the edges from the documents that are not deleted to the child document.
+	ListDocumentParentEdges(ctx context.Context, childID uuid.UUID) ([]*model.DocumentChild, error)
+	// ListDocumentParentEdgesFromIDs retrieves the edges from the documents that are not deleted to the child documents.
+	ListDocumentParentEdgesFromIDs(ctx context.Context, childIDs []uuid.UUID) ([]*model.DocumentChild, error)
+	// CountDocumentChildEdges counts the child edges of all the documents.
+	CountDocumentChildEdges(ctx context.Context) (int64, error)
+	// ListDocumentsAfter retrieves the documents ordered by ID after the given ID.
+	ListDocumentsAfter(ctx context.Context, afterID string, limit int) ([]*model.Document, error)
+	// GetDocumentPart retrieves a part of a document.
+	GetDocumentPart(ctx context.Context, docID uuid.UUID, partID string) (*model.DocumentPart, error)
+	// ListDocumentParts retrieves the parts of a document.
+	ListDocumentParts(ctx context.Context, docID uuid.UUID) ([]*model.DocumentPart, error)
+	// CreateDocumentPart creates a new part of a document.
+	CreateDocumentPart(ctx context.Context, part *model.DocumentPart) error
+	// UpdateDocumentPart saves the part if the stored version is still the given version.
+	UpdateDocumentPart(ctx context.Context, part *model.DocumentPart, version int64) (bool, error)
+	// DeleteDocumentPart deletes a part of a document.
+	DeleteDocumentPart(ctx context.Context, docID uuid.UUID, partID string) error
+	// DeleteDocumentParts deletes all the parts of a document.
+	DeleteDocumentParts(ctx context.Context, docID uuid.UUID) error
+	// UpdateDocumentPartIDs saves the order of the parts of a document without changing its version.
+	UpdateDocumentPartIDs(ctx context.Context, docID uuid.UUID, parts string) error
 }
 
 type DocumentBackupStore interface {
@@ -89,21 +166,23 @@ type DocumentBackupStore interface {
 	GetDocumentByUpdatedTime(start time.Time, end time.Time) ([]*model.DocumentBackup, error)
 	// DeleteDocumentBackups deletes document backups by document ID and versions.
 	DeleteDocumentBackups(ctx context.Context, backups map[string]goset.Set[int64]) error
+	// EraseDocumentBackups erases all the backups of a document and returns the number of erased backups.
+	EraseDocumentBackups(ctx context.Context, docID uuid.UUID) (int64, error)
 }
 
 type PublishedDocumentStore interface {
 	// ExistsPublishedDocuments checks if a published document exists by ID.
 	ExistsPublishedDocuments(ctx context.Context, docs []*model.PublishedDocument) (bool, error)
-	// GetPublishedDocumentByVersion retrieves a published document by ID.
-	GetPublishedDocumentByVersion(ctx context.Context, id uuid.UUID, version string) (*model.PublishedDocument, error)
-	// ListLatestPublishedDocuments retrieves a list of published documents by project ID.
-	ListLatestPublishedDocuments(ctx context.Context, projectID uuid.UUID) ([]*model.LatestPublishedDocumentMeta, error)
-	// ListPublishedDocumentsByIdVersion retrieves a list of published documents by id@version list.
-	ListPublishedDocumentsByIdVersion(ctx context.Context, projectID uuid.UUID, idVersions []*model.IDVersion) ([]*model.PublishedDocument, error)
+	// GetPublishedDocumentByVersion retrieves a published document by ID, only the given columns are loaded when any are given.
+	GetPublishedDocumentByVersion(ctx context.Context, id uuid.UUID, version string, columns ...string) (*model.PublishedDocument, error)
+	// ListLatestPublishedDocuments retrieves the latest published documents of a project, only the given columns are loaded when any are given.
+	ListLatestPublishedDocuments(ctx context.Context, projectID uuid.UUID, columns ...string) ([]*model.LatestPublishedDocument, error)
+	// ListPublishedDocumentsByIdVersion retrieves a list of published documents by id@version list, only the given columns are loaded when any are given.
+	ListPublishedDocumentsByIdVersion(ctx context.Context, projectID uuid.UUID, idVersions []*model.IDVersion, columns ...string) ([]*model.PublishedDocument, error)
 	// UnpublishDocument unpublishes a document.
 	UnpublishDocument(ctx context.Context, id uuid.UUID, version string) error
-	// GetLatestPublishedDocument retrieves the latest published document by ID.
-	GetLatestPublishedDocument(ctx context.Context, id uuid.UUID) (*model.LatestPublishedDocument, error)
+	// GetLatestPublishedDocument retrieves the latest published document by ID, only the given columns are loaded when any are given.
+	GetLatestPublishedDocument(ctx context.Context, id uuid.UUID, columns ...string) (*model.LatestPublishedDocument, error)
 	// ListPublishedDocumentVersions retrieves a list of published document versions by ID.
 	ListPublishedDocumentVersions(ctx context.Context, id uuid.UUID) ([]*model.PublishedDocumentMeta, error)
 	// GetLatestPublishedDocumentMeta retrieves the latest published document meta by ID.
@@ -114,6 +193,88 @@ type PublishedDocumentStore interface {
 	CreatePublishedLinks(ctx context.Context, links []*model.PublishedLink) error
 	// ListPublishedBacklinks retrieves a list of backlinks by source ID.
 	ListPublishedBacklinks(ctx context.Context, targetID uuid.UUID, targetVersion string) ([]*model.PublishedLink, error)
+	// ListPublishedLinks retrieves the outgoing links of a published document version.
+	ListPublishedLinks(ctx context.Context, sourceID uuid.UUID, sourceVersion string) ([]*model.PublishedLink, error)
 	// ListPublishedDocumentProjectIDs retrieves a list of project IDs by document ID.
 	ListPublishedDocumentProjectIDs(ctx context.Context, docs []*model.IDVersion) (map[uuid.UUID]uuid.UUID, error)
+	// ListPublishedDocumentIDVersions retrieves the published versions of the given documents.
+	ListPublishedDocumentIDVersions(ctx context.Context, ids []uuid.UUID) ([]*model.IDVersion, error)
+	// CreatePublishedChildEdges creates the child edges of a published document version.
+	CreatePublishedChildEdges(ctx context.Context, edges []*model.PublishedDocumentChild) error
+	// ListPublishedParentEdges retrieves the edges from the published document versions to the child document.
+	ListPublishedParentEdges(ctx context.Context, childID uuid.UUID) ([]*model.PublishedDocumentChild, error)
+}
+
+type PublishScheduleStore interface {
+	// CreatePublishSchedule creates a new publish schedule.
+	CreatePublishSchedule(ctx context.Context, schedule *model.PublishSchedule) error
+	// GetPublishSchedule retrieves a publish schedule with its audit records by ID.
+	GetPublishSchedule(ctx context.Context, id uuid.UUID) (*model.PublishSchedule, error)
+	// ListPublishSchedules retrieves a page of the publish schedules of a project, filtered by status if provided, along with their total.
+	ListPublishSchedules(ctx context.Context, projectID uuid.UUID, status string, offset, limit int) ([]*model.PublishSchedule, int64, error)
+	// ListDuePublishSchedules retrieves the pending publish schedules due before the given time.
+	ListDuePublishSchedules(ctx context.Context, before time.Time) ([]*model.PublishSchedule, error)
+	// UpdatePublishScheduleStatus moves a schedule from one status to another, it returns false if the schedule is not in the from status.
+	UpdatePublishScheduleStatus(ctx context.Context, id uuid.UUID, from, to string) (bool, error)
+	// ClaimPublishSchedule moves a pending schedule to running and records the claim time, it returns false if the schedule is not pending.
+	ClaimPublishSchedule(ctx context.Context, id uuid.UUID, claimedAt time.Time) (bool, error)
+	// FailStalePublishSchedules marks the schedules running since before the given time as failed with the reason.
+	FailStalePublishSchedules(ctx context.Context, claimedBefore time.Time, reason string) (int64, error)
+	// FinishPublishSchedule saves the outcome of a schedule run along with the published document versions.
+	// It returns false without saving if the schedule is no longer running under the claim of the run.
+	FinishPublishSchedule(ctx context.Context, schedule *model.PublishSchedule, audits []*model.PublishAudit) (bool, error)
+}
+
+type ReleaseStore interface {
+	// CreateRelease creates a new release along with its members.
+	CreateRelease(ctx context.Context, release *model.Release) error
+	// GetRelease retrieves a release with its members by root document ID and version.
+	GetRelease(ctx context.Context, rootID uuid.UUID, version string) (*model.Release, error)
+	// GetLatestRelease retrieves the most recent release of a root document.
+	GetLatestRelease(ctx context.Context, rootID uuid.UUID) (*model.Release, error)
+	// ListReleases retrieves the releases of a root document, newest first.
+	ListReleases(ctx context.Context, rootID uuid.UUID) ([]*model.Release, error)
+	// ListReleaseRootIDs retrieves the ids of the root documents released in a project.
+	ListReleaseRootIDs(ctx context.Context, projectID uuid.UUID) ([]string, error)
+}
+
+type AttachmentStore interface {
+	// CreateAttachment creates a new attachment.
+	CreateAttachment(ctx context.Context, attachment *model.Attachment) error
+	// GetAttachment retrieves an attachment of a document by ID.
+	GetAttachment(ctx context.Context, docID, id uuid.UUID) (*model.Attachment, error)
+	// ListAttachments retrieves the attachments of a document version.
+	ListAttachments(ctx context.Context, docID uuid.UUID, version int64) ([]*model.Attachment, error)
+	// RemoveAttachment removes an attachment from the document versions starting at the given version.
+	RemoveAttachment(ctx context.Context, id uuid.UUID, version int64) error
+	// CreatePublishedAttachments freezes the attachments into a published document version.
+	CreatePublishedAttachments(ctx context.Context, attachments []*model.PublishedAttachment) error
+	// ListPublishedAttachments retrieves the attachments of a published document version.
+	ListPublishedAttachments(ctx context.Context, docID uuid.UUID, version string) ([]*model.Attachment, error)
+	// EraseAttachments erases the attachments of a document that are not published and returns them.
+	EraseAttachments(ctx context.Context, docID uuid.UUID) ([]*model.Attachment, error)
+}
+
+type DocumentSchemaStore interface {
+	// SaveDocumentSchema creates or replaces the schema of a document type in a project.
+	SaveDocumentSchema(ctx context.Context, schema *model.DocumentSchema) error
+	// GetDocumentSchema retrieves the schema of a document type in a project.
+	GetDocumentSchema(ctx context.Context, projectID uuid.UUID, docType string) (*model.DocumentSchema, error)
+	// ListDocumentSchemas retrieves the schemas of a project.
+	ListDocumentSchemas(ctx context.Context, projectID uuid.UUID) ([]*model.DocumentSchema, error)
+	// DeleteDocumentSchema deletes the schema of a document type in a project.
+	DeleteDocumentSchema(ctx context.Context, projectID uuid.UUID, docType string) error
+}
+
+type IdempotencyKeyStore interface {
+	// CreateIdempotencyKey creates the key unless it exists, it returns whether the key was created.
+	CreateIdempotencyKey(ctx context.Context, key *model.IdempotencyKey) (bool, error)
+	// GetIdempotencyKey retrieves an idempotency key.
+	GetIdempotencyKey(ctx context.Context, key string) (*model.IdempotencyKey, error)
+	// SaveIdempotencyResponse saves the response of the request sent with the key and keeps the key until expiresAt.
+	SaveIdempotencyResponse(ctx context.Context, key string, response []byte, expiresAt time.Time) error
+	// DeleteIdempotencyKey deletes an idempotency key.
+	DeleteIdempotencyKey(ctx context.Context, key string) error
+	// DeleteExpiredIdempotencyKeys deletes the keys expired before the time and returns the number of deleted keys.
+	DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error)
 }